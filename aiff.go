@@ -0,0 +1,136 @@
+package sndtag
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// isAIFF reports whether header is the start of an AIFF or AIFF-C file.
+func isAIFF(header []byte) bool {
+	if len(header) < 12 || string(header[:4]) != "FORM" {
+		return false
+	}
+	form := string(header[8:12])
+	return form == "AIFF" || form == "AIFC"
+}
+
+// streamAIFF decodes the sound data chunk of an AIFF or AIFF-C file,
+// whose common chunk must come before it. AIFF-C files are decoded if
+// they are uncompressed, including the little-endian "sowt" samples and
+// 32 and 64-bit float samples.
+func streamAIFF(r io.Reader, h pcmHandler) error {
+	// Buffered, so that a missing pad byte can be put back, see skipPadByte.
+	r = bufio.NewReader(r)
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	var (
+		aifc  = string(header[8:12]) == "AIFC"
+		codec *sampleCodec
+		chunk = make([]byte, 8)
+	)
+	for {
+		if _, err := io.ReadFull(r, chunk); err == io.EOF {
+			return fmt.Errorf("AIFF file has no SSND chunk")
+		} else if err != nil {
+			return fmt.Errorf("truncated AIFF chunk header")
+		}
+		var (
+			id     = string(chunk[:4])
+			length = binary.BigEndian.Uint32(chunk[4:])
+			data   = io.LimitReader(r, int64(length))
+		)
+		switch id {
+		case "COMM":
+			b, err := ioutil.ReadAll(data)
+			if err != nil {
+				return err
+			}
+			if codec, err = readAIFFCodec(b, aifc); err != nil {
+				return err
+			}
+		case "SSND":
+			if codec == nil {
+				return fmt.Errorf("AIFF file has no COMM chunk before its SSND chunk")
+			}
+			// The samples start after the offset and block size
+			// fields, and as many bytes as the offset.
+			b := make([]byte, 8)
+			if _, err := io.ReadFull(data, b); err != nil {
+				return fmt.Errorf("truncated SSND chunk")
+			}
+			offset := int64(binary.BigEndian.Uint32(b))
+			if _, err := io.CopyN(ioutil.Discard, data, offset); err != nil {
+				return fmt.Errorf("truncated SSND chunk")
+			}
+			h.format(codec.pcmFormat)
+			return codec.stream(data, int64(length)-8-offset, h)
+		}
+		if _, err := io.Copy(ioutil.Discard, data); err != nil {
+			return err
+		}
+		if err := skipPadByte(r, length); err != nil {
+			return err
+		}
+	}
+}
+
+// readAIFFCodec reads how the samples of an AIFF file are stored from its
+// common chunk: the number of channels, the number of frames, the sample
+// size, the sample rate as an 80-bit float, and for AIFF-C files the
+// compression type.
+func readAIFFCodec(b []byte, aifc bool) (*sampleCodec, error) {
+	size := 18
+	if aifc {
+		size = 22
+	}
+	if len(b) < size {
+		return nil, fmt.Errorf("expected COMM chunk of at least %d bytes, got %d", size, len(b))
+	}
+	var (
+		channels = int(binary.BigEndian.Uint16(b))
+		bits     = int(binary.BigEndian.Uint16(b[6:8]))
+		codec    = &sampleCodec{width: (bits + 7) / 8, bigEndian: true}
+	)
+	if aifc {
+		switch compression := string(b[18:22]); compression {
+		case "NONE", "twos":
+		case "sowt":
+			// 8-bit samples are signed either way.
+			codec.bigEndian = codec.width == 1
+		case "fl32", "FL32":
+			codec.width, codec.float = 4, true
+		case "fl64", "FL64":
+			codec.width, codec.float = 8, true
+		default:
+			return nil, fmt.Errorf("unsupported AIFF-C compression %q", compression)
+		}
+	}
+	if channels == 0 || codec.width == 0 || codec.width > 8 {
+		return nil, fmt.Errorf("invalid AIFF format: %d channels of %d bits", channels, bits)
+	}
+	codec.rate, codec.channels = int(extendedFloat(b[8:18])), channels
+	if !codec.float {
+		codec.bits = bits
+	}
+	return codec, nil
+}
+
+// extendedFloat decodes an 80-bit IEEE 754 extended precision number.
+func extendedFloat(b []byte) float64 {
+	var (
+		exp      = int(binary.BigEndian.Uint16(b)&0x7fff) - 16383
+		mantissa = binary.BigEndian.Uint64(b[2:10])
+		v        = math.Ldexp(float64(mantissa), exp-63)
+	)
+	if b[0]&0x80 != 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,219 @@
+package sndtag
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An Album is a group of Walk results that belong to the same disc of an album.
+type Album struct {
+	// Artist is the album artist, the artist of all the tracks if they
+	// have no album artist, or "Various Artists".
+	Artist string
+	Title  string
+	Disc   int
+
+	// Tracks are sorted by track number. Tracks without a track number
+	// come last.
+	Tracks []Result
+
+	// Years and Genres are the distinct values of the tracks, sorted.
+	Years  []string
+	Genres []string
+
+	// Issues describes the inconsistencies between the tracks,
+	// e.g. missing track numbers or differing artwork.
+	Issues []string
+}
+
+// GroupAlbums groups Walk results into albums, by album artist, album and
+// disc number. Tracks that have no album artist are grouped with the tracks
+// of the same album in the same directory, so that compilations stay together.
+// Results without an album and results with an error are left out.
+// Albums are sorted by artist, title and disc.
+func GroupAlbums(results []Result) []Album {
+	var (
+		groups = map[string][]Result{}
+		keys   []string
+	)
+	for _, result := range results {
+		if result.Err != nil || result.Metadata[KeyAlbum] == "" {
+			continue
+		}
+		k := albumKey(result)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], result)
+	}
+
+	albums := make([]Album, 0, len(keys))
+	for _, k := range keys {
+		albums = append(albums, newAlbum(groups[k]))
+	}
+	sort.SliceStable(albums, func(i, j int) bool {
+		a, b := albums[i], albums[j]
+		if a.Artist != b.Artist {
+			return a.Artist < b.Artist
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.Disc < b.Disc
+	})
+	return albums
+}
+
+// albumKey returns the key that the tracks of an album have in common.
+func albumKey(result Result) string {
+	var (
+		m     = result.Metadata
+		disc  = strconv.Itoa(leadingNumber(m[KeyDisc]))
+		album = normalizeTag(m[KeyAlbum])
+	)
+	if artist := m[KeyAlbumArtist]; artist != "" {
+		return normalizeTag(artist) + "|" + album + "|" + disc
+	}
+	dir := result.Object.Archive
+	if dir == "" {
+		dir = path.Dir(strings.Replace(result.Object.Key, "\\", "/", -1))
+	}
+	return "|" + album + "|" + disc + "|" + dir
+}
+
+// newAlbum summarizes the tracks of an album.
+func newAlbum(tracks []Result) Album {
+	first := tracks[0].Metadata
+
+	a := Album{
+		Artist: albumArtist(tracks),
+		Title:  first[KeyAlbum],
+		Disc:   leadingNumber(first[KeyDisc]),
+		Tracks: tracks,
+		Years:  distinct(tracks, KeyYear),
+		Genres: distinct(tracks, KeyGenre),
+	}
+	sort.SliceStable(a.Tracks, func(i, j int) bool {
+		ti, tj := leadingNumber(a.Tracks[i].Metadata[KeyTrack]), leadingNumber(a.Tracks[j].Metadata[KeyTrack])
+		if ti == 0 || tj == 0 {
+			return tj == 0 && ti != 0
+		}
+		return ti < tj
+	})
+	if len(a.Years) > 1 {
+		a.Issues = append(a.Issues, "mixed years: "+strings.Join(a.Years, ", "))
+	}
+	a.Issues = append(a.Issues, trackNumberIssues(a.Tracks)...)
+
+	if artworks := distinctArtwork(tracks); len(artworks) > 1 {
+		a.Issues = append(a.Issues, "differing artwork")
+	}
+	return a
+}
+
+// albumArtist returns the album artist of the tracks of an album,
+// the artist if all the tracks have the same one, or "Various Artists".
+func albumArtist(tracks []Result) string {
+	if artist := tracks[0].Metadata[KeyAlbumArtist]; artist != "" {
+		return artist
+	}
+	artists := distinct(tracks, KeyArtist)
+	if len(artists) == 1 {
+		return artists[0]
+	}
+	return "Various Artists"
+}
+
+// trackNumberIssues describes tracks without a track number,
+// track numbers that appear more than once and gaps in the track numbers.
+func trackNumberIssues(tracks []Result) []string {
+	var (
+		issues  []string
+		missing int
+		seen    = map[int]int{}
+		max     int
+	)
+	for _, track := range tracks {
+		n := leadingNumber(track.Metadata[KeyTrack])
+		if n == 0 {
+			missing++
+			continue
+		}
+		seen[n]++
+		if n > max {
+			max = n
+		}
+	}
+	if missing > 0 {
+		issues = append(issues, fmt.Sprintf("tracks without a track number: %d", missing))
+	}
+	var duplicate, gaps []string
+	for n := 1; n <= max; n++ {
+		switch {
+		case seen[n] == 0:
+			gaps = append(gaps, strconv.Itoa(n))
+		case seen[n] > 1:
+			duplicate = append(duplicate, strconv.Itoa(n))
+		}
+	}
+	if len(gaps) > 0 {
+		issues = append(issues, "missing track numbers: "+strings.Join(gaps, ", "))
+	}
+	if len(duplicate) > 0 {
+		issues = append(issues, "duplicate track numbers: "+strings.Join(duplicate, ", "))
+	}
+	return issues
+}
+
+// distinct returns the distinct non-empty values of a property, sorted.
+func distinct(tracks []Result, key string) []string {
+	var (
+		values []string
+		seen   = map[string]bool{}
+	)
+	for _, track := range tracks {
+		v := track.Metadata[key]
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// distinctArtwork returns the distinct pictures of the tracks, identified
+// by the type, size and dimensions of the first picture. Tracks without
+// a picture count as a picture of their own.
+func distinctArtwork(tracks []Result) map[string]bool {
+	artworks := map[string]bool{}
+
+	for _, track := range tracks {
+		m := track.Metadata
+		artworks[strings.Join([]string{
+			m[KeyArtworkMIMEType(1)],
+			m[KeyArtworkSize(1)],
+			m[KeyArtworkWidth(1)],
+			m[KeyArtworkHeight(1)],
+		}, "|")] = true
+	}
+	return artworks
+}
+
+// leadingNumber returns the number at the start of a track or disc
+// number like "3" or "3/12", or 0 if there isn't one.
+func leadingNumber(s string) int {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,35 @@
+package sndtag
+
+// WithAlbumArtistFallback sets "AlbumArtist" to "Artist" for files that
+// don't have an album artist, which is what most players show. Without it
+// the album artist is only set from the tags that store it: ID3v2 TPE2
+// frames, MP4 aART atoms and ALBUMARTIST items and TXXX frames.
+//
+// TPE2 is the "band/orchestra/accompaniment" in the ID3v2 specification,
+// but every major player reads and writes it as the album artist, so
+// sndtag does too. The fallback is off by default since it hides which
+// files are missing the album artist, which compilations need to group
+// their tracks into one album.
+func WithAlbumArtistFallback() Option {
+	return func(o *options) {
+		o.artistFallback = true
+	}
+}
+
+// fallBackToArtist sets the album artist to the artist if it is missing
+// and WithAlbumArtistFallback was used. The source of the artist is
+// recorded as the source of the album artist.
+func (o options) fallBackToArtist(metadata map[string]string) map[string]string {
+	if !o.artistFallback || metadata[KeyAlbumArtist] != "" {
+		return metadata
+	}
+	artist, ok := metadata[KeyArtist]
+	if !ok {
+		return metadata
+	}
+	metadata[KeyAlbumArtist] = artist
+	if s, ok := o.sources[KeyArtist]; ok {
+		o.setSource(KeyAlbumArtist, s)
+	}
+	return metadata
+}
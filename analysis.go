@@ -0,0 +1,104 @@
+package sndtag
+
+import (
+	"io"
+	"math"
+	"strconv"
+)
+
+// defaultSilenceThreshold is the level below which audio is silent,
+// in dBFS, see WithSilenceThreshold.
+const defaultSilenceThreshold = -60
+
+// WithSilenceThreshold sets the level below which Analyze considers audio
+// silent, in dBFS, e.g. -48. The default is -60.
+func WithSilenceThreshold(dBFS float64) Option {
+	return func(o *options) {
+		o.silence = dBFS
+	}
+}
+
+// Analyze reads the audio of a file once and returns the properties that
+// describe it, for quality control on ingest: KeyLeadingSilence and
+// KeyTrailingSilence, the time before the first and after the last frame
+// that isn't silent, see WithSilenceThreshold, and KeyClippedSamples.
+// Integer samples are clipped if they have the largest or the smallest
+// value of their precision, and float samples if they are 1 or more or
+// -1 or less. Analyze decodes the same files as PreviewPCM. The context
+// set with WithContext stops it.
+func Analyze(r io.Reader, opts ...Option) (map[string]string, error) {
+	o := newOptions(opts)
+
+	threshold := o.silence
+	if threshold == 0 {
+		threshold = defaultSilenceThreshold
+	}
+	a := &analyzer{threshold: float32(math.Pow(10, threshold/20))}
+	if err := o.streamAudio(r, a); err != nil {
+		return nil, err
+	}
+	return a.metadata(), nil
+}
+
+// analyzer finds the silence and the clipped samples of audio.
+type analyzer struct {
+	pcmFormat
+	threshold float32
+
+	// clipMax and clipMin are the levels at which samples are clipped.
+	clipMax, clipMin float32
+
+	// frames is the number of frames read. If sound is true, first is the
+	// first frame that isn't silent and last is the one after the last.
+	frames      int64
+	first, last int64
+	sound       bool
+	clipped     int64
+}
+
+func (a *analyzer) format(f pcmFormat) {
+	a.pcmFormat = f
+	a.clipMax, a.clipMin = 1, -1
+	if f.bits > 0 {
+		// The largest value is one step below full scale.
+		a.clipMax = float32(1 - math.Ldexp(1, 1-f.bits))
+	}
+}
+
+func (a *analyzer) samples(s []float32) bool {
+	for ; len(s) >= a.channels && a.channels > 0; s = s[a.channels:] {
+		silent := true
+		for _, v := range s[:a.channels] {
+			if v >= a.clipMax || v <= a.clipMin {
+				a.clipped++
+			}
+			if v >= a.threshold || v <= -a.threshold {
+				silent = false
+			}
+		}
+		if !silent {
+			if !a.sound {
+				a.first, a.sound = a.frames, true
+			}
+			a.last = a.frames + 1
+		}
+		a.frames++
+	}
+	return true
+}
+
+// metadata returns the properties of the audio that was read.
+func (a *analyzer) metadata() map[string]string {
+	leading, trailing := a.frames, a.frames
+	if a.sound {
+		leading, trailing = a.first, a.frames-a.last
+	}
+	metadata := map[string]string{
+		KeyClippedSamples: strconv.FormatInt(a.clipped, 10),
+	}
+	if a.rate > 0 {
+		metadata[KeyLeadingSilence] = strconv.FormatFloat(float64(leading)/float64(a.rate), 'f', 3, 64)
+		metadata[KeyTrailingSilence] = strconv.FormatFloat(float64(trailing)/float64(a.rate), 'f', 3, 64)
+	}
+	return metadata
+}
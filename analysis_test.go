@@ -0,0 +1,93 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// testFloatWav encodes a mono WAV file at 44.1 kHz with 32-bit float samples.
+func testFloatWav(samples ...float32) []byte {
+	format := []byte{3, 0, 1, 0}
+	format = binary.LittleEndian.AppendUint32(format, 44100)
+	format = binary.LittleEndian.AppendUint32(format, 176400)
+	format = append(format, 4, 0, 32, 0)
+
+	var data []byte
+	for _, s := range samples {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(s))
+	}
+	body := []byte("WAVE")
+	body = append(body, testChunk("fmt ", format)...)
+	body = append(body, testChunk("data", data)...)
+	return testChunk("RIFF", body)
+}
+
+func TestAnalyze(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file []byte
+		opts []Option
+		want map[string]string
+	}{
+		{
+			name: "WAV",
+			file: testAudio(t, "tone.wav"),
+			want: map[string]string{KeyLeadingSilence: "0.010", KeyTrailingSilence: "0.010", KeyClippedSamples: "6"},
+		},
+		{
+			name: "FLAC",
+			file: testAudio(t, "tone.flac"),
+			want: map[string]string{KeyLeadingSilence: "0.010", KeyTrailingSilence: "0.010", KeyClippedSamples: "6"},
+		},
+		{
+			name: "AIFF",
+			file: testAudio(t, "tone.aiff"),
+			want: map[string]string{KeyLeadingSilence: "0.010", KeyTrailingSilence: "0.010", KeyClippedSamples: "6"},
+		},
+		{
+			// Only the clipped frames 2000 to 2002 are above half scale.
+			name: "threshold",
+			file: testAudio(t, "tone.flac"),
+			opts: []Option{WithSilenceThreshold(-6)},
+			want: map[string]string{KeyLeadingSilence: "0.045", KeyTrailingSilence: "0.055", KeyClippedSamples: "6"},
+		},
+		{
+			name: "silence",
+			file: testWav(),
+			want: map[string]string{KeyLeadingSilence: "0.002", KeyTrailingSilence: "0.002", KeyClippedSamples: "0"},
+		},
+		{
+			name: "float samples",
+			file: testFloatWav(0, 0.5, 1, -1.5, 0.99, 0, 0),
+			want: map[string]string{KeyLeadingSilence: "0.000", KeyTrailingSilence: "0.000", KeyClippedSamples: "2"},
+		},
+		{
+			name: "16-bit samples at full scale",
+			file: testAIFF(1, 0, 32767, -32768, 32766, -32767),
+			want: map[string]string{KeyLeadingSilence: "0.000", KeyTrailingSilence: "0.000", KeyClippedSamples: "2"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Analyze(bytes.NewReader(tc.file), tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+			for key, want := range tc.want {
+				if got[key] != want {
+					t.Errorf("%s: got %q, want %q", key, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeUnrecognized(t *testing.T) {
+	if _, err := Analyze(bytes.NewReader(testMP3(nil))); err == nil {
+		t.Error("got no error")
+	}
+}
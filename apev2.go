@@ -0,0 +1,192 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// apeFooterSize is the size of the footer at the end of an APEv2 tag,
+	// which is also the size of its optional header.
+	apeFooterSize = 32
+
+	// apeMaxSize is the largest APEv2 tag that is read.
+	apeMaxSize = 16 << 20
+
+	// id3v1Size is the size of an ID3v1 tag, which can follow an APEv2 tag.
+	id3v1Size = 128
+)
+
+// apeItems maps the keys of APEv2 items to property names.
+// Keys are case-insensitive.
+var apeItems = map[string]string{
+	"album":                 KeyAlbum,
+	"album artist":          KeyAlbumArtist,
+	"albumartist":           KeyAlbumArtist,
+	"artist":                KeyArtist,
+	"barcode":               KeyBarcode,
+	"catalognumber":         KeyCatalogNumber,
+	"comment":               KeyComment,
+	"genre":                 KeyGenre,
+	"label":                 KeyLabel,
+	"media":                 KeyMedia,
+	"originaldate":          KeyOriginalReleaseDate,
+	"originalyear":          KeyOriginalReleaseDate,
+	"releasecountry":        KeyReleaseCountry,
+	"releasedate":           KeyReleaseDate,
+	"replaygain_album_gain": KeyReplayGainAlbumGain,
+	"replaygain_album_peak": KeyReplayGainAlbumPeak,
+	"replaygain_track_gain": KeyReplayGainTrackGain,
+	"replaygain_track_peak": KeyReplayGainTrackPeak,
+	"title":                 KeyTitle,
+	"track":                 KeyTrack,
+	"year":                  KeyYear,
+}
+
+// readAPEv2 reads the APEv2 tag at the end of a file, if it has one,
+// and stores the items we recognize in metadata. Properties that are
+// already set are kept, unless WithDuplicateKeys says otherwise.
+func readAPEv2(rs io.ReadSeeker, metadata map[string]string, o options) error {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	// Read the footer and the ID3v1 tag that may follow it.
+	tailSize := int64(apeFooterSize + id3v1Size)
+	if tailSize > size {
+		tailSize = size
+	}
+	tail := make([]byte, tailSize)
+
+	if _, err := rs.Seek(size-tailSize, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rs, tail); err != nil {
+		return err
+	}
+	footer, end := findAPEv2Footer(tail)
+	if footer == nil {
+		return nil
+	}
+	length, count, err := apeTagSize(footer)
+	if err != nil {
+		return err
+	}
+
+	// The items come before the footer.
+	end += size - tailSize - apeFooterSize
+	if length > end {
+		return fmt.Errorf("APEv2 tag is larger than the file")
+	}
+	items := make([]byte, length)
+
+	if _, err := rs.Seek(end-length, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rs, items); err != nil {
+		return err
+	}
+	return decodeAPEv2Items(items, end-length, count, metadata, o)
+}
+
+// parseAPEv2 reads the APEv2 tag at the end of a file that is entirely
+// in memory. See readAPEv2.
+func parseAPEv2(b []byte, metadata map[string]string, o options) error {
+	footer, end := findAPEv2Footer(b)
+	if footer == nil {
+		return nil
+	}
+	length, count, err := apeTagSize(footer)
+	if err != nil {
+		return err
+	}
+	end -= apeFooterSize
+	if length > end {
+		return fmt.Errorf("APEv2 tag is larger than the file")
+	}
+	return decodeAPEv2Items(b[end-length:end], end-length, count, metadata, o)
+}
+
+// findAPEv2Footer finds the footer of an APEv2 tag at the end of b,
+// or before an ID3v1 tag at the end of b. It also returns the offset
+// of the end of the footer.
+func findAPEv2Footer(b []byte) ([]byte, int64) {
+	end := len(b)
+	if end >= id3v1Size && string(b[end-id3v1Size:end-id3v1Size+3]) == "TAG" {
+		end -= id3v1Size
+	}
+	if end < apeFooterSize || string(b[end-apeFooterSize:end-apeFooterSize+8]) != "APETAGEX" {
+		return nil, 0
+	}
+	return b[end-apeFooterSize : end], int64(end)
+}
+
+// apeTagSize returns the size of the items of an APEv2 tag
+// and the number of items from its footer.
+func apeTagSize(footer []byte) (int64, int, error) {
+	var (
+		version = binary.LittleEndian.Uint32(footer[8:12])
+		size    = int64(binary.LittleEndian.Uint32(footer[12:16]))
+		count   = binary.LittleEndian.Uint32(footer[16:20])
+	)
+	if version != 1000 && version != 2000 {
+		return 0, 0, fmt.Errorf("unsupported APE tag version %d", version)
+	}
+	// The size includes the footer but not the header.
+	if size < apeFooterSize || size > apeMaxSize {
+		return 0, 0, fmt.Errorf("invalid APEv2 tag size %d", size)
+	}
+	return size - apeFooterSize, int(count), nil
+}
+
+// decodeAPEv2Items decodes the items of an APEv2 tag. Each item is
+// the size of its value, flags, a NUL-terminated key and the value.
+// Text values are UTF-8, and multiple values are separated by NUL bytes.
+// Binary items are skipped. base is the offset of the items in the file.
+func decodeAPEv2Items(b []byte, base int64, count int, metadata map[string]string, o options) error {
+	start := b
+
+	for i := 0; i < count; i++ {
+		if len(b) < 9 {
+			return fmt.Errorf("truncated APEv2 item %d", i+1)
+		}
+		var (
+			offset = base + sliceOffset(start, b)
+			size   = int64(binary.LittleEndian.Uint32(b[0:4]))
+			flags  = binary.LittleEndian.Uint32(b[4:8])
+			key    = b[8:]
+		)
+		end := bytes.IndexByte(key, 0)
+		if end < 0 {
+			return fmt.Errorf("unterminated APEv2 item key")
+		}
+		value := key[end+1:]
+		key = key[:end]
+
+		if size > int64(len(value)) {
+			return fmt.Errorf("truncated APEv2 item %s", key)
+		}
+		b = value[size:]
+		value = value[:size]
+		o.countFrame()
+
+		// Bits 1 and 2 are the type of the value, 0 being text.
+		if flags>>1&3 != 0 {
+			continue
+		}
+		prop, ok := apeItems[strings.ToLower(string(key))]
+		if !ok {
+			continue
+		}
+		text := strings.Replace(string(value), "\x00", "/", -1)
+		if old, ok := metadata[prop]; !ok || o.replaces(prop, old, text) {
+			metadata[prop] = text
+			o.setSource(prop, Source{Tag: TagAPEv2, ID: string(key), Offset: offset})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package sndtag
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isArchive reports whether a file is an archive that Walk descends into.
+func isArchive(key string) bool {
+	return archiveType(key) != ""
+}
+
+// archiveType returns the type of archive from the extension of a file name,
+// or an empty string if it isn't an archive.
+func archiveType(key string) string {
+	key = strings.ToLower(key)
+
+	switch {
+	case strings.HasSuffix(key, ".zip"):
+		return "zip"
+	case strings.HasSuffix(key, ".tar"):
+		return "tar"
+	case strings.HasSuffix(key, ".tar.gz"), strings.HasSuffix(key, ".tgz"):
+		return "tgz"
+	}
+	return ""
+}
+
+// openArchive returns an fs.FS with the files in an archive.
+// Archives are read in place if rc is an io.ReaderAt, e.g. an *os.File,
+// otherwise they are read into memory, as are compressed tar files.
+func openArchive(rc io.Reader, obj Object) (fs.FS, error) {
+	var (
+		ra   io.ReaderAt
+		size = obj.Size
+	)
+	if r, ok := rc.(io.ReaderAt); ok {
+		ra = r
+	} else {
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		ra, size = bytes.NewReader(b), int64(len(b))
+	}
+
+	switch archiveType(obj.Key) {
+	case "zip":
+		return zip.NewReader(ra, size)
+	case "tgz":
+		zr, err := gzip.NewReader(io.NewSectionReader(ra, 0, size))
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+		ra, size = bytes.NewReader(b), int64(len(b))
+	}
+	return TarFS(ra, size)
+}
+
+// walkArchive reads the metadata of every file in an archive in a store
+// and sends the results. The keys of the results are the paths in the archive.
+func walkArchive(ctx context.Context, store Store, obj Object, opts []Option, send func(Result) error) error {
+	rc, err := store.Open(ctx, obj)
+	if err != nil {
+		return send(Result{Object: obj, Err: err})
+	}
+	defer rc.Close()
+
+	fsys, err := openArchive(rc, obj)
+	if err != nil {
+		return send(Result{Object: obj, Err: err})
+	}
+	archive := FSStore(fsys)
+	if newOptions(opts).editLists {
+		opts = append(opts[:len(opts):len(opts)], withEditIndex(newEditIndex(archive)))
+	}
+
+	return archive.List(ctx, func(entry Object) error {
+		result := readObject(ctx, archive, entry, opts)
+		result.Object.Archive = obj.Key
+		return send(result)
+	})
+}
+
+// FSStore returns a Store with the regular files in fsys, e.g. a zip
+// archive opened with zip.NewReader or a tar archive opened with TarFS.
+// The keys are the paths of the files in fsys.
+func FSStore(fsys fs.FS) Store {
+	return fsStore{fsys}
+}
+
+// fsStore is a Store with the files in an fs.FS.
+type fsStore struct {
+	fsys fs.FS
+}
+
+// List calls fn for every regular file in the file system.
+func (s fsStore) List(ctx context.Context, fn func(Object) error) error {
+	return fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(Object{Key: name, Size: info.Size()})
+	})
+}
+
+// Open opens a file.
+func (s fsStore) Open(ctx context.Context, obj Object) (io.ReadCloser, error) {
+	return s.fsys.Open(obj.Key)
+}
+
+// tarFS is an fs.FS with the regular files in a tar archive.
+type tarFS struct {
+	ra    io.ReaderAt
+	files map[string]tarEntry
+	dirs  map[string][]fs.DirEntry
+}
+
+// tarEntry is a regular file in a tar archive.
+type tarEntry struct {
+	info   fs.FileInfo
+	offset int64
+}
+
+// TarFS returns an fs.FS with the regular files in a tar archive.
+// The archive is indexed up front, and the files are read in place,
+// so they can be seeked.
+func TarFS(ra io.ReaderAt, size int64) (fs.FS, error) {
+	t := &tarFS{
+		ra:    ra,
+		files: map[string]tarEntry{},
+		dirs:  map[string][]fs.DirEntry{".": nil},
+	}
+	r := &countingReader{r: io.NewSectionReader(ra, 0, size)}
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if hdr.Typeflag != tar.TypeReg || !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		if _, ok := t.files[name]; ok {
+			continue
+		}
+		// The data of the file follows its header.
+		t.files[name] = tarEntry{info: hdr.FileInfo(), offset: r.n}
+		t.addEntry(name, fs.FileInfoToDirEntry(hdr.FileInfo()))
+	}
+}
+
+// addEntry adds a file or directory to the listing of its parent
+// directory, adding the parent directories that are missing.
+func (t *tarFS) addEntry(name string, entry fs.DirEntry) {
+	dir := path.Dir(name)
+	if _, ok := t.dirs[dir]; !ok {
+		t.dirs[dir] = nil
+		t.addEntry(dir, fs.FileInfoToDirEntry(tarDirInfo(path.Base(dir))))
+	}
+	t.dirs[dir] = append(t.dirs[dir], entry)
+}
+
+// Open opens a file or directory.
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if entry, ok := t.files[name]; ok {
+		return &tarFile{
+			SectionReader: io.NewSectionReader(t.ra, entry.offset, entry.info.Size()),
+			info:          entry.info,
+		}, nil
+	}
+	if _, ok := t.dirs[name]; ok {
+		return &tarDir{info: tarDirInfo(path.Base(name))}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir returns the entries of a directory.
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, ok := t.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sorted := append([]fs.DirEntry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name() < sorted[j].Name()
+	})
+	return sorted, nil
+}
+
+// tarFile is an open regular file in a tar archive.
+type tarFile struct {
+	*io.SectionReader
+	info fs.FileInfo
+}
+
+// Stat returns information about the file.
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Close does nothing.
+func (f *tarFile) Close() error { return nil }
+
+// tarDir is an open directory in a tar archive.
+// Its entries are listed by tarFS.ReadDir.
+type tarDir struct {
+	info fs.FileInfo
+}
+
+// Stat returns information about the directory.
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+// Read fails, since directories can't be read.
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+// Close does nothing.
+func (d *tarDir) Close() error { return nil }
+
+// tarDirInfo is the fs.FileInfo of a directory in a tar archive,
+// which doesn't need to have an entry of its own.
+type tarDirInfo string
+
+func (d tarDirInfo) Name() string       { return string(d) }
+func (d tarDirInfo) Size() int64        { return 0 }
+func (d tarDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (d tarDirInfo) ModTime() time.Time { return time.Time{} }
+func (d tarDirInfo) IsDir() bool        { return true }
+func (d tarDirInfo) Sys() interface{}   { return nil }
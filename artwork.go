@@ -0,0 +1,138 @@
+package sndtag
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"  // Register GIF for image.DecodeConfig.
+	_ "image/jpeg" // Register JPEG for image.DecodeConfig.
+	_ "image/png"  // Register PNG for image.DecodeConfig.
+	"io"
+	"strconv"
+	"strings"
+)
+
+// artworkSniffSize is the number of bytes of an image that are read
+// to find its type and dimensions. JPEG files can have large EXIF
+// and ICC segments before the frame header, so it is generous.
+const artworkSniffSize = 64 * 1024
+
+// pictureTypeFrontCover is the ID3v2 picture type of the front cover.
+const pictureTypeFrontCover = 3
+
+// artwork describes an embedded picture.
+type artwork struct {
+	MIMEType    string
+	PictureType int
+	Description string
+	Size        int64
+	Width       int
+	Height      int
+}
+
+// sniff fills in the MIME type and dimensions of the artwork from
+// the start of the image data. Only the image header is decoded.
+// The declared MIME type is kept if the image type isn't recognized.
+func (a *artwork) sniff(head []byte) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return
+	}
+	a.MIMEType = "image/" + format
+	a.Width, a.Height = config.Width, config.Height
+}
+
+// decodePicture decodes the data of an APIC frame.
+// It also returns the image data.
+func decodePicture(data []byte, cs charsets) (artwork, []byte) {
+	if len(data) < 2 {
+		return artwork{}, nil
+	}
+	enc := data[0]
+	mime, rest := splitTerminated(0, data[1:])
+	if len(rest) == 0 {
+		return artwork{MIMEType: decodeLatin1(mime)}, nil
+	}
+	pictureType := rest[0]
+	desc, img := splitTerminated(enc, rest[1:])
+
+	a := artwork{
+		MIMEType:    strings.ToLower(decodeLatin1(mime)),
+		PictureType: int(pictureType),
+		Description: decodeText(enc, desc, cs),
+		Size:        int64(len(img)),
+	}
+	// Some taggers write "jpg" instead of a MIME type.
+	if a.MIMEType != "" && !strings.Contains(a.MIMEType, "/") {
+		a.MIMEType = "image/" + a.MIMEType
+	}
+	if len(img) > artworkSniffSize {
+		a.sniff(img[:artworkSniffSize])
+	} else {
+		a.sniff(img)
+	}
+	return a, img
+}
+
+// pickArtwork returns the index of the front cover,
+// or the first picture if there is no front cover.
+func pickArtwork(artworks []artwork) int {
+	for i, a := range artworks {
+		if a.PictureType == pictureTypeFrontCover {
+			return i
+		}
+	}
+	return 0
+}
+
+// setArtworks stores the description of each picture as properties.
+// Each picture is stored as "Artwork<n>MIMEType", "Artwork<n>Width",
+// "Artwork<n>Height", "Artwork<n>Size", "Artwork<n>PictureType" and
+// "Artwork<n>Description", counting from 1, and the number of pictures
+// is stored as "Artworks". The dimensions are only set if the image
+// type is recognized.
+func setArtworks(metadata map[string]string, artworks []artwork) {
+	if len(artworks) == 0 {
+		return
+	}
+	metadata[KeyArtworks] = strconv.Itoa(len(artworks))
+
+	for i, a := range artworks {
+		n := i + 1
+		metadata[KeyArtworkMIMEType(n)] = a.MIMEType
+		metadata[KeyArtworkSize(n)] = strconv.FormatInt(a.Size, 10)
+		metadata[KeyArtworkPictureType(n)] = strconv.Itoa(a.PictureType)
+		metadata[KeyArtworkDescription(n)] = a.Description
+
+		if a.Width > 0 && a.Height > 0 {
+			metadata[KeyArtworkWidth(n)] = strconv.Itoa(a.Width)
+			metadata[KeyArtworkHeight(n)] = strconv.Itoa(a.Height)
+		}
+	}
+}
+
+// readArtwork reads an image from an io.Reader without holding more than
+// the start of it in memory. The image is copied to w if it isn't nil.
+func readArtwork(r io.Reader, w io.Writer) (artwork, error) {
+	head := make([]byte, artworkSniffSize)
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return artwork{}, err
+	}
+	head = head[:n]
+
+	var a artwork
+	a.sniff(head)
+
+	if w == nil {
+		w = io.Discard
+	} else if _, err := w.Write(head); err != nil {
+		return artwork{}, err
+	}
+	rest, err := io.Copy(w, r)
+	if err != nil {
+		return artwork{}, err
+	}
+	a.Size = int64(n) + rest
+	return a, nil
+}
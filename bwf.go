@@ -0,0 +1,216 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// bwfTimecode holds what is needed to format the start timecode of a
+// Broadcast Wave file, which can come from the bext and iXML chunks.
+type bwfTimecode struct {
+	// sampleRate is the rate of the time reference if it differs
+	// from the sample rate of the file, e.g. after a pull-down.
+	sampleRate int64
+}
+
+// readBext reads a Broadcast Wave bext chunk and stores its time reference,
+// the number of samples since midnight of the first sample, as "TimeReference",
+// and its coding history, see setCodingHistory.
+func (w wav) readBext(data []byte) error {
+	const (
+		// The time reference follows the description, originator,
+		// originator reference, origination date and origination time.
+		timeReferenceOffset = 256 + 32 + 32 + 10 + 8
+
+		// The coding history follows the time reference, the version,
+		// the UMID, the loudness values and the reserved bytes.
+		codingHistoryOffset = timeReferenceOffset + 8 + 2 + 64 + 10 + 180
+	)
+
+	if len(data) < timeReferenceOffset+8 {
+		return fmt.Errorf("truncated bext chunk")
+	}
+	low := binary.LittleEndian.Uint32(data[timeReferenceOffset:])
+	high := binary.LittleEndian.Uint32(data[timeReferenceOffset+4:])
+
+	w.metadata[KeyTimeReference] = strconv.FormatUint(uint64(high)<<32|uint64(low), 10)
+
+	if len(data) > codingHistoryOffset {
+		setCodingHistory(w.metadata, string(data[codingHistoryOffset:]))
+	}
+	return nil
+}
+
+// bextTextFields are the text fields at the start of a bext chunk that
+// WithBextSync keeps in sync with the INFO list, by their offset and size.
+var bextTextFields = []struct {
+	prop         string
+	offset, size int
+}{
+	{KeyTitle, 0, 256},   // Description
+	{KeyArtist, 256, 32}, // Originator
+}
+
+// WithBextSync makes Write keep the Description and Originator of the bext
+// chunk of Broadcast Wave files in sync with the title and the artist in
+// the INFO list, as the EBU recommends, so that files look the same in
+// broadcast tools, which read the bext chunk, and in consumer apps, which
+// read the INFO list. Properties that are written set both. Otherwise the
+// INFO list is copied to the bext chunk, and fields it doesn't have are
+// filled in from the bext chunk. The bext fields are Windows-1252 text and
+// are cut to 256 and 32 bytes. Files without a bext chunk are left alone.
+func WithBextSync() Option {
+	return func(o *options) {
+		o.bextSync = true
+	}
+}
+
+// syncBext returns a copy of the data of a bext chunk with its text fields
+// synced with the properties of an INFO list, which have been updated with
+// tags, and fills in the properties that the INFO list doesn't have.
+func syncBext(data []byte, info map[string]string, tags TagSet) []byte {
+	if len(data) < 256+32 {
+		return data
+	}
+	data = append([]byte(nil), data...)
+
+	for _, f := range bextTextFields {
+		field := data[f.offset : f.offset+f.size]
+		if i := bytes.IndexByte(field, 0); i >= 0 {
+			field = field[:i]
+		}
+		if _, written := tags[f.prop]; !written && info[f.prop] == "" && len(field) > 0 {
+			info[f.prop] = decodeWindows1252(field)
+			continue
+		}
+		text := encodeWindows1252(info[f.prop])
+		if len(text) > f.size {
+			text = text[:f.size]
+		}
+		copy(data[f.offset:f.offset+f.size], append(text, make([]byte, f.size-len(text))...))
+	}
+	return data
+}
+
+// ixmlDocument is the part of an iXML document that describes timecode.
+// See http://www.gallery.co.uk/ixml/ for more info.
+type ixmlDocument struct {
+	Speed struct {
+		TimecodeRate        string `xml:"TIMECODE_RATE"`
+		TimecodeFlag        string `xml:"TIMECODE_FLAG"`
+		SamplesHigh         string `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI"`
+		SamplesLow          string `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO"`
+		TimestampSampleRate string `xml:"TIMESTAMP_SAMPLE_RATE"`
+	} `xml:"SPEED"`
+}
+
+// readIXML reads an iXML chunk and stores the timecode rate as "TimecodeRate"
+// and whether it is drop-frame as "TimecodeDropFrame".
+// Its timestamp is stored as "TimeReference" if the file has no bext chunk.
+func (w wav) readIXML(data []byte) error {
+	var doc ixmlDocument
+
+	// The document is often padded with NUL bytes.
+	if err := xml.Unmarshal(bytes.TrimRight(data, "\x00"), &doc); err != nil {
+		return fmt.Errorf("invalid iXML chunk: %s", err)
+	}
+	speed := doc.Speed
+
+	if rate := strings.TrimSpace(speed.TimecodeRate); rate != "" {
+		w.metadata[KeyTimecodeRate] = rate
+		w.metadata[KeyTimecodeDropFrame] = strconv.FormatBool(strings.TrimSpace(speed.TimecodeFlag) == "DF")
+	}
+	if rate, err := strconv.ParseInt(strings.TrimSpace(speed.TimestampSampleRate), 10, 64); err == nil {
+		w.timecode.sampleRate = rate
+	}
+	if _, ok := w.metadata[KeyTimeReference]; ok {
+		return nil
+	}
+	high, errHigh := strconv.ParseUint(strings.TrimSpace(speed.SamplesHigh), 10, 32)
+	low, errLow := strconv.ParseUint(strings.TrimSpace(speed.SamplesLow), 10, 32)
+	if errHigh == nil && errLow == nil {
+		w.metadata[KeyTimeReference] = strconv.FormatUint(high<<32|low, 10)
+	}
+	return nil
+}
+
+// setTimecode stores the time reference as a SMPTE timecode, "Timecode",
+// once all the chunks have been read. It needs the timecode rate from
+// the iXML chunk and the sample rate of the file.
+func (w wav) setTimecode() {
+	samples, err := strconv.ParseUint(w.metadata[KeyTimeReference], 10, 64)
+	if err != nil {
+		return
+	}
+	rate, ok := new(big.Rat).SetString(w.metadata[KeyTimecodeRate])
+	if !ok || rate.Sign() <= 0 {
+		return
+	}
+	sampleRate := w.timecode.sampleRate
+	if sampleRate == 0 {
+		sampleRate, _ = strconv.ParseInt(w.metadata[KeySampleRate], 10, 64)
+	}
+	if sampleRate <= 0 {
+		return
+	}
+	dropFrame := w.metadata[KeyTimecodeDropFrame] == "true"
+
+	if tc, ok := formatTimecode(samples, sampleRate, rate, dropFrame); ok {
+		w.metadata[KeyTimecode] = tc
+	}
+}
+
+// formatTimecode formats a number of samples since midnight as a SMPTE
+// timecode, "HH:MM:SS:FF", or "HH:MM:SS;FF" for drop-frame timecode.
+// Frames are counted at the real frame rate, e.g. 30000/1001, and labelled
+// at the nominal frame rate, e.g. 30. It returns false if drop-frame is
+// requested for a rate that doesn't support it.
+func formatTimecode(samples uint64, sampleRate int64, rate *big.Rat, dropFrame bool) (string, bool) {
+	// frames = samples * rate / sampleRate, rounded down.
+	frames := new(big.Int).Mul(new(big.Int).SetUint64(samples), rate.Num())
+	frames.Quo(frames, new(big.Int).Mul(big.NewInt(sampleRate), rate.Denom()))
+	if !frames.IsInt64() {
+		return "", false
+	}
+	n := frames.Int64()
+
+	// The nominal rate is the real rate rounded to the nearest integer.
+	nominal, _ := rate.Float64()
+	fps := int64(nominal + 0.5)
+	if fps == 0 {
+		return "", false
+	}
+	sep := ":"
+
+	if dropFrame {
+		// Drop-frame timecode skips the first frame labels of each minute,
+		// except every tenth minute: 2 labels at 30 fps and 4 at 60 fps.
+		if fps%30 != 0 {
+			return "", false
+		}
+		var (
+			drop         = fps / 15
+			perMinute    = fps*60 - drop
+			perTenMinute = fps*600 - drop*9
+			tens         = n / perTenMinute
+			rest         = n % perTenMinute
+		)
+		n += 9 * drop * tens
+		if rest > drop {
+			n += drop * ((rest - drop) / perMinute)
+		}
+		sep = ";"
+	}
+	var (
+		ff = n % fps
+		ss = n / fps % 60
+		mm = n / fps / 60 % 60
+		hh = n / fps / 3600 % 24
+	)
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", hh, mm, ss, sep, ff), true
+}
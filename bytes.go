@@ -0,0 +1,117 @@
+package sndtag
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// NewFromBytes creates a new map with metadata read from a byte slice
+// that holds an entire file. It is the fast path for callers that already
+// have the file in memory: the parsers index into the slice directly
+// instead of reading and copying the data.
+// If the type is not one of the supported types then an error is returned.
+func NewFromBytes(b []byte, opts ...Option) (metadata map[string]string, err error) {
+	o := newOptions(opts)
+
+	defer o.startStats()()
+	o.startDuplicates()
+	defer func() {
+		if r := recover(); r != nil {
+			metadata, err = nil, malformed(r)
+		}
+	}()
+	if o.stats != nil {
+		o.stats.BytesRead = int64(len(b))
+	}
+
+	if err := o.check(len(b)); err != nil {
+		return nil, err
+	}
+	metadata, err = parseMetadata(b, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkDuplicates(); err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		// Files without tags are not an error, see HasTags.
+		metadata = map[string]string{}
+	}
+	if metadata, err = o.enrich(metadata); err != nil {
+		return nil, err
+	}
+	return o.styleKeys(o.fallBackToArtist(metadata)), nil
+}
+
+// parseMetadata reads the metadata of a file that is entirely in memory,
+// see NewFromBytes.
+func parseMetadata(b []byte, o options) (map[string]string, error) {
+	switch {
+	case len(b) < 4 && o.raw != nil:
+		return rawMetadata(int64(len(b)), *o.raw), nil
+	case len(b) < 4:
+		return nil, fmt.Errorf("expected at least 4 bytes, got %d", len(b))
+	}
+
+	// Figure out the type. Headerless PCM can look like an MPEG frame sync.
+	typ := o.detectType(b)
+	if typ == fileMPEG && o.raw != nil {
+		typ = fileUnknown
+	}
+	switch typ {
+	case fileID3v2:
+		tags, rest, err := parseID3v2Tags(b, 0, o)
+		if err != nil {
+			return nil, err
+		}
+		metadata := mergeID3v2Metadata(tags)
+
+		// Lossless formats like TTA are often tagged with ID3v2.
+		if legacy := legacyMetadata(rest); legacy != nil {
+			if err := parseAPEv2(b, legacy, o); err != nil {
+				return nil, err
+			}
+			o.mergeTags(metadata, legacy)
+		}
+		parseID3v1(b, metadata, o)
+		return metadata, nil
+	case fileID3v1:
+		if len(b) < id3v1Size {
+			return nil, fmt.Errorf("truncated ID3v1 tag")
+		}
+		return decodeID3v1(b[:id3v1Size], 0, o), nil
+	case fileRIFF:
+		return newWavBytes(b, o)
+	case fileMP4:
+		return newMP4Bytes(b, o)
+	case fileLegacy:
+		metadata := legacyMetadata(b)
+		if err := parseAPEv2(b, metadata, o); err != nil {
+			return nil, err
+		}
+		return metadata, nil
+	case fileMusepack:
+		return newMusepackBytes(b, o)
+	case fileMonkeysAudio:
+		return newMonkeysAudioBytes(b, o)
+	case fileMatroska:
+		return newMatroska(bytes.NewReader(b), o)
+	case fileMIDI:
+		return newMIDI(b)
+	case fileSphere:
+		return newSphereBytes(b, o)
+	case fileTracker:
+		return newTracker(b)
+	case fileFLAC:
+		return newFLAC(bytes.NewReader(b[4:]), o)
+	case fileMPEG:
+		metadata := map[string]string{}
+		parseID3v1(b, metadata, o)
+		return metadata, nil
+	}
+	if o.raw != nil {
+		return rawMetadata(int64(len(b)), *o.raw), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnrecognizedFormat, b[:3])
+}
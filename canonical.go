@@ -0,0 +1,123 @@
+package sndtag
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/briansorahan/sndtag/riff"
+)
+
+// CanonicalID3v2 encodes the writable properties of a metadata map as an
+// ID3v2.4 tag. The output only depends on the properties, not on the file
+// they were read from: frames are sorted by ID, text is UTF-8 and there is
+// no padding. Properties that can't be written to ID3v2, such as format
+// properties, are ignored.
+//
+// Comments are written from the numbered comment properties if there are
+// any, and from "Comment" otherwise. "RatingRaw" takes precedence over
+// "Rating", since it doesn't depend on the rating scale.
+//
+// Reading the tag with New returns the same writable properties.
+func CanonicalID3v2(metadata map[string]string) ([]byte, error) {
+	t := &id3v2{
+		header:   id3v2Header{Major: 4},
+		metadata: map[string]string{},
+	}
+	for prop, id := range id3v2Properties {
+		value := metadata[prop]
+		if value == "" {
+			continue
+		}
+		if id == ID3v2FrameYear {
+			id = ID3v2FrameRecordingTime
+		}
+		t.frames = append(t.frames, id3v2Frame{ID: id, Data: t.encodeTextFrame(value)})
+	}
+
+	// Add the user text frames, sorted by description.
+	var props []string
+	for prop := range id3v2UserTextProperties {
+		if metadata[prop] != "" {
+			props = append(props, prop)
+		}
+	}
+	sort.Slice(props, func(i, j int) bool {
+		return id3v2UserTextProperties[props[i]] < id3v2UserTextProperties[props[j]]
+	})
+	for _, prop := range props {
+		t.setUserText(id3v2UserTextProperties[prop], metadata[prop])
+	}
+
+	// Add the comments.
+	comments := Comments(metadata)
+	if len(comments) == 0 && metadata[KeyComment] != "" {
+		comments = []Comment{{Language: "eng", Text: metadata[KeyComment]}}
+	}
+	for _, c := range comments {
+		t.frames = append(t.frames, id3v2Frame{ID: ID3v2FrameComment, Data: t.encodeComment(c)})
+	}
+
+	// Add the popularimeter.
+	popm, ok, err := canonicalPopularimeter(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		t.frames = append(t.frames, id3v2Frame{ID: ID3v2FramePopularimeter, Data: popm.encode()})
+	}
+
+	// Comments and user text frames keep their order.
+	sort.SliceStable(t.frames, func(i, j int) bool {
+		return t.frames[i].ID < t.frames[j].ID
+	})
+	tag := t.encode(0)
+	if err := validateID3v2(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// canonicalPopularimeter returns the POPM frame for the rating properties
+// of a metadata map. It returns false if there are no rating properties.
+func canonicalPopularimeter(metadata map[string]string) (popularimeter, bool, error) {
+	var (
+		popm = popularimeter{Email: RatingScaleWMP.Email}
+		ok   bool
+	)
+	if email, set := metadata[KeyRatingEmail]; set {
+		popm.Email, ok = email, true
+	}
+	if raw := metadata[KeyRatingRaw]; raw != "" {
+		rating, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil {
+			return popularimeter{}, false, fmt.Errorf("invalid raw rating %q: %s", raw, err)
+		}
+		popm.Rating, ok = byte(rating), true
+	} else if stars := metadata[KeyRating]; stars != "" {
+		if err := popm.set(KeyRating, stars, options{}); err != nil {
+			return popularimeter{}, false, err
+		}
+		ok = true
+	}
+	if count := metadata[KeyPlayCount]; count != "" {
+		if err := popm.set(KeyPlayCount, count, options{}); err != nil {
+			return popularimeter{}, false, err
+		}
+		ok = true
+	}
+	return popm, ok, nil
+}
+
+// CanonicalINFO encodes the writable properties of a metadata map as a
+// WAV LIST chunk of type INFO, including the chunk header. Subchunks are
+// sorted by ID and text is UTF-8, which New reads back unchanged.
+// Properties that can't be written to an INFO list are ignored.
+// It returns nil if there are no writable properties.
+func CanonicalINFO(metadata map[string]string) []byte {
+	list := encodeInfo(metadata, UTF8)
+	if list == nil {
+		return nil
+	}
+	return riff.EncodeChunk("LIST", list)
+}
@@ -0,0 +1,288 @@
+package sndtag
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalID3v2(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		metadata map[string]string
+		want     map[string]string
+	}{
+		{
+			name: "text",
+			metadata: map[string]string{
+				KeyTitle: "Title", KeyArtist: "Artist", KeyAlbum: "Album",
+				KeyYear: "1999", KeyTrack: "3/12", KeyLabel: "Label",
+			},
+		},
+		{
+			name:     "unicode",
+			metadata: map[string]string{KeyTitle: "Grüße, 世界", KeyArtist: "Ærøskøbing"},
+		},
+		{
+			name:     "user text",
+			metadata: map[string]string{KeyBarcode: "0123456789012", KeyCatalogNumber: "CAT-1", KeyReleaseCountry: "GB"},
+		},
+		{
+			name:     "comment",
+			metadata: map[string]string{KeyComment: "Comment"},
+		},
+		{
+			name:     "rating",
+			metadata: map[string]string{KeyRatingEmail: RatingScaleWMP.Email, KeyRatingRaw: "196", KeyPlayCount: "7"},
+			want:     map[string]string{KeyRating: "4", KeyRatingRaw: "196", KeyPlayCount: "7"},
+		},
+		{
+			name:     "format properties",
+			metadata: map[string]string{KeyTitle: "Title", KeySampleRate: "44100"},
+			want:     map[string]string{KeyTitle: "Title", KeySampleRate: ""},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tag, err := CanonicalID3v2(tc.metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := CanonicalID3v2(tc.metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tag, again) {
+				t.Error("the output isn't deterministic")
+			}
+			metadata, err := NewFromBytes(testMP3(tag))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tc.want
+			if want == nil {
+				want = tc.metadata
+			}
+			for key, value := range want {
+				if got := metadata[key]; got != value {
+					t.Errorf("%s: got %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestCanonicalINFO(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		metadata map[string]string
+		want     map[string]string
+	}{
+		{
+			name:     "empty",
+			metadata: map[string]string{KeySampleRate: "44100"},
+		},
+		{
+			name: "text",
+			metadata: map[string]string{
+				KeyTitle: "Title", KeyArtist: "Artist", KeyAlbum: "Album",
+				KeyComment: "Comment", KeyGenre: "Genre", KeyTrack: "3", KeyYear: "1999",
+			},
+		},
+		{
+			// Odd lengths need pad bytes.
+			name:     "odd",
+			metadata: map[string]string{KeyTitle: "Odd", KeyArtist: "Even"},
+		},
+		{
+			name:     "unicode",
+			metadata: map[string]string{KeyTitle: "Grüße, 世界"},
+		},
+		{
+			name:     "unwritable",
+			metadata: map[string]string{KeyTitle: "Title", KeyLabel: "Label"},
+			want:     map[string]string{KeyTitle: "Title", KeyLabel: ""},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			list := CanonicalINFO(tc.metadata)
+			if tc.name == "empty" {
+				if list != nil {
+					t.Fatalf("got %q, want nil", list)
+				}
+				return
+			}
+			if err := validateChunk("LIST", list[8:]); err != nil {
+				t.Fatal(err)
+			}
+			metadata, err := NewFromBytes(testWav(list))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tc.want
+			if want == nil {
+				want = tc.metadata
+			}
+			for key, value := range want {
+				if got := metadata[key]; got != value {
+					t.Errorf("%s: got %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+// canonicalValue returns a value of a property that can be written.
+func canonicalValue(key string) string {
+	switch key {
+	case KeyTrack:
+		return "3"
+	case KeyYear:
+		return "1999"
+	}
+	return "Value of " + key
+}
+
+// canonicalMetadata returns a value for each property that CanonicalID3v2
+// writes, or that CanonicalINFO writes if info is set.
+func canonicalMetadata(info bool) map[string]string {
+	metadata := map[string]string{}
+	if info {
+		for key := range wavInfoProperties {
+			metadata[key] = canonicalValue(key)
+		}
+		return metadata
+	}
+	for key := range id3v2Properties {
+		metadata[key] = canonicalValue(key)
+	}
+	for key := range id3v2UserTextProperties {
+		metadata[key] = canonicalValue(key)
+	}
+	metadata[KeyComment] = "Comment"
+	metadata[KeyRatingRaw] = "196"
+	metadata[KeyPlayCount] = "7"
+	return metadata
+}
+
+func TestCanonicalAllKeys(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		info   bool
+		encode func(map[string]string) ([]byte, error)
+		file   func([]byte) []byte
+	}{
+		{"ID3v2", false, CanonicalID3v2, testMP3},
+		{"INFO", true, func(m map[string]string) ([]byte, error) { return CanonicalINFO(m), nil }, func(b []byte) []byte { return testWav(b) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := canonicalMetadata(tc.info)
+			tag, err := tc.encode(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metadata, err := NewFromBytes(tc.file(tag))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range want {
+				if got := metadata[key]; got != value {
+					t.Errorf("%s: got %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestCanonicalRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		info   bool
+		file   []byte
+		encode func(map[string]string) ([]byte, error)
+	}{
+		{"ID3v2", false, testMP3(nil), CanonicalID3v2},
+		{"ID3v2 over an existing tag", false, testMP3(testID3v2(3, testTextFrame(ID3v2FrameTrack, "1"), testTextFrame(ID3v2FrameTitle, "Old"))), CanonicalID3v2},
+		{"INFO", true, testWav(), func(m map[string]string) ([]byte, error) { return CanonicalINFO(m), nil }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tags := TagSet(canonicalMetadata(tc.info))
+			delete(tags, KeyRatingRaw)
+			delete(tags, KeyPlayCount)
+
+			var out bytes.Buffer
+			if err := Write(&out, bytes.NewReader(tc.file), tags); err != nil {
+				t.Fatal(err)
+			}
+			metadata, err := New(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := tc.encode(tags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tc.encode(metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("the canonical tag of the written file differs:\n%x\nwant\n%x", got, want)
+			}
+		})
+	}
+}
+
+func TestCanonicalFrameOrder(t *testing.T) {
+	var (
+		title   = testTextFrame(ID3v2FrameTitle, "Title")
+		artist  = testTextFrame(ID3v2FrameArtist, "Artist")
+		album   = testTextFrame(ID3v2FrameAlbum, "Album")
+		comment = testFrame(ID3v2FrameComment, []byte("\x00engFirst\x00One"))
+		second  = testFrame(ID3v2FrameComment, []byte("\x00engSecond\x00Two"))
+	)
+	// The same frames in different orders, including the comments, whose
+	// relative order is kept.
+	files := [][]byte{
+		testMP3(testID3v2(3, title, artist, comment, second, album)),
+		testMP3(testID3v2(3, album, comment, title, second, artist)),
+		testMP3(testID3v2(3, comment, second, artist, album, title)),
+	}
+	var want []byte
+	for i, file := range files {
+		metadata, err := NewFromBytes(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Maps are iterated in a random order, so encode several times.
+		for j := 0; j < 10; j++ {
+			tag, err := CanonicalID3v2(metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want == nil {
+				want = tag
+			}
+			if !bytes.Equal(tag, want) {
+				t.Fatalf("file %d: got\n%x\nwant\n%x", i, tag, want)
+			}
+		}
+	}
+	tags, _, err := parseID3v2Tags(want, 0, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, frame := range tags[0].frames {
+		ids = append(ids, frame.ID)
+	}
+	if got, want := strings.Join(ids, " "), "COMM COMM TALB TIT2 TPE1"; got != want {
+		t.Errorf("got frames %s, want %s", got, want)
+	}
+	metadata, err := NewFromBytes(testMP3(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := Comments(metadata); len(c) != 2 || c[0].Description != "First" {
+		t.Errorf("got comments %+v", c)
+	}
+}
@@ -0,0 +1,175 @@
+package sndtag
+
+import (
+	"bufio"
+	"io"
+)
+
+// Format is a file format that sndtag recognizes.
+type Format int
+
+// Formats.
+const (
+	FormatUnknown Format = iota
+
+	// FormatMP3 is an MPEG audio stream, with or without ID3 tags.
+	FormatMP3
+	FormatWAV
+	FormatMP4
+	FormatFLAC
+	FormatMusepack
+	FormatMonkeysAudio
+	FormatMatroska
+	FormatMIDI
+	FormatSphere
+
+	// FormatTracker is a MOD, S3M, XM or IT module.
+	FormatTracker
+
+	// Lossless formats that are only detected, see KeyFormat.
+	FormatShorten
+	FormatTTA
+	FormatTAK
+	FormatOptimFROG
+
+	// FormatAIFF is an AIFF or AIFF-C file, whose audio PreviewPCM,
+	// ComputePeaks and Analyze decode. New doesn't read it.
+	FormatAIFF
+)
+
+// legacyFormatTypes maps the names of the legacy lossless formats to their Format.
+var legacyFormatTypes = map[string]Format{
+	"Shorten":   FormatShorten,
+	"TTA":       FormatTTA,
+	"TAK":       FormatTAK,
+	"OptimFROG": FormatOptimFROG,
+}
+
+// DetectFormat returns the format of a file from the bytes at its start.
+// 12 bytes are enough for every format but MOD modules, which need 1084.
+func DetectFormat(b []byte) Format {
+	switch detectType(b) {
+	case fileID3v2, fileID3v1, fileMPEG:
+		return FormatMP3
+	case fileRIFF:
+		return FormatWAV
+	case fileMP4:
+		return FormatMP4
+	case fileLegacy:
+		return legacyFormatTypes[legacyFormat(b)]
+	case fileMusepack:
+		return FormatMusepack
+	case fileMonkeysAudio:
+		return FormatMonkeysAudio
+	case fileMatroska:
+		return FormatMatroska
+	case fileMIDI:
+		return FormatMIDI
+	case fileSphere:
+		return FormatSphere
+	case fileTracker:
+		return FormatTracker
+	case fileFLAC:
+		return FormatFLAC
+	}
+	if isAIFF(b) {
+		return FormatAIFF
+	}
+	return FormatUnknown
+}
+
+// DetectFormatReader returns the format of a stream without consuming any
+// of it, by peeking at its start, so that the stream can be handed to
+// a decoder or to New untouched. Peeking as far as MOD modules need
+// takes a buffer of 1084 bytes or more, which the default size of
+// bufio.NewReader is.
+func DetectFormatReader(br *bufio.Reader) (Format, error) {
+	b, err := br.Peek(trackerSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return FormatUnknown, err
+	}
+	if len(b) == 0 {
+		return FormatUnknown, err
+	}
+	return DetectFormat(b), nil
+}
+
+// Caps are what sndtag can do with a format.
+type Caps struct {
+	// ReadTags and WriteTags are whether New can read the descriptive
+	// properties of the format, like the title, and whether Write can
+	// write them.
+	ReadTags  bool
+	WriteTags bool
+
+	// ReadProperties is whether New reads the format at all, which for
+	// the formats that are only detected is just KeyFormat. It is set for
+	// every format with ReadTags.
+	ReadProperties bool
+
+	// ReadArtwork and WriteArtwork are whether New can read the embedded
+	// pictures, see WithArtwork, and whether Write can write them.
+	ReadArtwork  bool
+	WriteArtwork bool
+
+	// InPlace is whether tags can be edited without rewriting the file.
+	// Write and WriteFile always write a new file.
+	InPlace bool
+
+	// MultiValue is whether a property can have several values, which
+	// New returns as indexed keys, e.g. KeyCommentText(2).
+	MultiValue bool
+
+	// Verify is whether Verify can check the audio data of the format.
+	Verify bool
+
+	// Preview is whether PreviewPCM, ComputePeaks and Analyze can decode
+	// the audio of the format.
+	Preview bool
+}
+
+// capabilities are the capabilities of the formats that have any.
+var capabilities = map[Format]Caps{
+	FormatMP3: {
+		ReadTags:    true,
+		WriteTags:   true,
+		ReadArtwork: true,
+		MultiValue:  true,
+	},
+	FormatWAV: {
+		ReadTags:  true,
+		WriteTags: true,
+		Verify:    true,
+		Preview:   true,
+	},
+	FormatMP4: {
+		ReadTags:    true,
+		ReadArtwork: true,
+		MultiValue:  true,
+	},
+	FormatFLAC: {
+		ReadTags: true,
+		Verify:   true,
+		Preview:  true,
+	},
+	FormatMusepack:     {ReadTags: true},
+	FormatMonkeysAudio: {ReadTags: true},
+	FormatMatroska:     {ReadTags: true},
+	FormatMIDI:         {ReadTags: true},
+	FormatSphere:       {ReadTags: true},
+	FormatTracker:      {ReadTags: true},
+	FormatShorten:      {ReadProperties: true},
+	FormatTTA:          {ReadProperties: true},
+	FormatTAK:          {ReadProperties: true},
+	FormatOptimFROG:    {ReadProperties: true},
+	FormatAIFF:         {Preview: true},
+}
+
+// Capabilities returns what sndtag can read and write for a format, e.g.
+// so that a GUI can enable the buttons that make sense for a file, see
+// DetectFormat. Formats that are only detected just have ReadProperties.
+func Capabilities(format Format) Caps {
+	caps := capabilities[format]
+	caps.ReadProperties = caps.ReadProperties || caps.ReadTags
+	return caps
+}
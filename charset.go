@@ -0,0 +1,175 @@
+package sndtag
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252 maps the bytes 0x80-0x9f of Windows-1252 to runes.
+// The other bytes are the same as in ISO-8859-1.
+// Bytes that are undefined map to the replacement character.
+var windows1252 = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+// decodeWindows1252 decodes Windows-1252 text.
+func decodeWindows1252(b []byte) string {
+	var sb strings.Builder
+
+	for _, c := range b {
+		if c >= 0x80 && c < 0xa0 {
+			sb.WriteRune(windows1252[c-0x80])
+			continue
+		}
+		sb.WriteRune(rune(c))
+	}
+	return sb.String()
+}
+
+// encodeWindows1252 encodes a string as Windows-1252.
+// Characters that can't be encoded are replaced with '?'.
+func encodeWindows1252(s string) []byte {
+	b := make([]byte, 0, len(s))
+
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			b = append(b, byte(r))
+		default:
+			b = append(b, windows1252Byte(r))
+		}
+	}
+	return b
+}
+
+// windows1252Byte returns the byte for a rune in the range 0x80-0x9f
+// of Windows-1252, or '?' if there isn't one.
+func windows1252Byte(r rune) byte {
+	for i, c := range windows1252 {
+		if c == r && c != '�' {
+			return byte(0x80 + i)
+		}
+	}
+	return '?'
+}
+
+// decodeInfoText decodes the value of an INFO subchunk.
+// The RIFF spec doesn't say which encoding to use. Windows uses its
+// code page, and more recent programs use UTF-8, so text that is
+// valid UTF-8 is assumed to be UTF-8 and anything else Windows-1252.
+func decodeInfoText(b []byte) string {
+	b = []byte(strings.TrimRight(string(b), "\x00"))
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return decodeWindows1252(b)
+}
+
+// windows1251 maps the bytes 0x80-0xbf of Windows-1251 to runes.
+// The bytes 0xc0-0xff are the Cyrillic letters А-я.
+var windows1251 = [64]rune{
+	'Ђ', 'Ѓ', '‚', 'ѓ', '„', '…', '†', '‡', '€', '‰', 'Љ', '‹', 'Њ', 'Ќ', 'Ћ', 'Џ',
+	'ђ', '‘', '’', '“', '”', '•', '–', '—', '�', '™', 'љ', '›', 'њ', 'ќ', 'ћ', 'џ',
+	'\u00a0', 'Ў', 'ў', 'Ј', '¤', 'Ґ', '¦', '§', 'Ё', '©', 'Є', '«', '¬', '\u00ad', '®', 'Ї',
+	'°', '±', 'І', 'і', 'ґ', 'µ', '¶', '·', 'ё', '№', 'є', '»', 'ј', 'Ѕ', 'ѕ', 'ї',
+}
+
+// A Charset decodes text in a legacy character set.
+// Decode reports false if b isn't valid in the character set,
+// in which case the next Charset in the chain set by WithCharsets is tried.
+//
+// Charsets that aren't built in, e.g. GBK or Shift JIS from
+// golang.org/x/text/encoding, can be used with CharsetFunc.
+type Charset interface {
+	Decode(b []byte) (string, bool)
+}
+
+// CharsetFunc is an adapter that allows the use of ordinary functions as Charsets.
+type CharsetFunc func(b []byte) (string, bool)
+
+// Decode calls f(b).
+func (f CharsetFunc) Decode(b []byte) (string, bool) {
+	return f(b)
+}
+
+// Built-in charsets.
+var (
+	// CharsetUTF8 accepts text that is valid UTF-8.
+	CharsetUTF8 Charset = CharsetFunc(func(b []byte) (string, bool) {
+		return string(b), utf8.Valid(b)
+	})
+
+	// CharsetLatin1 decodes ISO-8859-1, and accepts any text.
+	CharsetLatin1 Charset = CharsetFunc(func(b []byte) (string, bool) {
+		return decodeLatin1(b), true
+	})
+
+	// CharsetWindows1252 decodes Windows-1252. It rejects text
+	// with bytes that are undefined in Windows-1252.
+	CharsetWindows1252 Charset = CharsetFunc(func(b []byte) (string, bool) {
+		for _, c := range b {
+			if c >= 0x80 && c < 0xa0 && windows1252[c-0x80] == '�' {
+				return "", false
+			}
+		}
+		return decodeWindows1252(b), true
+	})
+
+	// CharsetWindows1251 decodes Windows-1251, the Cyrillic code page.
+	// It rejects text with bytes that are undefined in Windows-1251.
+	CharsetWindows1251 Charset = CharsetFunc(decodeWindows1251)
+)
+
+// decodeWindows1251 decodes Windows-1251 text.
+func decodeWindows1251(b []byte) (string, bool) {
+	var sb strings.Builder
+
+	for _, c := range b {
+		switch {
+		case c < 0x80:
+			sb.WriteByte(c)
+		case c < 0xc0:
+			if windows1251[c-0x80] == '�' {
+				return "", false
+			}
+			sb.WriteRune(windows1251[c-0x80])
+		default:
+			sb.WriteRune('А' + rune(c-0xc0))
+		}
+	}
+	return sb.String(), true
+}
+
+// charsets is a chain of charsets that is tried in order.
+type charsets []Charset
+
+// decode decodes text that is stored in an unknown 8-bit or multi-byte
+// character set, up to the first NUL byte. ASCII text is decoded as is,
+// anything else with the first charset that accepts it, and text that no
+// charset accepts is decoded as ISO-8859-1.
+func (cs charsets) decode(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	if len(cs) == 0 || isASCII(b) {
+		return decodeLatin1(b)
+	}
+	for _, c := range cs {
+		if s, ok := c.Decode(b); ok {
+			return s
+		}
+	}
+	return decodeLatin1(b)
+}
+
+// isASCII reports whether b only contains 7-bit ASCII.
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
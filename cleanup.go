@@ -0,0 +1,197 @@
+package sndtag
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Cleanup normalizes the values of properties and returns the properties
+// it changed, which can be passed to Write. Cleanups are opt-in, for batch
+// retagging, see CleanTags.
+type Cleanup func(metadata map[string]string) TagSet
+
+// cleanedProperties are the descriptive properties that cleanups change.
+var cleanedProperties = []string{KeyTitle, KeyArtist, KeyAlbum, KeyAlbumArtist, KeyGenre, KeyComment}
+
+// CleanTags applies cleanups in order to the properties returned by New and
+// returns the properties that changed, e.g.
+//
+//	changes := sndtag.CleanTags(metadata, sndtag.CollapseSpace, sndtag.TitleCase("en"))
+//	err := sndtag.WriteFile(path, changes)
+func CleanTags(metadata map[string]string, cleanups ...Cleanup) TagSet {
+	current := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		current[k] = v
+	}
+	for _, cleanup := range cleanups {
+		for k, v := range cleanup(current) {
+			current[k] = v
+		}
+	}
+	changes := TagSet{}
+	for k, v := range current {
+		if original, ok := metadata[k]; !ok && v != "" || ok && v != original {
+			changes[k] = v
+		}
+	}
+	return changes
+}
+
+// CollapseSpace trims the descriptive properties and replaces runs of
+// white space in them with a single space. Comments keep their line
+// breaks, but each line is cleaned up.
+func CollapseSpace(metadata map[string]string) TagSet {
+	changes := TagSet{}
+	for _, prop := range cleanedProperties {
+		value, ok := metadata[prop]
+		if !ok {
+			continue
+		}
+		var cleaned string
+		if prop == KeyComment {
+			lines := strings.Split(strings.ReplaceAll(value, "\r\n", "\n"), "\n")
+			for i, line := range lines {
+				lines[i] = strings.Join(strings.Fields(line), " ")
+			}
+			cleaned = strings.TrimSpace(strings.Join(lines, "\n"))
+		} else {
+			cleaned = strings.Join(strings.Fields(value), " ")
+		}
+		if cleaned != value {
+			changes[prop] = cleaned
+		}
+	}
+	return changes
+}
+
+// featuring matches the ways of crediting a featured artist.
+var featuring = regexp.MustCompile(`(?i)(^|[\s(\[])(featuring|feat\.?|ft\.?)\s+`)
+
+// NormalizeFeaturing writes the credits of featured artists in the title
+// and the artists as "feat.", e.g. "Ft. X" and "featuring X" are "feat. X".
+func NormalizeFeaturing(metadata map[string]string) TagSet {
+	changes := TagSet{}
+	for _, prop := range []string{KeyTitle, KeyArtist, KeyAlbumArtist} {
+		value, ok := metadata[prop]
+		if !ok {
+			continue
+		}
+		if cleaned := featuring.ReplaceAllString(value, "${1}feat. "); cleaned != value {
+			changes[prop] = cleaned
+		}
+	}
+	return changes
+}
+
+// SplitArtistTitle fixes titles that hold "Artist - Title", which some
+// rippers and downloaders write. The title is split if the file has no
+// artist, or if the part before the dash is the artist.
+func SplitArtistTitle(metadata map[string]string) TagSet {
+	var (
+		title  = metadata[KeyTitle]
+		artist = metadata[KeyArtist]
+	)
+	i := strings.Index(title, " - ")
+	if i <= 0 {
+		return nil
+	}
+	prefix, rest := strings.TrimSpace(title[:i]), strings.TrimSpace(title[i+3:])
+	switch {
+	case rest == "":
+		return nil
+	case artist == "":
+		return TagSet{KeyArtist: prefix, KeyTitle: rest}
+	case strings.EqualFold(prefix, artist):
+		return TagSet{KeyTitle: rest}
+	}
+	return nil
+}
+
+// englishMinorWords are the words that English title case leaves in lower
+// case, unless they start or end the title.
+var englishMinorWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "for": true, "from": true, "in": true, "into": true, "nor": true,
+	"of": true, "on": true, "or": true, "the": true, "to": true, "vs": true,
+	"vs.": true, "with": true, "feat.": true,
+}
+
+// TitleCase returns a Cleanup that writes the titles and the album in title
+// case with the rules of a language, given as a BCP 47 tag like "en" or
+// "tr-TR". English capitalizes every word but minor ones like "of" and
+// "the". Other languages capitalize the first word only, like most
+// European languages do, and Turkish and Azerbaijani use their dotted and
+// dotless i. Words in capitals, like "DJ" or "II", are kept, unless most
+// of the value is in capitals, like a dump from an old tagger.
+func TitleCase(lang string) Cleanup {
+	base := strings.ToLower(strings.SplitN(strings.ReplaceAll(lang, "_", "-"), "-", 2)[0])
+
+	special := unicode.SpecialCase(nil)
+	if base == "tr" || base == "az" {
+		special = unicode.TurkishCase
+	}
+	return func(metadata map[string]string) TagSet {
+		changes := TagSet{}
+		for _, prop := range []string{KeyTitle, KeyAlbum} {
+			value, ok := metadata[prop]
+			if !ok {
+				continue
+			}
+			if cased := titleCase(value, base == "en", special); cased != value {
+				changes[prop] = cased
+			}
+		}
+		return changes
+	}
+}
+
+// titleCase returns s in title case. If english is false, only the first
+// word is capitalized.
+func titleCase(s string, english bool, special unicode.SpecialCase) string {
+	words := strings.Fields(s)
+	var upper, cased int
+	for _, word := range words {
+		if strings.ToLowerSpecial(special, word) == word && strings.ToUpperSpecial(special, word) == word {
+			continue
+		}
+		cased++
+		if strings.ToUpperSpecial(special, word) == word {
+			upper++
+		}
+	}
+	shouting := cased > 0 && upper*3 >= cased*2
+	if shouting {
+		for i, word := range words {
+			words[i] = strings.ToLowerSpecial(special, word)
+		}
+	}
+	for i, word := range words {
+		if !shouting && word == strings.ToUpperSpecial(special, word) {
+			// An acronym or a numeral.
+			continue
+		}
+		lower := strings.ToLowerSpecial(special, word)
+		first, last := i == 0, i == len(words)-1
+		switch {
+		case first, english && (last || !englishMinorWords[lower]):
+			words[i] = capitalize(word, special)
+		case english:
+			words[i] = lower
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// capitalize returns a word with its first letter in upper case,
+// skipping leading punctuation like an opening parenthesis.
+func capitalize(word string, special unicode.SpecialCase) string {
+	for i, r := range word {
+		if unicode.IsLetter(r) {
+			upper := string(special.ToUpper(r))
+			return word[:i] + upper + word[i+utf8.RuneLen(r):]
+		}
+	}
+	return word
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+
+	"github.com/briansorahan/sndtag"
+)
+
+// Exit statuses, see the package documentation.
+const (
+	exitOK           = 0
+	exitFailure      = 1
+	exitUsage        = 2
+	exitUnrecognized = 3
+	exitParse        = 4
+	exitConflict     = 5
+	exitPartial      = 6
+)
+
+// strict turns warnings into failures.
+var strict = flag.Bool("strict", false, "treat warnings as failures")
+
+// status tracks the outcome of the files a command processes
+// and decides the exit status.
+type status struct {
+	ok, failed int
+
+	// code is the exit status of the first failure.
+	code int
+}
+
+// succeed records a file that was processed.
+func (s *status) succeed() {
+	s.ok++
+}
+
+// fail records a file that failed with an error, or with a failure that
+// isn't an error, like a checksum mismatch, if err is nil.
+func (s *status) fail(err error) {
+	s.failed++
+	if s.code == exitOK {
+		s.code = exitCode(err)
+	}
+}
+
+// warn prints a warning about a file and records it, see warning.
+func (s *status) warn(path, warning string) {
+	fmt.Fprintf(os.Stderr, "%s: warning: %s\n", path, warning)
+	s.warning()
+}
+
+// warning records a file with a warning, which fails the file with
+// -strict and succeeds it otherwise.
+func (s *status) warning() {
+	if *strict {
+		s.fail(nil)
+		return
+	}
+	s.succeed()
+}
+
+// check records a file that was read, warning about the metadata
+// that suggests it needs attention.
+func (s *status) check(path string, metadata map[string]string) {
+	if metadata[sndtag.KeyPartial] == "true" {
+		s.warn(path, "file is still being written")
+		return
+	}
+	if n, _ := strconv.Atoi(metadata[sndtag.KeyID3v2TagCount]); n > 1 {
+		s.warn(path, fmt.Sprintf("file has %d ID3v2 tags", n))
+		return
+	}
+	s.succeed()
+}
+
+// exit returns the exit status: exitOK if nothing failed, exitPartial if
+// some files failed and others didn't, and otherwise the status of the
+// first failure.
+func (s *status) exit() int {
+	switch {
+	case s.failed == 0:
+		return exitOK
+	case s.ok > 0:
+		return exitPartial
+	}
+	return s.code
+}
+
+// exitCode returns the exit status for an error.
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+
+	switch {
+	case err == nil:
+		return exitFailure
+	case errors.Is(err, sndtag.ErrUnrecognizedFormat), errors.Is(err, sndtag.ErrVerifyUnsupported):
+		return exitUnrecognized
+	case errors.Is(err, sndtag.ErrConflict):
+		return exitConflict
+	case errors.As(err, &pathErr):
+		// The file couldn't be opened or read.
+		return exitFailure
+	}
+	return exitParse
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/briansorahan/sndtag"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"failure", nil, exitFailure},
+		{"unrecognized", sndtag.ErrUnrecognizedFormat, exitUnrecognized},
+		{"wrapped unrecognized", fmt.Errorf("a.txt: %w", sndtag.ErrUnrecognizedFormat), exitUnrecognized},
+		{"verify unsupported", sndtag.ErrVerifyUnsupported, exitUnrecognized},
+		{"conflict", fmt.Errorf("Title: %w", sndtag.ErrConflict), exitConflict},
+		{"path", &fs.PathError{Op: "open", Path: "a.wav", Err: fs.ErrNotExist}, exitFailure},
+		{"parse", errors.New("truncated chunk"), exitParse},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.err); got != tc.want {
+				t.Errorf("got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStatusExit(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		strict bool
+		record func(s *status)
+		want   int
+	}{
+		{"none", false, func(s *status) {}, exitOK},
+		{"ok", false, func(s *status) { s.succeed() }, exitOK},
+		{"first failure", false, func(s *status) {
+			s.fail(sndtag.ErrUnrecognizedFormat)
+			s.fail(errors.New("parse"))
+		}, exitUnrecognized},
+		{"partial", false, func(s *status) {
+			s.succeed()
+			s.fail(errors.New("parse"))
+		}, exitPartial},
+		{"warning", false, func(s *status) { s.warning() }, exitOK},
+		{"strict warning", true, func(s *status) { s.warning() }, exitFailure},
+		{"strict partial", true, func(s *status) {
+			s.succeed()
+			s.warning()
+		}, exitPartial},
+		{"still being written", true, func(s *status) {
+			s.check("a.wav", map[string]string{sndtag.KeyPartial: "true"})
+		}, exitFailure},
+		{"several ID3v2 tags", false, func(s *status) {
+			s.check("a.mp3", map[string]string{sndtag.KeyID3v2TagCount: "2"})
+		}, exitOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func(old bool) { *strict = old }(*strict)
+			*strict = tc.strict
+
+			var s status
+			tc.record(&s)
+			if got := s.exit(); got != tc.want {
+				t.Errorf("got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
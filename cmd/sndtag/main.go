@@ -0,0 +1,446 @@
+// Command sndtag reads and checks the metadata of audio files.
+//
+// Usage:
+//
+//	sndtag [-strict] verify FILE...
+//	sndtag [-strict] find [-workers N] EXPR DIR...
+//	sndtag [-strict] scan [-jsonl] [-workers N] DIR...
+//	sndtag [-strict] show [-1] FILE...
+//	sndtag check [-truncate N] [-timeout D] FILE...
+//	sndtag revert JOURNAL
+//
+// The verify command recomputes the checksum of the audio data of FLAC and
+// WAV files and compares it to the one embedded in them, see sndtag.Verify.
+// It prints one line per file with the result and the computed digest,
+// and fails for files that don't match or can't be checked. Files without
+// a checksum are a warning.
+//
+// The find command prints the paths of the files in the directories whose
+// metadata matches a filter expression, see sndtag.ParseFilter, e.g.
+//
+//	sndtag find 'genre == "Jazz" && year >= 1960 && !has(artwork)' ~/Music
+//
+// Files that can't be read are reported on stderr.
+//
+// The scan command prints the metadata of the files in the directories as
+// JSON. Each file is an object with its "path" and either its "metadata"
+// or the "error" reading it. By default the objects are printed as an
+// array sorted by path once every file has been read. With -jsonl each
+// object is printed on a line of its own as soon as its file is read,
+// which uses constant memory and suits pipelines, e.g.
+//
+//	sndtag scan -jsonl ~/Music | jq -r 'select(.metadata.Genre == "Jazz") | .path'
+//
+// The show command prints the metadata of files as a table, or as one line
+// per file with -1, see sndtag.Print.
+//
+// The check command runs the parsers over invalid, truncated or crafted
+// files, like the ones in testdata/corrupt, and checks that they degrade
+// gracefully: each file, and with -truncate N that many truncated copies
+// of it, must be parsed by both New and NewFromBytes without panicking and
+// within the timeout. Errors are expected. It prints the files that fail
+// and exits with status 1 if any do.
+//
+// The revert command undoes the writes recorded in a journal, see
+// sndtag.WithJournal, newest first.
+//
+// Files that are still being written or that have several ID3v2 tags are
+// a warning, which is printed on stderr. With -strict warnings fail the
+// file.
+//
+// Exit status:
+//
+//	0  every file succeeded
+//	1  a failure, like a checksum mismatch, a warning with -strict, or a
+//	   file that can't be opened
+//	2  invalid usage
+//	3  the format of a file isn't recognized, or verify doesn't support it
+//	4  a file can't be parsed
+//	5  a file has changed since the write that revert undoes
+//	6  some of the files failed and others succeeded
+//
+// Commands that fail for a single file, or for every file, exit with the
+// status of the first failure.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/briansorahan/sndtag"
+)
+
+// commands are the subcommands, by name.
+var commands = map[string]func(args []string) int{
+	"check":  check,
+	"find":   find,
+	"revert": revert,
+	"scan":   scan,
+	"show":   show,
+	"verify": verify,
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "sndtag: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(exitUsage)
+	}
+	os.Exit(cmd(flag.Args()[1:]))
+}
+
+// usage prints how to use the command.
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: sndtag [-strict] verify FILE...\n")
+	fmt.Fprintf(os.Stderr, "       sndtag [-strict] find [-workers N] EXPR DIR...\n")
+	fmt.Fprintf(os.Stderr, "       sndtag [-strict] scan [-jsonl] [-workers N] DIR...\n")
+	fmt.Fprintf(os.Stderr, "       sndtag [-strict] show [-1] FILE...\n")
+	fmt.Fprintf(os.Stderr, "       sndtag check [-truncate N] [-timeout D] FILE...\n")
+	fmt.Fprintf(os.Stderr, "       sndtag revert JOURNAL\n")
+}
+
+// verify verifies the checksums of files.
+func verify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sndtag verify FILE...\n")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	var s status
+	for _, path := range fs.Args() {
+		verifyFile(os.Stdout, path, &s)
+	}
+	return s.exit()
+}
+
+// verifyFile verifies the checksum of a file, prints the result to w,
+// and records it in s. Files without a checksum are a warning.
+func verifyFile(w io.Writer, path string, s *status) {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(w, "%s: ERROR %s\n", path, err)
+		s.fail(err)
+		return
+	}
+	defer f.Close()
+
+	v, err := sndtag.Verify(f)
+	switch {
+	case errors.Is(err, sndtag.ErrNoChecksum):
+		fmt.Fprintf(w, "%s: NO CHECKSUM\n", path)
+		s.warning()
+		return
+	case err != nil:
+		fmt.Fprintf(w, "%s: ERROR %s\n", path, err)
+		s.fail(err)
+		return
+	case !v.OK:
+		fmt.Fprintf(w, "%s: FAILED %s md5 %s, expected %s\n", path, v.Format, v.Computed, v.Expected)
+		s.fail(nil)
+		return
+	}
+	fmt.Fprintf(w, "%s: OK %s md5 %s\n", path, v.Format, v.Computed)
+	s.succeed()
+}
+
+// find prints the files whose metadata matches a filter expression.
+func find(args []string) int {
+	fs := flag.NewFlagSet("find", flag.ExitOnError)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of files to read at once")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sndtag find [-workers N] EXPR DIR...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	filter, err := sndtag.ParseFilter(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sndtag: %s\n", err)
+		return exitUsage
+	}
+	var s status
+	for _, dir := range fs.Args()[1:] {
+		err := sndtag.Walk(context.Background(), sndtag.DirStore(dir), *workers, func(result sndtag.Result) error {
+			if result.Err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", result.Object.Key, result.Err)
+				s.fail(result.Err)
+				return nil
+			}
+			s.check(result.Object.Key, result.Metadata)
+			fmt.Println(result.Object.Key)
+			return nil
+		}, sndtag.WithFilter(filter))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sndtag: %s\n", err)
+			return exitFailure
+		}
+	}
+	return s.exit()
+}
+
+// scanRecord is the JSON object scan prints for a file.
+type scanRecord struct {
+	Path     string            `json:"path"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// scan prints the metadata of the files in directories as JSON.
+func scan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	var (
+		jsonl   = fs.Bool("jsonl", false, "print one JSON object per line as files are read")
+		workers = fs.Int("workers", runtime.NumCPU(), "number of files to read at once")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sndtag scan [-jsonl] [-workers N] DIR...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+
+	var (
+		records []scanRecord
+		s       status
+	)
+	for _, dir := range fs.Args() {
+		err := sndtag.Walk(context.Background(), sndtag.DirStore(dir), *workers, func(result sndtag.Result) error {
+			record := scanRecord{Path: result.Object.Key, Metadata: result.Metadata}
+			if result.Err != nil {
+				record.Error = result.Err.Error()
+				s.fail(result.Err)
+			} else {
+				s.check(result.Object.Key, result.Metadata)
+			}
+			if *jsonl {
+				return enc.Encode(record)
+			}
+			records = append(records, record)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sndtag: %s\n", err)
+			return exitFailure
+		}
+	}
+	if *jsonl {
+		return s.exit()
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Path < records[j].Path })
+	if records == nil {
+		records = []scanRecord{}
+	}
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(records); err != nil {
+		fmt.Fprintf(os.Stderr, "sndtag: %s\n", err)
+		return exitFailure
+	}
+	return s.exit()
+}
+
+// show prints the metadata of files.
+func show(args []string) int {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	oneLine := fs.Bool("1", false, "print one line per file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sndtag show [-1] FILE...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	style := sndtag.TableStyle
+	if *oneLine {
+		style = sndtag.LineStyle
+	}
+	var s status
+	for i, path := range fs.Args() {
+		metadata, err := readFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			s.fail(err)
+			continue
+		}
+		s.check(path, metadata)
+		switch {
+		case style == sndtag.LineStyle:
+			fmt.Printf("%s: ", path)
+		case fs.NArg() > 1:
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s:\n", path)
+		}
+		if err := sndtag.Print(os.Stdout, metadata, style); err != nil {
+			fmt.Fprintf(os.Stderr, "sndtag: %s\n", err)
+			return exitFailure
+		}
+	}
+	return s.exit()
+}
+
+// readFile reads the metadata of a file.
+func readFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return sndtag.New(f)
+}
+
+// check checks that files are parsed without panicking or hanging.
+func check(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var (
+		truncate = fs.Int("truncate", 0, "number of truncated copies of each file to check")
+		timeout  = fs.Duration("timeout", 5*time.Second, "maximum time spent on a file")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sndtag check [-truncate N] [-timeout D] FILE...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	var checked, failed int
+	for _, path := range fs.Args() {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			return exitFailure
+		}
+		for i := 0; i <= *truncate; i++ {
+			// The file itself, then copies cut at evenly spaced lengths.
+			data, name := b, path
+			if i > 0 {
+				n := len(b) * i / (*truncate + 1)
+				data, name = b[:n], fmt.Sprintf("%s[:%d]", path, n)
+			}
+			checked++
+			if err := checkData(data, *timeout); err != nil {
+				fmt.Printf("%s: %s\n", name, err)
+				failed++
+			}
+		}
+	}
+	fmt.Printf("%d checked, %d failed\n", checked, failed)
+	if failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// checkData parses a file with New and NewFromBytes and returns an error
+// if either panics or takes longer than timeout.
+func checkData(b []byte, timeout time.Duration) error {
+	done := make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	go func() {
+		for _, parse := range []func() error{
+			func() error {
+				_, err := sndtag.New(bytes.NewReader(b), sndtag.WithContext(ctx))
+				return err
+			},
+			func() error {
+				_, err := sndtag.NewFromBytes(b, sndtag.WithContext(ctx))
+				return err
+			},
+		} {
+			switch err := parse(); {
+			case errors.Is(err, sndtag.ErrMalformed):
+				done <- err
+				return
+			case errors.Is(err, context.DeadlineExceeded):
+				done <- fmt.Errorf("timed out after %s", timeout)
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// revert undoes the writes recorded in a journal.
+func revert(args []string) int {
+	fs := flag.NewFlagSet("revert", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sndtag revert JOURNAL\n")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sndtag: %s\n", err)
+		return exitFailure
+	}
+	defer f.Close()
+
+	entries, err := sndtag.ReadJournal(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sndtag: %s\n", err)
+		return exitFailure
+	}
+	var s status
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := sndtag.Revert(entries[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "sndtag: %s\n", err)
+			s.fail(err)
+			continue
+		}
+		fmt.Printf("%s: reverted\n", entries[i].Path)
+		s.succeed()
+	}
+	return s.exit()
+}
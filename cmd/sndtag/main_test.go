@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRevertJournal(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.journal")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	garbage := filepath.Join(dir, "garbage.journal")
+	if err := os.WriteFile(garbage, []byte("not a journal"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(dir, "stale.journal")
+	if err := os.WriteFile(stale, []byte(`{"Path":"`+filepath.ToSlash(filepath.Join(dir, "missing.wav"))+`","WrittenSize":10}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		journal string
+		want    int
+	}{
+		{journal: filepath.Join(dir, "missing.journal"), want: exitFailure},
+		{journal: garbage, want: exitFailure},
+		{journal: empty, want: exitOK},
+		{journal: stale, want: exitFailure},
+	} {
+		if got := revert([]string{tc.journal}); got != tc.want {
+			t.Errorf("%s: got exit code %d, want %d", filepath.Base(tc.journal), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Command sndtagd is an HTTP server that reads audio metadata,
+// so that services that aren't written in Go can use the parsers.
+//
+// POST a file to /inspect, either as the request body or as the "file"
+// field of a multipart form, and the properties are returned as a JSON
+// object. The "field" query parameter can be repeated to only read some
+// properties, e.g. /inspect?field=Title&field=Artist.
+//
+// The body is parsed as it streams in, so tags at the end of a file,
+// like APEv2 and ID3v1, aren't read.
+//
+// No more than -max-size bytes, 64 MiB by default, are read from a file,
+// which is plenty for the tags and the stream properties of most files,
+// since they are at the start. Files that need more are rejected with
+// status 413, so that a client can't keep the server busy with a huge body.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/briansorahan/sndtag"
+)
+
+// defaultMaxSize is the default of -max-size. Tags are rarely more than
+// a few MiB, unless they have large pictures.
+const defaultMaxSize = 64 << 20
+
+func main() {
+	var (
+		addr    = flag.String("addr", ":8080", "address to listen on")
+		maxSize = flag.Int64("max-size", defaultMaxSize, "maximum number of bytes read from a file")
+		timeout = flag.Duration("timeout", 30*time.Second, "maximum time spent on a file")
+	)
+	flag.Parse()
+
+	s := &server{maxSize: *maxSize, timeout: *timeout}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/inspect", s.inspect)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Fatal(srv.ListenAndServe())
+}
+
+// server handles inspect requests.
+type server struct {
+	maxSize int64
+	timeout time.Duration
+}
+
+// inspect reads the metadata of the file in the request
+// and writes it to the response as JSON.
+func (s *server) inspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	body, err := fileBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts := []sndtag.Option{
+		sndtag.WithContext(ctx),
+		sndtag.WithReadLimit(s.maxSize),
+	}
+	if fields := r.URL.Query()["field"]; len(fields) > 0 {
+		opts = append(opts, sndtag.WithFields(fields...))
+	}
+	metadata, err := sndtag.New(body, opts...)
+	if err != nil {
+		writeError(w, statusCode(err), err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := sndtag.Getter(metadata).WriteJSON(w); err != nil {
+		log.Printf("writing response: %s", err)
+	}
+}
+
+// fileBody returns the file in a request, which is either the request body
+// or the "file" field of a multipart form. The form is streamed, not
+// buffered.
+func fileBody(r *http.Request) (io.Reader, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.New(`no "file" field in form`)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// statusCode returns the HTTP status code for an error returned by the parsers.
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, sndtag.ErrReadLimit):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// writeError writes an error to the response as a JSON object.
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); err != nil {
+		log.Printf("writing response: %s", err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	wav := []byte("RIFF\x24\x00\x00\x00WAVEfmt \x10\x00\x00\x00\x01\x00\x02\x00\x44\xac\x00\x00\x10\xb1\x02\x00\x04\x00\x10\x00")
+	for _, tc := range []struct {
+		name    string
+		maxSize int64
+		method  string
+		body    []byte
+		want    int
+	}{
+		{"ok", defaultMaxSize, http.MethodPost, wav, http.StatusOK},
+		{"GET", defaultMaxSize, http.MethodGet, nil, http.StatusMethodNotAllowed},
+		{"too large", 16, http.MethodPost, wav, http.StatusRequestEntityTooLarge},
+		{"unrecognized", defaultMaxSize, http.MethodPost, []byte("not audio"), http.StatusUnprocessableEntity},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &server{maxSize: tc.maxSize, timeout: time.Minute}
+			w := httptest.NewRecorder()
+			s.inspect(w, httptest.NewRequest(tc.method, "/inspect", bytes.NewReader(tc.body)))
+			if w.Code != tc.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package sndtag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A CodingHistoryEntry is a line of the CodingHistory field of a Broadcast
+// Wave bext chunk, which describes a step in the life of the audio, like
+// an A/D conversion or an encoding, in the syntax of EBU R 98, e.g.
+//
+//	A=PCM,F=48000,W=24,M=stereo,T=original
+//
+// The numbers are 0 if they are missing.
+type CodingHistoryEntry struct {
+	// Algorithm is the coding algorithm, e.g. "ANALOGUE", "PCM"
+	// or "MPEG1L2".
+	Algorithm string
+
+	// SampleRate is in Hz.
+	SampleRate int
+
+	// BitRate is in kbit/s per channel, for MPEG coding.
+	BitRate int
+
+	// WordLength is the number of bits of the samples.
+	WordLength int
+
+	// Mode is e.g. "mono", "stereo", "dual-mono" or "joint-stereo".
+	Mode string
+
+	// Text is free text, like the device or the settings that were used.
+	Text string
+}
+
+// String formats the entry in the syntax of EBU R 98, without the line break.
+func (e CodingHistoryEntry) String() string {
+	var params []string
+	for _, p := range []struct {
+		name  string
+		value string
+	}{
+		{"A", e.Algorithm},
+		{"F", formatCodingNumber(e.SampleRate)},
+		{"B", formatCodingNumber(e.BitRate)},
+		{"W", formatCodingNumber(e.WordLength)},
+		{"M", e.Mode},
+		{"T", e.Text},
+	} {
+		if p.value != "" {
+			params = append(params, p.name+"="+p.value)
+		}
+	}
+	return strings.Join(params, ",")
+}
+
+// formatCodingNumber formats a number of a coding history entry,
+// or returns "" if it is missing.
+func formatCodingNumber(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// ParseCodingHistory parses the CodingHistory field of a bext chunk, as
+// stored in KeyCodingHistory. Lines are separated by CR LF, or LF alone,
+// and empty lines are ignored. An error is returned for a line that doesn't
+// follow the syntax of EBU R 98: every parameter must be one of A, F, B,
+// W, M and T, appear once, and F, B and W must be numbers. The text of T
+// is the rest of the line, since it may hold commas.
+func ParseCodingHistory(s string) ([]CodingHistoryEntry, error) {
+	var entries []CodingHistoryEntry
+
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, "\r\x00 ")
+		if line == "" {
+			continue
+		}
+		e, err := parseCodingHistoryEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("coding history line %d: %w", i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseCodingHistoryEntry parses a line of coding history.
+func parseCodingHistoryEntry(line string) (CodingHistoryEntry, error) {
+	var (
+		e    CodingHistoryEntry
+		seen = map[string]bool{}
+	)
+	for line != "" {
+		var param string
+		if strings.HasPrefix(line, "T=") {
+			param, line = line, ""
+		} else if i := strings.IndexByte(line, ','); i >= 0 {
+			param, line = line[:i], line[i+1:]
+		} else {
+			param, line = line, ""
+		}
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			return e, fmt.Errorf("expected parameter, got %q", param)
+		}
+		if seen[name] {
+			return e, fmt.Errorf("parameter %s appears more than once", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "A":
+			e.Algorithm = value
+		case "F":
+			e.SampleRate, err = parseCodingNumber(name, value)
+		case "B":
+			e.BitRate, err = parseCodingNumber(name, value)
+		case "W":
+			e.WordLength, err = parseCodingNumber(name, value)
+		case "M":
+			e.Mode = value
+		case "T":
+			e.Text = value
+		default:
+			return e, fmt.Errorf("unknown parameter %q", name)
+		}
+		if err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// parseCodingNumber parses the value of a numeric parameter.
+func parseCodingNumber(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a number for parameter %s, got %q", name, value)
+	}
+	return n, nil
+}
+
+// setCodingHistory stores the coding history of a bext chunk as
+// KeyCodingHistory, and its entries as properties if it follows EBU R 98,
+// see KeyCodingHistoryProperty.
+func setCodingHistory(metadata map[string]string, history string) {
+	history = strings.TrimRight(history, "\x00\r\n ")
+	if history == "" {
+		return
+	}
+	metadata[KeyCodingHistory] = history
+
+	entries, err := ParseCodingHistory(history)
+	if err != nil {
+		return
+	}
+	metadata[KeyCodingHistoryEntries] = strconv.Itoa(len(entries))
+
+	for i, e := range entries {
+		fields := map[string]string{
+			"Algorithm":  e.Algorithm,
+			"SampleRate": formatCodingNumber(e.SampleRate),
+			"BitRate":    formatCodingNumber(e.BitRate),
+			"WordLength": formatCodingNumber(e.WordLength),
+			"Mode":       e.Mode,
+			"Text":       e.Text,
+		}
+		for field, value := range fields {
+			if value != "" {
+				metadata[KeyCodingHistoryProperty(i+1, field)] = value
+			}
+		}
+	}
+}
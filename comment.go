@@ -0,0 +1,89 @@
+package sndtag
+
+import "strconv"
+
+// Comment is a comment with a language and a description.
+// ID3v2 tags can contain any number of comments, but only one
+// per language and description.
+type Comment struct {
+	// Language is an ISO-639-2 language code, e.g. "eng".
+	Language    string
+	Description string
+	Text        string
+}
+
+// setComments stores comments as properties.
+// Each comment is stored as "Comment<n>Language", "Comment<n>Description"
+// and "Comment<n>Text", counting from 1, and the number of comments is
+// stored as "Comments".
+// The "Comment" property is set to the best comment for the preferred
+// language, see WithLanguage.
+func setComments(metadata map[string]string, comments []Comment, language string) {
+	if len(comments) == 0 {
+		return
+	}
+	metadata[KeyComments] = strconv.Itoa(len(comments))
+
+	for i, c := range comments {
+		metadata[KeyCommentLanguage(i+1)] = c.Language
+		metadata[KeyCommentDescription(i+1)] = c.Description
+		metadata[KeyCommentText(i+1)] = c.Text
+	}
+	if c, ok := BestComment(comments, language); ok {
+		metadata[KeyComment] = c.Text
+	}
+}
+
+// Comments returns the comments stored in a metadata map,
+// in the order they appear in the file.
+func Comments(metadata map[string]string) []Comment {
+	count := listCount(metadata, KeyComments)
+	if count == 0 {
+		return nil
+	}
+	comments := make([]Comment, 0, count)
+
+	for i := 1; i <= count; i++ {
+		comments = append(comments, Comment{
+			Language:    metadata[KeyCommentLanguage(i)],
+			Description: metadata[KeyCommentDescription(i)],
+			Text:        metadata[KeyCommentText(i)],
+		})
+	}
+	return comments
+}
+
+// LanguageTag returns the language of the comment as a BCP 47 tag,
+// see LanguageTag.
+func (c Comment) LanguageTag() string {
+	return LanguageTag(c.Language)
+}
+
+// BestComment picks the comment that best matches a preferred language,
+// given as a BCP 47 tag or an ISO 639 code, see LanguageMatches.
+// Comments with an empty description are preferred, since taggers use
+// descriptions for machine-readable data (e.g. "iTunNORM").
+// If no comment is in the preferred language then comments with an
+// unknown language ("XXX", "und" or empty) are preferred, and then
+// the first comment. The second return value is false if there are no comments.
+func BestComment(comments []Comment, language string) (Comment, bool) {
+	if len(comments) == 0 {
+		return Comment{}, false
+	}
+	best := bestLanguage(len(comments), func(i int) (string, string) {
+		return comments[i].Language, comments[i].Description
+	}, language)
+	return comments[best], true
+}
+
+// CommentsIn returns the comments in a preferred language, see
+// LanguageMatches.
+func CommentsIn(comments []Comment, language string) []Comment {
+	var matches []Comment
+	for _, c := range comments {
+		if LanguageMatches(c.Language, language) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
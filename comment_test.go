@@ -0,0 +1,36 @@
+package sndtag
+
+import "testing"
+
+func TestIndexedListCounts(t *testing.T) {
+	lists := map[string]func(map[string]string) int{
+		KeyComments:        func(m map[string]string) int { return len(Comments(m)) },
+		KeyUnsyncedLyrics:  func(m map[string]string) int { return len(UnsyncedLyrics(m)) },
+		KeyObjects:         func(m map[string]string) int { return len(EncapsulatedObjects(m)) },
+		KeyRelativeVolumes: func(m map[string]string) int { return len(RelativeVolumes(m)) },
+		KeyEqualizations:   func(m map[string]string) int { return len(Equalizations(m)) },
+	}
+	for _, tc := range []struct {
+		name  string
+		count string
+		max   int
+	}{
+		{"missing", "", 0},
+		{"invalid", "two", 0},
+		{"negative", "-1", 0},
+		{"huge", "9223372036854775807", 1},
+		{"one", "1", 1},
+	} {
+		for key, list := range lists {
+			t.Run(tc.name+"/"+key, func(t *testing.T) {
+				metadata := map[string]string{}
+				if tc.count != "" {
+					metadata[key] = tc.count
+				}
+				if got := list(metadata); got > tc.max {
+					t.Errorf("got %d items, want at most %d", got, tc.max)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package sndtag
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrDuplicateKey is wrapped by the error that New and NewFromBytes return
+// when a property is read from more than one place with different values
+// and the policy set with WithDuplicateKeys is DuplicateError.
+var ErrDuplicateKey = errors.New("conflicting values for property")
+
+// DuplicatePolicy controls which value of a property is kept when it is
+// read from more than one place, e.g. from the INAM chunk and the id3
+// chunk of a WAV file.
+type DuplicatePolicy int
+
+// Duplicate policies.
+const (
+	// DuplicateFirstWins keeps the value that was read first, which is
+	// the default. For files with several tags that is the tag read
+	// first, e.g. the ID3v2 tag rather than the APEv2 or ID3v1 tag.
+	DuplicateFirstWins DuplicatePolicy = iota
+
+	// DuplicateLastWins keeps the value that was read last.
+	DuplicateLastWins
+
+	// DuplicateError makes New and NewFromBytes fail.
+	DuplicateError
+)
+
+// A DuplicateKey is a property that was read from more than one place
+// with different values.
+type DuplicateKey struct {
+	Key     string
+	Kept    string
+	Dropped string
+}
+
+// String returns a description of the conflict.
+func (d DuplicateKey) String() string {
+	return fmt.Sprintf("%s: kept %q, dropped %q", d.Key, d.Kept, d.Dropped)
+}
+
+// WithDuplicateKeys sets the policy for properties that are read from
+// more than one place with different values, and records each conflict
+// in warnings, if it isn't nil, in the order they were found. Only the
+// single-valued tag properties, like "Title" and "Year", are checked;
+// values that are the same aren't conflicts, and neither are ID3v1
+// fields that are cut off versions of the values of other tags, see
+// KeyID3v1Truncated. The sources recorded with WithSources are those of
+// the values read first.
+func WithDuplicateKeys(policy DuplicatePolicy, warnings *[]DuplicateKey) Option {
+	return func(o *options) {
+		if warnings == nil {
+			warnings = new([]DuplicateKey)
+		}
+		o.duplicatePolicy = policy
+		o.duplicates = warnings
+	}
+}
+
+// replaces reports whether value replaces the value old of a property that
+// is already set, according to the duplicate policy, and records the
+// conflict if they differ.
+func (o options) replaces(key, old, value string) bool {
+	if o.duplicates == nil || old == value || !isDuplicateChecked(key) {
+		return false
+	}
+	d := DuplicateKey{Key: key, Kept: old, Dropped: value}
+	if o.duplicatePolicy == DuplicateLastWins {
+		d.Kept, d.Dropped = value, old
+	}
+	*o.duplicates = append(*o.duplicates, d)
+
+	return o.duplicatePolicy == DuplicateLastWins
+}
+
+// mergeTags merges the properties of src, read from a tag, into dst, read
+// from the tags before it, according to the duplicate policy.
+func (o options) mergeTags(dst, src map[string]string) {
+	keys := make([]string, 0, len(src))
+	for k := range src {
+		keys = append(keys, k)
+	}
+	// Sorted so that conflicts are recorded in a stable order.
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if old, ok := dst[k]; !ok || o.replaces(k, old, src[k]) {
+			dst[k] = src[k]
+		}
+	}
+}
+
+// startDuplicates resets the conflicts, if they were requested.
+func (o options) startDuplicates() {
+	if o.duplicates != nil {
+		*o.duplicates = nil
+	}
+}
+
+// checkDuplicates returns an error wrapping ErrDuplicateKey for the first
+// conflict if the duplicate policy is DuplicateError.
+func (o options) checkDuplicates() error {
+	if o.duplicatePolicy != DuplicateError || o.duplicates == nil || len(*o.duplicates) == 0 {
+		return nil
+	}
+	d := (*o.duplicates)[0]
+	return fmt.Errorf("%w %s: %q and %q", ErrDuplicateKey, d.Key, d.Kept, d.Dropped)
+}
+
+// isDuplicateChecked reports whether a property is one of the tag
+// properties that are checked for conflicts. Counts of indexed properties,
+// like "Comments", are left out, since they go with the indexed properties.
+func isDuplicateChecked(key string) bool {
+	if key == KeyComments || key == KeyArtworks {
+		return false
+	}
+	for _, k := range tagProperties {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package sndtag
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// charsetCandidates are the charsets that DetectCharset chooses from
+// when text isn't valid UTF-8.
+var charsetCandidates = []struct {
+	name    string
+	charset Charset
+}{
+	{"Windows-1252", CharsetWindows1252},
+	{"Windows-1251", CharsetWindows1251},
+}
+
+// commonLetters are the most frequent non-ASCII letters of the languages
+// written in the candidate charsets, in lower case.
+const commonLetters = "оеаинтсрвлкмдпуяыьгзбйчж" + "éèàáíóúüöäñçêâôß"
+
+// CharsetDetect guesses the charset of text with DetectCharset.
+// It rejects text that none of the candidates can decode.
+var CharsetDetect Charset = CharsetFunc(func(b []byte) (string, bool) {
+	name, _ := DetectCharset(b)
+	if name == "UTF-8" {
+		return string(b), true
+	}
+	for _, c := range charsetCandidates {
+		if c.name == name {
+			return c.charset.Decode(b)
+		}
+	}
+	return "", false
+})
+
+// DetectCharset guesses the charset of text that was written in an unknown
+// code page, and returns its name and how confident the guess is, from 0 to 1.
+// Text that is valid UTF-8 is assumed to be UTF-8, otherwise the text is
+// decoded with each of the built-in 8-bit charsets, and the one whose
+// letters are the most frequent and the most consistent in script and case
+// wins. Short strings give low confidence. An empty name is returned if
+// none of the charsets can decode the text.
+func DetectCharset(b []byte) (string, float64) {
+	if utf8.Valid(b) {
+		return "UTF-8", 1
+	}
+	var (
+		best         string
+		bestScore    float64
+		totalWeights float64
+	)
+	for _, c := range charsetCandidates {
+		s, ok := c.charset.Decode(b)
+		if !ok {
+			continue
+		}
+		score := plausibility(s)
+		if best == "" || score > bestScore {
+			best, bestScore = c.name, score
+		}
+		totalWeights += score * score
+	}
+	if best == "" || totalWeights == 0 {
+		return best, 0
+	}
+	return best, bestScore * bestScore / totalWeights
+}
+
+// plausibility scores how likely it is that the non-ASCII characters of s
+// were decoded with the right charset, from 0 to 1. Common letters score
+// best, other letters half as well, and symbols, letters that switch
+// between Latin and Cyrillic, and capitals in the middle of words score
+// nothing.
+func plausibility(s string) float64 {
+	var (
+		total, good float64
+		prev        rune
+	)
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			prev = r
+			continue
+		}
+		total++
+
+		switch {
+		case !unicode.IsLetter(r):
+		case unicode.IsLetter(prev) && unicode.Is(unicode.Cyrillic, prev) != unicode.Is(unicode.Cyrillic, r):
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+		case strings.ContainsRune(commonLetters, unicode.ToLower(r)):
+			good++
+		default:
+			good += 0.5
+		}
+		prev = r
+	}
+	if total == 0 {
+		return 1
+	}
+	return good / total
+}
+
+// reportCharset stores the charset that DetectCharset guesses for the raw
+// bytes of a property, how confident it is, and the raw bytes themselves,
+// so that callers can decode them differently. ASCII text isn't reported.
+func reportCharset(metadata map[string]string, key string, b []byte) {
+	b = []byte(strings.TrimRight(string(b), "\x00"))
+	if isASCII(b) {
+		return
+	}
+	name, confidence := DetectCharset(b)
+
+	metadata[KeyCharset(key)] = name
+	metadata[KeyCharsetConfidence(key)] = strconv.FormatFloat(confidence, 'f', 2, 64)
+	metadata[KeyRawText(key)] = hex.EncodeToString(b)
+}
+
+// RawText returns the raw bytes of a property whose charset was detected,
+// see WithCharsetDetection.
+func RawText(metadata map[string]string, key string) ([]byte, bool) {
+	s, ok := metadata[KeyRawText(key)]
+	if !ok {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
@@ -0,0 +1,179 @@
+package sndtag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDeviceProfile is wrapped by the error that Write returns when a tag
+// can't be written within the limits of the device profile set with
+// WithDeviceProfile.
+var ErrDeviceProfile = errors.New("tag exceeds device profile")
+
+// A DeviceProfile is a set of limits of the ID3v2 tags that a kind of
+// player reads reliably. Tags that are valid can still break embedded
+// players, e.g. car stereos that only read ID3v2.3 or that hang on large
+// pictures.
+type DeviceProfile struct {
+	// Name identifies the profile, see LookupDeviceProfile.
+	Name string
+
+	// Version is the ID3v2 version that tags are written in, 3 or 4.
+	// Existing tags are converted to it, see ConvertID3v2. 0 keeps the
+	// version of the existing tag.
+	Version uint8
+
+	// Latin1 makes text that can be encoded in ISO-8859-1 be written in
+	// it instead of UTF-16 or UTF-8.
+	Latin1 bool
+
+	// MaxFrameSize is the largest frame, in bytes. 0 means no limit.
+	MaxFrameSize int
+
+	// MaxArtworkSize is the largest image of a picture, in bytes.
+	// 0 means no limit.
+	MaxArtworkSize int
+
+	// ArtworkMIMETypes are the image types of the pictures, e.g.
+	// "image/jpeg". Any type is allowed if it is empty.
+	ArtworkMIMETypes []string
+}
+
+// DeviceProfileCarStereo is for car stereos and other embedded players:
+// ID3v2.3 tags with ISO-8859-1 text where possible, no frame larger than
+// 64 KB, and JPEG pictures of at most 500 KB.
+var DeviceProfileCarStereo = DeviceProfile{
+	Name:             "car-stereo-safe",
+	Version:          3,
+	Latin1:           true,
+	MaxFrameSize:     64 * 1024,
+	MaxArtworkSize:   500 * 1024,
+	ArtworkMIMETypes: []string{"image/jpeg"},
+}
+
+// DeviceProfiles is the list of profiles that LookupDeviceProfile finds.
+// Add to it to support other devices.
+var DeviceProfiles = []DeviceProfile{
+	DeviceProfileCarStereo,
+}
+
+// LookupDeviceProfile returns the profile with a name, e.g.
+// "car-stereo-safe", and whether there is one.
+func LookupDeviceProfile(name string) (DeviceProfile, bool) {
+	for _, p := range DeviceProfiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return DeviceProfile{}, false
+}
+
+// WithDeviceProfile makes Write enforce a device profile on the ID3v2 tags
+// it writes, including the id3 chunk of WAV files, which stays ID3v2.3.
+// Tags are converted to the version of the profile and their text is
+// re-encoded. An error wrapping ErrDeviceProfile is returned for a frame
+// that the version can't hold, or a frame or a picture that exceeds the
+// limits, e.g. so that a sync tool can strip or shrink the artwork and
+// try again.
+func WithDeviceProfile(p DeviceProfile) Option {
+	return func(o *options) {
+		o.device = &p
+	}
+}
+
+// convert converts tags to the version of the profile. It returns an
+// error wrapping ErrDeviceProfile for frames that the version can't hold,
+// rather than dropping them.
+func (p *DeviceProfile) convert(tags []*id3v2) ([]*id3v2, error) {
+	if p.Version == 0 {
+		return tags, nil
+	}
+	converted := make([]*id3v2, len(tags))
+	for i, tag := range tags {
+		converted[i] = tag
+		if tag.header.Major != p.Version {
+			var dropped []string
+			converted[i], dropped = tag.convert(p.Version)
+			if len(dropped) > 0 {
+				return nil, fmt.Errorf("%w %s: frames %s can not be converted to ID3v2.%d", ErrDeviceProfile, p.Name, strings.Join(dropped, ", "), p.Version)
+			}
+			converted[i].padding = tag.padding
+		}
+	}
+	return converted, nil
+}
+
+// enforce re-encodes the text of a tag in ISO-8859-1 if the profile
+// asks for it, and checks the frames against the limits of the profile.
+func (p *DeviceProfile) enforce(t *id3v2) error {
+	for i, frame := range t.frames {
+		if p.Latin1 {
+			if data, ok := t.latin1(frame); ok {
+				t.frames[i] = id3v2Frame{ID: frame.ID, Data: data}
+				frame = t.frames[i]
+			}
+		}
+		if p.MaxFrameSize > 0 && len(frame.Data) > p.MaxFrameSize {
+			return fmt.Errorf("%w %s: frame %s is %d bytes, the limit is %d", ErrDeviceProfile, p.Name, frame.ID, len(frame.Data), p.MaxFrameSize)
+		}
+		if frame.ID != ID3v2FramePicture {
+			continue
+		}
+		data := t.content(frame)
+		if data == nil {
+			continue
+		}
+		a, _ := decodePicture(data, nil)
+		if p.MaxArtworkSize > 0 && a.Size > int64(p.MaxArtworkSize) {
+			return fmt.Errorf("%w %s: picture is %d bytes, the limit is %d", ErrDeviceProfile, p.Name, a.Size, p.MaxArtworkSize)
+		}
+		if len(p.ArtworkMIMETypes) > 0 && !containsFold(p.ArtworkMIMETypes, a.MIMEType) {
+			return fmt.Errorf("%w %s: picture is %s, expected %s", ErrDeviceProfile, p.Name, a.MIMEType, strings.Join(p.ArtworkMIMETypes, " or "))
+		}
+	}
+	return nil
+}
+
+// latin1 re-encodes the text of a text frame, a TXXX frame or a COMM
+// frame in ISO-8859-1. It returns false for other frames, for text that
+// is already in ISO-8859-1 and for text that can't be encoded in it.
+func (t *id3v2) latin1(frame id3v2Frame) ([]byte, bool) {
+	if !strings.HasPrefix(frame.ID, "T") && frame.ID != ID3v2FrameComment {
+		return nil, false
+	}
+	data := t.content(frame)
+	if len(data) == 0 || data[0] == 0 {
+		return nil, false
+	}
+	latin1 := &id3v2{header: id3v2Header{Major: 3}}
+
+	switch frame.ID {
+	case ID3v2FrameComment:
+		c := decodeComment(data, nil)
+		if _, ok := encodeLatin1(c.Description + c.Text); ok {
+			return latin1.encodeComment(c), true
+		}
+	case ID3v2FrameUserText:
+		desc, value := decodeUserText(data, nil)
+		if _, ok := encodeLatin1(desc + value); ok {
+			return latin1.encodeUserText(desc, value), true
+		}
+	default:
+		text := decodeTextFrame(data, nil)
+		if _, ok := encodeLatin1(text); ok {
+			return latin1.encodeTextFrame(text), true
+		}
+	}
+	return nil, false
+}
+
+// containsFold reports whether a list has a string, regardless of case.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// testFrame encodes an ID3v2.3 frame, or an ID3v2.4 frame with data
+// below 128 bytes.
+func testFrame(id string, data []byte) []byte {
+	b := []byte(id)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, 0, 0)
+	return append(b, data...)
+}
+
+// testPictureFrame encodes an APIC frame of a front cover.
+func testPictureFrame(mimeType string, size int) []byte {
+	data := append([]byte{0}, mimeType...)
+	data = append(data, 0, 3, 0)
+	data = append(data, make([]byte, size)...)
+	return testFrame(ID3v2FramePicture, data)
+}
+
+func TestWithDeviceProfile(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		file     []byte
+		tags     TagSet
+		err      bool
+		encoding byte
+		want     map[string]string
+	}{
+		{
+			name:     "v2.4 converted with latin1 text",
+			file:     testMP3(testID3v2(4, testFrame(ID3v2FrameTitle, append([]byte{3}, "Café"...)))),
+			tags:     TagSet{KeyArtist: "Artist"},
+			encoding: 0,
+			want:     map[string]string{KeyTitle: "Café", KeyArtist: "Artist", KeyID3v2Version: "2.3.0"},
+		},
+		{
+			name:     "text that isn't latin1",
+			file:     testMP3(testID3v2(3)),
+			tags:     TagSet{KeyTitle: "日本"},
+			encoding: 1,
+			want:     map[string]string{KeyTitle: "日本"},
+		},
+		{
+			name: "v2.4 only frame",
+			file: testMP3(testID3v2(4, testTextFrame(ID3v2FrameTitle, "Title"), testTextFrame(ID3v2FrameReleaseTime, "2020-01-02"))),
+			err:  true,
+		},
+		{
+			name: "png picture",
+			file: testMP3(testID3v2(3, testPictureFrame("image/png", 16))),
+			err:  true,
+		},
+		{
+			name: "large picture",
+			file: testMP3(testID3v2(3, testPictureFrame("image/jpeg", 600*1024))),
+			err:  true,
+		},
+		{
+			name: "large frame",
+			file: testMP3(testID3v2(3)),
+			tags: TagSet{KeyComment: string(bytes.Repeat([]byte("a"), 70*1024))},
+			err:  true,
+		},
+		{
+			name: "jpeg picture",
+			file: testMP3(testID3v2(3, testPictureFrame("image/jpeg", 16))),
+			tags: TagSet{KeyTitle: "Title"},
+			want: map[string]string{KeyTitle: "Title"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Write(&out, bytes.NewReader(tc.file), tc.tags, WithDeviceProfile(DeviceProfileCarStereo))
+			if tc.err {
+				if !errors.Is(err, ErrDeviceProfile) {
+					t.Fatalf("got %v, want an error wrapping ErrDeviceProfile", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := out.Bytes()
+			if b[3] != 3 {
+				t.Errorf("got ID3v2.%d, want ID3v2.3", b[3])
+			}
+			if i := bytes.Index(b, []byte(ID3v2FrameTitle)); i < 0 || b[i+10] != tc.encoding {
+				t.Errorf("TIT2 is not in encoding %d", tc.encoding)
+			}
+			metadata, err := NewFromBytes(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tc.want {
+				if got := metadata[key]; got != want {
+					t.Errorf("%s: got %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupDeviceProfile(t *testing.T) {
+	if p, ok := LookupDeviceProfile("car-stereo-safe"); !ok || p.Version != 3 {
+		t.Errorf("got %+v, %t", p, ok)
+	}
+	if _, ok := LookupDeviceProfile("phone"); ok {
+		t.Error("found an unknown profile")
+	}
+}
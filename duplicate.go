@@ -0,0 +1,155 @@
+package sndtag
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// AudioHash returns the hex-encoded SHA-256 of the audio data of a file,
+// so that files with the same audio but different tags have the same hash.
+// ID3v2 tags at the start of the file and ID3v1 and APEv2 tags at the end
+// are skipped, and only the data chunk of WAV files and the frames of FLAC
+// files are hashed. Other files are hashed as a whole, apart from those tags.
+func AudioHash(rs io.ReadSeeker) (string, error) {
+	return AudioHashWith(rs, sha256.New())
+}
+
+// AudioHashWith is like AudioHash but hashes the audio data with h, e.g.
+// a faster non-cryptographic hash for deduplicating large libraries.
+// h is reset before it is used.
+func AudioHashWith(rs io.ReadSeeker, h hash.Hash) (string, error) {
+	start, end, err := AudioRange(rs)
+	if err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return "", err
+	}
+	h.Reset()
+
+	if _, err := io.CopyN(h, rs, end-start); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// TagDigest returns the hex-encoded SHA-256 of the regions of a file that
+// are not its audio data, see AudioHash, so that sync tools can tell that
+// the tags of a file changed without comparing whole files or parsing
+// them. Those are the ID3v2, APEv2 and ID3v1 tags, and the other chunks of
+// WAV files and the metadata blocks of FLAC files. The digest changes with
+// any byte of them, including padding, and not with the audio data.
+func TagDigest(rs io.ReadSeeker) (string, error) {
+	start, end, err := AudioRange(rs)
+	if err != nil {
+		return "", err
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+
+	for _, region := range [][2]int64{{0, start}, {end, size}} {
+		// The length of each region is hashed too, so that bytes
+		// that move from one region to the other change the digest.
+		length := region[1] - region[0]
+		if err := binary.Write(h, binary.BigEndian, length); err != nil {
+			return "", err
+		}
+		if _, err := rs.Seek(region[0], io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(h, rs, length); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// wavDataRange returns the offsets of the start and the end of the data
+// chunk of a WAV file, given the offsets of its first subchunk and the end
+// of the file. The whole range is returned if there is no data chunk.
+func wavDataRange(rs io.ReadSeeker, offset, end int64) (int64, int64, error) {
+	start := offset
+	header := make([]byte, 8)
+
+	for offset+8 <= end {
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(rs, header); err != nil {
+			return 0, 0, err
+		}
+		length := int64(binary.LittleEndian.Uint32(header[4:8]))
+
+		if string(header[:4]) == "data" {
+			if offset+8+length > end {
+				length = end - offset - 8
+			}
+			return offset + 8, offset + 8 + length, nil
+		}
+		offset += 8 + length + length%2
+	}
+	return start, end, nil
+}
+
+// TagKey returns a key made of the artist and the title of a file,
+// normalized so that differences in case, punctuation and spacing don't
+// matter, e.g. "the beatles|let it be". It returns an empty string if
+// the file doesn't have a title.
+func TagKey(metadata map[string]string) string {
+	title := normalizeTag(metadata[KeyTitle])
+	if title == "" {
+		return ""
+	}
+	return normalizeTag(metadata[KeyArtist]) + "|" + title
+}
+
+// normalizeTag lower-cases a tag value, drops punctuation
+// and collapses runs of white space.
+func normalizeTag(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// GroupDuplicates groups results by the key that key returns for them, and
+// returns the groups that have more than one result, i.e. the duplicates.
+// Results with an empty key or an error are left out. Groups are sorted by
+// key, and the results in a group keep their order.
+func GroupDuplicates(results []Result, key func(Result) string) [][]Result {
+	var (
+		groups = map[string][]Result{}
+		keys   []string
+	)
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		k := key(result)
+		if k == "" {
+			continue
+		}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], result)
+	}
+	sort.Strings(keys)
+
+	var duplicates [][]Result
+	for _, k := range keys {
+		if len(groups[k]) > 1 {
+			duplicates = append(duplicates, groups[k])
+		}
+	}
+	return duplicates
+}
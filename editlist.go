@@ -0,0 +1,391 @@
+package sndtag
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// An EditEvent is an event of an edit decision list, which places part
+// of a source file at a point on the timeline of a project. Timecodes are
+// kept as they are written in the list.
+type EditEvent struct {
+	// Number is the number of the event in the list.
+	Number int
+
+	// Source is the file the event plays: the clip name or the reel name
+	// for CMX 3600 EDLs, and the URL of the source file for AES31 ADLs.
+	Source string
+
+	// Track is the track or channels of the event, e.g. "A1" or "1~2".
+	Track string
+
+	// SourceIn and SourceOut are the range of the source that is played,
+	// and RecordIn and RecordOut are where it is placed on the timeline.
+	// ADLs don't have a source out timecode.
+	SourceIn  string
+	SourceOut string
+	RecordIn  string
+	RecordOut string
+}
+
+// ParseEDL parses a CMX 3600 edit decision list. The source of an event is
+// the name in a "* FROM CLIP NAME:" or "* SOURCE FILE:" comment after it,
+// or its reel name if there is no such comment.
+func ParseEDL(r io.Reader) ([]EditEvent, error) {
+	var (
+		events  []EditEvent
+		scanner = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "*") && len(events) > 0 {
+			comment := strings.TrimSpace(strings.TrimPrefix(line, "*"))
+			for _, prefix := range []string{"FROM CLIP NAME:", "SOURCE FILE:"} {
+				if strings.HasPrefix(strings.ToUpper(comment), prefix) {
+					events[len(events)-1].Source = strings.TrimSpace(comment[len(prefix):])
+				}
+			}
+			continue
+		}
+
+		// An event is its number, reel, track, transition, the duration
+		// of dissolves and wipes, and the source and record timecodes.
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		timecodes := fields[len(fields)-4:]
+		events = append(events, EditEvent{
+			Number:    n,
+			Source:    fields[1],
+			Track:     fields[2],
+			SourceIn:  timecodes[0],
+			SourceOut: timecodes[1],
+			RecordIn:  timecodes[2],
+			RecordOut: timecodes[3],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ParseADL parses the source index and the event list of an AES31-3 audio
+// decision list. Only cut events, which are most of the events of an
+// ADL, are returned; fades and gain changes are ignored.
+func ParseADL(r io.Reader) ([]EditEvent, error) {
+	var (
+		events  []EditEvent
+		sources = map[string]string{}
+		section string
+		scanner = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") {
+			section = strings.Trim(line, "<>/")
+			continue
+		}
+		fields, err := splitQuoted(line)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case section == "SOURCE_INDEX" && len(fields) >= 4 && fields[0] == "(Index)":
+			// An index entry is its number, the type of source
+			// and the URL of the source file.
+			sources[fields[1]] = fields[3]
+
+		case section == "EVENT_LIST" && len(fields) >= 10 && fields[0] == "(Entry)" && fields[2] == "(Cut)":
+			// A cut is its number, the source type, the source index,
+			// the source and destination channels, the source in
+			// timecode and the destination in and out timecodes.
+			n, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid ADL entry number %q", fields[1])
+			}
+			events = append(events, EditEvent{
+				Number:    n,
+				Source:    sources[fields[4]],
+				Track:     fields[6],
+				SourceIn:  fields[7],
+				RecordIn:  fields[8],
+				RecordOut: fields[9],
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// splitQuoted splits a line of an ADL or a CUE sheet into fields
+// separated by white space, unquoting the quoted ones.
+func splitQuoted(line string) ([]string, error) {
+	var fields []string
+
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] != '"' {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			fields = append(fields, line[:end])
+			line = line[end:]
+			continue
+		}
+		end := strings.IndexByte(line[1:], '"')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string in line %q", line)
+		}
+		fields = append(fields, line[1:end+1])
+		line = line[end+2:]
+	}
+	return fields, nil
+}
+
+// editListFormat returns the format of an edit list from the extension
+// of its file name, or an empty string if it isn't an edit list.
+func editListFormat(key string) string {
+	switch strings.ToLower(path.Ext(filepath.ToSlash(key))) {
+	case ".edl":
+		return "EDL"
+	case ".adl":
+		return "ADL"
+	}
+	return ""
+}
+
+// parseEditList parses an edit list in the given format.
+func parseEditList(r io.Reader, format string) ([]EditEvent, error) {
+	if format == "ADL" {
+		return ParseADL(r)
+	}
+	return ParseEDL(r)
+}
+
+// WithEditLists makes Walk read the CMX 3600 EDLs (".edl") and AES31 ADLs
+// (".adl") it finds, and link the files they reference, like the BWF files
+// of a post-production project, to their events. The events of an edit
+// list are stored as its properties, see KeyEditProperty, and the events
+// that reference a file in the same directory as the edit list are added
+// to the properties of that file, with the key of the edit list as
+// "Edit<n>List". Files are matched by their name, with or without their
+// extension, regardless of case.
+//
+// Files are only linked to the edit lists next to them in stores that
+// can list a directory, which are the ones returned by DirStore and
+// FSStore and the archives Walk descends into.
+func WithEditLists() Option {
+	return func(o *options) {
+		o.editLists = true
+	}
+}
+
+// withEditIndex sets the index of the edit lists of the store being walked.
+func withEditIndex(index *editIndex) Option {
+	return func(o *options) {
+		o.editIndex = index
+	}
+}
+
+// A dirLister is a Store that can list the files in a directory.
+type dirLister interface {
+	// dir returns the directory of the file with the given key.
+	dir(key string) string
+
+	// listDir returns the files in a directory.
+	listDir(dir string) ([]Object, error)
+}
+
+// dir returns the directory of a file.
+func (d dirStore) dir(key string) string {
+	return filepath.Dir(key)
+}
+
+// listDir returns the regular files in a directory.
+func (d dirStore) listDir(dir string) ([]Object, error) {
+	entries, err := os.ReadDir(osPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			objects = append(objects, Object{Key: filepath.Join(dir, entry.Name())})
+		}
+	}
+	return objects, nil
+}
+
+// dir returns the directory of a file.
+func (s fsStore) dir(key string) string {
+	return path.Dir(key)
+}
+
+// listDir returns the regular files in a directory.
+func (s fsStore) listDir(dir string) ([]Object, error) {
+	entries, err := fs.ReadDir(s.fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			objects = append(objects, Object{Key: path.Join(dir, entry.Name())})
+		}
+	}
+	return objects, nil
+}
+
+// editIndex holds the edit lists of the directories of a store,
+// which are read the first time a file in the directory is read.
+type editIndex struct {
+	store  Store
+	lister dirLister
+
+	mu   sync.Mutex
+	dirs map[string]*editDir
+}
+
+// editDir holds the edit lists in a directory.
+type editDir struct {
+	once  sync.Once
+	lists []editList
+}
+
+// editList is an edit list and its key.
+type editList struct {
+	key    string
+	events []EditEvent
+}
+
+// newEditIndex returns an editIndex for the files in a store, or nil
+// if the store can't list directories.
+func newEditIndex(store Store) *editIndex {
+	lister, ok := store.(dirLister)
+	if !ok {
+		return nil
+	}
+	return &editIndex{store: store, lister: lister, dirs: map[string]*editDir{}}
+}
+
+// lists returns the edit lists in the directory of a file.
+// Edit lists that can't be read are left out.
+func (x *editIndex) lists(ctx context.Context, key string) []editList {
+	dir := x.lister.dir(key)
+
+	x.mu.Lock()
+	d, ok := x.dirs[dir]
+	if !ok {
+		d = &editDir{}
+		x.dirs[dir] = d
+	}
+	x.mu.Unlock()
+
+	d.once.Do(func() {
+		objects, err := x.lister.listDir(dir)
+		if err != nil {
+			return
+		}
+		for _, obj := range objects {
+			format := editListFormat(obj.Key)
+			if format == "" {
+				continue
+			}
+			events, err := readEditList(ctx, x.store, obj, format)
+			if err != nil {
+				continue
+			}
+			d.lists = append(d.lists, editList{key: obj.Key, events: events})
+		}
+	})
+	return d.lists
+}
+
+// readEditList opens an edit list in a store and parses it.
+func readEditList(ctx context.Context, store Store, obj Object, format string) ([]EditEvent, error) {
+	rc, err := store.Open(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return parseEditList(rc, format)
+}
+
+// link adds the events of the edit lists next to a file that reference
+// it to its properties.
+func (x *editIndex) link(ctx context.Context, key string, metadata map[string]string) {
+	name := strings.ToLower(baseName(key))
+	n, _ := strconv.Atoi(metadata[KeyEdits])
+
+	for _, list := range x.lists(ctx, key) {
+		for _, event := range list.events {
+			source := strings.ToLower(baseName(event.Source))
+			if source != name && source != strings.TrimSuffix(name, path.Ext(name)) {
+				continue
+			}
+			n++
+			metadata[KeyEditProperty(n, "List")] = list.key
+			setEditEvent(metadata, n, event)
+		}
+	}
+	if n > 0 {
+		metadata[KeyEdits] = strconv.Itoa(n)
+	}
+}
+
+// editListMetadata returns the properties of an edit list.
+func editListMetadata(format string, events []EditEvent) map[string]string {
+	metadata := map[string]string{
+		KeyEditListFormat: format,
+		KeyEdits:          strconv.Itoa(len(events)),
+	}
+	for i, event := range events {
+		metadata[KeyEditProperty(i+1, "Source")] = event.Source
+		setEditEvent(metadata, i+1, event)
+	}
+	return metadata
+}
+
+// setEditEvent stores the fields of the nth edit event as properties,
+// apart from its source.
+func setEditEvent(metadata map[string]string, n int, event EditEvent) {
+	fields := map[string]string{
+		"Number":    strconv.Itoa(event.Number),
+		"Track":     event.Track,
+		"SourceIn":  event.SourceIn,
+		"SourceOut": event.SourceOut,
+		"RecordIn":  event.RecordIn,
+		"RecordOut": event.RecordOut,
+	}
+	for field, value := range fields {
+		if value != "" {
+			metadata[KeyEditProperty(n, field)] = value
+		}
+	}
+}
+
+// baseName returns the last element of a path or URL,
+// which may use slashes or backslashes.
+func baseName(p string) string {
+	return p[strings.LastIndexAny(p, `/\`)+1:]
+}
@@ -0,0 +1,54 @@
+// Command artwork extracts the front cover of an audio file, or its first
+// picture if it has no front cover, next to it as "cover.jpg" or
+// "cover.png", or to the file given with -o.
+//
+//	go run ./examples/artwork song.m4a
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/briansorahan/sndtag"
+)
+
+func main() {
+	out := flag.String("o", "", "file to write the picture to")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: artwork [-o FILE] AUDIOFILE")
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	var picture bytes.Buffer
+	metadata, err := sndtag.New(f, sndtag.WithArtwork(&picture))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if picture.Len() == 0 {
+		log.Fatalf("%s has no artwork", path)
+	}
+	if *out == "" {
+		ext := ".jpg"
+		if metadata[sndtag.KeyArtworkMIMEType(1)] == "image/png" {
+			ext = ".png"
+		}
+		*out = filepath.Join(filepath.Dir(path), "cover"+ext)
+	}
+	if err := os.WriteFile(*out, picture.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote %d bytes to %s\n", picture.Len(), *out)
+}
@@ -0,0 +1,75 @@
+// Command copytags copies the descriptive properties of one audio file to
+// another, e.g. from an MP3 to the WAV it was made from. Properties that
+// the destination can't hold are skipped.
+//
+//	go run ./examples/copytags song.mp3 song.wav
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/briansorahan/sndtag"
+)
+
+// copied are the properties that are copied.
+var copied = []string{
+	sndtag.KeyTitle,
+	sndtag.KeyArtist,
+	sndtag.KeyAlbum,
+	sndtag.KeyAlbumArtist,
+	sndtag.KeyTrack,
+	sndtag.KeyYear,
+	sndtag.KeyGenre,
+	sndtag.KeyComment,
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: copytags SRC DST")
+		os.Exit(2)
+	}
+	src, dst := os.Args[1], os.Args[2]
+
+	f, err := os.Open(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	metadata, err := sndtag.New(f, sndtag.WithFields(copied...))
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Write fails on properties the format doesn't have, so try each
+	// property without writing anything, then write the ones that work.
+	tags := sndtag.TagSet{}
+	for _, key := range copied {
+		value, ok := metadata[key]
+		if !ok {
+			continue
+		}
+		if err := tryWrite(dst, sndtag.TagSet{key: value}); err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %s\n", key, err)
+			continue
+		}
+		tags[key] = value
+	}
+	if err := sndtag.WriteFile(dst, tags); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("copied %d properties to %s\n", len(tags), dst)
+}
+
+// tryWrite writes tags to a copy of the file at path that is thrown away.
+func tryWrite(path string, tags sndtag.TagSet) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return sndtag.Write(io.Discard, f, tags)
+}
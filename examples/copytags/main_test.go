@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/briansorahan/sndtag"
+)
+
+func TestCopyTags(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "song.wav")
+	b, err := os.ReadFile(filepath.Join("..", "..", "testdata", "interop", "missing-pad.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = []string{"copytags", filepath.Join("..", "..", "testdata", "interop", "id3v23.mp3"), dst}
+	main()
+
+	f, err := os.Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	metadata, err := sndtag.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// WAV files have no album artist, so it is skipped.
+	for key, want := range map[string]string{
+		sndtag.KeyTitle:       "Interop Title",
+		sndtag.KeyArtist:      "Interop Artist",
+		sndtag.KeyTrack:       "3/12",
+		sndtag.KeyAlbumArtist: "",
+	} {
+		if got := metadata[key]; got != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Command printtags prints the properties of audio files as a table,
+// or one line per file with -1.
+//
+//	go run ./examples/printtags song.mp3 take1.wav
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/briansorahan/sndtag"
+)
+
+func main() {
+	oneLine := flag.Bool("1", false, "print one line per file")
+	flag.Parse()
+
+	style := sndtag.TableStyle
+	if *oneLine {
+		style = sndtag.LineStyle
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		metadata, err := sndtag.New(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %s", path, err)
+		}
+		if !*oneLine {
+			fmt.Printf("%s:\n", path)
+		}
+		if err := sndtag.Print(os.Stdout, metadata, style); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Command rename renames the audio files in a directory to
+// "Artist - Title" with their extension, e.g. to tidy up a download
+// folder. Files without an artist or a title are left alone, and so are
+// files whose new name is taken. With -n it only prints what it would do,
+// and -filter only renames the files that match a filter expression.
+//
+//	go run ./examples/rename -n -filter 'genre == "Jazz"' ~/Downloads
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/briansorahan/sndtag"
+)
+
+func main() {
+	var (
+		dryRun = flag.Bool("n", false, "print the renames without doing them")
+		expr   = flag.String("filter", "", "only rename files that match a filter expression")
+	)
+	flag.Parse()
+
+	var opts []sndtag.Option
+	if *expr != "" {
+		filter, err := sndtag.ParseFilter(*expr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, sndtag.WithFilter(filter))
+	}
+	for _, dir := range flag.Args() {
+		err := sndtag.Walk(context.Background(), sndtag.DirStore(dir), 4, func(result sndtag.Result) error {
+			if result.Err != nil {
+				// Not an audio file, or a broken one.
+				return nil
+			}
+			return rename(result.Object.Key, result.Metadata, *dryRun)
+		}, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// rename renames a file to "Artist - Title" with its extension.
+func rename(path string, metadata map[string]string, dryRun bool) error {
+	artist, title := metadata[sndtag.KeyArtist], metadata[sndtag.KeyTitle]
+	if artist == "" || title == "" {
+		return nil
+	}
+	name := cleanName(artist+" - "+title) + strings.ToLower(filepath.Ext(path))
+	newPath := filepath.Join(filepath.Dir(path), name)
+	if newPath == path {
+		return nil
+	}
+	if _, err := os.Stat(newPath); err == nil {
+		fmt.Printf("skipping %s: %s exists\n", path, name)
+		return nil
+	}
+	fmt.Printf("%s -> %s\n", path, name)
+	if dryRun {
+		return nil
+	}
+	return os.Rename(path, newPath)
+}
+
+// cleanName replaces the characters that aren't allowed in file names
+// on common file systems.
+func cleanName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/briansorahan/sndtag"
+)
+
+func TestCleanName(t *testing.T) {
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"Artist - Title", "Artist - Title"},
+		{"AC/DC - Back In Black", "AC_DC - Back In Black"},
+		{`What? - "Quotes" <and> *stars*`, `What_ - _Quotes_ _and_ _stars_`},
+		{"Tab\tand\nnewline", "Tab_and_newline"},
+		{"Grüße - 世界", "Grüße - 世界"},
+	} {
+		if got := cleanName(tc.name); got != tc.want {
+			t.Errorf("cleanName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		metadata map[string]string
+		taken    bool
+		dryRun   bool
+		want     string
+	}{
+		{"rename", map[string]string{sndtag.KeyArtist: "Artist", sndtag.KeyTitle: "Title"}, false, false, "Artist - Title.wav"},
+		{"dry run", map[string]string{sndtag.KeyArtist: "Artist", sndtag.KeyTitle: "Title"}, false, true, "song.WAV"},
+		{"no title", map[string]string{sndtag.KeyArtist: "Artist"}, false, false, "song.WAV"},
+		{"taken", map[string]string{sndtag.KeyArtist: "Artist", sndtag.KeyTitle: "Title"}, true, false, "song.WAV"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "song.WAV")
+			if err := os.WriteFile(path, []byte("song"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tc.taken {
+				if err := os.WriteFile(filepath.Join(dir, "Artist - Title.wav"), []byte("other"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := rename(path, tc.metadata, tc.dryRun); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(filepath.Join(dir, tc.want))
+			if err != nil || string(b) != "song" {
+				t.Errorf("%s: got %q, %v", tc.want, b, err)
+			}
+		})
+	}
+}
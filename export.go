@@ -0,0 +1,101 @@
+package sndtag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strconv"
+	"unicode"
+)
+
+// keys returns the keys of the properties that have a value, sorted,
+// so that exported documents are stable.
+func (g Getter) keys() []string {
+	keys := make([]string, 0, len(g))
+
+	for k, v := range g {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// WriteJSON writes the properties to w as a JSON object, sorted by key.
+// Properties with an empty value are omitted.
+func (g Getter) WriteJSON(w io.Writer) error {
+	m := make(map[string]string, len(g))
+
+	for _, k := range g.keys() {
+		m[k] = g[k]
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+
+	return enc.Encode(m)
+}
+
+// WriteXML writes the properties to w as an XML document, sorted by key.
+// Each property is an element named after its key inside a metadata
+// element, e.g. <Title>Song</Title>, which is easy to map to schemas like
+// EBUCore. Keys that aren't valid XML names are written as
+// <Property name="key">. Properties with an empty value are omitted.
+func (g Getter) WriteXML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	if _, err := bw.WriteString(xml.Header + "<metadata>\n"); err != nil {
+		return err
+	}
+	for _, k := range g.keys() {
+		start, end := "<"+k+">", "</"+k+">"
+		if !isXMLName(k) {
+			var name bytes.Buffer
+			if err := xml.EscapeText(&name, []byte(k)); err != nil {
+				return err
+			}
+			start, end = `<Property name="`+name.String()+`">`, "</Property>"
+		}
+		bw.WriteString("  " + start)
+
+		if err := xml.EscapeText(bw, []byte(g[k])); err != nil {
+			return err
+		}
+		bw.WriteString(end + "\n")
+	}
+	bw.WriteString("</metadata>\n")
+
+	return bw.Flush()
+}
+
+// WriteYAML writes the properties to w as a YAML mapping, sorted by key.
+// Values are always double-quoted so that they are read back as strings.
+// Properties with an empty value are omitted.
+func (g Getter) WriteYAML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, k := range g.keys() {
+		key := k
+		if !isXMLName(k) {
+			key = strconv.Quote(k)
+		}
+		bw.WriteString(key + ": " + strconv.Quote(g[k]) + "\n")
+	}
+	return bw.Flush()
+}
+
+// isXMLName reports whether s is made of ASCII letters and digits
+// and starts with a letter, which is true for all the keys we use.
+func isXMLName(s string) bool {
+	for i, r := range s {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,61 @@
+package sndtag
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// ExtractAudio copies the audio data of a file from src to dst without
+// its tags: the payload of the data chunk of WAV files, the frames of
+// FLAC files, and for other files, like MP3 files, everything but the
+// ID3v2 tags at the start and the APEv2 and ID3v1 tags at the end.
+// See AudioRange. It returns the number of bytes copied.
+//
+// The tags at the end can only be found by seeking, so if src isn't an
+// io.ReadSeeker it is read into memory.
+func ExtractAudio(dst io.Writer, src io.Reader) (int64, error) {
+	rs, ok := src.(io.ReadSeeker)
+	if !ok {
+		b, err := ioutil.ReadAll(src)
+		if err != nil {
+			return 0, err
+		}
+		rs = bytes.NewReader(b)
+	}
+	start, end, err := AudioRange(rs)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.CopyN(dst, rs, end-start)
+}
+
+// flacFramesOffset returns the offset of the first frame of a FLAC
+// stream, given the offset of its first metadata block, i.e. the one
+// after the "fLaC" signature, and the end of the stream.
+func flacFramesOffset(rs io.ReadSeeker, offset, end int64) (int64, error) {
+	header := make([]byte, 4)
+
+	for offset+4 <= end {
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(rs, header); err != nil {
+			return 0, err
+		}
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		offset += 4 + length
+
+		// The first bit is set for the last metadata block.
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+	if offset > end {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return offset, nil
+}
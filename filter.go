@@ -0,0 +1,433 @@
+package sndtag
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A Filter selects files by their properties, see ParseFilter.
+type Filter struct {
+	expr filterExpr
+}
+
+// ParseFilter parses a filter expression, e.g.
+//
+//	genre == "Jazz" && year >= 1960 && !has(artwork)
+//
+// Expressions compare properties, which are named regardless of case, to
+// strings and numbers with ==, !=, <, <=, > and >=, or match them against
+// regular expressions with =~. Underscores in names are ignored as well, so
+// that album_artist works whatever the key style. They can be combined with &&, || and !, and
+// grouped with parentheses. A property that isn't set is the empty string.
+//
+// Values are compared as numbers if both sides start with a number, which
+// is the number that is compared, e.g. a year of "2001-05-31" is 2001 and
+// a track of "3/12" is 3. Otherwise they are compared as strings.
+//
+// has(name) is true if the property, or a property that starts with name,
+// is set, e.g. has(artwork) is true for files with "Artwork1MIMEType".
+// A property on its own is true if it is set to a value other than "",
+// "0" or "false".
+func ParseFilter(s string) (*Filter, error) {
+	tokens, err := lexFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("filter: unexpected %s at offset %d", t, t.offset)
+	}
+	return &Filter{expr: expr}, nil
+}
+
+// Match reports whether a file with the given properties matches the filter.
+func (f *Filter) Match(metadata map[string]string) bool {
+	return f.expr.eval(newFilterProperties(metadata))
+}
+
+// WithFilter makes Walk only pass the files that match f to its callback.
+// Files that can't be opened or parsed are still passed with their error.
+func WithFilter(f *Filter) Option {
+	return func(o *options) {
+		o.filter = f
+	}
+}
+
+// filterProperties holds the properties of a file by their folded name.
+type filterProperties map[string]string
+
+// lookup returns the value of a property, named regardless of case.
+func (p filterProperties) lookup(name string) string {
+	return p[foldFilterName(name)]
+}
+
+// newFilterProperties returns the properties of a file by their folded name.
+func newFilterProperties(metadata map[string]string) filterProperties {
+	p := make(filterProperties, len(metadata))
+	for k, v := range metadata {
+		p[foldFilterName(k)] = v
+	}
+	return p
+}
+
+// foldFilterName returns a property name in lower case without underscores.
+func foldFilterName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// filterExpr is a node of a parsed filter expression.
+type filterExpr interface {
+	eval(p filterProperties) bool
+}
+
+// filterAnd is true if both expressions are.
+type filterAnd struct{ x, y filterExpr }
+
+func (e filterAnd) eval(p filterProperties) bool { return e.x.eval(p) && e.y.eval(p) }
+
+// filterOr is true if either expression is.
+type filterOr struct{ x, y filterExpr }
+
+func (e filterOr) eval(p filterProperties) bool { return e.x.eval(p) || e.y.eval(p) }
+
+// filterNot is true if the expression isn't.
+type filterNot struct{ x filterExpr }
+
+func (e filterNot) eval(p filterProperties) bool { return !e.x.eval(p) }
+
+// filterHas is true if a property, or a property that starts with its
+// name, is set.
+type filterHas struct{ name string }
+
+func (e filterHas) eval(p filterProperties) bool {
+	name := foldFilterName(e.name)
+	for k := range p {
+		if strings.HasPrefix(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterTruthy is true if a property is set to a value
+// other than "", "0" or "false".
+type filterTruthy struct{ name string }
+
+func (e filterTruthy) eval(p filterProperties) bool {
+	switch strings.ToLower(p.lookup(e.name)) {
+	case "", "0", "false":
+		return false
+	}
+	return true
+}
+
+// filterOperand is a property or a literal.
+type filterOperand struct {
+	name    string
+	literal string
+	isName  bool
+}
+
+// value returns the value of the operand.
+func (o filterOperand) value(p filterProperties) string {
+	if o.isName {
+		return p.lookup(o.name)
+	}
+	return o.literal
+}
+
+// filterCompare compares two operands.
+type filterCompare struct {
+	op   string
+	x, y filterOperand
+	re   *regexp.Regexp
+}
+
+func (e filterCompare) eval(p filterProperties) bool {
+	x, y := e.x.value(p), e.y.value(p)
+	if e.op == "=~" {
+		return e.re.MatchString(x)
+	}
+	var cmp int
+	if a, ok := filterNumber(x); ok {
+		if b, ok := filterNumber(y); ok {
+			switch {
+			case a < b:
+				cmp = -1
+			case a > b:
+				cmp = 1
+			}
+			return compareResult(e.op, cmp)
+		}
+	}
+	return compareResult(e.op, strings.Compare(x, y))
+}
+
+// compareResult returns the result of a comparison operator
+// given the result of comparing its operands.
+func compareResult(op string, cmp int) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// filterNumber returns the number at the start of s.
+func filterNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || end == 0 && (s[end] == '-' || s[end] == '+')) {
+		end++
+	}
+	f, err := strconv.ParseFloat(s[:end], 64)
+	return f, err == nil
+}
+
+// Kinds of filter tokens.
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+// filterToken is a token of a filter expression.
+type filterToken struct {
+	kind   int
+	text   string
+	offset int
+}
+
+// String returns the token as it appears in the expression.
+func (t filterToken) String() string {
+	if t.kind == tokenEOF {
+		return "end of filter"
+	}
+	return strconv.Quote(t.text)
+}
+
+// filterOps are the operators, longest first.
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "(", ")"}
+
+// lexFilter splits a filter expression into tokens.
+func lexFilter(s string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("filter: unterminated string at offset %d", i)
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("filter: invalid string at offset %d: %s", i, err)
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: text, offset: i})
+			i = end + 1
+		case c >= '0' && c <= '9' || c == '-' || c == '.':
+			end := i + 1
+			for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: s[i:end], offset: i})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end]))) {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: tokenIdent, text: s[i:end], offset: i})
+			i = end
+		default:
+			var op string
+			for _, o := range filterOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("filter: unexpected %q at offset %d", c, i)
+			}
+			tokens = append(tokens, filterToken{kind: tokenOp, text: op, offset: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, filterToken{kind: tokenEOF, offset: len(s)}), nil
+}
+
+// filterParser parses the tokens of a filter expression.
+type filterParser struct {
+	tokens []filterToken
+}
+
+// peek returns the next token.
+func (p *filterParser) peek() filterToken {
+	return p.tokens[0]
+}
+
+// next returns the next token and consumes it.
+func (p *filterParser) next() filterToken {
+	t := p.tokens[0]
+	if t.kind != tokenEOF {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given operator.
+func (p *filterParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// parseOr parses expressions separated by ||.
+func (p *filterParser) parseOr() (filterExpr, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = filterOr{x, y}
+	}
+	return x, nil
+}
+
+// parseAnd parses expressions separated by &&.
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = filterAnd{x, y}
+	}
+	return x, nil
+}
+
+// parseUnary parses a negation, a parenthesized expression,
+// a call to has, a comparison or a property on its own.
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{x}, nil
+	}
+	if p.accept("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			t := p.peek()
+			return nil, fmt.Errorf("filter: expected \")\", got %s at offset %d", t, t.offset)
+		}
+		return x, nil
+	}
+	t := p.peek()
+	if t.kind == tokenIdent && strings.EqualFold(t.text, "has") && len(p.tokens) > 1 && p.tokens[1].text == "(" {
+		p.next()
+		p.next()
+		name := p.next()
+		if name.kind != tokenIdent {
+			return nil, fmt.Errorf("filter: expected a property name, got %s at offset %d", name, name.offset)
+		}
+		if !p.accept(")") {
+			t := p.peek()
+			return nil, fmt.Errorf("filter: expected \")\", got %s at offset %d", t, t.offset)
+		}
+		return filterHas{name.text}, nil
+	}
+
+	x, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	if op.kind != tokenOp || !isCompareOp(op.text) {
+		if !x.isName {
+			return nil, fmt.Errorf("filter: expected a comparison, got %s at offset %d", op, op.offset)
+		}
+		return filterTruthy{x.name}, nil
+	}
+	p.next()
+	y, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	e := filterCompare{op: op.text, x: x, y: y}
+	if op.text == "=~" {
+		if y.isName {
+			return nil, fmt.Errorf("filter: expected a regular expression at offset %d", op.offset)
+		}
+		if e.re, err = regexp.Compile(y.literal); err != nil {
+			return nil, fmt.Errorf("filter: invalid regular expression: %s", err)
+		}
+	}
+	return e, nil
+}
+
+// parseOperand parses a property, a string or a number.
+func (p *filterParser) parseOperand() (filterOperand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenIdent:
+		return filterOperand{name: t.text, isName: true}, nil
+	case tokenString, tokenNumber:
+		return filterOperand{literal: t.text}, nil
+	}
+	return filterOperand{}, fmt.Errorf("filter: expected a property or a value, got %s at offset %d", t, t.offset)
+}
+
+// isCompareOp reports whether an operator is a comparison.
+func isCompareOp(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package sndtag
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	library := map[string]map[string]string{}
+	for _, dir := range []string{"interop", "midi", "musepack", "monkeysaudio"} {
+		files, err := filepath.Glob(filepath.Join("testdata", dir, "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			metadata, err := readTestFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			library[filepath.Base(file)] = metadata
+		}
+	}
+	if len(library) != 11 {
+		t.Fatalf("got %d files, want 11", len(library))
+	}
+
+	for _, tc := range []struct {
+		expr string
+		want []string
+	}{
+		{
+			expr: `genre == "Ambient"`,
+			want: []string{"id3-chunk.wav", "id3v23.mp3", "id3v24.mp3", "info.wav", "old.ape"},
+		},
+		{
+			// "3/12" is compared as 3.
+			expr: `track >= 3`,
+			want: []string{"id3-chunk.wav", "id3v23.mp3", "id3v24.mp3", "info.wav"},
+		},
+		{
+			// An empty sample rate is less than "44100" as a string.
+			expr: `has(sample_rate) && SampleRate < 44100`,
+			want: []string{"old.ape"},
+		},
+		{
+			expr: `title =~ "^Interop" && !has(comments)`,
+			want: []string{"info.wav"},
+		},
+		{
+			expr: `format == "Musepack" || format == "Monkey's Audio" && num_channels == 1`,
+			want: []string{"old.ape", "sv7.mpc", "sv8.mpc"},
+		},
+		{
+			expr: `(format == "Musepack" || format == "Monkey's Audio") && num_channels == 1`,
+			want: []string{"old.ape", "sv8.mpc"},
+		},
+		{
+			// Text1 and Texts start with text.
+			expr: `has(text)`,
+			want: []string{"song.mid"},
+		},
+		{
+			expr: `year`,
+			want: []string{"id3-chunk.wav", "id3v23.mp3", "id3v24.mp3", "info.wav", "sv7.mpc"},
+		},
+		{
+			expr: `duration > 1 && duration <= 2.0`,
+			want: []string{"smpte.mid", "song.mid"},
+		},
+		{
+			expr: `artist == "Nobody"`,
+		},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			f, err := ParseFilter(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for name, metadata := range library {
+				if f.Match(metadata) {
+					got = append(got, name)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		`title ==`,
+		`(year > 1`,
+		`year > 1)`,
+		`title =~ "["`,
+		`title == "unterminated`,
+		`year # 1`,
+		`year 1`,
+		``,
+	} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("%q: got no error", expr)
+		}
+	}
+}
+
+func TestWalkFilter(t *testing.T) {
+	f, err := ParseFilter(`format == "FLAC"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tone.wav doesn't match, and tone.aiff is passed with its error.
+	var got []string
+	err = Walk(context.Background(), DirStore(filepath.Join("testdata", "audio")), 2, func(r Result) error {
+		name := filepath.Base(r.Object.Key)
+		if r.Err != nil {
+			name += " (error)"
+		}
+		got = append(got, name)
+		return nil
+	}, WithFilter(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if want := []string{"tone.aiff (error)", "tone.flac"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/briansorahan/sndtag/riff"
+)
+
+// testChunk encodes a RIFF chunk, with its pad byte.
+func testChunk(id string, data []byte) []byte {
+	return riff.EncodeChunk(id, data)
+}
+
+// testUnpaddedChunk encodes a RIFF chunk without its pad byte,
+// as some encoders do.
+func testUnpaddedChunk(id string, data []byte) []byte {
+	b := []byte(id)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// testInfoList encodes a LIST chunk with an INFO list of subchunks.
+func testInfoList(subchunks ...[]byte) []byte {
+	data := []byte("INFO")
+	for _, c := range subchunks {
+		data = append(data, c...)
+	}
+	return testChunk("LIST", data)
+}
+
+// testWav encodes a WAV file with a 16-bit stereo fmt chunk at 44.1 kHz,
+// 400 bytes of audio data and the extra chunks after them.
+func testWav(extra ...[]byte) []byte {
+	format := []byte{1, 0, 2, 0}
+	format = binary.LittleEndian.AppendUint32(format, 44100)
+	format = binary.LittleEndian.AppendUint32(format, 176400)
+	format = append(format, 4, 0, 16, 0)
+
+	body := []byte("WAVE")
+	body = append(body, testChunk("fmt ", format)...)
+	body = append(body, testChunk("data", make([]byte, 400))...)
+	for _, c := range extra {
+		body = append(body, c...)
+	}
+	return testChunk("RIFF", body)
+}
+
+// testTextFrame encodes an ISO-8859-1 text frame of an ID3v2.3 or
+// ID3v2.4 tag.
+func testTextFrame(id, text string) []byte {
+	data := append([]byte{0}, text...)
+	b := []byte(id)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, 0, 0)
+	return append(b, data...)
+}
+
+// testID3v2 encodes an ID3v2 tag of a version with frames and a little
+// padding. Frame sizes are only valid in ID3v2.4 tags if they are below
+// 128 bytes.
+func testID3v2(major byte, frames ...[]byte) []byte {
+	var body []byte
+	for _, f := range frames {
+		body = append(body, f...)
+	}
+	body = append(body, make([]byte, 16)...)
+	tag := []byte{'I', 'D', '3', major, 0, 0}
+	tag = append(tag, encodeSynchsafe(int64(len(body)))...)
+	return append(tag, body...)
+}
+
+// testID3v22Frame encodes a frame of an ID3v2.2 tag.
+func testID3v22Frame(id string, data []byte) []byte {
+	b := []byte(id)
+	b = append(b, byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+	return append(b, data...)
+}
+
+// testMP3 encodes an MP3 file with a tag and a few bytes of MPEG audio.
+func testMP3(tag []byte) []byte {
+	audio := []byte{0xff, 0xfb, 0x90, 0x64}
+	audio = append(audio, make([]byte, 413)...)
+	return append(append([]byte(nil), tag...), audio...)
+}
+
+// testAIFF encodes a 16-bit AIFF file at 44.1 kHz with big-endian samples
+// of a number of channels, interleaved.
+func testAIFF(channels int, samples ...int16) []byte {
+	comm := binary.BigEndian.AppendUint16(nil, uint16(channels))
+	comm = binary.BigEndian.AppendUint32(comm, uint32(len(samples)/channels))
+	comm = binary.BigEndian.AppendUint16(comm, 16)
+	comm = append(comm, 0x40, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0)
+
+	ssnd := make([]byte, 8)
+	for _, s := range samples {
+		ssnd = binary.BigEndian.AppendUint16(ssnd, uint16(s))
+	}
+	body := []byte("AIFF")
+	for _, c := range []struct {
+		id   string
+		data []byte
+	}{{"COMM", comm}, {"SSND", ssnd}} {
+		body = append(body, c.id...)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(c.data)))
+		body = append(body, c.data...)
+	}
+	b := []byte("FORM")
+	b = binary.BigEndian.AppendUint32(b, uint32(len(body)))
+	return append(b, body...)
+}
+
+// testAudio reads a file of testdata/audio. They all hold the same 100 ms
+// of 16-bit stereo audio at 44.1 kHz: 10 ms of silence, a 440 Hz tone with
+// the right channel inverted at half the level and 3 frames clipped on both
+// channels, and 10 ms of silence.
+func testAudio(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", "audio", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
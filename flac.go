@@ -0,0 +1,686 @@
+package sndtag
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/briansorahan/sndtag/vorbiscomment"
+)
+
+// flacStreamInfo is the STREAMINFO block of a FLAC stream.
+type flacStreamInfo struct {
+	sampleRate    uint32
+	channels      int
+	bitsPerSample int
+	totalSamples  uint64
+	md5           [16]byte
+}
+
+// readFLACStreamInfo reads the metadata blocks of a FLAC stream, whose
+// "fLaC" signature has already been read, and returns the STREAMINFO block.
+func readFLACStreamInfo(r io.Reader) (flacStreamInfo, error) {
+	var (
+		info   flacStreamInfo
+		header = make([]byte, 4)
+		found  bool
+	)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return info, fmt.Errorf("truncated FLAC metadata block header")
+		}
+		var (
+			last   = header[0]&0x80 != 0
+			typ    = header[0] & 0x7f
+			length = int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		)
+		if typ == 0 && !found {
+			if length < 34 {
+				return info, fmt.Errorf("FLAC STREAMINFO block of %d bytes is too short", length)
+			}
+			b, err := readN(r, length)
+			if err != nil {
+				return info, fmt.Errorf("truncated FLAC STREAMINFO block")
+			}
+			info = parseFLACStreamInfo(b)
+			found = true
+		} else if _, err := io.CopyN(io.Discard, r, length); err != nil {
+			return info, fmt.Errorf("truncated FLAC metadata block")
+		}
+		if last {
+			break
+		}
+	}
+	if !found {
+		return info, fmt.Errorf("FLAC stream has no STREAMINFO block")
+	}
+	return info, nil
+}
+
+// parseFLACStreamInfo parses a STREAMINFO block of 34 bytes or more.
+func parseFLACStreamInfo(b []byte) flacStreamInfo {
+	var info flacStreamInfo
+
+	// Sample rate (20 bits), channels - 1 (3 bits),
+	// bits per sample - 1 (5 bits) and total samples (36 bits).
+	v := binary.BigEndian.Uint64(b[10:18])
+	info.sampleRate = uint32(v >> 44)
+	info.channels = int(v>>41&0x7) + 1
+	info.bitsPerSample = int(v>>36&0x1f) + 1
+	info.totalSamples = v & (1<<36 - 1)
+	copy(info.md5[:], b[18:34])
+	return info
+}
+
+// newFLAC reads the properties of a FLAC stream, whose "fLaC" signature
+// has already been read, from its STREAMINFO and VORBIS_COMMENT blocks.
+// The Vorbis comment fields that NewTag writes are read back, the first
+// value of each.
+func newFLAC(r io.Reader, o options) (map[string]string, error) {
+	var (
+		metadata = map[string]string{KeyFormat: "FLAC"}
+		header   = make([]byte, 4)
+		found    bool
+	)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("truncated FLAC metadata block header")
+		}
+		var (
+			last   = header[0]&0x80 != 0
+			typ    = header[0] & 0x7f
+			length = int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		)
+		switch {
+		case typ == 0 && !found:
+			if length < 34 {
+				return nil, fmt.Errorf("FLAC STREAMINFO block of %d bytes is too short", length)
+			}
+			b, err := readN(r, length)
+			if err != nil {
+				return nil, fmt.Errorf("truncated FLAC STREAMINFO block")
+			}
+			setFLACStreamInfo(metadata, parseFLACStreamInfo(b))
+			found = true
+		case typ == flacBlockVorbisComment:
+			b, err := readN(r, length)
+			if err != nil {
+				return nil, fmt.Errorf("truncated FLAC VORBIS_COMMENT block")
+			}
+			c, err := vorbiscomment.Decode(b)
+			if err != nil {
+				return nil, err
+			}
+			for prop, field := range vorbisCommentFields {
+				if _, ok := metadata[prop]; ok {
+					continue
+				}
+				if values := c.Get(field); len(values) > 0 {
+					metadata[prop] = values[0]
+				}
+			}
+		default:
+			if _, err := io.CopyN(ioutil.Discard, r, length); err != nil {
+				return nil, fmt.Errorf("truncated FLAC metadata block")
+			}
+		}
+		if last {
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("FLAC stream has no STREAMINFO block")
+	}
+	return metadata, nil
+}
+
+// setFLACStreamInfo sets the stream properties of a STREAMINFO block.
+func setFLACStreamInfo(metadata map[string]string, info flacStreamInfo) {
+	metadata[KeySampleRate] = strconv.FormatUint(uint64(info.sampleRate), 10)
+	metadata[KeyNumChannels] = strconv.Itoa(info.channels)
+	metadata[KeyBitRate] = strconv.Itoa(info.bitsPerSample)
+	if info.totalSamples == 0 {
+		// The number of samples is unknown.
+		return
+	}
+	metadata[KeySampleCount] = strconv.FormatUint(info.totalSamples, 10)
+	if info.sampleRate > 0 {
+		seconds := float64(info.totalSamples) / float64(info.sampleRate)
+		metadata[KeyDuration] = strconv.FormatFloat(seconds, 'f', 3, 64)
+	}
+}
+
+// errFLACEnd is returned by readFrame when there are no more frames.
+var errFLACEnd = errors.New("end of FLAC frames")
+
+// flacDecoder decodes the frames of a FLAC stream.
+type flacDecoder struct {
+	br   bitReader
+	info flacStreamInfo
+
+	// samples holds the decoded samples of each channel of a frame.
+	samples [][]int64
+}
+
+// hashFLACSamples decodes the audio frames of a FLAC stream that follow its
+// metadata blocks, and writes the samples to h the way the MD5 signature in
+// STREAMINFO is computed: interleaved, little-endian and signed, in as many
+// bytes as the samples need.
+func hashFLACSamples(r io.Reader, info flacStreamInfo, h hash.Hash) error {
+	d := &flacDecoder{
+		br:   bitReader{r: bufio.NewReader(r)},
+		info: info,
+	}
+	var (
+		decoded uint64
+		buf     []byte
+	)
+	for info.totalSamples == 0 || decoded < info.totalSamples {
+		n, bps, err := d.readFrame()
+		if err == errFLACEnd {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if info.totalSamples > 0 && decoded+uint64(n) > info.totalSamples {
+			n = int(info.totalSamples - decoded)
+		}
+		decoded += uint64(n)
+
+		width := (bps + 7) / 8
+		buf = buf[:0]
+		for i := 0; i < n; i++ {
+			for _, ch := range d.samples {
+				s := ch[i]
+				for j := 0; j < width; j++ {
+					buf = append(buf, byte(s>>(8*j)))
+				}
+			}
+		}
+		h.Write(buf)
+	}
+	if info.totalSamples > 0 && decoded < info.totalSamples {
+		return fmt.Errorf("FLAC stream ends after %d of %d samples", decoded, info.totalSamples)
+	}
+	return nil
+}
+
+// streamFLAC decodes the audio frames of a FLAC stream,
+// starting at its "fLaC" signature.
+func streamFLAC(r io.Reader, h pcmHandler) error {
+	// Skip the signature.
+	if _, err := io.CopyN(ioutil.Discard, r, 4); err != nil {
+		return err
+	}
+	info, err := readFLACStreamInfo(r)
+	if err != nil {
+		return err
+	}
+	d := &flacDecoder{
+		br:   bitReader{r: bufio.NewReader(r)},
+		info: info,
+	}
+	h.format(pcmFormat{rate: int(info.sampleRate), channels: info.channels, bits: info.bitsPerSample})
+
+	var samples []float32
+	for {
+		n, bps, err := d.readFrame()
+		if err == errFLACEnd {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(d.samples) != info.channels {
+			return fmt.Errorf("FLAC frame has %d channels, expected %d", len(d.samples), info.channels)
+		}
+		scale := float64(uint64(1) << uint(bps-1))
+		samples = samples[:0]
+		for i := 0; i < n; i++ {
+			for _, ch := range d.samples {
+				samples = append(samples, float32(float64(ch[i])/scale))
+			}
+		}
+		if !h.samples(samples) {
+			return nil
+		}
+	}
+}
+
+// flacBlockSizes are the block sizes of the block size codes 1 to 5.
+var flacBlockSizes = [...]int{0, 192, 576, 1152, 2304, 4608}
+
+// flacSampleSizes are the sample sizes of the sample size codes,
+// where 0 means the sample size of STREAMINFO and -1 is reserved.
+var flacSampleSizes = [...]int{0, 8, 12, -1, 16, 20, 24, 32}
+
+// readFrame decodes the next frame and returns its block size and its
+// sample size. It returns errFLACEnd at the end of the stream, or when
+// what follows isn't a frame, like an ID3v1 tag.
+func (d *flacDecoder) readFrame() (int, int, error) {
+	d.br.align()
+
+	sync, err := d.br.read(14)
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && sync != 0x3ffe) {
+		return 0, 0, errFLACEnd
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	// Reserved bit and blocking strategy, block size, sample rate,
+	// channel assignment, sample size and reserved bit.
+	header, err := d.br.read(18)
+	if err != nil {
+		return 0, 0, d.truncated(err)
+	}
+	var (
+		blockCode  = header >> 12 & 0xf
+		rateCode   = header >> 8 & 0xf
+		assignment = int(header >> 4 & 0xf)
+		sizeCode   = header >> 1 & 0x7
+	)
+	// Skip the coded frame or sample number.
+	first, err := d.br.read(8)
+	if err != nil {
+		return 0, 0, d.truncated(err)
+	}
+	// It is UTF-8 coded, so the leading one bits of the first byte
+	// are the number of bytes.
+	for mask := uint64(0x40); first&0x80 != 0 && first&mask != 0; mask >>= 1 {
+		if _, err := d.br.read(8); err != nil {
+			return 0, 0, d.truncated(err)
+		}
+	}
+
+	// Read the block size.
+	var blockSize int
+	switch {
+	case blockCode == 0:
+		return 0, 0, fmt.Errorf("reserved FLAC block size")
+	case blockCode <= 5:
+		blockSize = flacBlockSizes[blockCode]
+	case blockCode == 6, blockCode == 7:
+		v, err := d.br.read(8 * uint(blockCode-5))
+		if err != nil {
+			return 0, 0, d.truncated(err)
+		}
+		blockSize = int(v) + 1
+	default:
+		blockSize = 256 << (blockCode - 8)
+	}
+
+	// Skip the sample rate, which isn't needed to decode the samples.
+	switch rateCode {
+	case 12:
+		_, err = d.br.read(8)
+	case 13, 14:
+		_, err = d.br.read(16)
+	case 15:
+		return 0, 0, fmt.Errorf("invalid FLAC sample rate")
+	}
+	if err != nil {
+		return 0, 0, d.truncated(err)
+	}
+
+	bps := flacSampleSizes[sizeCode]
+	switch bps {
+	case -1:
+		return 0, 0, fmt.Errorf("reserved FLAC sample size")
+	case 0:
+		bps = d.info.bitsPerSample
+	}
+
+	// Skip the CRC-8 of the header.
+	if _, err := d.br.read(8); err != nil {
+		return 0, 0, d.truncated(err)
+	}
+
+	channels := assignment + 1
+	if assignment > 10 {
+		return 0, 0, fmt.Errorf("reserved FLAC channel assignment %d", assignment)
+	}
+	if assignment >= 8 {
+		channels = 2
+	}
+	if cap(d.samples) < channels {
+		d.samples = make([][]int64, channels)
+	}
+	d.samples = d.samples[:channels]
+
+	for ch := range d.samples {
+		if cap(d.samples[ch]) < blockSize {
+			d.samples[ch] = make([]int64, blockSize)
+		}
+		d.samples[ch] = d.samples[ch][:blockSize]
+
+		// The side channel has an extra bit.
+		size := bps
+		if (assignment == 8 && ch == 1) || (assignment == 9 && ch == 0) || (assignment == 10 && ch == 1) {
+			size++
+		}
+		if err := d.readSubframe(d.samples[ch], size); err != nil {
+			return 0, 0, d.truncated(err)
+		}
+	}
+	d.decorrelate(assignment)
+
+	// Skip the padding and the CRC-16 of the frame.
+	d.br.align()
+	if _, err := d.br.read(16); err != nil {
+		return 0, 0, d.truncated(err)
+	}
+	return blockSize, bps, nil
+}
+
+// truncated returns the error for a frame that is cut off.
+func (d *flacDecoder) truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("truncated FLAC frame")
+	}
+	return err
+}
+
+// decorrelate restores the left and right channels of a stereo frame.
+func (d *flacDecoder) decorrelate(assignment int) {
+	switch assignment {
+	case 8:
+		// Left and side.
+		left, side := d.samples[0], d.samples[1]
+		for i := range side {
+			side[i] = left[i] - side[i]
+		}
+	case 9:
+		// Side and right.
+		side, right := d.samples[0], d.samples[1]
+		for i := range side {
+			side[i] += right[i]
+		}
+	case 10:
+		// Mid and side.
+		mid, side := d.samples[0], d.samples[1]
+		for i := range mid {
+			m := mid[i]<<1 | side[i]&1
+			mid[i], side[i] = (m+side[i])>>1, (m-side[i])>>1
+		}
+	}
+}
+
+// readSubframe decodes the samples of a channel.
+func (d *flacDecoder) readSubframe(samples []int64, bps int) error {
+	header, err := d.br.read(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return fmt.Errorf("invalid FLAC subframe header")
+	}
+	typ := header >> 1 & 0x3f
+
+	// Read the number of wasted bits, which are zero in every sample.
+	var wasted int
+	if header&1 != 0 {
+		n, err := d.br.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = n + 1
+		bps -= wasted
+	}
+	if bps <= 0 {
+		return fmt.Errorf("invalid FLAC subframe sample size")
+	}
+
+	switch {
+	case typ == 0:
+		// Constant.
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		for i := range samples {
+			samples[i] = v
+		}
+	case typ == 1:
+		// Verbatim.
+		for i := range samples {
+			if samples[i], err = d.br.readSigned(bps); err != nil {
+				return err
+			}
+		}
+	case typ >= 8 && typ <= 12:
+		// Fixed predictor.
+		if err := d.readFixed(samples, bps, int(typ-8)); err != nil {
+			return err
+		}
+	case typ >= 32:
+		// Linear predictor.
+		if err := d.readLPC(samples, bps, int(typ-31)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("reserved FLAC subframe type %d", typ)
+	}
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= uint(wasted)
+		}
+	}
+	return nil
+}
+
+// readWarmup reads the unpredicted samples at the start of a subframe.
+func (d *flacDecoder) readWarmup(samples []int64, bps, order int) error {
+	if order > len(samples) {
+		return fmt.Errorf("FLAC predictor order %d exceeds the block size", order)
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		samples[i] = v
+	}
+	return nil
+}
+
+// readFixed decodes a subframe with a fixed predictor.
+func (d *flacDecoder) readFixed(samples []int64, bps, order int) error {
+	if err := d.readWarmup(samples, bps, order); err != nil {
+		return err
+	}
+	if err := d.readResidual(samples, order); err != nil {
+		return err
+	}
+	s := samples
+	for i := order; i < len(s); i++ {
+		switch order {
+		case 1:
+			s[i] += s[i-1]
+		case 2:
+			s[i] += 2*s[i-1] - s[i-2]
+		case 3:
+			s[i] += 3*s[i-1] - 3*s[i-2] + s[i-3]
+		case 4:
+			s[i] += 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+		}
+	}
+	return nil
+}
+
+// readLPC decodes a subframe with a linear predictor.
+func (d *flacDecoder) readLPC(samples []int64, bps, order int) error {
+	if err := d.readWarmup(samples, bps, order); err != nil {
+		return err
+	}
+	precision, err := d.br.read(4)
+	if err != nil {
+		return err
+	}
+	if precision == 0xf {
+		return fmt.Errorf("invalid FLAC coefficient precision")
+	}
+	shift, err := d.br.readSigned(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return fmt.Errorf("negative FLAC predictor shift")
+	}
+	coefs := make([]int64, order)
+	for i := range coefs {
+		if coefs[i], err = d.br.readSigned(int(precision) + 1); err != nil {
+			return err
+		}
+	}
+	if err := d.readResidual(samples, order); err != nil {
+		return err
+	}
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, c := range coefs {
+			sum += c * samples[i-1-j]
+		}
+		samples[i] += sum >> uint(shift)
+	}
+	return nil
+}
+
+// readResidual reads the Rice-coded residual of a subframe into the
+// samples that follow the warm-up samples.
+func (d *flacDecoder) readResidual(samples []int64, order int) error {
+	method, err := d.br.read(2)
+	if err != nil {
+		return err
+	}
+	if method > 1 {
+		return fmt.Errorf("reserved FLAC residual coding method %d", method)
+	}
+	var (
+		paramBits = uint(4 + method)
+		escape    = uint64(1)<<paramBits - 1
+	)
+	partitionOrder, err := d.br.read(4)
+	if err != nil {
+		return err
+	}
+	var (
+		partitions = 1 << partitionOrder
+		size       = len(samples) >> partitionOrder
+		i          = order
+	)
+	if size<<partitionOrder != len(samples) || size < order {
+		return fmt.Errorf("invalid FLAC partition order %d", partitionOrder)
+	}
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * size
+
+		param, err := d.br.read(paramBits)
+		if err != nil {
+			return err
+		}
+		if param == escape {
+			// The residual is stored unencoded.
+			n, err := d.br.read(5)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				if n == 0 {
+					samples[i] = 0
+				} else if samples[i], err = d.br.readSigned(int(n)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for ; i < end; i++ {
+			q, err := d.br.readUnary()
+			if err != nil {
+				return err
+			}
+			low, err := d.br.read(uint(param))
+			if err != nil {
+				return err
+			}
+			u := uint64(q)<<param | low
+			samples[i] = int64(u>>1) ^ -int64(u&1)
+		}
+	}
+	return nil
+}
+
+// bitReader reads a stream bit by bit, most significant bit first.
+type bitReader struct {
+	r    *bufio.Reader
+	bits uint64
+	n    uint
+}
+
+// read reads n bits, up to 56.
+func (b *bitReader) read(n uint) (uint64, error) {
+	for b.n < n {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && b.n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		b.bits = b.bits<<8 | uint64(c)
+		b.n += 8
+	}
+	b.n -= n
+	v := b.bits >> b.n & (1<<n - 1)
+	b.bits &= 1<<b.n - 1
+	return v, nil
+}
+
+// readSigned reads a two's complement number of n bits.
+func (b *bitReader) readSigned(n int) (int64, error) {
+	v, err := b.read(uint(n))
+	if err != nil {
+		return 0, err
+	}
+	return int64(v<<(64-uint(n))) >> (64 - uint(n)), nil
+}
+
+// readUnary reads the number of zero bits before the next one bit.
+func (b *bitReader) readUnary() (int, error) {
+	var n int
+	for {
+		if b.n == 0 {
+			c, err := b.r.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+			b.bits, b.n = uint64(c), 8
+		}
+		if b.bits == 0 {
+			n += int(b.n)
+			b.n = 0
+			continue
+		}
+		// The leading zeros of the remaining bits.
+		for b.bits>>(b.n-1)&1 == 0 {
+			n++
+			b.n--
+		}
+		b.n--
+		b.bits &= 1<<b.n - 1
+		return n, nil
+	}
+}
+
+// align skips the bits that are left of the current byte.
+func (b *bitReader) align() {
+	b.bits, b.n = 0, 0
+}
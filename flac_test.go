@@ -0,0 +1,82 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/briansorahan/sndtag/vorbiscomment"
+)
+
+// testFLAC encodes the metadata blocks of a FLAC stream of 44.1 kHz
+// 16-bit stereo with 88200 samples, followed by the blocks given, the
+// last of which needs its last-block flag set by the caller.
+func testFLAC(blocks ...[]byte) []byte {
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint64(info[10:18], 44100<<44|1<<41|15<<36|88200)
+	b := append([]byte("fLaC\x00\x00\x00\x22"), info...)
+	if len(blocks) == 0 {
+		b[4] |= 0x80
+	}
+	for _, block := range blocks {
+		b = append(b, block...)
+	}
+	return b
+}
+
+func TestNewFLAC(t *testing.T) {
+	tags := TagSet{
+		KeyTitle: "Title", KeyArtist: "Artist", KeyAlbum: "Album", KeyYear: "2019-05-01",
+		KeyTrack: "3", KeyDisc: "1", KeyGenre: "Genre", KeyComment: "Comment", KeyLabel: "Label",
+	}
+	block, err := NewTag(FormatFLAC, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block[0] |= 0x80
+
+	// Field names are case-insensitive and the first value is read.
+	other := vorbiscomment.Comments{Vendor: "other"}
+	other.Add("title", "First")
+	other.Add("TITLE", "Second")
+	data := other.Encode()
+	lowercase := append([]byte{0x80 | flacBlockVorbisComment, 0, byte(len(data) >> 8), byte(len(data))}, data...)
+
+	stream := map[string]string{
+		KeyFormat: "FLAC", KeySampleRate: "44100", KeyNumChannels: "2", KeyBitRate: "16",
+		KeySampleCount: "88200", KeyDuration: "2.000",
+	}
+	for _, tc := range []struct {
+		name string
+		file []byte
+		want map[string]string
+	}{
+		{"no tags", testFLAC(), map[string]string{KeyTitle: ""}},
+		{"NewTag", testFLAC(block), tags},
+		{"padding first", testFLAC([]byte{1, 0, 0, 4, 0, 0, 0, 0}, block), tags},
+		{"lowercase", testFLAC(lowercase), map[string]string{KeyTitle: "First"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DetectFormat(tc.file); got != FormatFLAC {
+				t.Fatalf("DetectFormat: got %s, want %s", got, FormatFLAC)
+			}
+			readers := map[string]func() (map[string]string, error){
+				"NewFromBytes": func() (map[string]string, error) { return NewFromBytes(tc.file) },
+				"New":          func() (map[string]string, error) { return New(bytes.NewReader(tc.file)) },
+			}
+			for name, read := range readers {
+				metadata, err := read()
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				for _, want := range []map[string]string{stream, tc.want} {
+					for key, value := range want {
+						if got := metadata[key]; got != value {
+							t.Errorf("%s: %s: got %q, want %q", name, key, got, value)
+						}
+					}
+				}
+			}
+		})
+	}
+}
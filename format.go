@@ -0,0 +1,169 @@
+package sndtag
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatDuration formats a duration the way players show it,
+// e.g. "3:45", or "1:02:03" for durations of an hour or more.
+// The duration is rounded to the nearest second.
+func FormatDuration(d time.Duration) string {
+	var sign string
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	s := int64(d.Round(time.Second) / time.Second)
+
+	if s >= 3600 {
+		return fmt.Sprintf("%s%d:%02d:%02d", sign, s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%s%d:%02d", sign, s/60, s%60)
+}
+
+// ParseDuration parses a duration formatted by FormatDuration. The seconds
+// may have a fraction, e.g. "3:45.5", and a plain number of seconds, like
+// the "Duration" property, is accepted too.
+func ParseDuration(s string) (time.Duration, error) {
+	var (
+		trimmed  = strings.TrimSpace(s)
+		negative = strings.HasPrefix(trimmed, "-")
+		parts    = strings.Split(strings.TrimPrefix(trimmed, "-"), ":")
+		seconds  float64
+	)
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		// Only the seconds can have a fraction, and only the first
+		// part can be larger than 59.
+		last := i == len(parts)-1
+		if (!last && v != math.Trunc(v)) || (i > 0 && v >= 60) {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		seconds = seconds*60 + v
+	}
+	if seconds > float64(math.MaxInt64/time.Second) {
+		return 0, fmt.Errorf("duration %q is too long", s)
+	}
+	d := time.Duration(math.Round(seconds * float64(time.Second)))
+	if negative {
+		d = -d
+	}
+	return d, nil
+}
+
+// FormatBitRate formats a bit rate in bits per second as kilobits per
+// second, e.g. "192 kbps", rounded to the nearest kilobit.
+func FormatBitRate(bps int64) string {
+	return fmt.Sprintf("%d kbps", (bps+500)/1000)
+}
+
+// bitRateUnits are the units ParseBitRate accepts, in bits per second.
+var bitRateUnits = map[string]float64{
+	"bps":  1,
+	"kbps": 1e3,
+	"mbps": 1e6,
+}
+
+// ParseBitRate parses a bit rate like "192 kbps" and returns it in
+// bits per second. The unit can be "bps", "kbps" or "Mbps", regardless
+// of case, and defaults to kbps, which is how bit rates are usually given.
+func ParseBitRate(s string) (int64, error) {
+	v, unit, err := splitUnit(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bit rate %q", s)
+	}
+	if unit == "" {
+		unit = "kbps"
+	}
+	scale, ok := bitRateUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("invalid bit rate unit %q", unit)
+	}
+	return int64(math.Round(v * scale)), nil
+}
+
+// sizeUnits are the units FormatSize uses, in order.
+var sizeUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+
+// FormatSize formats a size in bytes with decimal units and one decimal,
+// e.g. "4.2 MB", the way file managers show it. Sizes under a kilobyte
+// are shown in bytes, e.g. "512 B".
+func FormatSize(n int64) string {
+	var sign string
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	if n < 1000 {
+		return fmt.Sprintf("%s%d B", sign, n)
+	}
+	v, unit := float64(n), 0
+	for v >= 999.95 && unit < len(sizeUnits)-1 {
+		v /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%s%.1f %s", sign, v, sizeUnits[unit])
+}
+
+// ParseSize parses a size like "4.2 MB" and returns it in bytes.
+// Decimal units (KB, MB, ...) and binary units (KiB, MiB, ...) are
+// accepted regardless of case, and a number without a unit is in bytes.
+func ParseSize(s string) (int64, error) {
+	v, unit, err := splitUnit(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit = strings.ToUpper(unit)
+
+	scale := 1.0
+	switch {
+	case unit == "" || unit == "B":
+	case strings.HasSuffix(unit, "IB") && len(unit) == 3:
+		i := strings.Index("KMGTPE", unit[:1])
+		if i < 0 {
+			return 0, fmt.Errorf("invalid size unit %q", unit)
+		}
+		scale = math.Pow(1024, float64(i+1))
+	default:
+		i := -1
+		for j, u := range sizeUnits {
+			if u == unit {
+				i = j
+			}
+		}
+		if i < 0 {
+			return 0, fmt.Errorf("invalid size unit %q", unit)
+		}
+		scale = math.Pow(1000, float64(i))
+	}
+	if v*scale >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(math.Round(v * scale)), nil
+}
+
+// splitUnit splits a non-negative number with an optional unit,
+// like "4.2 MB" or "192kbps", into the number and the unit.
+func splitUnit(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	v, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return v, strings.TrimSpace(s[i:]), nil
+}
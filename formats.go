@@ -0,0 +1,197 @@
+package sndtag
+
+import "strconv"
+
+// FormatInfo describes a format that sndtag recognizes, see SupportedFormats.
+type FormatInfo struct {
+	Format Format
+	Name   string
+
+	// MIMEType is the media type of the format, e.g. "audio/mpeg".
+	MIMEType string
+
+	// Extensions are the file name extensions of the format, with the
+	// leading dot, most common first.
+	Extensions []string
+
+	// Magic describes the signatures the format is recognized by.
+	Magic []string
+
+	// Read is whether New reads the properties of the format and Write is
+	// whether Write can write its tags, see Capabilities.
+	Read  bool
+	Write bool
+}
+
+// formatInfos are the formats that sndtag recognizes, in the order
+// SupportedFormats returns them.
+var formatInfos = []FormatInfo{
+	{
+		Format:     FormatMP3,
+		Name:       "MP3",
+		MIMEType:   "audio/mpeg",
+		Extensions: []string{".mp3", ".mp2", ".mpga"},
+		Magic:      []string{`"ID3" tag`, `MPEG audio frame sync (0xFFE)`, `"TAG" ID3v1 tag`},
+	},
+	{
+		Format:     FormatWAV,
+		Name:       "WAV",
+		MIMEType:   "audio/wav",
+		Extensions: []string{".wav", ".bwf"},
+		Magic:      []string{`"RIFF" chunk`},
+	},
+	{
+		Format:     FormatMP4,
+		Name:       "MP4",
+		MIMEType:   "audio/mp4",
+		Extensions: []string{".m4a", ".mp4", ".m4b", ".m4v", ".mov"},
+		Magic:      []string{`"ftyp" atom at offset 4`},
+	},
+	{
+		Format:     FormatFLAC,
+		Name:       "FLAC",
+		MIMEType:   "audio/flac",
+		Extensions: []string{".flac"},
+		Magic:      []string{`"fLaC" signature`},
+	},
+	{
+		Format:     FormatMusepack,
+		Name:       "Musepack",
+		MIMEType:   "audio/x-musepack",
+		Extensions: []string{".mpc", ".mp+", ".mpp"},
+		Magic:      []string{`"MPCK" signature (SV8)`, `"MP+" signature (SV7)`},
+	},
+	{
+		Format:     FormatMonkeysAudio,
+		Name:       "Monkey's Audio",
+		MIMEType:   "audio/x-ape",
+		Extensions: []string{".ape"},
+		Magic:      []string{`"MAC " signature`},
+	},
+	{
+		Format:     FormatMatroska,
+		Name:       "Matroska",
+		MIMEType:   "audio/x-matroska",
+		Extensions: []string{".mka", ".mkv", ".webm"},
+		Magic:      []string{`EBML header (0x1A45DFA3)`},
+	},
+	{
+		Format:     FormatMIDI,
+		Name:       "MIDI",
+		MIMEType:   "audio/midi",
+		Extensions: []string{".mid", ".midi", ".kar"},
+		Magic:      []string{`"MThd" chunk`},
+	},
+	{
+		Format:     FormatSphere,
+		Name:       "NIST SPHERE",
+		MIMEType:   "audio/x-nist-sphere",
+		Extensions: []string{".sph", ".nist"},
+		Magic:      []string{`"NIST_1A" header ("NIST")`},
+	},
+	{
+		Format:     FormatTracker,
+		Name:       "Tracker module",
+		MIMEType:   "audio/x-mod",
+		Extensions: []string{".mod", ".s3m", ".xm", ".it"},
+		Magic: []string{
+			`"Extended Module: " (XM)`,
+			`"IMPM" (IT)`,
+			`"SCRM" at offset 44 (S3M)`,
+			`channel signature like "M.K." at offset 1080 (MOD)`,
+		},
+	},
+	{
+		Format:     FormatShorten,
+		Name:       "Shorten",
+		MIMEType:   "audio/x-shorten",
+		Extensions: []string{".shn"},
+		Magic:      []string{`"ajkg" signature`},
+	},
+	{
+		Format:     FormatTTA,
+		Name:       "TTA",
+		MIMEType:   "audio/x-tta",
+		Extensions: []string{".tta"},
+		Magic:      []string{`"TTA1" signature`},
+	},
+	{
+		Format:     FormatTAK,
+		Name:       "TAK",
+		MIMEType:   "audio/x-tak",
+		Extensions: []string{".tak"},
+		Magic:      []string{`"tBaK" signature`},
+	},
+	{
+		Format:     FormatOptimFROG,
+		Name:       "OptimFROG",
+		MIMEType:   "audio/x-optimfrog",
+		Extensions: []string{".ofr", ".ofs"},
+		Magic:      []string{`"OFR " signature`},
+	},
+	{
+		Format:     FormatAIFF,
+		Name:       "AIFF",
+		MIMEType:   "audio/aiff",
+		Extensions: []string{".aiff", ".aif", ".aifc"},
+		Magic:      []string{`"FORM" chunk of type "AIFF" or "AIFC"`},
+	},
+}
+
+// SupportedFormats returns the formats that sndtag recognizes, with what
+// it can do with them, e.g. to build the filters of a file dialog.
+// The result is a copy that can be modified.
+func SupportedFormats() []FormatInfo {
+	formats := make([]FormatInfo, len(formatInfos))
+	for i, info := range formatInfos {
+		caps := Capabilities(info.Format)
+
+		info.Extensions = append([]string(nil), info.Extensions...)
+		info.Magic = append([]string(nil), info.Magic...)
+		info.Read = caps.ReadProperties
+		info.Write = caps.WriteTags
+		formats[i] = info
+	}
+	return formats
+}
+
+// lookupFormatInfo returns the description of a format,
+// or nil for FormatUnknown and values that aren't formats.
+func lookupFormatInfo(f Format) *FormatInfo {
+	for i := range formatInfos {
+		if formatInfos[i].Format == f {
+			return &formatInfos[i]
+		}
+	}
+	return nil
+}
+
+// String returns the name of the format, e.g. "MP3", for logging.
+func (f Format) String() string {
+	if info := lookupFormatInfo(f); info != nil {
+		return info.Name
+	}
+	if f == FormatUnknown {
+		return "unknown"
+	}
+	return "Format(" + strconv.Itoa(int(f)) + ")"
+}
+
+// MIMEType returns the media type of the format, e.g. "audio/mpeg",
+// or "application/octet-stream" if the format is unknown.
+func (f Format) MIMEType() string {
+	if info := lookupFormatInfo(f); info != nil {
+		return info.MIMEType
+	}
+	return "application/octet-stream"
+}
+
+// Extensions returns the file name extensions of the format, with the
+// leading dot, most common first, or nil if the format is unknown.
+// The result is a copy that can be modified.
+func (f Format) Extensions() []string {
+	if info := lookupFormatInfo(f); info != nil {
+		return append([]string(nil), info.Extensions...)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package sndtag
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSupportedFormats(t *testing.T) {
+	for _, tc := range []struct {
+		format      Format
+		read, write bool
+	}{
+		{FormatMP3, true, true},
+		{FormatWAV, true, true},
+		{FormatMP4, true, false},
+		{FormatFLAC, true, false},
+		{FormatMatroska, true, false},
+		{FormatTTA, true, false},
+		{FormatShorten, true, false},
+		{FormatAIFF, false, false},
+	} {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			var info *FormatInfo
+			formats := SupportedFormats()
+			for i := range formats {
+				if formats[i].Format == tc.format {
+					info = &formats[i]
+				}
+			}
+			if info == nil {
+				t.Fatal("not supported")
+			}
+			if info.Read != tc.read || info.Write != tc.write {
+				t.Errorf("got Read %t, Write %t, want %t, %t", info.Read, info.Write, tc.read, tc.write)
+			}
+			// Read and Write are derived from Capabilities.
+			caps := Capabilities(tc.format)
+			if info.Read != caps.ReadProperties || info.Write != caps.WriteTags {
+				t.Errorf("disagrees with Capabilities: %+v", caps)
+			}
+		})
+	}
+}
+
+func TestFormatAIFF(t *testing.T) {
+	aiff := testAIFF(1, 0, 100, -100)
+	aifc := append([]byte(nil), aiff...)
+	copy(aifc[8:12], "AIFC")
+
+	for _, b := range [][]byte{aiff, aifc} {
+		if got := DetectFormat(b); got != FormatAIFF {
+			t.Errorf("DetectFormat(%q): got %s, want AIFF", b[8:12], got)
+		}
+	}
+	if got := DetectFormat([]byte("FORM\x00\x00\x00\x04ILBM")); got != FormatUnknown {
+		t.Errorf("DetectFormat(ILBM): got %s", got)
+	}
+	if caps := Capabilities(FormatAIFF); !caps.Preview || caps.ReadProperties || caps.ReadTags || caps.WriteTags {
+		t.Errorf("got %+v", caps)
+	}
+	if FormatAIFF.String() != "AIFF" || FormatAIFF.MIMEType() != "audio/aiff" || FormatAIFF.Extensions()[0] != ".aiff" {
+		t.Errorf("got %s, %s, %v", FormatAIFF, FormatAIFF.MIMEType(), FormatAIFF.Extensions())
+	}
+	pcm, err := PreviewPCM(bytes.NewReader(aiff), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcm.SampleRate != 44100 || pcm.Channels != 1 {
+		t.Errorf("got %+v", pcm)
+	}
+}
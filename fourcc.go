@@ -0,0 +1,57 @@
+package sndtag
+
+import "strings"
+
+// wavFourCCs are the IDs of the chunks of WAV files that are read,
+// apart from the subchunks of INFO lists.
+var wavFourCCs = []string{"WAVE", "fmt ", "data", "LIST", "INFO", "id3 ", "ID3 ", "cue ", "smpl", "bext", "iXML"}
+
+// WithLenientParsing makes the parsers accept files that bend the format
+// in ways that some encoders are known to. The chunk IDs of WAV files are
+// matched regardless of case and of trailing NUL bytes and spaces, e.g.
+// "fmt\x00" and "FMT " are read as "fmt ". WAV files without a fmt chunk
+// are read too, without the properties of the audio format and the
+// duration, instead of failing.
+func WithLenientParsing() Option {
+	return func(o *options) {
+		o.lenient = true
+	}
+}
+
+// chunkID returns the ID of a known WAV chunk that id matches in lenient
+// mode, or id itself.
+func (o options) chunkID(id string) string {
+	if !o.lenient {
+		return id
+	}
+	if _, ok := wavInfoChunks[id]; ok {
+		return id
+	}
+	for _, known := range wavFourCCs {
+		if id == known {
+			return id
+		}
+	}
+	for _, known := range wavFourCCs {
+		if foldFourCC(id) == foldFourCC(known) {
+			return known
+		}
+	}
+	for known := range wavInfoChunks {
+		if foldFourCC(id) == foldFourCC(known) {
+			return known
+		}
+	}
+	return id
+}
+
+// matchFourCC reports whether a chunk ID is the expected one,
+// see WithLenientParsing.
+func (o options) matchFourCC(id, expected string) bool {
+	return id == expected || o.lenient && foldFourCC(id) == foldFourCC(expected)
+}
+
+// foldFourCC upper-cases a chunk ID and trims trailing NUL bytes and spaces.
+func foldFourCC(id string) string {
+	return strings.ToUpper(strings.TrimRight(id, "\x00 "))
+}
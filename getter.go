@@ -0,0 +1,200 @@
+package sndtag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingProperty is returned by the typed getters when a property is not set.
+var ErrMissingProperty = errors.New("missing property")
+
+// PropertyError is returned by the typed getters when a property
+// is missing or can not be parsed as the requested type.
+type PropertyError struct {
+	Key   string
+	Value string
+	Type  string
+	Err   error
+}
+
+// Error returns a description of the error.
+func (e *PropertyError) Error() string {
+	if e.Err == ErrMissingProperty {
+		return fmt.Sprintf("property %s: %s", e.Key, e.Err)
+	}
+	return fmt.Sprintf("property %s: can not parse %q as %s: %s", e.Key, e.Value, e.Type, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PropertyError) Unwrap() error {
+	return e.Err
+}
+
+// Getter provides typed access to the properties returned by New.
+// It is a view of the same map, so a map returned by New or NewFromBytes
+// can be converted to a Getter, and a Getter can be used as a map.
+type Getter map[string]string
+
+// NewGetter creates a new Getter with metadata read from an io.Reader.
+func NewGetter(r io.Reader, opts ...Option) (Getter, error) {
+	metadata, err := New(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return Getter(metadata), nil
+}
+
+// NewGetterFromBytes creates a new Getter with metadata read from
+// a byte slice that holds an entire file, see NewFromBytes.
+func NewGetterFromBytes(b []byte, opts ...Option) (Getter, error) {
+	metadata, err := NewFromBytes(b, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return Getter(metadata), nil
+}
+
+// Get returns the value of a property and whether it is set.
+func (g Getter) Get(key string) (string, bool) {
+	value, ok := g[key]
+	return value, ok
+}
+
+// HasTags reports whether the file has descriptive properties, see HasTags.
+func (g Getter) HasTags() bool {
+	return HasTags(g)
+}
+
+// Truncated reports whether the ID3v1 tag of the file has a cut-off copy
+// of a property, see KeyID3v1Truncated, e.g. so that a repair tool can
+// rewrite it from the complete value that Get returns.
+func (g Getter) Truncated(key string) bool {
+	for _, k := range strings.Split(g[KeyID3v1Truncated], "/") {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// GetInt returns the value of a property as a signed integer.
+func (g Getter) GetInt(key string) (int64, error) {
+	value, err := g.lookup(key, "int")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, g.parseError(key, "int", err)
+	}
+	return n, nil
+}
+
+// GetUint returns the value of a property as an unsigned integer.
+func (g Getter) GetUint(key string) (uint64, error) {
+	value, err := g.lookup(key, "uint")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, g.parseError(key, "uint", err)
+	}
+	return n, nil
+}
+
+// GetUint16 returns the value of a property as a 16-bit unsigned integer,
+// which is the type of e.g. the number of channels of WAV files. Values
+// that don't fit are an error wrapping strconv.ErrRange.
+func (g Getter) GetUint16(key string) (uint16, error) {
+	n, err := g.getUintBits(key, "uint16", 16)
+	return uint16(n), err
+}
+
+// GetUint32 returns the value of a property as a 32-bit unsigned integer,
+// which is the type of e.g. the sample rate and chunk lengths of WAV files.
+// Values that don't fit are an error wrapping strconv.ErrRange.
+func (g Getter) GetUint32(key string) (uint32, error) {
+	n, err := g.getUintBits(key, "uint32", 32)
+	return uint32(n), err
+}
+
+// getUintBits returns the value of a property as an unsigned integer
+// that fits in the given number of bits.
+func (g Getter) getUintBits(key, typ string, bits int) (uint64, error) {
+	value, err := g.lookup(key, typ)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 10, bits)
+	if err != nil {
+		return 0, g.parseError(key, typ, err)
+	}
+	return n, nil
+}
+
+// GetBool returns the value of a property as a boolean.
+// See strconv.ParseBool for the values that are accepted.
+func (g Getter) GetBool(key string) (bool, error) {
+	value, err := g.lookup(key, "bool")
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, g.parseError(key, "bool", err)
+	}
+	return b, nil
+}
+
+// timeLayouts are the layouts accepted by GetTime, which cover the
+// ID3v2.4 timestamp format and the dates written to INFO lists.
+var timeLayouts = []string{
+	"2006",
+	"2006-01",
+	"2006-01-02",
+	"2006-01-02T15",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+}
+
+// GetTime returns the value of a property as a time.
+// Dates that only have a year, or a year and a month, are accepted
+// and fill in the rest of the time with the earliest possible value.
+func (g Getter) GetTime(key string) (time.Time, error) {
+	value, err := g.lookup(key, "time")
+	if err != nil {
+		return time.Time{}, err
+	}
+	value = strings.TrimSpace(value)
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, g.parseError(key, "time", errors.New("unrecognized time format"))
+}
+
+// lookup returns the value of a property or an error if it is not set.
+func (g Getter) lookup(key, typ string) (string, error) {
+	value, ok := g[key]
+	if !ok {
+		return "", &PropertyError{Key: key, Type: typ, Err: ErrMissingProperty}
+	}
+	return value, nil
+}
+
+// parseError returns a PropertyError for a value that could not be parsed.
+func (g Getter) parseError(key, typ string, err error) error {
+	if numErr, ok := err.(*strconv.NumError); ok {
+		err = numErr.Err
+	}
+	return &PropertyError{Key: key, Value: g[key], Type: typ, Err: err}
+}
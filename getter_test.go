@@ -0,0 +1,76 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestGetUintBits(t *testing.T) {
+	for _, tc := range []struct {
+		value  string
+		want16 uint16
+		err16  error
+		want32 uint32
+		err32  error
+	}{
+		{value: "2", want16: 2, want32: 2},
+		{value: " 44100 ", want16: 44100, want32: 44100},
+		{value: "65535", want16: 65535, want32: 65535},
+		{value: "65536", err16: strconv.ErrRange, want32: 65536},
+		{value: "4294967295", err16: strconv.ErrRange, want32: 4294967295},
+		{value: "4294967296", err16: strconv.ErrRange, err32: strconv.ErrRange},
+		{value: "-1", err16: strconv.ErrSyntax, err32: strconv.ErrSyntax},
+		{value: "", err16: ErrMissingProperty, err32: ErrMissingProperty},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			g := Getter{}
+			if tc.value != "" {
+				g[KeySampleRate] = tc.value
+			}
+			got16, err := g.GetUint16(KeySampleRate)
+			if !errors.Is(err, tc.err16) || (tc.err16 == nil && got16 != tc.want16) {
+				t.Errorf("GetUint16: got %d, %v, want %d, %v", got16, err, tc.want16, tc.err16)
+			}
+			got32, err := g.GetUint32(KeySampleRate)
+			if !errors.Is(err, tc.err32) || (tc.err32 == nil && got32 != tc.want32) {
+				t.Errorf("GetUint32: got %d, %v, want %d, %v", got32, err, tc.want32, tc.err32)
+			}
+		})
+	}
+}
+
+func TestWavFormatUnsigned(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		channels               uint16
+		sampleRate, byteRate   uint32
+		wantChannels, wantRate string
+	}{
+		{"typical", 2, 44100, 176400, "2", "44100"},
+		{"top bits", 0x8000, 0x80000000, 0xffffffff, "32768", "2147483648"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			format := binary.LittleEndian.AppendUint16([]byte{1, 0}, tc.channels)
+			format = binary.LittleEndian.AppendUint32(format, tc.sampleRate)
+			format = binary.LittleEndian.AppendUint32(format, tc.byteRate)
+			format = append(format, 4, 0, 16, 0)
+			file := testChunk("RIFF", append([]byte("WAVE"), testChunk("fmt ", format)...))
+
+			metadata, err := NewFromBytes(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := metadata[KeyNumChannels]; got != tc.wantChannels {
+				t.Errorf("NumChannels: got %s, want %s", got, tc.wantChannels)
+			}
+			if got := metadata[KeySampleRate]; got != tc.wantRate {
+				t.Errorf("SampleRate: got %s, want %s", got, tc.wantRate)
+			}
+			if got, err := Getter(metadata).GetUint32(KeyByteRate); err != nil || got != tc.byteRate {
+				t.Errorf("ByteRate: got %d, %v, want %d", got, err, tc.byteRate)
+			}
+		})
+	}
+}
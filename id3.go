@@ -1,10 +1,189 @@
 package sndtag
 
 import (
+	"bytes"
 	"io"
+	"strconv"
+	"strings"
 )
 
-// newID3 returns a new getter that returns properties from ID3 metadata.
-func newID3(r io.Reader) (map[string]string, error) {
-	return nil, nil
+// id3v1Genres are the genres of ID3v1 tags, including the Winamp extensions.
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap",
+	"Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska", "Death Metal", "Pranks",
+	"Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance",
+	"Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi",
+	"Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebob", "Latin", "Revival",
+	"Celtic", "Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock", "Slow Rock",
+	"Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour", "Speech", "Chanson", "Opera",
+	"Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam",
+	"Club", "Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle",
+	"Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House", "Dance Hall",
+}
+
+// newID3 creates a new map that contains properties from an ID3v1 tag
+// at the start of the stream, which is what a file that only holds
+// the tag looks like. Note that "TAG" has already been read.
+func newID3(r io.Reader, o options) (map[string]string, error) {
+	b := make([]byte, id3v1Size)
+	copy(b, "TAG")
+
+	if _, err := io.ReadFull(r, b[3:]); err != nil {
+		return nil, err
+	}
+	return decodeID3v1(b, 0, o), nil
+}
+
+// newMPEG reads the properties of an MPEG audio file without an ID3v2 tag,
+// which can only have an ID3v1 tag at its end. It is only read if r is
+// an io.ReadSeeker.
+func newMPEG(r io.Reader, o options) (map[string]string, error) {
+	metadata := map[string]string{}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if err := readID3v1(rs, metadata, o); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// readID3v1 reads the ID3v1 tag at the end of a file, if it has one,
+// and stores its properties in metadata. Properties that are already
+// set are kept, unless WithDuplicateKeys says otherwise.
+func readID3v1(rs io.ReadSeeker, metadata map[string]string, o options) error {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if size < id3v1Size {
+		return nil
+	}
+	b := make([]byte, id3v1Size)
+
+	if _, err := rs.Seek(size-id3v1Size, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rs, b); err != nil {
+		return err
+	}
+	if string(b[:3]) == "TAG" {
+		mergeID3v1(metadata, b, size-id3v1Size, o)
+	}
+	return nil
+}
+
+// parseID3v1 reads the ID3v1 tag at the end of a file that is entirely
+// in memory. See readID3v1.
+func parseID3v1(b []byte, metadata map[string]string, o options) {
+	if len(b) < id3v1Size {
+		return
+	}
+	offset := len(b) - id3v1Size
+	if string(b[offset:offset+3]) != "TAG" {
+		return
+	}
+	mergeID3v1(metadata, b[offset:], int64(offset), o)
+}
+
+// mergeID3v1 merges the properties of an ID3v1 tag into the properties
+// read from the other tags of a file, and lists the fields that appear to
+// be cut off as KeyID3v1Truncated.
+func mergeID3v1(metadata map[string]string, b []byte, offset int64, o options) {
+	var (
+		v1        = decodeID3v1(b, offset, o)
+		truncated []string
+	)
+	for _, key := range id3v1FullFields(b) {
+		other, short := metadata[key], v1[key]
+		if short != "" && len(other) > len(short) && strings.HasPrefix(other, short) {
+			truncated = append(truncated, key)
+		}
+	}
+	// Cut off fields aren't conflicts, and never replace the full values.
+	for _, key := range truncated {
+		delete(v1, key)
+	}
+	o.mergeTags(metadata, v1)
+
+	if len(truncated) > 0 {
+		metadata[KeyID3v1Truncated] = strings.Join(truncated, "/")
+	}
+}
+
+// id3v1FullFields returns the properties of the text fields of an ID3v1
+// tag that fill their whole width, without a NUL terminator or padding
+// with spaces, so that they may have been cut off.
+func id3v1FullFields(b []byte) []string {
+	comment := b[97:127]
+	if comment[28] == 0 && comment[29] != 0 {
+		comment = comment[:28]
+	}
+	var full []string
+	for _, field := range []struct {
+		key  string
+		data []byte
+	}{
+		{KeyTitle, b[3:33]},
+		{KeyArtist, b[33:63]},
+		{KeyAlbum, b[63:93]},
+		{KeyComment, comment},
+	} {
+		if bytes.IndexByte(field.data, 0) < 0 && field.data[len(field.data)-1] != ' ' {
+			full = append(full, field.key)
+		}
+	}
+	return full
+}
+
+// decodeID3v1 decodes an ID3v1 tag, which is "TAG" followed by the title,
+// artist, album, year and comment in fixed-size fields, and the genre.
+// ID3v1.1 tags use the last byte of the comment for the track number.
+// The spec says the text is ISO-8859-1, but it is usually in whatever
+// code page the tagger used, so it is decoded with the charsets set by
+// WithCharsets.
+func decodeID3v1(b []byte, offset int64, o options) map[string]string {
+	var (
+		metadata = map[string]string{}
+		comment  = b[97:127]
+		genre    = int(b[127])
+	)
+	if comment[28] == 0 && comment[29] != 0 {
+		metadata[KeyTrack] = strconv.Itoa(int(comment[29]))
+		o.setSource(KeyTrack, Source{Tag: TagID3v1, Offset: offset + 126})
+		comment = comment[:28]
+	}
+	fields := []struct {
+		key   string
+		start int
+		data  []byte
+	}{
+		{KeyTitle, 3, b[3:33]},
+		{KeyArtist, 33, b[33:63]},
+		{KeyAlbum, 63, b[63:93]},
+		{KeyYear, 93, b[93:97]},
+		{KeyComment, 97, comment},
+	}
+	for _, field := range fields {
+		s := strings.TrimRight(o.charsets.decode(field.data), " ")
+		if s == "" {
+			continue
+		}
+		metadata[field.key] = s
+		o.setSource(field.key, Source{Tag: TagID3v1, Offset: offset + int64(field.start)})
+
+		if o.detectCharset {
+			reportCharset(metadata, field.key, field.data)
+		}
+	}
+	if genre < len(id3v1Genres) {
+		metadata[KeyGenre] = id3v1Genres[genre]
+		o.setSource(KeyGenre, Source{Tag: TagID3v1, Offset: offset + 127})
+	}
+	return metadata
 }
@@ -0,0 +1,245 @@
+package id3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Text encodings, the first byte of the data of text frames.
+const (
+	EncodingLatin1  = 0
+	EncodingUTF16   = 1
+	EncodingUTF16BE = 2
+	EncodingUTF8    = 3
+)
+
+// A Frame is a frame of a tag. The data is stored as it appears in the tag,
+// after the unsynchronisation of the whole tag has been removed, see
+// Content.
+type Frame struct {
+	ID    string
+	Flags uint16
+	Data  []byte
+}
+
+// ParseFrame parses the frame at the start of b, in a tag of a version,
+// and returns the bytes that follow it.
+func ParseFrame(major uint8, b []byte) (Frame, []byte, error) {
+	var (
+		frame      Frame
+		headerSize = 10
+		size       int64
+	)
+	if major == 2 {
+		headerSize = 6
+	}
+	if len(b) < headerSize {
+		return frame, nil, fmt.Errorf("truncated ID3v2 frame header")
+	}
+
+	switch major {
+	case 2:
+		frame.ID = string(b[:3])
+		size = int64(b[3])<<16 | int64(b[4])<<8 | int64(b[5])
+	case 3:
+		frame.ID = string(b[:4])
+		size = int64(binary.BigEndian.Uint32(b[4:8]))
+		frame.Flags = binary.BigEndian.Uint16(b[8:10])
+	default:
+		frame.ID = string(b[:4])
+		size = Synchsafe(b[4:8])
+		frame.Flags = binary.BigEndian.Uint16(b[8:10])
+	}
+	if size > int64(len(b)-headerSize) {
+		return frame, nil, fmt.Errorf("ID3v2 frame size %d exceeds remaining tag size %d", size, len(b)-headerSize)
+	}
+	frame.Data = b[headerSize : headerSize+int(size)]
+
+	return frame, b[headerSize+int(size):], nil
+}
+
+// Content returns the content of a frame of a tag of a version with the
+// format flags applied. It returns nil if the frame is compressed or
+// encrypted.
+func (f Frame) Content(major uint8) []byte {
+	data := f.Data
+
+	switch major {
+	case 3:
+		// Compression, encryption.
+		if f.Flags&0x00c0 != 0 {
+			return nil
+		}
+		// Grouping identity.
+		if f.Flags&0x0020 != 0 && len(data) > 0 {
+			data = data[1:]
+		}
+	case 4:
+		// Compression, encryption.
+		if f.Flags&0x000c != 0 {
+			return nil
+		}
+		// Grouping identity.
+		if f.Flags&0x0040 != 0 && len(data) > 0 {
+			data = data[1:]
+		}
+		if f.Flags&0x0002 != 0 {
+			data = RemoveUnsync(data)
+		}
+		// Data length indicator.
+		if f.Flags&0x0001 != 0 && len(data) >= 4 {
+			data = data[4:]
+		}
+	}
+	return data
+}
+
+// TextFrame returns a text information frame, e.g. TIT2, with the values
+// of the text, in ISO-8859-1 if it can be encoded in it, and otherwise in
+// UTF-16 for ID3v2.3 tags and UTF-8 for ID3v2.4 tags. Values are separated
+// by NUL bytes in ID3v2.4 tags and by "/" in older tags.
+func TextFrame(major uint8, id string, values ...string) Frame {
+	var (
+		sep = "/"
+		enc = byte(EncodingLatin1)
+	)
+	if major >= 4 {
+		sep = "\x00"
+	}
+	text := strings.Join(values, sep)
+	if _, ok := EncodeLatin1(text); !ok {
+		enc = EncodingUTF16
+		if major >= 4 {
+			enc = EncodingUTF8
+		}
+	}
+	return Frame{ID: id, Data: append([]byte{enc}, EncodeText(enc, text)...)}
+}
+
+// DecodeTextFrame decodes the values of the data of a text information
+// frame, see Frame.Content.
+func DecodeTextFrame(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	var (
+		enc    = data[0]
+		values []string
+		rest   = data[1:]
+	)
+	for len(rest) > 0 {
+		var value []byte
+		value, rest = SplitTerminated(enc, rest)
+		if s := DecodeText(enc, value); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// SplitTerminated splits b at the first string terminator for a text
+// encoding. The terminator itself is dropped.
+func SplitTerminated(enc byte, b []byte) (head, rest []byte) {
+	if enc == EncodingUTF16 || enc == EncodingUTF16BE {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[:i], b[i+2:]
+			}
+		}
+		return b, nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+	return b, nil
+}
+
+// DecodeText decodes a string with a text encoding.
+func DecodeText(enc byte, b []byte) string {
+	switch enc {
+	case EncodingUTF16:
+		// UTF-16 with a byte order mark.
+		if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+			return DecodeUTF16(b[2:], binary.LittleEndian)
+		}
+		if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+			b = b[2:]
+		}
+		return DecodeUTF16(b, binary.BigEndian)
+	case EncodingUTF16BE:
+		return DecodeUTF16(b, binary.BigEndian)
+	case EncodingUTF8:
+		return strings.TrimRight(string(b), "\x00")
+	default:
+		return DecodeLatin1(b)
+	}
+}
+
+// EncodeText encodes a string with a text encoding. Characters that
+// can't be encoded in ISO-8859-1 are dropped.
+func EncodeText(enc byte, s string) []byte {
+	switch enc {
+	case EncodingLatin1:
+		latin1, _ := EncodeLatin1(s)
+		return latin1
+	case EncodingUTF16:
+		b := []byte{0xff, 0xfe}
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = binary.LittleEndian.AppendUint16(b, u)
+		}
+		return b
+	case EncodingUTF16BE:
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = binary.BigEndian.AppendUint16(b, u)
+		}
+		return b
+	default:
+		return []byte(s)
+	}
+}
+
+// DecodeLatin1 decodes ISO-8859-1 text, up to the first NUL byte.
+func DecodeLatin1(b []byte) string {
+	runes := make([]rune, 0, len(b))
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+		runes = append(runes, rune(c))
+	}
+	return string(runes)
+}
+
+// EncodeLatin1 encodes a string as ISO-8859-1. It returns false if the
+// string has characters that can't be encoded, which are dropped.
+func EncodeLatin1(s string) ([]byte, bool) {
+	var (
+		b  = make([]byte, 0, len(s))
+		ok = true
+	)
+	for _, r := range s {
+		if r > 0xff {
+			ok = false
+			continue
+		}
+		b = append(b, byte(r))
+	}
+	return b, ok
+}
+
+// DecodeUTF16 decodes UTF-16 text with a byte order, up to the first NUL.
+func DecodeUTF16(b []byte, order binary.ByteOrder) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := order.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,242 @@
+// Package id3 reads and writes ID3v2 tags at the level of their frames,
+// for programs that need frames that sndtag doesn't map to properties,
+// e.g. to copy private frames between files or to inspect their flags.
+// See http://id3.org/id3v2.4.0-structure.
+//
+// Tags are read with their frames as they are stored, so that they can be
+// written back without being decoded, and ID3v2.2 frames keep their 3-byte
+// IDs. Tags are written without unsynchronisation, extended header or
+// footer.
+package id3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Header flags.
+const (
+	FlagUnsync         = 0x80
+	FlagExtendedHeader = 0x40
+	FlagFooter         = 0x10
+)
+
+// footerSize is the size of the optional ID3v2.4 footer.
+const footerSize = 10
+
+// A Tag is an ID3v2 tag.
+type Tag struct {
+	// Major and Revision are the version of the tag,
+	// e.g. 4 and 0 for ID3v2.4.0.
+	Major    uint8
+	Revision uint8
+	Flags    uint8
+
+	Frames []Frame
+
+	// Padding is the number of zero bytes after the frames.
+	Padding int
+}
+
+// Read reads a tag, starting with the "ID3" identifier. The buffer for
+// the tag grows as it is read, so a header that claims a large size
+// doesn't allocate more than the stream holds.
+func Read(r io.Reader) (*Tag, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size, err := headerSize(header)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(header)
+	if _, err := io.CopyN(&buf, r, size); err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	t, _, err := Parse(buf.Bytes())
+	return t, err
+}
+
+// Parse parses the tag at the start of b, starting with the "ID3"
+// identifier, and returns the bytes that follow it. The data of the
+// frames refers to b instead of being copied, unless the whole tag
+// is unsynchronised.
+func Parse(b []byte) (*Tag, []byte, error) {
+	if len(b) < 10 {
+		return nil, nil, fmt.Errorf("truncated ID3v2 header")
+	}
+	size, err := headerSize(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if size > int64(len(b)-10) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	t := &Tag{Major: b[3], Revision: b[4], Flags: b[5]}
+
+	body := b[10 : 10+Synchsafe(b[6:10])]
+	if err := t.parse(body); err != nil {
+		return nil, nil, err
+	}
+	return t, b[10+size:], nil
+}
+
+// headerSize checks a tag header and returns the size of the tag after it,
+// including the footer.
+func headerSize(header []byte) (int64, error) {
+	if string(header[:3]) != "ID3" {
+		return 0, fmt.Errorf("expected ID3v2 tag, got %q", header[:3])
+	}
+	if header[3] < 2 || header[3] > 4 {
+		return 0, fmt.Errorf("unsupported ID3v2 version 2.%d", header[3])
+	}
+	size := Synchsafe(header[6:10])
+	if header[5]&FlagFooter != 0 {
+		size += footerSize
+	}
+	return size, nil
+}
+
+// parse parses the frames of the body of a tag.
+func (t *Tag) parse(body []byte) error {
+	// ID3v2.4 unsynchronises each frame separately.
+	if t.Flags&FlagUnsync != 0 && t.Major < 4 {
+		body = RemoveUnsync(body)
+	}
+	body, err := SkipExtendedHeader(t.Major, t.Flags, body)
+	if err != nil {
+		return err
+	}
+	for len(body) > 0 {
+		// Padding starts with a zero byte.
+		if body[0] == 0 {
+			t.Padding = len(body)
+			break
+		}
+		frame, rest, err := ParseFrame(t.Major, body)
+		if err != nil {
+			return err
+		}
+		t.Frames = append(t.Frames, frame)
+		body = rest
+	}
+	return nil
+}
+
+// SkipExtendedHeader returns the body of a tag of a version and with
+// header flags without its extended header.
+func SkipExtendedHeader(major, flags uint8, body []byte) ([]byte, error) {
+	if major < 3 || flags&FlagExtendedHeader == 0 {
+		return body, nil
+	}
+	if len(body) < 4 {
+		return nil, fmt.Errorf("truncated ID3v2 extended header")
+	}
+	var size int64
+	if major == 3 {
+		// The ID3v2.3 size excludes the size field itself.
+		size = int64(binary.BigEndian.Uint32(body)) + 4
+	} else {
+		size = Synchsafe(body[:4])
+	}
+	if size > int64(len(body)) {
+		return nil, fmt.Errorf("ID3v2 extended header size %d exceeds tag size %d", size, len(body))
+	}
+	return body[size:], nil
+}
+
+// Encode encodes the tag, including the "ID3" identifier, followed by
+// its padding. ID3v2.2 tags can't be written.
+func (t *Tag) Encode() []byte {
+	var body bytes.Buffer
+
+	for _, frame := range t.Frames {
+		body.WriteString(frame.ID)
+		if t.Major == 4 {
+			body.Write(EncodeSynchsafe(int64(len(frame.Data))))
+		} else {
+			_ = binary.Write(&body, binary.BigEndian, uint32(len(frame.Data)))
+		}
+		_ = binary.Write(&body, binary.BigEndian, frame.Flags)
+		body.Write(frame.Data)
+	}
+	body.Write(make([]byte, t.Padding))
+
+	tag := []byte{'I', 'D', '3', t.Major, 0, 0}
+	tag = append(tag, EncodeSynchsafe(int64(body.Len()))...)
+	return append(tag, body.Bytes()...)
+}
+
+// Find returns the first frame with an ID and whether there is one.
+func (t *Tag) Find(id string) (Frame, bool) {
+	for _, frame := range t.Frames {
+		if frame.ID == id {
+			return frame, true
+		}
+	}
+	return Frame{}, false
+}
+
+// Set replaces the first frame with the ID of frame, keeping its position,
+// and removes any other frames with the same ID. The frame is added at the
+// end if the tag doesn't have one.
+func (t *Tag) Set(frame Frame) {
+	var (
+		frames   = t.Frames[:0]
+		replaced bool
+	)
+	for _, f := range t.Frames {
+		if f.ID != frame.ID {
+			frames = append(frames, f)
+			continue
+		}
+		if !replaced {
+			frames = append(frames, frame)
+			replaced = true
+		}
+	}
+	if !replaced {
+		frames = append(frames, frame)
+	}
+	t.Frames = frames
+}
+
+// Remove removes the frames with an ID.
+func (t *Tag) Remove(id string) {
+	frames := t.Frames[:0]
+	for _, f := range t.Frames {
+		if f.ID != id {
+			frames = append(frames, f)
+		}
+	}
+	t.Frames = frames
+}
+
+// Synchsafe decodes a 4-byte synchsafe integer, which uses 7 bits per byte.
+func Synchsafe(b []byte) int64 {
+	return int64(b[0]&0x7f)<<21 | int64(b[1]&0x7f)<<14 | int64(b[2]&0x7f)<<7 | int64(b[3]&0x7f)
+}
+
+// EncodeSynchsafe encodes a 4-byte synchsafe integer.
+func EncodeSynchsafe(n int64) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
+
+// RemoveUnsync reverses the unsynchronisation scheme,
+// which inserts a zero byte after every 0xFF byte.
+func RemoveUnsync(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package id3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tag := &Tag{Major: 3, Frames: []Frame{{ID: "TIT2", Data: append([]byte{0}, "Title"...)}}, Padding: 8}
+	valid := tag.Encode()
+
+	for _, tc := range []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{name: "valid", b: valid},
+		{name: "truncated", b: valid[:len(valid)-4], err: io.ErrUnexpectedEOF},
+		{name: "huge size", b: []byte{'I', 'D', '3', 3, 0, 0, 0x7f, 0x7f, 0x7f, 0x7f, 'T', 'I', 'T', '2'}, err: io.ErrUnexpectedEOF},
+		{name: "no header", b: []byte("ID3"), err: io.ErrUnexpectedEOF},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			got, err := Read(bytes.NewReader(tc.b))
+			runtime.ReadMemStats(&after)
+
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+				t.Errorf("allocated %d bytes for a %d-byte stream", allocated, len(tc.b))
+			}
+			if tc.err != nil {
+				return
+			}
+			if frame, ok := got.Find("TIT2"); !ok || string(frame.Data[1:]) != "Title" || got.Padding != 8 {
+				t.Errorf("got %+v", got)
+			}
+		})
+	}
+}
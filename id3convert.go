@@ -0,0 +1,309 @@
+package sndtag
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// id3v24Only are the frames of ID3v2.4 that ID3v2.3 doesn't have and that
+// are dropped when a tag is converted to ID3v2.3. TDRC, TDOR and TIPL are
+// converted instead.
+var id3v24Only = map[string]bool{
+	"ASPI": true,
+	"EQU2": true,
+	"RVA2": true,
+	"SEEK": true,
+	"SIGN": true,
+	"TDEN": true,
+	"TDRL": true,
+	"TDTG": true,
+	"TMCL": true,
+	"TMOO": true,
+	"TPRO": true,
+	"TSST": true,
+}
+
+// id3v23Only are the frames of ID3v2.3 that ID3v2.4 doesn't have and that
+// are dropped when a tag is converted to ID3v2.4. TYER, TDAT, TIME, TORY
+// and IPLS are converted instead.
+var id3v23Only = map[string]bool{
+	"EQUA": true,
+	"RVAD": true,
+	"TRDA": true,
+	"TSIZ": true,
+}
+
+// ConvertID3v2 returns a Repair that converts the ID3v2 tags at the start
+// of a file to ID3v2.major, where major is 3 or 4, so that a library can be
+// standardized on one version. Tags that already have that version are
+// left alone. The dates are converted between the TYER, TDAT and TIME
+// frames of ID3v2.3 and the TDRC frame of ID3v2.4, and text is re-encoded
+// in the encodings of the version. Frames that the version doesn't have
+// are dropped, and so are ID3v2.2 frames that have no ID3v2.3 equivalent
+// and frames whose text can't be re-encoded, e.g. SYLT frames in UTF-8.
+// Other versions leave files unchanged.
+//
+// Use it with RepairFile, e.g.
+//
+//	fixes, err := sndtag.RepairFile(path, sndtag.ConvertID3v2(4))
+func ConvertID3v2(major int) Repair {
+	return func(b []byte) ([]byte, []Fix) {
+		if (major != 3 && major != 4) || !bytes.HasPrefix(b, []byte("ID3")) {
+			return b, nil
+		}
+		tags, rest, err := parseID3v2Tags(b, 0, options{})
+		if err != nil {
+			return b, nil
+		}
+		var (
+			converted []byte
+			fixes     []Fix
+		)
+		for _, tag := range tags {
+			if int(tag.header.Major) == major {
+				converted = append(converted, b[tag.offset:tag.offset+10+tag.size()]...)
+				continue
+			}
+			t, dropped := tag.convert(uint8(major))
+			fixes = append(fixes, Fix{
+				Offset:      tag.offset,
+				Description: fmt.Sprintf("converted ID3v2.%d tag to ID3v2.%d", tag.header.Major, major),
+			})
+			for _, id := range dropped {
+				fixes = append(fixes, Fix{
+					Offset:      tag.offset,
+					Description: fmt.Sprintf("dropped ID3v2 frame %q, which can't be converted to ID3v2.%d", id, major),
+				})
+			}
+			converted = append(converted, t.encode(tag.padding)...)
+		}
+		if len(fixes) == 0 {
+			return b, nil
+		}
+		return append(converted, rest...), fixes
+	}
+}
+
+// ConvertID3v1 returns a Repair that moves the ID3v1 tag at the end of a
+// file to an ID3v2.major tag at its start, where major is 3 or 4. The
+// fields of the ID3v1 tag are added to the first ID3v2 tag if the file has
+// one, unless it has them already, and the ID3v2 tags are converted to
+// ID3v2.major too, see ConvertID3v2. Otherwise a new tag is added.
+// Other versions leave files unchanged.
+func ConvertID3v1(major int) Repair {
+	return func(b []byte) ([]byte, []Fix) {
+		if (major != 3 && major != 4) || len(b) < id3v1Size || string(b[len(b)-id3v1Size:len(b)-id3v1Size+3]) != "TAG" {
+			return b, nil
+		}
+		var (
+			original = b
+			offset   = len(b) - id3v1Size
+			v1       = decodeID3v1(b[offset:], int64(offset), options{})
+			t        = &id3v2{header: id3v2Header{Major: uint8(major)}, metadata: map[string]string{}}
+			size     int64
+		)
+		b, fixes := ConvertID3v2(major)(b[:offset:offset])
+
+		if bytes.HasPrefix(b, []byte("ID3")) {
+			tags, _, err := parseID3v2Tags(b, 0, options{})
+			if err != nil {
+				return original, nil
+			}
+			t = tags[0]
+			t.frames = mergeID3v2Frames(tags[:1], uint8(major))
+			size = 10 + t.size()
+		}
+		tags := TagSet{}
+		for _, prop := range []string{KeyTitle, KeyArtist, KeyAlbum, KeyYear, KeyComment, KeyTrack, KeyGenre} {
+			if _, ok := t.metadata[prop]; !ok && v1[prop] != "" {
+				tags[prop] = v1[prop]
+			}
+		}
+		if err := t.update(tags); err != nil {
+			return original, nil
+		}
+
+		// Keep the size of an existing tag if the new frames fit in its padding.
+		tag := t.encode(0)
+		padding := id3v2DefaultPadding
+		if int64(len(tag)) <= size {
+			padding = int(size) - len(tag)
+		}
+		fixes = append(fixes, Fix{
+			Offset:      int64(offset),
+			Description: fmt.Sprintf("moved ID3v1 tag to ID3v2.%d tag", major),
+		})
+		return append(t.encode(padding), b[size:]...), fixes
+	}
+}
+
+// convert returns a copy of the tag converted to ID3v2.major, along with
+// the IDs of the frames that were dropped.
+func (t *id3v2) convert(major uint8) (*id3v2, []string) {
+	var (
+		c       = &id3v2{header: id3v2Header{Major: major}, metadata: map[string]string{}}
+		dropped []string
+		dates   = map[string]string{}
+	)
+	for _, frame := range mergeID3v2Frames([]*id3v2{t}, major) {
+		switch {
+		case frame.ID == ID3v2FrameYear || frame.ID == "TDAT" || frame.ID == "TIME" || frame.ID == ID3v2FrameRecordingTime:
+			// The dates are merged below.
+			if len(frame.Data) > 0 {
+				dates[frame.ID] = decodeTextFrame(frame.Data, nil)
+			}
+			continue
+		case frame.ID == ID3v2FrameOriginalYear && major == 4:
+			frame.ID = ID3v2FrameOriginalTime
+		case frame.ID == ID3v2FrameOriginalTime && major == 3:
+			frame.ID = ID3v2FrameOriginalYear
+		case frame.ID == "IPLS" && major == 4:
+			frame.ID = "TIPL"
+		case frame.ID == "TIPL" && major == 3:
+			frame.ID = "IPLS"
+		case major == 4 && id3v23Only[frame.ID], major == 3 && id3v24Only[frame.ID]:
+			dropped = append(dropped, frame.ID)
+			continue
+		}
+		data, ok := c.reencode(frame)
+		if !ok {
+			dropped = append(dropped, frame.ID)
+			continue
+		}
+		if frame.ID == ID3v2FrameOriginalYear && len(data) > 0 {
+			// TORY only has the year.
+			if year := decodeTextFrame(data, nil); len(year) > 4 {
+				data = c.encodeTextFrame(year[:4])
+			}
+		}
+		c.frames = append(c.frames, id3v2Frame{ID: frame.ID, Flags: frame.Flags, Data: data})
+	}
+	c.frames = append(c.frames, c.dateFrames(dates)...)
+	return c, dropped
+}
+
+// id3v2EncodedFrames are the frames other than text information frames
+// that start with a text encoding.
+var id3v2EncodedFrames = map[string]bool{
+	ID3v2FrameComment: true,
+	ID3v2FrameLyrics:  true,
+	ID3v2FramePicture: true,
+	ID3v2FrameObject:  true,
+	"COMR":            true,
+	"IPLS":            true,
+	"OWNE":            true,
+	"SYLT":            true,
+	"USER":            true,
+	"WXXX":            true,
+}
+
+// reencode re-encodes the text of a frame in an encoding of the version of
+// the tag, which only matters for tags converted to ID3v2.3 since it
+// doesn't have the UTF-16BE and UTF-8 encodings of ID3v2.4. It returns
+// false for frames that use those encodings and can't be re-encoded.
+func (t *id3v2) reencode(frame id3v2Frame) ([]byte, bool) {
+	data := frame.Data
+	if t.header.Major >= 4 || len(data) == 0 || !strings.HasPrefix(frame.ID, "T") && !id3v2EncodedFrames[frame.ID] {
+		return data, true
+	}
+	if data[0] < 2 {
+		return data, true
+	}
+	enc := data[0]
+	switch frame.ID {
+	case ID3v2FrameComment, ID3v2FrameLyrics:
+		return t.encodeComment(decodeComment(data, nil)), true
+	case ID3v2FrameUserText:
+		return t.encodeUserText(decodeUserText(data, nil)), true
+	case "WXXX":
+		desc, url := splitTerminated(enc, data[1:])
+		return t.encodeTerminated(nil, []string{decodeText(enc, desc, nil)}, url), true
+	case ID3v2FramePicture:
+		mime, rest := splitTerminated(0, data[1:])
+		if len(rest) == 0 {
+			return nil, false
+		}
+		desc, img := splitTerminated(enc, rest[1:])
+		prefix := append(append([]byte(nil), mime...), 0, rest[0])
+		return t.encodeTerminated(prefix, []string{decodeText(enc, desc, nil)}, img), true
+	case ID3v2FrameObject:
+		mime, _ := splitTerminated(0, data[1:])
+		obj := decodeObject(data, nil)
+		prefix := append(append([]byte(nil), mime...), 0)
+		return t.encodeTerminated(prefix, []string{obj.Filename, obj.Description}, obj.Data), true
+	case "COMR", "IPLS", "OWNE", "SYLT", "USER":
+		return nil, false
+	}
+	return t.encodeTextFrame(decodeTextFrame(data, nil)), true
+}
+
+// encodeTerminated encodes the data of a frame that is made of a text
+// encoding, a prefix that isn't encoded, terminated strings and a suffix
+// that isn't encoded, e.g. the image of an APIC frame.
+func (t *id3v2) encodeTerminated(prefix []byte, texts []string, suffix []byte) []byte {
+	enc := t.textEncoding(strings.Join(texts, ""))
+	data := append([]byte{enc}, prefix...)
+	for _, s := range texts {
+		data = append(data, encodeText(enc, s)...)
+		if enc == 1 {
+			data = append(data, 0, 0)
+		} else {
+			data = append(data, 0)
+		}
+	}
+	return append(data, suffix...)
+}
+
+// dateFrames returns the frames for the date of a recording, given the
+// text of the TYER, TDAT, TIME and TDRC frames of a tag. ID3v2.3 splits
+// the date into the year, the day and month as DDMM, and the time as HHMM,
+// while ID3v2.4 has a single timestamp, e.g. "2001-05-31T18:30".
+func (t *id3v2) dateFrames(dates map[string]string) []id3v2Frame {
+	var (
+		year = dates[ID3v2FrameYear]
+		day  = dates["TDAT"]
+		hour = dates["TIME"]
+	)
+	if ts := dates[ID3v2FrameRecordingTime]; ts != "" {
+		year, day, hour = splitTimestamp(ts)
+	}
+	if year == "" {
+		return nil
+	}
+	if t.header.Major >= 4 {
+		ts := year
+		if len(day) == 4 {
+			ts += "-" + day[2:4] + "-" + day[0:2]
+			if len(hour) == 4 {
+				ts += "T" + hour[0:2] + ":" + hour[2:4]
+			}
+		}
+		return []id3v2Frame{{ID: ID3v2FrameRecordingTime, Data: t.encodeTextFrame(ts)}}
+	}
+	frames := []id3v2Frame{{ID: ID3v2FrameYear, Data: t.encodeTextFrame(year)}}
+	if day != "" {
+		frames = append(frames, id3v2Frame{ID: "TDAT", Data: t.encodeTextFrame(day)})
+	}
+	if hour != "" {
+		frames = append(frames, id3v2Frame{ID: "TIME", Data: t.encodeTextFrame(hour)})
+	}
+	return frames
+}
+
+// splitTimestamp splits an ID3v2.4 timestamp, "yyyy-MM-ddTHH:mm:ss" or
+// the start of it, into the year, the day and month as DDMM and the time
+// as HHMM of ID3v2.3. The parts that the timestamp doesn't have are empty.
+func splitTimestamp(ts string) (year, day, hour string) {
+	if len(ts) < 4 {
+		return ts, "", ""
+	}
+	year = ts[:4]
+	if len(ts) >= 10 && ts[4] == '-' && ts[7] == '-' {
+		day = ts[8:10] + ts[5:7]
+	}
+	if len(ts) >= 16 && ts[10] == 'T' && ts[13] == ':' {
+		hour = ts[11:13] + ts[14:16]
+	}
+	return year, day, hour
+}
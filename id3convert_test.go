@@ -0,0 +1,154 @@
+package sndtag
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConvertID3v2(t *testing.T) {
+	utf8 := func(fields ...string) []byte {
+		return append([]byte{3}, strings.Join(fields, "\x00")...)
+	}
+	for _, tc := range []struct {
+		name    string
+		major   int
+		file    []byte
+		want    map[string]string
+		dropped []string
+	}{
+		{
+			name:  "v2.4 to v2.3",
+			major: 3,
+			file: testMP3(testID3v2(4,
+				testFrame(ID3v2FrameTitle, utf8("Café")),
+				testFrame(ID3v2FrameRecordingTime, utf8("2001-05-31T18:30")),
+				testFrame(ID3v2FrameLyrics, utf8("engLyrics", "Là")),
+				testFrame("WXXX", utf8("Site", "http://example.com")),
+				testFrame(ID3v2FramePicture, append(utf8("image/jpeg", "\x03Cover", ""), 0xff, 0xd8)),
+				testFrame(ID3v2FrameObject, append(utf8("text/plain", "a.txt", "Notes", ""), "data"...)),
+				testFrame("SYLT", utf8("eng\x02\x01", "Là", "")),
+				testFrame(ID3v2FrameReleaseTime, utf8("2002")),
+			)),
+			want: map[string]string{
+				KeyTitle: "Café", KeyYear: "2001", KeyUnsyncedLyricsText(1): "Là",
+				KeyArtworkDescription(1): "Cover", KeyObjectFilename(1): "a.txt", KeyObjectDescription(1): "Notes",
+			},
+			dropped: []string{"SYLT", ID3v2FrameReleaseTime},
+		},
+		{
+			name:    "v2.3 to v2.4",
+			major:   4,
+			file:    testMP3(testID3v2(3, testTextFrame(ID3v2FrameYear, "2001"), testTextFrame("TDAT", "3105"), testTextFrame("TIME", "1830"), testFrame("RVAD", []byte{0, 16}))),
+			want:    map[string]string{KeyYear: "2001-05-31T18:30"},
+			dropped: []string{"RVAD"},
+		},
+		{
+			name:  "same version",
+			major: 3,
+			file:  testMP3(testID3v2(3, testTextFrame(ID3v2FrameTitle, "Title"))),
+		},
+		{
+			name:  "unsupported version",
+			major: 2,
+			file:  testMP3(testID3v2(3, testTextFrame(ID3v2FrameTitle, "Title"))),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, fixes := ConvertID3v2(tc.major)(tc.file)
+			if tc.want == nil {
+				if !bytes.Equal(b, tc.file) || len(fixes) > 0 {
+					t.Fatalf("got changes %v", fixes)
+				}
+				return
+			}
+			if int(b[3]) != tc.major {
+				t.Errorf("got ID3v2.%d", b[3])
+			}
+			tags, _, err := parseID3v2Tags(b, 0, options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, frame := range tags[0].frames {
+				if tc.major == 3 && id3v2EncodedFrames[frame.ID] && frame.Data[0] > 1 {
+					t.Errorf("%s frame has encoding %d", frame.ID, frame.Data[0])
+				}
+			}
+			for _, id := range tc.dropped {
+				found := false
+				for _, fix := range fixes {
+					found = found || strings.Contains(fix.Description, `"`+id+`"`)
+				}
+				if !found {
+					t.Errorf("%s is not listed in %v", id, fixes)
+				}
+			}
+			metadata, err := NewFromBytes(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tc.want {
+				if got := metadata[key]; got != want {
+					t.Errorf("%s: got %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertID3v1(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		file  []byte
+		want  map[string]string
+		fixes int
+	}{
+		{
+			name:  "ID3v1 only",
+			file:  append(testMP3(nil), testID3v1("Title")...),
+			want:  map[string]string{KeyTitle: "Title", KeyID3v2Version: "2.3.0"},
+			fixes: 1,
+		},
+		{
+			name:  "ID3v2 has the title",
+			file:  append(testMP3(testID3v2(3, testTextFrame(ID3v2FrameTitle, "Other"))), testID3v1("Title")...),
+			want:  map[string]string{KeyTitle: "Other"},
+			fixes: 1,
+		},
+		{
+			name:  "ID3v2.4 is converted",
+			file:  append(testMP3(testID3v2(4, testTextFrame(ID3v2FrameArtist, "Artist"))), testID3v1("Title")...),
+			want:  map[string]string{KeyTitle: "Title", KeyArtist: "Artist", KeyID3v2Version: "2.3.0"},
+			fixes: 2,
+		},
+		{
+			name: "no ID3v1",
+			file: testMP3(testID3v2(3)),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, fixes := ConvertID3v1(3)(tc.file)
+			if len(fixes) != tc.fixes {
+				t.Fatalf("got fixes %v, want %d", fixes, tc.fixes)
+			}
+			if tc.fixes == 0 {
+				if !bytes.Equal(b, tc.file) {
+					t.Error("file was changed")
+				}
+				return
+			}
+			if bytes.Contains(b[len(b)-id3v1Size:], []byte("TAG")) {
+				t.Error("the ID3v1 tag is still there")
+			}
+			metadata, err := NewFromBytes(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tc.want {
+				if got := metadata[key]; got != want {
+					t.Errorf("%s: got %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,668 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/briansorahan/sndtag/id3"
+)
+
+// ID3v2 header flags.
+const (
+	id3v2FlagUnsync         = id3.FlagUnsync
+	id3v2FlagExtendedHeader = id3.FlagExtendedHeader
+	id3v2FlagFooter         = id3.FlagFooter
+)
+
+// id3v2FooterSize is the size of the optional ID3v2.4 footer.
+const id3v2FooterSize = 10
+
+// id3v2Header is the part of the ID3v2 header that follows the "ID3" identifier.
+type id3v2Header struct {
+	Major    uint8
+	Revision uint8
+	Flags    uint8
+	Size     [4]byte
+}
+
+// id3v2 parses ID3v2 tags.
+// See http://id3.org/id3v2.4.0-structure for more info.
+type id3v2 struct {
+	header   id3v2Header
+	frames   []id3v2Frame
+	metadata map[string]string
+	opts     options
+
+	// padding is the number of padding bytes after the frames.
+	padding int
+
+	// dropped are the IDs of the ID3v2.2 frames that have no ID3v2.3
+	// equivalent, and aren't kept.
+	dropped []string
+
+	// offset is the offset of the tag in the file. body is the tag body
+	// that frame offsets are relative to, or nil if the tag was
+	// unsynchronised as a whole.
+	offset int64
+	body   []byte
+}
+
+// id3v2Frame is a single frame of an ID3v2 tag, see id3.Frame.
+type id3v2Frame = id3.Frame
+
+// id3v2Frames maps ID3v2.3/2.4 frame IDs to property names.
+var id3v2Frames = map[string]string{
+	ID3v2FrameAlbum:         KeyAlbum,
+	ID3v2FrameGenre:         KeyGenre,
+	ID3v2FrameRecordingTime: KeyYear,
+	ID3v2FrameTitle:         KeyTitle,
+	ID3v2FrameArtist:        KeyArtist,
+	ID3v2FrameBand:          KeyAlbumArtist,
+	ID3v2FrameTrack:         KeyTrack,
+	ID3v2FrameYear:          KeyYear,
+	ID3v2FrameComment:       KeyComment,
+	ID3v2FrameGrouping:      KeyGrouping,
+	ID3v2FrameMovementName:  KeyMovementName,
+	ID3v2FrameOriginalTime:  KeyOriginalReleaseDate,
+	ID3v2FrameOriginalYear:  KeyOriginalReleaseDate,
+	ID3v2FrameReleaseTime:   KeyReleaseDate,
+	ID3v2FramePublisher:     KeyLabel,
+	ID3v2FrameMedia:         KeyMedia,
+}
+
+// id3v22Frames maps ID3v2.2 frame IDs to their ID3v2.3 equivalents, which
+// have the same format. PIC frames are converted, see convertID3v22Picture.
+var id3v22Frames = map[string]string{
+	"BUF": "RBUF",
+	"CNT": "PCNT",
+	"COM": "COMM",
+	"CRA": "AENC",
+	"EQU": "EQUA",
+	"ETC": "ETCO",
+	"GEO": "GEOB",
+	"IPL": "IPLS",
+	"MCI": "MCDI",
+	"MLL": "MLLT",
+	"POP": "POPM",
+	"REV": "RVRB",
+	"RVA": "RVAD",
+	"SLT": "SYLT",
+	"STC": "SYTC",
+	"TAL": "TALB",
+	"TBP": "TBPM",
+	"TCM": "TCOM",
+	"TCO": "TCON",
+	"TCR": "TCOP",
+	"TDA": "TDAT",
+	"TDY": "TDLY",
+	"TEN": "TENC",
+	"TFT": "TFLT",
+	"TIM": "TIME",
+	"TKE": "TKEY",
+	"TLA": "TLAN",
+	"TLE": "TLEN",
+	"TMT": "TMED",
+	"TOA": "TOPE",
+	"TOF": "TOFN",
+	"TOL": "TOLY",
+	"TOR": "TORY",
+	"TOT": "TOAL",
+	"TP1": "TPE1",
+	"TP2": "TPE2",
+	"TP3": "TPE3",
+	"TP4": "TPE4",
+	"TPA": "TPOS",
+	"TPB": "TPUB",
+	"TRC": "TSRC",
+	"TRD": "TRDA",
+	"TRK": "TRCK",
+	"TSI": "TSIZ",
+	"TSS": "TSSE",
+	"TT1": "TIT1",
+	"TT2": "TIT2",
+	"TT3": "TIT3",
+	"TXT": "TEXT",
+	"TXX": "TXXX",
+	"TYE": "TYER",
+	"UFI": "UFID",
+	"ULT": "USLT",
+	"WAF": "WOAF",
+	"WAR": "WOAR",
+	"WAS": "WOAS",
+	"WCM": "WCOM",
+	"WCP": "WCOP",
+	"WPB": "WPUB",
+	"WXX": "WXXX",
+}
+
+// id3v22ImageFormats maps the image formats of ID3v2.2 PIC frames to MIME
+// types.
+var id3v22ImageFormats = map[string]string{
+	"JPG": "image/jpeg",
+	"PNG": "image/png",
+	"GIF": "image/gif",
+	"BMP": "image/bmp",
+	"-->": "-->",
+}
+
+// convertID3v22Picture converts the data of an ID3v2.2 PIC frame to the
+// data of an APIC frame, which has a MIME type instead of a 3-character
+// image format. The "-->" format, a link to the image, is kept as is.
+func convertID3v22Picture(data []byte) ([]byte, bool) {
+	if len(data) < 5 {
+		return nil, false
+	}
+	format := strings.ToUpper(string(data[1:4]))
+	mime, ok := id3v22ImageFormats[format]
+	if !ok {
+		mime = "image/" + strings.ToLower(format)
+	}
+	apic := append([]byte{data[0]}, mime...)
+	apic = append(apic, 0)
+	return append(apic, data[4:]...), true
+}
+
+// newID3v2 creates a new map that contains properties from ID3v2 tags.
+// Note that the "ID3" identifier has already been read
+// by the time this function is called.
+//
+// Some taggers prepend a new tag without removing the old one,
+// so every tag found back-to-back at the start of the stream is parsed.
+// When tags disagree the tag closest to the start of the stream wins,
+// since it is the one most recently written. Later tags only fill in
+// properties that are missing from earlier ones, and comments are
+// taken from the first tag that has any.
+// The number of tags that were found is stored as the "ID3v2TagCount" property,
+// anything other than 1 means the file should be repaired.
+func newID3v2(r io.Reader, o options) (map[string]string, error) {
+	tags, rest, err := readID3v2Tags(r, o)
+	if err != nil {
+		return nil, err
+	}
+	metadata := mergeID3v2Metadata(tags)
+
+	// Lossless formats like TTA are often tagged with ID3v2.
+	if isLegacyPrefix(rest) {
+		legacy, err := newLegacy(r, rest, o)
+		if err != nil {
+			return nil, err
+		}
+		o.mergeTags(metadata, legacy)
+	}
+
+	// Some taggers also write an ID3v1 tag at the end of the file.
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if err := readID3v1(rs, metadata, o); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// mergeID3v2Metadata merges the properties of tags that appear back-to-back,
+// giving priority to the earlier tags, unless WithDuplicateKeys says
+// otherwise. See newID3v2.
+func mergeID3v2Metadata(tags []*id3v2) map[string]string {
+	metadata := map[string]string{}
+
+	for _, tag := range tags {
+		_, hasComments := metadata[KeyComments]
+		_, hasObjects := metadata[KeyObjects]
+		_, hasLyrics := metadata[KeyUnsyncedLyrics]
+		_, hasVolumes := metadata[KeyRelativeVolumes]
+		_, hasEqs := metadata[KeyEqualizations]
+		keys := make([]string, 0, len(tag.metadata))
+		for k := range tag.metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v := tag.metadata[k]
+
+			// Comments, lyrics, objects and volume adjustments are only
+			// taken from a single tag.
+			if hasComments && strings.HasPrefix(k, KeyComment) {
+				continue
+			}
+			if hasLyrics && (k == KeyLyrics || strings.HasPrefix(k, KeyUnsyncedLyrics)) {
+				continue
+			}
+			if hasObjects && strings.HasPrefix(k, "Object") {
+				continue
+			}
+			if hasVolumes && strings.HasPrefix(k, "RelativeVolume") {
+				continue
+			}
+			if hasEqs && strings.HasPrefix(k, "Equalization") {
+				continue
+			}
+			if old, ok := metadata[k]; !ok || tag.opts.replaces(k, old, v) {
+				metadata[k] = v
+			}
+		}
+	}
+	metadata[KeyID3v2TagCount] = strconv.Itoa(len(tags))
+
+	return metadata
+}
+
+// readID3v2Tags reads all the ID3v2 tags at the start of a stream.
+// Note that the first "ID3" identifier has already been read.
+// It also returns the bytes that were read after the last tag
+// while looking for another one.
+// If all the fields requested with WithFields have been found,
+// the tags that follow are not read.
+func readID3v2Tags(r io.Reader, o options) ([]*id3v2, []byte, error) {
+	var (
+		tags   []*id3v2
+		offset int64
+	)
+	for {
+		tag := &id3v2{metadata: map[string]string{}, opts: o, offset: offset}
+
+		if err := tag.read(r); err != nil {
+			return nil, nil, err
+		}
+		tags = append(tags, tag)
+		offset += 10 + tag.size()
+
+		if o.done(mergeID3v2Metadata(tags)) {
+			return tags, nil, nil
+		}
+
+		// Look for another tag.
+		next, err := readID3v2ID(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if string(next) != "ID3" {
+			return tags, next, nil
+		}
+	}
+}
+
+// readID3v2ID reads up to 3 bytes from an io.Reader that could be
+// the "ID3" identifier. Reaching the end of the stream is not an error.
+func readID3v2ID(r io.Reader) ([]byte, error) {
+	id := make([]byte, 3)
+	n, err := io.ReadFull(r, id)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return id[:n], err
+}
+
+// parseID3v2Tags reads all the ID3v2 tags at the start of a byte slice,
+// which starts with the "ID3" identifier and is at offset base in the file.
+// The frame data refers to the byte slice instead of being copied.
+// It also returns the bytes that follow the last tag.
+func parseID3v2Tags(b []byte, base int64, o options) ([]*id3v2, []byte, error) {
+	var (
+		tags  []*id3v2
+		start = b
+	)
+
+	for len(b) >= 3 && string(b[:3]) == "ID3" {
+		if len(b) < 10 {
+			return nil, nil, fmt.Errorf("truncated ID3v2 header")
+		}
+		tag := &id3v2{
+			metadata: map[string]string{},
+			opts:     o,
+			offset:   base + sliceOffset(start, b),
+		}
+		tag.header = id3v2Header{
+			Major:    b[3],
+			Revision: b[4],
+			Flags:    b[5],
+		}
+		copy(tag.header.Size[:], b[6:10])
+
+		if err := tag.checkVersion(); err != nil {
+			return nil, nil, err
+		}
+		size := tag.size()
+		if size > int64(len(b)-10) {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		if err := tag.parse(b[10 : 10+synchsafe(tag.header.Size[:])]); err != nil {
+			return nil, nil, err
+		}
+		tags = append(tags, tag)
+		b = b[10+size:]
+
+		if o.done(mergeID3v2Metadata(tags)) {
+			break
+		}
+	}
+	if len(tags) == 0 {
+		return nil, nil, fmt.Errorf("expected ID3v2 tag")
+	}
+	return tags, b, nil
+}
+
+// read reads a single tag, starting after the "ID3" identifier.
+func (t *id3v2) read(r io.Reader) error {
+	if err := binary.Read(r, binary.BigEndian, &t.header); err != nil {
+		return err
+	}
+	if err := t.checkVersion(); err != nil {
+		return err
+	}
+
+	body, err := readN(r, synchsafe(t.header.Size[:]))
+	if err != nil {
+		return err
+	}
+	if t.header.Flags&id3v2FlagFooter != 0 {
+		if _, err := io.ReadFull(r, make([]byte, id3v2FooterSize)); err != nil {
+			return err
+		}
+	}
+	return t.parse(body)
+}
+
+// checkVersion checks that the tag has a version we can read
+// and stores the version as a property.
+func (t *id3v2) checkVersion() error {
+	if t.header.Major < 2 || t.header.Major > 4 {
+		return fmt.Errorf("unsupported ID3v2 version 2.%d", t.header.Major)
+	}
+	t.metadata[KeyID3v2Version] = fmt.Sprintf("2.%d.%d", t.header.Major, t.header.Revision)
+	return nil
+}
+
+// size returns the size of the tag after the header, including the footer.
+func (t *id3v2) size() int64 {
+	size := synchsafe(t.header.Size[:])
+	if t.header.Flags&id3v2FlagFooter != 0 {
+		size += id3v2FooterSize
+	}
+	return size
+}
+
+// parse parses the body of a tag, i.e. everything between
+// the header and the footer.
+func (t *id3v2) parse(body []byte) error {
+	t.body = body
+
+	// ID3v2.4 unsynchronises each frame separately.
+	if t.header.Flags&id3v2FlagUnsync != 0 && t.header.Major < 4 {
+		body = removeUnsync(body)
+		t.body = nil
+	}
+	body, err := t.skipExtendedHeader(body)
+	if err != nil {
+		return err
+	}
+	return t.readFrames(body)
+}
+
+// skipExtendedHeader returns the tag body without its extended header.
+func (t *id3v2) skipExtendedHeader(body []byte) ([]byte, error) {
+	return id3.SkipExtendedHeader(t.header.Major, t.header.Flags, body)
+}
+
+// frameOffset returns the offset in the file of the frame at the start of b,
+// which is a slice of the tag body.
+func (t *id3v2) frameOffset(b []byte) int64 {
+	if t.body == nil {
+		return t.offset
+	}
+	return t.offset + 10 + sliceOffset(t.body, b)
+}
+
+// readFrames reads all the frames in a tag body and stores
+// the ones we recognize as properties.
+func (t *id3v2) readFrames(body []byte) error {
+	var (
+		comments []Comment
+		lyrics   []Lyrics
+		artworks []artwork
+		images   [][]byte
+		objects  []EncapsulatedObject
+		volumes  []RelativeVolume
+		eqs      []Equalization
+
+		// contentGroup is the TIT1 frame, which is either the work or the
+		// grouping depending on whether there is a GRP1 frame.
+		contentGroup       string
+		contentGroupSource Source
+		hasGrouping        bool
+	)
+
+	for len(body) > 0 {
+		// Padding starts with a zero byte.
+		if body[0] == 0 {
+			t.padding = len(body)
+			break
+		}
+		frame, rest, err := t.readFrame(body)
+		if err != nil {
+			return err
+		}
+		t.opts.countFrame()
+		source := Source{Tag: TagID3v2, ID: frame.ID, Offset: t.frameOffset(body)}
+		body = rest
+
+		// ID3v2.2 frames we don't know how to convert are dropped,
+		// see checkDropped.
+		if frame.ID == "" {
+			continue
+		}
+		t.frames = append(t.frames, frame)
+
+		data := t.content(frame)
+		if data == nil {
+			continue
+		}
+		switch frame.ID {
+		case ID3v2FrameComment:
+			if t.opts.wants(KeyComment) {
+				comments = append(comments, decodeComment(data, t.opts.charsets))
+				t.opts.setSource(KeyComment, source)
+			}
+			continue
+		case ID3v2FrameLyrics:
+			if t.opts.wants(KeyLyrics) || t.opts.wants(KeyUnsyncedLyrics) {
+				lyrics = append(lyrics, decodeLyrics(data, t.opts.charsets))
+				t.opts.setSource(KeyLyrics, source)
+			}
+			continue
+		case ID3v2FramePicture:
+			if t.opts.wants("Artwork") || t.opts.artwork != nil {
+				a, img := decodePicture(data, t.opts.charsets)
+				artworks, images = append(artworks, a), append(images, img)
+			}
+			continue
+		case ID3v2FrameObject:
+			if t.opts.wants(KeyObjects) {
+				objects = append(objects, decodeObject(data, t.opts.charsets))
+				t.opts.setSource(KeyObjects, source)
+			}
+			continue
+		case ID3v2FrameRelativeVol:
+			if t.opts.wants(KeyRelativeVolumes) {
+				volumes = append(volumes, decodeRelativeVolume(data))
+				t.opts.setSource(KeyRelativeVolumes, source)
+			}
+			continue
+		case ID3v2FrameEqualization:
+			if t.opts.wants(KeyEqualizations) {
+				eqs = append(eqs, decodeEqualization(data))
+				t.opts.setSource(KeyEqualizations, source)
+			}
+			continue
+		case ID3v2FrameContentGroup:
+			if contentGroup == "" && len(data) > 0 {
+				contentGroup, contentGroupSource = decodeTextFrame(data, t.opts.charsets), source
+			}
+			continue
+		case ID3v2FrameGrouping:
+			hasGrouping = true
+		case ID3v2FrameMovement:
+			number, count := splitNumber(decodeTextFrame(data, t.opts.charsets))
+			t.setFrameProperties(map[string]string{KeyMovementNumber: number, KeyMovementCount: count}, source)
+			continue
+		case ID3v2FrameUserText:
+			t.setFrameProperties(userTextProperties(data, t.opts.charsets), source)
+			continue
+		case ID3v2FrameOwnership:
+			t.setFrameProperties(decodeOwnership(data, t.opts.charsets), source)
+			continue
+		case ID3v2FrameCommercial:
+			t.setFrameProperties(decodeCommercial(data, t.opts.charsets), source)
+			continue
+		case ID3v2FramePopularimeter:
+			if !t.opts.wantsAny(KeyRating, KeyPlayCount) {
+				continue
+			}
+			if _, ok := t.metadata[KeyRating]; !ok {
+				setPopularimeter(t.metadata, decodePopularimeter(data), t.opts)
+				t.opts.setSource(KeyRating, source)
+				t.opts.setSource(KeyPlayCount, source)
+			}
+			continue
+		}
+		prop, ok := id3v2Frames[frame.ID]
+		if !ok || !t.opts.wants(prop) {
+			continue
+		}
+		if _, ok := t.metadata[prop]; ok {
+			continue
+		}
+		if len(data) > 0 {
+			t.metadata[prop] = decodeTextFrame(data, t.opts.charsets)
+			t.opts.setSource(prop, source)
+			if data[0] == 0 && t.opts.detectCharset {
+				reportCharset(t.metadata, prop, data[1:])
+			}
+		}
+	}
+	setComments(t.metadata, comments, t.opts.language)
+	setArtworks(t.metadata, artworks)
+	setObjects(t.metadata, objects)
+	setLyrics(t.metadata, lyrics, t.opts.language)
+	setRelativeVolumes(t.metadata, volumes)
+	setEqualizations(t.metadata, eqs)
+
+	// iTunes stores the work in TIT1 and the grouping in GRP1,
+	// but TIT1 is the grouping in files without a GRP1 frame.
+	if contentGroup != "" {
+		if hasGrouping {
+			t.setFrameProperties(map[string]string{KeyWork: contentGroup}, contentGroupSource)
+		} else {
+			t.setFrameProperties(map[string]string{KeyGrouping: contentGroup}, contentGroupSource)
+		}
+	}
+
+	if t.opts.artwork != nil && len(images) > 0 {
+		if _, err := t.opts.artwork.Write(images[pickArtwork(artworks)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrame reads the frame at the start of body and returns it
+// along with the bytes that follow it.
+// ID3v2.2 frames are converted to their ID3v2.3 IDs, or to an empty ID
+// if they have none.
+func (t *id3v2) readFrame(body []byte) (frame id3v2Frame, rest []byte, err error) {
+	frame, rest, err = id3.ParseFrame(t.header.Major, body)
+	if err != nil || t.header.Major != 2 {
+		return frame, rest, err
+	}
+	if frame.ID == "PIC" {
+		if data, ok := convertID3v22Picture(frame.Data); ok {
+			return id3v2Frame{ID: ID3v2FramePicture, Data: data}, rest, nil
+		}
+	}
+	id, ok := id3v22Frames[frame.ID]
+	if !ok {
+		t.dropped = append(t.dropped, frame.ID)
+	}
+	frame.ID = id
+	return frame, rest, nil
+}
+
+// content returns the content of a frame with the format flags applied.
+// It returns nil if the frame is compressed or encrypted.
+func (t *id3v2) content(frame id3v2Frame) []byte {
+	return frame.Content(t.header.Major)
+}
+
+// decodeComment decodes the data of a COMM frame.
+func decodeComment(data []byte, cs charsets) Comment {
+	if len(data) < 4 {
+		return Comment{}
+	}
+	enc := data[0]
+	desc, text := splitTerminated(enc, data[4:])
+
+	return Comment{
+		Language:    string(data[1:4]),
+		Description: decodeText(enc, desc, cs),
+		Text:        decodeText(enc, text, cs),
+	}
+}
+
+// decodeTextFrame decodes the data of a text information frame.
+// Multiple values are joined with "/", as in ID3v2.3.
+func decodeTextFrame(data []byte, cs charsets) string {
+	var (
+		enc    = data[0]
+		values []string
+		rest   = data[1:]
+	)
+	for len(rest) > 0 {
+		var value []byte
+		value, rest = splitTerminated(enc, rest)
+		if s := decodeText(enc, value, cs); s != "" {
+			values = append(values, s)
+		}
+	}
+	return strings.Join(values, "/")
+}
+
+// splitTerminated splits b at the first string terminator for the
+// given text encoding. The terminator itself is dropped.
+func splitTerminated(enc byte, b []byte) (head, rest []byte) {
+	return id3.SplitTerminated(enc, b)
+}
+
+// decodeText decodes a string with an ID3v2 text encoding.
+// Text that is declared ISO-8859-1 is decoded with cs, since many taggers
+// wrote text in the local code page instead.
+func decodeText(enc byte, b []byte, cs charsets) string {
+	if enc == id3.EncodingLatin1 {
+		return cs.decode(b)
+	}
+	return id3.DecodeText(enc, b)
+}
+
+// decodeLatin1 decodes ISO-8859-1 text.
+func decodeLatin1(b []byte) string {
+	return id3.DecodeLatin1(b)
+}
+
+// decodeUTF16 decodes UTF-16 text with the given byte order.
+func decodeUTF16(b []byte, order binary.ByteOrder) string {
+	return id3.DecodeUTF16(b, order)
+}
+
+// removeUnsync reverses the unsynchronisation scheme,
+// which inserts a zero byte after every 0xFF byte.
+func removeUnsync(b []byte) []byte {
+	return id3.RemoveUnsync(b)
+}
+
+// synchsafe decodes a 4-byte synchsafe integer, which uses 7 bits per byte.
+func synchsafe(b []byte) int64 {
+	return id3.Synchsafe(b)
+}
@@ -0,0 +1,78 @@
+package sndtag
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteID3v22(t *testing.T) {
+	picture := append([]byte{0}, "JPG"...)
+	picture = append(picture, 3, 0)
+	picture = append(picture, "\xff\xd8\xff\xe0 jpeg data"...)
+
+	for _, tc := range []struct {
+		name   string
+		frames [][]byte
+		want   map[string]string
+		err    string
+	}{
+		{
+			name: "text",
+			frames: [][]byte{
+				testID3v22Frame("TT2", []byte("\x00Title")),
+				testID3v22Frame("TCM", []byte("\x00Composer")),
+			},
+			want: map[string]string{KeyTitle: "New", KeyArtist: "Artist"},
+		},
+		{
+			name: "picture",
+			frames: [][]byte{
+				testID3v22Frame("TT2", []byte("\x00Title")),
+				testID3v22Frame("PIC", picture),
+			},
+			want: map[string]string{KeyTitle: "New", KeyArtworks: "1", "Artwork1MIMEType": "image/jpeg"},
+		},
+		{
+			name: "link",
+			frames: [][]byte{
+				testID3v22Frame("TT2", []byte("\x00Title")),
+				testID3v22Frame("LNK", []byte("TT2http://example.com\x00")),
+			},
+			err: "LNK",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var body []byte
+			for _, f := range tc.frames {
+				body = append(body, f...)
+			}
+			tag := append([]byte{'I', 'D', '3', 2, 0, 0}, encodeSynchsafe(int64(len(body)))...)
+			src := testMP3(append(tag, body...))
+
+			var dst bytes.Buffer
+			err := Write(&dst, bytes.NewReader(src), TagSet{KeyTitle: "New", KeyArtist: "Artist"})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want one about %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			metadata, err := NewFromBytes(dst.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tc.want {
+				if got := metadata[key]; got != want {
+					t.Errorf("%s: got %q, want %q", key, got, want)
+				}
+			}
+			if tc.name == "text" && !bytes.Contains(dst.Bytes(), []byte("TCOM")) {
+				t.Error("the TCM frame was dropped")
+			}
+		})
+	}
+}
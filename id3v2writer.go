@@ -0,0 +1,369 @@
+package sndtag
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/briansorahan/sndtag/id3"
+)
+
+// id3v2DefaultPadding is the amount of padding written after the frames,
+// so that small edits can be made without moving the audio data.
+const id3v2DefaultPadding = 1024
+
+// id3v2Properties maps property names to the ID3v2 frames they are written to.
+// Properties without a frame of their own are written to TXXX frames,
+// see id3v2UserTextProperties.
+var id3v2Properties = map[string]string{
+	KeyAlbum:       ID3v2FrameAlbum,
+	KeyAlbumArtist: ID3v2FrameBand,
+	KeyArtist:      ID3v2FrameArtist,
+	KeyGenre:       ID3v2FrameGenre,
+	KeyLabel:       ID3v2FramePublisher,
+	KeyMedia:       ID3v2FrameMedia,
+	KeyTitle:       ID3v2FrameTitle,
+	KeyTrack:       ID3v2FrameTrack,
+	KeyYear:        ID3v2FrameYear,
+}
+
+// writeID3v2 writes a single ID3v2 tag followed by the audio data,
+// which starts at audioOffset in the original stream.
+// The frames of existing tags are merged with the same priority as newID3v2
+// and then updated with the properties in tags. Frames keep their order and
+// the padding of the first tag is kept, unless WithCanonicalFrames or
+// WithPadding is used.
+func writeID3v2(dst io.Writer, existing []*id3v2, audio io.Reader, audioOffset int64, tags TagSet, o options) error {
+	if err := checkDropped(existing); err != nil {
+		return err
+	}
+	var (
+		major   uint8 = 3
+		padding       = id3v2DefaultPadding
+	)
+	if o.device != nil {
+		var err error
+		if existing, err = o.device.convert(existing); err != nil {
+			return err
+		}
+		if o.device.Version != 0 {
+			major = o.device.Version
+		}
+	}
+	if len(existing) > 0 {
+		if existing[0].header.Major == 4 {
+			major = 4
+		}
+		padding = existing[0].padding
+	}
+	t := &id3v2{
+		header:   id3v2Header{Major: major},
+		frames:   mergeID3v2Frames(existing, major),
+		metadata: map[string]string{},
+		opts:     o,
+	}
+	if err := t.update(tags); err != nil {
+		return err
+	}
+	if o.device != nil {
+		if err := o.device.enforce(t); err != nil {
+			return err
+		}
+	}
+	if o.canonicalFrames {
+		sort.SliceStable(t.frames, func(i, j int) bool {
+			return t.frames[i].ID < t.frames[j].ID
+		})
+		padding = id3v2DefaultPadding
+	}
+	if o.padding != nil {
+		room := -1
+		if len(existing) > 0 {
+			room = int(audioOffset) - 10
+		}
+		padding = o.padding.padding(len(t.encode(0))-10, room)
+	}
+	tag := t.encode(padding)
+	if err := validateID3v2(tag); err != nil {
+		return err
+	}
+	if _, err := dst.Write(tag); err != nil {
+		return err
+	}
+	_, err := copySpan(dst, audio, audioOffset, -1)
+	return err
+}
+
+// checkDropped returns an error if existing ID3v2.2 tags have frames that
+// have no ID3v2.3 equivalent, which would be lost when the tags are
+// written again.
+func checkDropped(tags []*id3v2) error {
+	for _, t := range tags {
+		if len(t.dropped) > 0 {
+			return fmt.Errorf("ID3v2.2 frames %s can not be converted to ID3v2.3", strings.Join(t.dropped, ", "))
+		}
+	}
+	return nil
+}
+
+// mergeID3v2Frames returns the frames of the first tag followed by
+// the frames of later tags whose IDs don't appear in earlier tags.
+// Frames that only make sense in a different version are dropped.
+func mergeID3v2Frames(tags []*id3v2, major uint8) []id3v2Frame {
+	var (
+		frames []id3v2Frame
+		seen   = map[string]bool{}
+	)
+	for _, tag := range tags {
+		ids := map[string]bool{}
+
+		for _, frame := range tag.frames {
+			if seen[frame.ID] {
+				continue
+			}
+			ids[frame.ID] = true
+
+			// Format flags are version-specific.
+			if tag.header.Major != major {
+				data := tag.content(frame)
+				if data == nil {
+					continue
+				}
+				frame = id3v2Frame{ID: frame.ID, Data: data}
+			}
+			frames = append(frames, frame)
+		}
+		for id := range ids {
+			seen[id] = true
+		}
+	}
+	return frames
+}
+
+// update updates the frames of a tag with a set of properties.
+func (t *id3v2) update(tags TagSet) error {
+	for prop, value := range tags {
+		switch prop {
+		case KeyComment:
+			t.setComment(value)
+		case KeyRating, KeyRatingEmail, KeyPlayCount:
+			// Written below.
+		default:
+			if desc, ok := id3v2UserTextProperties[prop]; ok {
+				t.setUserText(desc, value)
+				continue
+			}
+			id, ok := id3v2Properties[prop]
+			if !ok {
+				return fmt.Errorf("property %s can not be written to ID3v2", prop)
+			}
+			if id == ID3v2FrameYear && t.header.Major == 4 {
+				id = ID3v2FrameRecordingTime
+			}
+			t.setFrame(id, t.encodeTextFrame(value), value == "")
+		}
+	}
+	return t.updatePopularimeter(tags)
+}
+
+// updatePopularimeter updates the POPM frame of a tag with the rating
+// properties in tags. The email identifier is set first, since it decides
+// the rating scale.
+func (t *id3v2) updatePopularimeter(tags TagSet) error {
+	var (
+		popm    = t.popularimeter()
+		changed bool
+	)
+	for _, prop := range []string{KeyRatingEmail, KeyRating, KeyPlayCount} {
+		value, ok := tags[prop]
+		if !ok {
+			continue
+		}
+		if err := popm.set(prop, value, t.opts); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if changed {
+		t.setFrame(ID3v2FramePopularimeter, popm.encode(), false)
+	}
+	return nil
+}
+
+// setFrame replaces the first frame with an ID, keeping its position,
+// and removes any other frames with the same ID.
+// The frame is added at the end if the tag doesn't have one.
+// If remove is true all frames with the ID are removed.
+func (t *id3v2) setFrame(id string, data []byte, remove bool) {
+	var (
+		frames   = t.frames[:0]
+		replaced = remove
+	)
+	for _, frame := range t.frames {
+		if frame.ID != id {
+			frames = append(frames, frame)
+			continue
+		}
+		if !replaced {
+			frames = append(frames, id3v2Frame{ID: id, Data: data})
+			replaced = true
+		}
+	}
+	if !replaced {
+		frames = append(frames, id3v2Frame{ID: id, Data: data})
+	}
+	t.frames = frames
+}
+
+// setComment replaces the comments that don't have a description,
+// which are the ones that are shown as "the" comment.
+// An empty value removes them.
+func (t *id3v2) setComment(value string) {
+	var (
+		frames   = t.frames[:0]
+		replaced = value == ""
+		data     = t.encodeComment(Comment{Language: "eng", Text: value})
+	)
+	for _, frame := range t.frames {
+		if frame.ID != ID3v2FrameComment {
+			frames = append(frames, frame)
+			continue
+		}
+		content := t.content(frame)
+		if content == nil || decodeComment(content, nil).Description != "" {
+			frames = append(frames, frame)
+			continue
+		}
+		if !replaced {
+			frames = append(frames, id3v2Frame{ID: ID3v2FrameComment, Data: data})
+			replaced = true
+		}
+	}
+	if !replaced {
+		frames = append(frames, id3v2Frame{ID: ID3v2FrameComment, Data: data})
+	}
+	t.frames = frames
+}
+
+// popularimeter returns the first POPM frame of the tag,
+// or an empty one for Windows Media Player.
+func (t *id3v2) popularimeter() popularimeter {
+	for _, frame := range t.frames {
+		if frame.ID != ID3v2FramePopularimeter {
+			continue
+		}
+		if data := t.content(frame); data != nil {
+			return decodePopularimeter(data)
+		}
+	}
+	return popularimeter{Email: RatingScaleWMP.Email}
+}
+
+// set sets a rating property of a POPM frame.
+// The rating is a number of stars, e.g. "3" or "2.5", that is converted
+// with the rating scale of the program named by the email identifier.
+func (p *popularimeter) set(prop, value string, o options) error {
+	switch prop {
+	case KeyRatingEmail:
+		// Keep the number of stars when the program changes.
+		halfStars := o.ratingScale(p.Email).HalfStars(p.Rating)
+		p.Email = value
+		p.Rating = o.ratingScale(p.Email).HalfValue(halfStars)
+	case KeyRating:
+		if value == "" {
+			p.Rating = 0
+			return nil
+		}
+		halfStars, err := parseRating(value)
+		if err != nil {
+			return fmt.Errorf("invalid rating %q: %s", value, err)
+		}
+		p.Rating = o.ratingScale(p.Email).HalfValue(halfStars)
+	case KeyPlayCount:
+		if value == "" {
+			p.Count, p.HasCount = 0, false
+			return nil
+		}
+		count, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid play count %q: %s", value, err)
+		}
+		p.Count, p.HasCount = count, true
+	}
+	return nil
+}
+
+// encodeTextFrame encodes the data of a text information frame.
+func (t *id3v2) encodeTextFrame(value string) []byte {
+	enc := t.textEncoding(value)
+	return append([]byte{enc}, encodeText(enc, value)...)
+}
+
+// encodeComment encodes the data of a COMM frame.
+func (t *id3v2) encodeComment(c Comment) []byte {
+	enc := t.textEncoding(c.Description + c.Text)
+
+	data := append([]byte{enc}, c.Language...)
+	data = append(data, encodeText(enc, c.Description)...)
+	if enc == 1 {
+		data = append(data, 0, 0)
+	} else {
+		data = append(data, 0)
+	}
+	return append(data, encodeText(enc, c.Text)...)
+}
+
+// encodeUserText encodes the data of a TXXX frame.
+func (t *id3v2) encodeUserText(desc, value string) []byte {
+	enc := t.textEncoding(desc + value)
+
+	data := append([]byte{enc}, encodeText(enc, desc)...)
+	if enc == 1 {
+		data = append(data, 0, 0)
+	} else {
+		data = append(data, 0)
+	}
+	return append(data, encodeText(enc, value)...)
+}
+
+// textEncoding returns the best text encoding for a string
+// in the version of the tag. ID3v2.4 tags use UTF-8.
+// ID3v2.3 tags use ISO-8859-1 if possible and UTF-16 otherwise.
+func (t *id3v2) textEncoding(s string) byte {
+	if t.header.Major >= 4 {
+		return 3
+	}
+	if _, ok := encodeLatin1(s); ok {
+		return 0
+	}
+	return 1
+}
+
+// encodeText encodes a string with an ID3v2 text encoding.
+func encodeText(enc byte, s string) []byte {
+	return id3.EncodeText(enc, s)
+}
+
+// encodeLatin1 encodes a string as ISO-8859-1.
+// It returns false if the string has characters that can't be encoded.
+func encodeLatin1(s string) ([]byte, bool) {
+	b, ok := id3.EncodeLatin1(s)
+	if !ok {
+		return nil, false
+	}
+	return b, true
+}
+
+// encode encodes the tag, including the "ID3" identifier,
+// followed by the given amount of padding.
+func (t *id3v2) encode(padding int) []byte {
+	tag := id3.Tag{Major: t.header.Major, Frames: t.frames, Padding: padding}
+	return tag.Encode()
+}
+
+// encodeSynchsafe encodes a 4-byte synchsafe integer.
+func encodeSynchsafe(n int64) []byte {
+	return id3.EncodeSynchsafe(n)
+}
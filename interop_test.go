@@ -0,0 +1,294 @@
+//go:build interop
+
+package sndtag
+
+// The interop tests cross-check the properties that sndtag reads from the
+// files in testdata/interop, or in the directories given with
+// -interop.corpus, against the output of reference taggers, so that
+// regressions show up as the number of supported formats grows. They are
+// behind the interop build tag since they need ffprobe, and optionally
+// TagLib's tagreader example, on the PATH:
+//
+//	go test -tags interop -run Interop -interop.taglib tagreader
+//
+// Titles, artists, albums, album artists, genres, comments, years, track
+// and disc numbers, sample rates and channel counts are compared. Values
+// are compared after trimming spaces, years by their first 4 digits and
+// track and disc numbers by their leading number. Properties that one side
+// doesn't have are only reported with -interop.missing. A reference that
+// isn't installed is skipped.
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	interopCorpus  = flag.String("interop.corpus", filepath.Join("testdata", "interop"), "comma-separated directories of files to cross-check")
+	interopFFprobe = flag.String("interop.ffprobe", "ffprobe", "ffprobe command, or empty to skip it")
+	interopTagLib  = flag.String("interop.taglib", "", "TagLib tagreader command, or empty to skip it")
+	interopMissing = flag.Bool("interop.missing", false, "also report properties that only one side has")
+)
+
+func TestInterop(t *testing.T) {
+	references := map[string]func(string) (map[string]string, error){}
+	for name, command := range map[string]string{"ffprobe": *interopFFprobe, "taglib": *interopTagLib} {
+		if command == "" {
+			continue
+		}
+		if _, err := exec.LookPath(command); err != nil {
+			t.Logf("skipping %s: %s", name, err)
+			continue
+		}
+		command := command
+		switch name {
+		case "ffprobe":
+			references[name] = func(path string) (map[string]string, error) { return readFFprobe(command, path) }
+		case "taglib":
+			references[name] = func(path string) (map[string]string, error) { return readTagLib(command, path) }
+		}
+	}
+
+	var files []string
+	for _, root := range strings.Split(*interopCorpus, ",") {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			ours, err := readSndtag(path)
+			if err != nil {
+				t.Fatalf("sndtag: %s", err)
+			}
+			for prop, want := range interopExpected[filepath.Base(path)] {
+				if got := ours[prop]; got != want {
+					t.Errorf("sndtag: %s: got %q, want %q", prop, got, want)
+				}
+			}
+			for _, name := range []string{"ffprobe", "taglib"} {
+				read, ok := references[name]
+				if !ok {
+					continue
+				}
+				theirs, err := read(path)
+				if err != nil {
+					// The reference doesn't read the file, which isn't
+					// a divergence in itself.
+					continue
+				}
+				for _, d := range compareInterop(ours, theirs, *interopMissing) {
+					t.Errorf("%s: %s", name, d)
+				}
+			}
+		})
+	}
+	if len(references) == 0 {
+		t.Skip("no reference taggers installed, only checked that sndtag reads the corpus")
+	}
+}
+
+// interopExpected are properties of the files in testdata/interop, which
+// are checked even if no reference tagger is installed.
+var interopExpected = map[string]map[string]string{
+	"id3-chunk.wav":   {KeyTitle: "Interop Title", KeyYear: "2019", KeyID3v2Version: "2.3.0", KeySampleRate: "44100"},
+	"id3v23.mp3":      {KeyTitle: "Interop Title", KeyAlbumArtist: "Interop Album Artist", KeyTrack: "3/12", KeyID3v2Version: "2.3.0"},
+	"id3v24.mp3":      {KeyTitle: "Grüße, 世界", KeyYear: "2019", KeyID3v2Version: "2.4.0"},
+	"info.wav":        {KeyTitle: "Interop Title", KeyComment: "Interop comment", KeyNumChannels: "2"},
+	"missing-pad.wav": {KeyTitle: "Odd", KeyArtist: "Unpadded", KeyDataLength: "400"},
+}
+
+// interopCompared are the properties that are compared, and how.
+var interopCompared = map[string]func(string) string{
+	KeyTitle:       strings.TrimSpace,
+	KeyArtist:      strings.TrimSpace,
+	KeyAlbum:       strings.TrimSpace,
+	KeyAlbumArtist: strings.TrimSpace,
+	KeyGenre:       strings.TrimSpace,
+	KeyComment:     strings.TrimSpace,
+	KeyYear:        interopYear,
+	KeyTrack:       interopNumber,
+	KeyDisc:        interopNumber,
+	KeySampleRate:  interopNumber,
+	KeyNumChannels: interopNumber,
+}
+
+// ffprobeTags maps the lower-case tag names of ffprobe to properties.
+var ffprobeTags = map[string]string{
+	"title":        KeyTitle,
+	"artist":       KeyArtist,
+	"album":        KeyAlbum,
+	"album_artist": KeyAlbumArtist,
+	"albumartist":  KeyAlbumArtist,
+	"genre":        KeyGenre,
+	"comment":      KeyComment,
+	"date":         KeyYear,
+	"year":         KeyYear,
+	"track":        KeyTrack,
+	"tracknumber":  KeyTrack,
+	"disc":         KeyDisc,
+	"discnumber":   KeyDisc,
+}
+
+// taglibFields maps the fields of the basic tag and the audio properties
+// that tagreader prints to properties.
+var taglibFields = map[string]string{
+	"title":       KeyTitle,
+	"artist":      KeyArtist,
+	"album":       KeyAlbum,
+	"year":        KeyYear,
+	"comment":     KeyComment,
+	"track":       KeyTrack,
+	"genre":       KeyGenre,
+	"sample rate": KeySampleRate,
+	"channels":    KeyNumChannels,
+}
+
+// readSndtag reads the properties of a file with sndtag.
+func readSndtag(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return New(f)
+}
+
+// readFFprobe reads the tags of the container and the first audio stream
+// of a file with ffprobe.
+func readFFprobe(command, path string) (map[string]string, error) {
+	out, err := exec.Command(command, "-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", path).Output()
+	if err != nil {
+		return nil, err
+	}
+	var probe struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType  string            `json:"codec_type"`
+			SampleRate string            `json:"sample_rate"`
+			Channels   int               `json:"channels"`
+			Tags       map[string]string `json:"tags"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, err
+	}
+	metadata := map[string]string{}
+	for _, s := range probe.Streams {
+		if s.CodecType != "audio" {
+			continue
+		}
+		metadata[KeySampleRate] = s.SampleRate
+		metadata[KeyNumChannels] = strconv.Itoa(s.Channels)
+
+		// Ogg files have their tags on the stream.
+		addFFprobeTags(metadata, s.Tags)
+		break
+	}
+	addFFprobeTags(metadata, probe.Format.Tags)
+	return metadata, nil
+}
+
+// addFFprobeTags adds the tags that ffprobe printed to metadata.
+func addFFprobeTags(metadata, tags map[string]string) {
+	for name, value := range tags {
+		if prop, ok := ffprobeTags[strings.ToLower(name)]; ok && value != "" {
+			metadata[prop] = value
+		}
+	}
+}
+
+// readTagLib reads the basic tag and the audio properties of a file with
+// TagLib's tagreader example, which prints lines like
+//
+//	title   - "Some Title"
+//	sample rate - 44100
+func readTagLib(command, path string) (map[string]string, error) {
+	out, err := exec.Command(command, path).Output()
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]string{}
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		name, value, ok := strings.Cut(string(line), " - ")
+		if !ok {
+			continue
+		}
+		prop, ok := taglibFields[strings.TrimSpace(name)]
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		// TagLib prints 0 for a missing year or track.
+		if value != "" && value != "0" {
+			metadata[prop] = value
+		}
+	}
+	return metadata, nil
+}
+
+// compareInterop returns the properties whose values differ.
+func compareInterop(ours, theirs map[string]string, missing bool) []string {
+	var diffs []string
+	for prop, normalize := range interopCompared {
+		a, b := normalize(ours[prop]), normalize(theirs[prop])
+		switch {
+		case a == b:
+		case a == "" || b == "":
+			if missing {
+				diffs = append(diffs, fmt.Sprintf("%s: sndtag %q, reference %q", prop, ours[prop], theirs[prop]))
+			}
+		default:
+			diffs = append(diffs, fmt.Sprintf("%s: sndtag %q, reference %q", prop, ours[prop], theirs[prop]))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+// interopYear returns the first 4 digits of a date.
+func interopYear(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 4 {
+		return s[:4]
+	}
+	return s
+}
+
+// interopNumber returns the leading number of a value like "3/12", without
+// leading zeros.
+func interopNumber(s string) string {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	if n, err := strconv.Atoi(s[:end]); err == nil {
+		return strconv.Itoa(n)
+	}
+	return s
+}
@@ -0,0 +1,176 @@
+//go:build go1.23
+
+package sndtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+	"sort"
+)
+
+// Tags returns an iterator over the properties returned by New,
+// in the order of their keys.
+func Tags(metadata map[string]string) iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		keys := make([]string, 0, len(metadata))
+		for key := range metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if !yield(key, metadata[key]) {
+				return
+			}
+		}
+	}
+}
+
+// A Chunk is a chunk of a RIFF file or an atom of an MP4 file.
+type Chunk struct {
+	// ID is the FourCC of the chunk or the type of the atom.
+	ID string
+
+	// Offset is the offset of the header of the chunk in the file,
+	// and Size is the size of its data, without the header.
+	Offset int64
+	Size   int64
+
+	// Depth is 0 for the chunks at the top of the file, 1 for the
+	// chunks in them, and so on.
+	Depth int
+}
+
+// Chunks returns an iterator over the chunks of a WAV file, including the
+// subchunks of its LIST chunks, or over the atoms of an MP4 file, including
+// the atoms in the moov, udta, meta and ilst atoms. The chunks are read as
+// the iteration goes, and their data is skipped. An error reading the file
+// is yielded with the zero Chunk and ends the iteration, and so is a
+// DepthError for containers nested deeper than WithMaxDepth allows.
+func Chunks(rs io.ReadSeeker, opts ...Option) iter.Seq2[Chunk, error] {
+	o := newOptions(opts)
+
+	return func(yield func(Chunk, error) bool) {
+		size, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		header := make([]byte, 12)
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		if _, err := io.ReadFull(rs, header); err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		switch {
+		case string(header[:4]) == "RIFF":
+			yieldRIFFChunks(rs, 12, size, 0, o, yield)
+		case string(header[4:8]) == "ftyp":
+			yieldMP4Atoms(rs, 0, size, 0, o, yield)
+		default:
+			yield(Chunk{}, fmt.Errorf("not a RIFF or MP4 file"))
+		}
+	}
+}
+
+// yieldRIFFChunks yields the chunks from offset up to end, descending into
+// LIST chunks. It reports whether the iteration should go on.
+func yieldRIFFChunks(rs io.ReadSeeker, offset, end int64, depth int, o options, yield func(Chunk, error) bool) bool {
+	header := make([]byte, 8)
+
+	for offset+8 <= end {
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			yield(Chunk{}, err)
+			return false
+		}
+		if _, err := io.ReadFull(rs, header); err != nil {
+			yield(Chunk{}, err)
+			return false
+		}
+		var (
+			id     = string(header[:4])
+			length = int64(binary.LittleEndian.Uint32(header[4:8]))
+		)
+		if offset+8+length > end {
+			// Truncated files end with a short chunk.
+			length = end - offset - 8
+		}
+		if !yield(Chunk{ID: id, Offset: offset, Size: length, Depth: depth}, nil) {
+			return false
+		}
+		if id == "LIST" && length >= 4 {
+			if err := o.checkDepth(id, depth); err != nil {
+				yield(Chunk{}, err)
+				return false
+			}
+			if !yieldRIFFChunks(rs, offset+12, offset+8+length, depth+1, o, yield) {
+				return false
+			}
+		}
+		offset += 8 + length + length%2
+	}
+	return true
+}
+
+// yieldMP4Atoms yields the atoms from offset up to end, descending into the
+// atoms that lead to the ilst atom. It reports whether the iteration
+// should go on.
+func yieldMP4Atoms(rs io.ReadSeeker, offset, end int64, depth int, o options, yield func(Chunk, error) bool) bool {
+	header := make([]byte, 16)
+
+	for offset+8 <= end {
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			yield(Chunk{}, err)
+			return false
+		}
+		if _, err := io.ReadFull(rs, header[:8]); err != nil {
+			yield(Chunk{}, err)
+			return false
+		}
+		var (
+			typ        = string(header[4:8])
+			size       = int64(binary.BigEndian.Uint32(header[:4]))
+			headerSize = int64(8)
+		)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			// 64-bit extended size.
+			if _, err := io.ReadFull(rs, header[8:16]); err != nil {
+				yield(Chunk{}, err)
+				return false
+			}
+			size, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if size < headerSize || offset+size > end {
+			yield(Chunk{}, fmt.Errorf("invalid %s atom size %d", typ, size))
+			return false
+		}
+		if !yield(Chunk{ID: typ, Offset: offset, Size: size - headerSize, Depth: depth}, nil) {
+			return false
+		}
+		start := offset + headerSize
+		switch typ {
+		case "meta":
+			// The meta atom has a version and flags before its children.
+			start += 4
+			fallthrough
+		case "moov", "udta", "ilst":
+			if err := o.checkDepth(typ, depth); err != nil {
+				yield(Chunk{}, err)
+				return false
+			}
+			if !yieldMP4Atoms(rs, start, offset+size, depth+1, o, yield) {
+				return false
+			}
+		}
+		offset += size
+	}
+	return true
+}
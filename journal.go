@@ -0,0 +1,277 @@
+package sndtag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A JournalEntry records how a file was changed by a write,
+// so that the write can be undone with Revert.
+type JournalEntry struct {
+	Path string
+	Time time.Time
+
+	// Size is the size of the file before the write,
+	// and WrittenSize is its size after the write.
+	Size        int64
+	WrittenSize int64
+
+	// WrittenSHA256 is the hex-encoded SHA-256 digest of the file after
+	// the write.
+	WrittenSHA256 string `json:",omitempty"`
+
+	// Regions make up the original file, in order.
+	Regions []JournalRegion
+}
+
+// A JournalRegion is a part of the original file. Regions that were
+// replaced by the write, i.e. the tags, hold the original bytes,
+// and regions that were copied unchanged, like the audio data,
+// hold the offset they were copied to.
+type JournalRegion struct {
+	// Offset is the offset of the region in the original file.
+	Offset int64
+	Length int64
+
+	// Data is the original bytes of a region that was replaced.
+	Data []byte `json:",omitempty"`
+
+	// From is the offset of a region that was copied in the written file.
+	From int64 `json:",omitempty"`
+}
+
+// A Journal records the tags replaced by WriteFile and WriteQueue,
+// as one JSON entry per line. The entry for a file is written and synced
+// before the file is replaced. See WithJournal.
+type Journal struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJournal returns a Journal that writes entries to w.
+// If w has a Sync method, like *os.File, it is synced before files are replaced.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w}
+}
+
+// WithJournal tells WriteFile and WriteQueue to record the tags they
+// replace in j. Write doesn't record anything since it doesn't know
+// which file it is writing.
+func WithJournal(j *Journal) Option {
+	return func(o *options) {
+		o.journal = j
+	}
+}
+
+// Record writes an entry to the journal.
+func (j *Journal) Record(entry JournalEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
+
+// sync syncs the journal if it is written to a file. It does nothing
+// if j is nil.
+func (j *Journal) sync() error {
+	if j == nil {
+		return nil
+	}
+	s, ok := j.w.(interface{ Sync() error })
+	if !ok {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return s.Sync()
+}
+
+// ReadJournal reads the entries written to a Journal.
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	var (
+		entries []JournalEntry
+		dec     = json.NewDecoder(r)
+	)
+	for {
+		var entry JournalEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading journal: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// ErrConflict is wrapped by the error that Revert returns when a file has
+// changed since the write that it is asked to undo.
+var ErrConflict = errors.New("file has changed since it was written")
+
+// Revert undoes the write recorded in entry by restoring the original
+// bytes of the file at entry.Path. It fails with an error wrapping
+// ErrConflict if the size or the digest of the file has changed since the
+// write, e.g. because it was written again, in which case the later writes
+// must be reverted first. Entries without a digest only have their size
+// checked.
+// The file is locked while it is reverted, like WriteFile.
+func Revert(entry JournalEntry) error {
+	unlock, err := lockPath(defaultLocker, entry.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.Open(osPath(entry.Path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != entry.WrittenSize {
+		return fmt.Errorf("%s: %w", entry.Path, ErrConflict)
+	}
+	if entry.WrittenSHA256 != "" {
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != entry.WrittenSHA256 {
+			return fmt.Errorf("%s: %w", entry.Path, ErrConflict)
+		}
+	}
+	tmp, err := createTemp(entry.Path, info.Mode())
+	if err != nil {
+		return err
+	}
+	for _, region := range entry.Regions {
+		if region.Data != nil {
+			_, err = tmp.Write(region.Data)
+		} else {
+			_, err = io.Copy(tmp, io.NewSectionReader(f, region.From, region.Length))
+		}
+		if err != nil {
+			discardTemp(tmp)
+			return err
+		}
+	}
+	return commitBatch([]writtenFile{{path: entry.Path, tmp: tmp}}, nil)[0].Err
+}
+
+// copyRecorder is an io.Writer that counts and hashes the bytes written
+// to it, and records the regions of the original stream that writers copy
+// to it unchanged with copySpan.
+type copyRecorder struct {
+	w       io.Writer
+	n       int64
+	h       hash.Hash
+	regions []JournalRegion
+}
+
+// newCopyRecorder returns a copyRecorder that writes to w.
+func newCopyRecorder(w io.Writer) *copyRecorder {
+	return &copyRecorder{w: w, h: sha256.New()}
+}
+
+// Write writes p to the underlying writer.
+func (r *copyRecorder) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	r.n += int64(n)
+	r.h.Write(p[:n])
+	return n, err
+}
+
+// copySpan copies n bytes, or everything if n is negative, from src,
+// which is at offset in the original stream, to dst. The copy is
+// recorded if dst is a copyRecorder.
+func copySpan(dst io.Writer, src io.Reader, offset, n int64) (int64, error) {
+	rec, ok := dst.(*copyRecorder)
+	if !ok {
+		if n < 0 {
+			return io.Copy(dst, src)
+		}
+		return io.CopyN(dst, src, n)
+	}
+	var (
+		from    = rec.n
+		written int64
+		err     error
+	)
+	if n < 0 {
+		written, err = io.Copy(rec, src)
+	} else {
+		written, err = io.CopyN(rec, src, n)
+	}
+	if written > 0 {
+		rec.regions = append(rec.regions, JournalRegion{Offset: offset, Length: written, From: from})
+	}
+	return written, err
+}
+
+// entry returns the journal entry for a write, reading the regions
+// of the original file that weren't copied from src.
+func (r *copyRecorder) entry(path string, src io.ReaderAt, size int64) (JournalEntry, error) {
+	copied := append([]JournalRegion(nil), r.regions...)
+	sort.Slice(copied, func(i, j int) bool {
+		return copied[i].Offset < copied[j].Offset
+	})
+	var (
+		regions []JournalRegion
+		offset  int64
+	)
+	replaced := func(end int64) error {
+		if end <= offset {
+			return nil
+		}
+		data := make([]byte, end-offset)
+		if _, err := src.ReadAt(data, offset); err != nil {
+			return err
+		}
+		regions = append(regions, JournalRegion{Offset: offset, Length: end - offset, Data: data})
+		return nil
+	}
+	for _, region := range copied {
+		if err := replaced(region.Offset); err != nil {
+			return JournalEntry{}, err
+		}
+		offset = region.Offset + region.Length
+
+		// Merge regions that were copied in one piece.
+		if n := len(regions); n > 0 && regions[n-1].Data == nil &&
+			regions[n-1].Offset+regions[n-1].Length == region.Offset &&
+			regions[n-1].From+regions[n-1].Length == region.From {
+			regions[n-1].Length += region.Length
+			continue
+		}
+		regions = append(regions, region)
+	}
+	if err := replaced(size); err != nil {
+		return JournalEntry{}, err
+	}
+	return JournalEntry{
+		Path:          path,
+		Time:          time.Now(),
+		Size:          size,
+		WrittenSize:   r.n,
+		WrittenSHA256: hex.EncodeToString(r.h.Sum(nil)),
+		Regions:       regions,
+	}, nil
+}
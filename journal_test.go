@@ -0,0 +1,122 @@
+package sndtag
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRevert(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		file   []byte
+		change func(b []byte) []byte
+		digest bool
+		err    error
+	}{
+		{name: "wav", file: testWav(), digest: true},
+		{name: "mp3", file: testMP3(testID3v2(3, testTextFrame(ID3v2FrameTitle, "Title"))), digest: true},
+		{
+			name:   "same size",
+			file:   testWav(),
+			change: func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b },
+			digest: true,
+			err:    ErrConflict,
+		},
+		{
+			name:   "other size",
+			file:   testWav(),
+			change: func(b []byte) []byte { return append(b, 0, 0) },
+			digest: true,
+			err:    ErrConflict,
+		},
+		{
+			name:   "same size without a digest",
+			file:   testWav(),
+			change: func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			if err := os.WriteFile(path, tc.file, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var journal bytes.Buffer
+			if err := WriteFile(path, TagSet{KeyTitle: "New title"}, WithJournal(NewJournal(&journal))); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := ReadJournal(&journal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Path != path || entries[0].WrittenSHA256 == "" {
+				t.Fatalf("got entries %+v", entries)
+			}
+			entry := entries[0]
+			if !tc.digest {
+				entry.WrittenSHA256 = ""
+			}
+			if tc.change != nil {
+				b, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, tc.change(b), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Revert(entry)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tc.err != nil && !bytes.Equal(got, before):
+				t.Error("file was changed despite the conflict")
+			case tc.err == nil && tc.change == nil && !bytes.Equal(got, tc.file):
+				t.Error("file was not restored")
+			}
+		})
+	}
+}
+
+func TestRevertMissingFile(t *testing.T) {
+	entry := JournalEntry{Path: filepath.Join(t.TempDir(), "missing")}
+	if err := Revert(entry); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want an error wrapping os.ErrNotExist", err)
+	}
+}
+
+func TestReadJournal(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		journal string
+		entries int
+		err     bool
+	}{
+		{name: "empty", journal: ""},
+		{name: "entries", journal: `{"Path":"a","Size":1}` + "\n" + `{"Path":"b","Size":2}` + "\n", entries: 2},
+		{name: "truncated", journal: `{"Path":"a","Size":1}` + "\n" + `{"Path":`, err: true},
+		{name: "garbage", journal: "not a journal", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := ReadJournal(strings.NewReader(tc.journal))
+			if (err != nil) != tc.err {
+				t.Fatalf("got error %v", err)
+			}
+			if len(entries) != tc.entries {
+				t.Errorf("got %d entries, want %d", len(entries), tc.entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,565 @@
+package sndtag
+
+import "strconv"
+
+// Property names, i.e. the keys of the maps returned by New
+// and the keys of a TagSet.
+const (
+	// KeyFormat is the name of a format that is detected but not parsed,
+	// e.g. "Shorten".
+	KeyFormat = "Format"
+
+	// KeySchemaVersion is the version of the keys, see WithSchemaVersion.
+	KeySchemaVersion = "SchemaVersion"
+
+	// Stream properties of formats that are organized in frames,
+	// e.g. Musepack.
+	KeyStreamVersion = "StreamVersion"
+	KeyFrameCount    = "FrameCount"
+
+	// KeyCompressionLevel is the compression level of a Monkey's Audio file,
+	// from 1000 (fast) to 5000 (insane).
+	KeyCompressionLevel = "CompressionLevel"
+
+	// Descriptive properties.
+	KeyAlbum       = "Album"
+	KeyArtist      = "Artist"
+	KeyComment     = "Comment"
+	KeyGenre       = "Genre"
+	KeyTitle       = "Title"
+	KeyTrack       = "Track"
+	KeyYear        = "Year"
+	KeyAlbumArtist = "AlbumArtist"
+	KeyDisc        = "Disc"
+	KeyGrouping    = "Grouping"
+	KeyRating      = "Rating"
+	KeyRatingRaw   = "RatingRaw"
+	KeyRatingEmail = "RatingEmail"
+	KeyPlayCount   = "PlayCount"
+
+	// Classical work and movement properties. KeyMovementNumber and
+	// KeyMovementCount are the number of the movement in the work and the
+	// number of movements.
+	KeyWork           = "Work"
+	KeyMovementName   = "MovementName"
+	KeyMovementNumber = "MovementNumber"
+	KeyMovementCount  = "MovementCount"
+
+	// Release dates. KeyOriginalReleaseDate is the date the recording was
+	// first released and KeyReleaseDate is the date of this release, which
+	// differ for reissues and remasters. Neither of them changes KeyYear.
+	KeyOriginalReleaseDate = "OriginalReleaseDate"
+	KeyReleaseDate         = "ReleaseDate"
+
+	// Release properties, as used by MusicBrainz. KeyReleaseCountry is
+	// the country the release was issued in, e.g. "GB", and KeyMedia is
+	// the medium, e.g. "CD".
+	KeyBarcode        = "Barcode"
+	KeyCatalogNumber  = "CatalogNumber"
+	KeyLabel          = "Label"
+	KeyMedia          = "Media"
+	KeyReleaseCountry = "ReleaseCountry"
+
+	// KeyComments is the number of comments, see Comments.
+	KeyComments = "Comments"
+
+	// KeyUnsyncedLyrics is the number of ID3v2 USLT frames, see
+	// UnsyncedLyrics. KeyLyrics holds the best of them, see WithLanguage.
+	KeyUnsyncedLyrics = "UnsyncedLyrics"
+
+	// KeyLanguage is the language of the first track of an MP4 file,
+	// as a BCP 47 tag, see LanguageTag.
+	KeyLanguage = "Language"
+
+	// KeyArtworks is the number of embedded pictures.
+	KeyArtworks = "Artworks"
+
+	// KeyObjects is the number of objects in ID3v2 GEOB frames,
+	// see EncapsulatedObjects.
+	KeyObjects = "Objects"
+
+	// KeyRelativeVolumes and KeyEqualizations are the number of ID3v2 RVA2
+	// and EQU2 frames, see RelativeVolumes and Equalizations.
+	KeyRelativeVolumes = "RelativeVolumes"
+	KeyEqualizations   = "Equalizations"
+
+	// ReplayGain properties, from REPLAYGAIN_* TXXX frames and APEv2 items.
+	// Gains are as written by the tagger, e.g. "-6.48 dB", and peaks are
+	// amplitudes where 1 is full scale.
+	KeyReplayGainTrackGain = "ReplayGainTrackGain"
+	KeyReplayGainTrackPeak = "ReplayGainTrackPeak"
+	KeyReplayGainAlbumGain = "ReplayGainAlbumGain"
+	KeyReplayGainAlbumPeak = "ReplayGainAlbumPeak"
+
+	// WAV format properties.
+	KeyAudioFormat = "AudioFormat"
+	KeyNumChannels = "NumChannels"
+	KeySampleRate  = "SampleRate"
+	KeyByteRate    = "ByteRate"
+	KeyBlockAlign  = "BlockAlign"
+	KeyBitRate     = "BitRate"
+	KeyDataOffset  = "DataOffset"
+	KeyDataLength  = "DataLength"
+	KeyCuePoints   = "CuePoints"
+	KeySampleLoops = "SampleLoops"
+
+	// WAV sample properties. KeySampleFormat is one of the SampleFormat
+	// constants. KeyBitRate is the bits per sample the fmt chunk declares,
+	// KeyContainerBits is the bits each sample takes up in the data, and
+	// KeyValidBits is how many of them hold the sample, e.g. 32, 32 and 24
+	// for 24-bit samples in 32-bit containers, or 24, 24 and 24 for packed
+	// 24-bit samples. KeyChannelMask is the speaker positions of the channels
+	// of WAVE_FORMAT_EXTENSIBLE files, as a hexadecimal bit mask.
+	KeySampleFormat  = "SampleFormat"
+	KeyContainerBits = "ContainerBits"
+	KeyValidBits     = "ValidBits"
+	KeyChannelMask   = "ChannelMask"
+
+	// KeyPartial is "true" for a file that looks like it is still being
+	// written, see WithPartialFiles.
+	KeyPartial = "Partial"
+
+	// Analysis properties, see Analyze. KeyLeadingSilence and
+	// KeyTrailingSilence are in seconds, and KeyClippedSamples is the
+	// number of samples at full scale, counting every channel.
+	KeyLeadingSilence  = "LeadingSilence"
+	KeyTrailingSilence = "TrailingSilence"
+	KeyClippedSamples  = "ClippedSamples"
+
+	// KeySampleCount is the number of samples per channel and KeySampleCoding
+	// is one of the SampleCoding constants, for NIST SPHERE and raw files.
+	KeySampleCount  = "SampleCount"
+	KeySampleCoding = "SampleCoding"
+
+	// Tracker module properties. KeySamples and KeyInstruments are the
+	// number of sample and instrument names, see KeySampleName.
+	KeyModuleFormat = "ModuleFormat"
+	KeyTracker      = "Tracker"
+	KeySamples      = "Samples"
+	KeyInstruments  = "Instruments"
+
+	// MIDI properties. KeyDuration is in seconds and KeyTexts
+	// is the number of text events, see KeyText.
+	KeyMIDIFormat   = "MIDIFormat"
+	KeyMIDITracks   = "MIDITracks"
+	KeyMIDIDivision = "MIDIDivision"
+	KeyCopyright    = "Copyright"
+	KeyDuration     = "Duration"
+	KeyTexts        = "Texts"
+
+	// Matroska properties. KeyTracks and KeyAttachments are the number of
+	// tracks and attached files, see KeyTrackProperty.
+	KeyTracks      = "Tracks"
+	KeyAttachments = "Attachments"
+	KeyCodec       = "Codec"
+
+	// Broadcast Wave timecode properties.
+	KeyTimeReference     = "TimeReference"
+	KeyTimecode          = "Timecode"
+	KeyTimecodeRate      = "TimecodeRate"
+	KeyTimecodeDropFrame = "TimecodeDropFrame"
+
+	// KeyCodingHistory is the CodingHistory field of a Broadcast Wave bext
+	// chunk, and KeyCodingHistoryEntries is the number of its lines if it
+	// follows EBU R 98, see ParseCodingHistory and KeyCodingHistoryProperty.
+	KeyCodingHistory        = "CodingHistory"
+	KeyCodingHistoryEntries = "CodingHistoryEntries"
+
+	// Sidecar properties, see WithSidecars. KeySidecars is the names of
+	// the sidecar files that were merged, separated by "/", and
+	// KeyCueSheetTracks is the number of tracks of a CUE sheet for a file
+	// that holds several tracks, see KeyCueSheetTrackProperty.
+	KeySidecars       = "Sidecars"
+	KeyLyrics         = "Lyrics"
+	KeyNotes          = "Notes"
+	KeyCueSheetTracks = "CueSheetTracks"
+
+	// Edit list properties, see WithEditLists. KeyEdits is the number of
+	// edit events, see KeyEditProperty.
+	KeyEditListFormat = "EditListFormat"
+	KeyEdits          = "Edits"
+
+	// ID3v2 properties.
+	KeyID3v2TagCount = "ID3v2TagCount"
+	KeyID3v2Version  = "ID3v2Version"
+
+	// KeyID3v1Truncated is the properties whose ID3v1 field appears to be
+	// cut off, separated by "/": the field fills its 30 bytes, and another
+	// tag of the file has a longer value that starts with the same text.
+	// The other value is the one that is returned. See Getter.Truncated.
+	KeyID3v1Truncated = "ID3v1Truncated"
+
+	// Purchase properties, from ID3v2 OWNE frames and MP4 apID, ownr and
+	// purd atoms. KeyPurchaseDate is formatted as YYYY-MM-DD if the file
+	// only has a date.
+	KeyPricePaid       = "PricePaid"
+	KeyPurchaseDate    = "PurchaseDate"
+	KeySeller          = "Seller"
+	KeyPurchaseAccount = "PurchaseAccount"
+	KeyOwner           = "Owner"
+
+	// Commercial properties, from ID3v2 COMR frames. KeyCommercialPrice
+	// can hold several prices separated by "/", e.g. "USD9.99/EUR8.99".
+	KeyCommercialPrice       = "CommercialPrice"
+	KeyCommercialValidUntil  = "CommercialValidUntil"
+	KeyCommercialContactURL  = "CommercialContactURL"
+	KeyCommercialReceivedAs  = "CommercialReceivedAs"
+	KeyCommercialSeller      = "CommercialSeller"
+	KeyCommercialDescription = "CommercialDescription"
+
+	// MP4 properties. KeyAdvisory is 1 for explicit content and 2 for
+	// clean versions, and KeyGapless is 1 for gapless albums. They are
+	// read from ITUNESADVISORY, ITUNESGAPLESS and ITUNESMEDIATYPE TXXX
+	// frames in ID3v2 tags.
+	KeyBrand         = "Brand"
+	KeyMediaKind     = "MediaKind"
+	KeyMediaKindName = "MediaKindName"
+	KeyAdvisory      = "Advisory"
+	KeyAdvisoryName  = "AdvisoryName"
+	KeyGapless       = "Gapless"
+	KeyTVEpisode     = "TVEpisode"
+	KeyTVEpisodeID   = "TVEpisodeID"
+	KeyTVNetwork     = "TVNetwork"
+	KeyTVSeason      = "TVSeason"
+	KeyTVShow        = "TVShow"
+)
+
+// KeyCommentLanguage returns the key of the language of the nth comment,
+// counting from 1.
+func KeyCommentLanguage(n int) string {
+	return indexedKey("Comment", n, "Language")
+}
+
+// KeyCommentDescription returns the key of the description of the nth comment,
+// counting from 1.
+func KeyCommentDescription(n int) string {
+	return indexedKey("Comment", n, "Description")
+}
+
+// KeyCommentText returns the key of the text of the nth comment,
+// counting from 1.
+func KeyCommentText(n int) string {
+	return indexedKey("Comment", n, "Text")
+}
+
+// KeyUnsyncedLyricsLanguage returns the key of the language of the nth
+// USLT frame, counting from 1.
+func KeyUnsyncedLyricsLanguage(n int) string {
+	return indexedKey("UnsyncedLyrics", n, "Language")
+}
+
+// KeyUnsyncedLyricsDescription returns the key of the description of the
+// nth USLT frame, counting from 1.
+func KeyUnsyncedLyricsDescription(n int) string {
+	return indexedKey("UnsyncedLyrics", n, "Description")
+}
+
+// KeyUnsyncedLyricsText returns the key of the lyrics of the nth USLT
+// frame, counting from 1.
+func KeyUnsyncedLyricsText(n int) string {
+	return indexedKey("UnsyncedLyrics", n, "Text")
+}
+
+// KeyCueID returns the key of the identifier of the nth cue point,
+// counting from 1.
+func KeyCueID(n int) string {
+	return indexedKey("Cue", n, "ID")
+}
+
+// KeyCueSampleOffset returns the key of the sample offset of the nth cue point,
+// counting from 1.
+func KeyCueSampleOffset(n int) string {
+	return indexedKey("Cue", n, "SampleOffset")
+}
+
+// KeyLoopStart returns the key of the first sample of the nth loop,
+// counting from 1.
+func KeyLoopStart(n int) string {
+	return indexedKey("Loop", n, "Start")
+}
+
+// KeyLoopEnd returns the key of the last sample of the nth loop,
+// counting from 1.
+func KeyLoopEnd(n int) string {
+	return indexedKey("Loop", n, "End")
+}
+
+// KeyArtworkMIMEType returns the key of the MIME type of the nth picture,
+// counting from 1.
+func KeyArtworkMIMEType(n int) string {
+	return indexedKey("Artwork", n, "MIMEType")
+}
+
+// KeyArtworkWidth returns the key of the width in pixels of the nth picture,
+// counting from 1.
+func KeyArtworkWidth(n int) string {
+	return indexedKey("Artwork", n, "Width")
+}
+
+// KeyArtworkHeight returns the key of the height in pixels of the nth picture,
+// counting from 1.
+func KeyArtworkHeight(n int) string {
+	return indexedKey("Artwork", n, "Height")
+}
+
+// KeyArtworkSize returns the key of the size in bytes of the nth picture,
+// counting from 1.
+func KeyArtworkSize(n int) string {
+	return indexedKey("Artwork", n, "Size")
+}
+
+// KeyArtworkPictureType returns the key of the ID3v2 picture type of the
+// nth picture, counting from 1. 3 is the front cover.
+func KeyArtworkPictureType(n int) string {
+	return indexedKey("Artwork", n, "PictureType")
+}
+
+// KeyArtworkDescription returns the key of the description of the nth picture,
+// counting from 1.
+func KeyArtworkDescription(n int) string {
+	return indexedKey("Artwork", n, "Description")
+}
+
+// KeyObjectMIMEType returns the key of the MIME type of the nth
+// encapsulated object, counting from 1.
+func KeyObjectMIMEType(n int) string {
+	return indexedKey("Object", n, "MIMEType")
+}
+
+// KeyObjectFilename returns the key of the file name of the nth
+// encapsulated object, counting from 1.
+func KeyObjectFilename(n int) string {
+	return indexedKey("Object", n, "Filename")
+}
+
+// KeyObjectDescription returns the key of the description of the nth
+// encapsulated object, counting from 1.
+func KeyObjectDescription(n int) string {
+	return indexedKey("Object", n, "Description")
+}
+
+// KeyObjectSize returns the key of the size in bytes of the data of the
+// nth encapsulated object, counting from 1.
+func KeyObjectSize(n int) string {
+	return indexedKey("Object", n, "Size")
+}
+
+// KeyObjectData returns the key of the hex-encoded data of the nth
+// encapsulated object, counting from 1.
+func KeyObjectData(n int) string {
+	return indexedKey("Object", n, "Data")
+}
+
+// KeyRelativeVolumeIdentification returns the key of the identification
+// of the nth RVA2 frame, counting from 1.
+func KeyRelativeVolumeIdentification(n int) string {
+	return indexedKey("RelativeVolume", n, "Identification")
+}
+
+// KeyRelativeVolumeGain returns the key of the gain in dB of a channel in
+// the nth RVA2 frame, counting from 1.
+func KeyRelativeVolumeGain(n int, channel VolumeChannel) string {
+	return indexedKey("RelativeVolume", n, channel.String()+"Gain")
+}
+
+// KeyRelativeVolumePeak returns the key of the peak of a channel in the
+// nth RVA2 frame, counting from 1.
+func KeyRelativeVolumePeak(n int, channel VolumeChannel) string {
+	return indexedKey("RelativeVolume", n, channel.String()+"Peak")
+}
+
+// KeyEqualizationIdentification returns the key of the identification of
+// the nth EQU2 frame, counting from 1.
+func KeyEqualizationIdentification(n int) string {
+	return indexedKey("Equalization", n, "Identification")
+}
+
+// KeyEqualizationInterpolation returns the key of the interpolation method
+// of the nth EQU2 frame, counting from 1.
+func KeyEqualizationInterpolation(n int) string {
+	return indexedKey("Equalization", n, "Interpolation")
+}
+
+// KeyEqualizationPoints returns the key of the points of the nth EQU2
+// frame, counting from 1.
+func KeyEqualizationPoints(n int) string {
+	return indexedKey("Equalization", n, "Points")
+}
+
+// KeySampleName returns the key of the name of the nth sample of a tracker
+// module, counting from 1.
+func KeySampleName(n int) string {
+	return indexedKey("Sample", n, "Name")
+}
+
+// KeyInstrumentName returns the key of the name of the nth instrument of a
+// tracker module, counting from 1.
+func KeyInstrumentName(n int) string {
+	return indexedKey("Instrument", n, "Name")
+}
+
+// KeyTrackName returns the key of the name of the nth track of a MIDI file,
+// counting from 1.
+func KeyTrackName(n int) string {
+	return indexedKey("Track", n, "Name")
+}
+
+// KeyTrackProperty returns the key of a property of the nth track of a
+// Matroska file, counting from 1, e.g. "Track1SampleRate".
+func KeyTrackProperty(n int, prop string) string {
+	return indexedKey("Track", n, prop)
+}
+
+// KeyTrackCodec returns the key of the codec ID of the nth track of a
+// Matroska file, counting from 1.
+func KeyTrackCodec(n int) string {
+	return KeyTrackProperty(n, KeyCodec)
+}
+
+// KeyTrackCodecPrivate returns the key of the hex-encoded codec private data
+// of the nth track of a Matroska file, counting from 1.
+func KeyTrackCodecPrivate(n int) string {
+	return KeyTrackProperty(n, "CodecPrivate")
+}
+
+// KeyAttachmentProperty returns the key of a property of the nth attached file
+// of a Matroska file, counting from 1, e.g. "Attachment1Name".
+func KeyAttachmentProperty(n int, prop string) string {
+	return indexedKey("Attachment", n, prop)
+}
+
+// KeyCueSheetTrackProperty returns the key of a property of the nth track
+// of a CUE sheet, counting from 1. The properties are "Number", "Title",
+// "Performer" and "Index", which is the start of the track as mm:ss:ff.
+func KeyCueSheetTrackProperty(n int, prop string) string {
+	return indexedKey("CueSheetTrack", n, prop)
+}
+
+// KeyEditProperty returns the key of a property of the nth edit event,
+// counting from 1, e.g. "Edit1SourceIn". The properties are the names of
+// the fields of EditEvent, and "List" for the key of the edit list.
+func KeyEditProperty(n int, prop string) string {
+	return indexedKey("Edit", n, prop)
+}
+
+// KeyCodingHistoryProperty returns the key of a field of the nth entry of
+// the coding history of a Broadcast Wave file, counting from 1, e.g.
+// "CodingHistory1Algorithm". The fields are the ones of CodingHistoryEntry.
+func KeyCodingHistoryProperty(n int, prop string) string {
+	return indexedKey("CodingHistory", n, prop)
+}
+
+// KeyText returns the key of the nth text event of a MIDI file,
+// counting from 1.
+func KeyText(n int) string {
+	return indexedKey("Text", n, "")
+}
+
+// KeyCharset returns the key of the charset that was detected for the text
+// of a property, e.g. "TitleCharset". See WithCharsetDetection.
+func KeyCharset(key string) string {
+	return key + "Charset"
+}
+
+// KeyCharsetConfidence returns the key of the confidence, from 0 to 1,
+// of the charset that was detected for the text of a property.
+func KeyCharsetConfidence(key string) string {
+	return key + "CharsetConfidence"
+}
+
+// KeyRawText returns the key of the hex-encoded raw bytes of a property
+// whose charset was detected. See RawText.
+func KeyRawText(key string) string {
+	return key + "Raw"
+}
+
+// indexedKey returns the key of a field of the nth item of a list.
+func indexedKey(prefix string, n int, field string) string {
+	return prefix + strconv.Itoa(n) + field
+}
+
+// listCount returns the number of items of a list, stored under a count
+// key like KeyComments. The count comes from the metadata, which can be
+// anything, so it is bounded by the number of properties: every item has
+// at least one.
+func listCount(metadata map[string]string, key string) int {
+	count, err := strconv.Atoi(metadata[key])
+	if err != nil || count < 0 {
+		return 0
+	}
+	if count > len(metadata) {
+		count = len(metadata)
+	}
+	return count
+}
+
+// ID3v2 frame IDs.
+const (
+	ID3v2FrameAlbum         = "TALB"
+	ID3v2FrameArtist        = "TPE1"
+	ID3v2FrameBand          = "TPE2"
+	ID3v2FrameComment       = "COMM"
+	ID3v2FrameContentGroup  = "TIT1"
+	ID3v2FrameCommercial    = "COMR"
+	ID3v2FrameEqualization  = "EQU2"
+	ID3v2FrameGenre         = "TCON"
+	ID3v2FrameGrouping      = "GRP1"
+	ID3v2FrameLyrics        = "USLT"
+	ID3v2FrameMedia         = "TMED"
+	ID3v2FrameMovementName  = "MVNM"
+	ID3v2FrameMovement      = "MVIN"
+	ID3v2FrameObject        = "GEOB"
+	ID3v2FrameOriginalTime  = "TDOR"
+	ID3v2FrameOriginalYear  = "TORY"
+	ID3v2FrameOwnership     = "OWNE"
+	ID3v2FramePicture       = "APIC"
+	ID3v2FramePopularimeter = "POPM"
+	ID3v2FramePublisher     = "TPUB"
+	ID3v2FrameRecordingTime = "TDRC"
+	ID3v2FrameRelativeVol   = "RVA2"
+	ID3v2FrameReleaseTime   = "TDRL"
+	ID3v2FrameTitle         = "TIT2"
+	ID3v2FrameTrack         = "TRCK"
+	ID3v2FrameUserText      = "TXXX"
+	ID3v2FrameYear          = "TYER"
+)
+
+// WAV INFO list chunk IDs.
+const (
+	INFOChunkAlbum   = "IPRD"
+	INFOChunkArtist  = "IART"
+	INFOChunkComment = "ICMT"
+	INFOChunkDate    = "ICRD"
+	INFOChunkGenre   = "IGNR"
+	INFOChunkTitle   = "INAM"
+	INFOChunkTrack   = "ITRK"
+)
+
+// MP4 ilst item atom types.
+const (
+	MP4AtomAdvisory        = "rtng"
+	MP4AtomAlbum           = "\xa9alb"
+	MP4AtomAlbumArtist     = "aART"
+	MP4AtomArtist          = "\xa9ART"
+	MP4AtomComment         = "\xa9cmt"
+	MP4AtomCover           = "covr"
+	MP4AtomGapless         = "pgap"
+	MP4AtomGenre           = "\xa9gen"
+	MP4AtomGrouping        = "\xa9grp"
+	MP4AtomMovementCount   = "\xa9mvc"
+	MP4AtomMovementName    = "\xa9mvn"
+	MP4AtomMovementNumber  = "\xa9mvi"
+	MP4AtomMediaKind       = "stik"
+	MP4AtomOwner           = "ownr"
+	MP4AtomPurchaseAccount = "apID"
+	MP4AtomPurchaseDate    = "purd"
+	MP4AtomTitle           = "\xa9nam"
+	MP4AtomTrack           = "trkn"
+	MP4AtomTVEpisode       = "tves"
+	MP4AtomTVEpisodeID     = "tven"
+	MP4AtomTVNetwork       = "tvnn"
+	MP4AtomTVSeason        = "tvsn"
+	MP4AtomTVShow          = "tvsh"
+	MP4AtomWork            = "\xa9wrk"
+	MP4AtomYear            = "\xa9day"
+)
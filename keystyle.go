@@ -0,0 +1,92 @@
+package sndtag
+
+import (
+	"strings"
+	"unicode"
+)
+
+// KeyStyle is the style of the keys of the properties.
+type KeyStyle int
+
+// Key styles.
+const (
+	// CamelCase keys are the keys defined in this package, e.g. "SampleRate".
+	CamelCase KeyStyle = iota
+
+	// ScreamingSnakeCase keys are upper-case words separated
+	// by underscores, e.g. "SAMPLE_RATE".
+	ScreamingSnakeCase
+
+	// SnakeCase keys are lower-case words separated
+	// by underscores, e.g. "sample_rate".
+	SnakeCase
+)
+
+// WithKeyStyle sets the style of the keys of the properties that New and
+// NewFromBytes return, and of the sources recorded with WithSources.
+// Keys are split into words where the case changes, and numbers stay
+// with the word before them, e.g. "ID3v2TagCount" is "id3v2_tag_count"
+// in SnakeCase. The keys passed to other options, like WithFields, are
+// always in CamelCase.
+func WithKeyStyle(style KeyStyle) Option {
+	return func(o *options) {
+		o.keyStyle = style
+	}
+}
+
+// Key returns key, which is in CamelCase, in the given style.
+func (style KeyStyle) Key(key string) string {
+	switch style {
+	case ScreamingSnakeCase:
+		return strings.ToUpper(snakeCase(key))
+	case SnakeCase:
+		return snakeCase(key)
+	}
+	return key
+}
+
+// styleKeys renames the properties and the sources to the key style set
+// with WithKeyStyle. The schema version is added first, see WithSchemaVersion.
+func (o options) styleKeys(metadata map[string]string) map[string]string {
+	metadata = o.stampSchema(metadata)
+	if o.keyStyle == CamelCase {
+		return metadata
+	}
+	styled := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		styled[o.keyStyle.Key(k)] = v
+	}
+	var keys []string
+	for k := range o.sources {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		if key := o.keyStyle.Key(k); key != k {
+			o.sources[key] = o.sources[k]
+			delete(o.sources, k)
+		}
+	}
+	return styled
+}
+
+// snakeCase splits a CamelCase key into lower-case words separated by
+// underscores. A word starts at an upper-case letter that follows a
+// lower-case letter or a digit, or that ends a run of upper-case letters,
+// e.g. "MusicBrainzTrackID" is "music_brainz_track_id".
+func snakeCase(key string) string {
+	var (
+		b     strings.Builder
+		runes = []rune(key)
+	)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			endsRun := unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || endsRun {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
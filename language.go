@@ -0,0 +1,148 @@
+package sndtag
+
+import "strings"
+
+// iso639 maps ISO 639-2 codes, both the terminology codes and the
+// bibliographic ones, to the ISO 639-1 codes that BCP 47 prefers.
+// Languages without an ISO 639-1 code keep their ISO 639-2 code.
+var iso639 = map[string]string{
+	"aar": "aa", "abk": "ab", "afr": "af", "aka": "ak", "alb": "sq", "amh": "am",
+	"ara": "ar", "arg": "an", "arm": "hy", "asm": "as", "ava": "av", "ave": "ae",
+	"aym": "ay", "aze": "az", "bak": "ba", "bam": "bm", "baq": "eu", "bel": "be",
+	"ben": "bn", "bis": "bi", "bod": "bo", "bos": "bs", "bre": "br", "bul": "bg",
+	"bur": "my", "cat": "ca", "ces": "cs", "cha": "ch", "che": "ce", "chi": "zh",
+	"chu": "cu", "chv": "cv", "cor": "kw", "cos": "co", "cre": "cr", "cym": "cy",
+	"cze": "cs", "dan": "da", "deu": "de", "div": "dv", "dut": "nl", "dzo": "dz",
+	"ell": "el", "eng": "en", "epo": "eo", "est": "et", "eus": "eu", "ewe": "ee",
+	"fao": "fo", "fas": "fa", "fij": "fj", "fin": "fi", "fra": "fr", "fre": "fr",
+	"fry": "fy", "ful": "ff", "geo": "ka", "ger": "de", "gla": "gd", "gle": "ga",
+	"glg": "gl", "glv": "gv", "gre": "el", "grn": "gn", "guj": "gu", "hat": "ht",
+	"hau": "ha", "heb": "he", "her": "hz", "hin": "hi", "hmo": "ho", "hrv": "hr",
+	"hun": "hu", "hye": "hy", "ibo": "ig", "ice": "is", "ido": "io", "iii": "ii",
+	"iku": "iu", "ile": "ie", "ina": "ia", "ind": "id", "ipk": "ik", "isl": "is",
+	"ita": "it", "jav": "jv", "jpn": "ja", "kal": "kl", "kan": "kn", "kas": "ks",
+	"kat": "ka", "kau": "kr", "kaz": "kk", "khm": "km", "kik": "ki", "kin": "rw",
+	"kir": "ky", "kom": "kv", "kon": "kg", "kor": "ko", "kua": "kj", "kur": "ku",
+	"lao": "lo", "lat": "la", "lav": "lv", "lim": "li", "lin": "ln", "lit": "lt",
+	"ltz": "lb", "lub": "lu", "lug": "lg", "mac": "mk", "mah": "mh", "mal": "ml",
+	"mao": "mi", "mar": "mr", "may": "ms", "mkd": "mk", "mlg": "mg", "mlt": "mt",
+	"mon": "mn", "mri": "mi", "msa": "ms", "mya": "my", "nau": "na", "nav": "nv",
+	"nbl": "nr", "nde": "nd", "ndo": "ng", "nep": "ne", "nld": "nl", "nno": "nn",
+	"nob": "nb", "nor": "no", "nya": "ny", "oci": "oc", "oji": "oj", "ori": "or",
+	"orm": "om", "oss": "os", "pan": "pa", "per": "fa", "pli": "pi", "pol": "pl",
+	"por": "pt", "pus": "ps", "que": "qu", "roh": "rm", "ron": "ro", "rum": "ro",
+	"run": "rn", "rus": "ru", "sag": "sg", "san": "sa", "sin": "si", "slk": "sk",
+	"slo": "sk", "slv": "sl", "sme": "se", "smo": "sm", "sna": "sn", "snd": "sd",
+	"som": "so", "sot": "st", "spa": "es", "sqi": "sq", "srd": "sc", "srp": "sr",
+	"ssw": "ss", "sun": "su", "swa": "sw", "swe": "sv", "tah": "ty", "tam": "ta",
+	"tat": "tt", "tel": "te", "tgk": "tg", "tgl": "tl", "tha": "th", "tib": "bo",
+	"tir": "ti", "ton": "to", "tsn": "tn", "tso": "ts", "tuk": "tk", "tur": "tr",
+	"twi": "tw", "uig": "ug", "ukr": "uk", "urd": "ur", "uzb": "uz", "ven": "ve",
+	"vie": "vi", "vol": "vo", "wel": "cy", "wln": "wa", "wol": "wo", "xho": "xh",
+	"yid": "yi", "yor": "yo", "zha": "za", "zho": "zh", "zul": "zu",
+
+	// Deprecated ISO 639-1 codes.
+	"in": "id", "iw": "he", "ji": "yi",
+}
+
+// LanguageUndetermined is the BCP 47 tag of an unknown language.
+const LanguageUndetermined = "und"
+
+// LanguageTag normalizes a language code, like the ISO 639-2 codes of
+// ID3v2 frames and MP4 files or a BCP 47 tag, to a BCP 47 tag, e.g. "eng"
+// and "ENG" are "en", "ger" is "de" and "pt_br" is "pt-BR". Codes that
+// don't name a language, like "XXX" and empty ones, are "und".
+func LanguageTag(code string) string {
+	code = strings.TrimRight(code, "\x00 ")
+	subtags := strings.FieldsFunc(code, func(r rune) bool { return r == '-' || r == '_' })
+	if len(subtags) == 0 {
+		return LanguageUndetermined
+	}
+	lang := strings.ToLower(subtags[0])
+	if !isAlpha(lang) || len(lang) < 2 || len(lang) > 3 || lang == "xxx" {
+		return LanguageUndetermined
+	}
+	if short, ok := iso639[lang]; ok {
+		lang = short
+	}
+	subtags[0] = lang
+
+	for i, subtag := range subtags[1:] {
+		switch {
+		case len(subtag) == 4 && isAlpha(subtag):
+			// Script, e.g. "Latn".
+			subtag = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		case len(subtag) == 2 && isAlpha(subtag), len(subtag) == 3 && !isAlpha(subtag):
+			// Region, e.g. "BR" or "419".
+			subtag = strings.ToUpper(subtag)
+		default:
+			subtag = strings.ToLower(subtag)
+		}
+		subtags[i+1] = subtag
+	}
+	return strings.Join(subtags, "-")
+}
+
+// isAlpha reports whether s only has ASCII letters.
+func isAlpha(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// LanguageMatches reports whether a language code is in a preferred
+// language, both of which are normalized with LanguageTag. A preference
+// for a language matches all of its regions, e.g. "en" matches "en-GB",
+// but a preference for a region only matches that region and codes
+// without one, e.g. "en-GB" matches "eng" but not "en-US".
+func LanguageMatches(code, preferred string) bool {
+	code, preferred = LanguageTag(code), LanguageTag(preferred)
+	if code == LanguageUndetermined || preferred == LanguageUndetermined {
+		return false
+	}
+	if code == preferred || strings.HasPrefix(code, preferred+"-") {
+		return true
+	}
+	return strings.HasPrefix(preferred, code+"-")
+}
+
+// WithLanguage sets the preferred language of New, as a BCP 47 tag or an
+// ISO 639 code, which picks the comment and the lyrics that KeyComment and
+// KeyLyrics hold when a file has them in several languages. All of them are
+// still returned, see Comments and UnsyncedLyrics.
+func WithLanguage(lang string) Option {
+	return func(o *options) {
+		o.language = lang
+	}
+}
+
+// bestLanguage returns the index of the entry that best matches a
+// preferred language, of n entries with a language and a description.
+// Entries with an empty description are preferred, since taggers use
+// descriptions for machine-readable data (e.g. "iTunNORM").
+// If no entry is in the preferred language then entries with an unknown
+// language ("XXX", "und" or empty) are preferred, and then the first entry.
+func bestLanguage(n int, entry func(i int) (language, description string), preferred string) int {
+	best, bestScore := 0, -1
+
+	for i := 0; i < n; i++ {
+		language, description := entry(i)
+
+		score := 0
+		if preferred != "" && LanguageMatches(language, preferred) {
+			score += 4
+		} else if LanguageTag(language) == LanguageUndetermined {
+			score += 2
+		}
+		if description == "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,92 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+)
+
+// legacyFormats maps the signatures of lossless formats that are only
+// detected, not parsed, to the names stored in the "Format" property.
+var legacyFormats = map[string]string{
+	"ajkg": "Shorten",
+	"TTA1": "TTA",
+	"tBaK": "TAK",
+	"OFR ": "OptimFROG",
+}
+
+// ttaHeaderSize is the size of a TTA1 header, which is simple enough
+// to read the stream properties from.
+const ttaHeaderSize = 22
+
+// legacyFormat returns the name of a legacy lossless format from the
+// start of a file, or an empty string if it isn't one.
+func legacyFormat(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+	return legacyFormats[string(b[:4])]
+}
+
+// isLegacyPrefix reports whether b could be the start of the signature
+// of a legacy lossless format.
+func isLegacyPrefix(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for sig := range legacyFormats {
+		if len(b) <= len(sig) && sig[:len(b)] == string(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// newLegacy creates a new map that contains properties for a legacy
+// lossless format. header holds the bytes that have already been read.
+// If r is an io.ReadSeeker the APEv2 tag at the end of the file is read too.
+func newLegacy(r io.Reader, header []byte, o options) (map[string]string, error) {
+	if len(header) < ttaHeaderSize {
+		rest := make([]byte, ttaHeaderSize-len(header))
+
+		n, err := io.ReadFull(r, rest)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		header = append(header, rest[:n]...)
+	}
+	metadata := legacyMetadata(header)
+	if metadata == nil {
+		return nil, nil
+	}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if err := readAPEv2(rs, metadata, o); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// legacyMetadata returns the format of a legacy lossless file, and the
+// stream properties if it is TTA, or nil if it isn't a legacy format.
+func legacyMetadata(b []byte) map[string]string {
+	format := legacyFormat(b)
+	if format == "" {
+		return nil
+	}
+	metadata := map[string]string{
+		KeyFormat: format,
+	}
+	if format != "TTA" || len(b) < ttaHeaderSize {
+		return metadata
+	}
+
+	// The signature is followed by the audio format, the number of channels,
+	// the bits per sample, the sample rate and the number of samples.
+	metadata[KeyNumChannels] = strconv.Itoa(int(binary.LittleEndian.Uint16(b[6:8])))
+	metadata[KeyBitRate] = strconv.Itoa(int(binary.LittleEndian.Uint16(b[8:10])))
+	metadata[KeySampleRate] = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[10:14])), 10)
+	metadata[KeySampleCount] = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[14:18])), 10)
+
+	return metadata
+}
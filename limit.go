@@ -0,0 +1,149 @@
+package sndtag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrReadLimit is returned when reading a file needs more bytes
+// than the limit set with WithReadLimit.
+var ErrReadLimit = errors.New("read limit exceeded")
+
+// ErrMaxDepth is wrapped by the DepthError that is returned when containers
+// are nested deeper than the limit set with WithMaxDepth.
+var ErrMaxDepth = errors.New("containers nested too deeply")
+
+// defaultMaxDepth is how deep containers can be nested by default,
+// which is far deeper than any real file nests them.
+const defaultMaxDepth = 32
+
+// A DepthError is returned when containers, like MP4 atoms or RIFF LIST
+// chunks, are nested deeper than the limit set with WithMaxDepth.
+type DepthError struct {
+	// Container is the ID of the container that is nested too deeply,
+	// and Depth is its depth, which is 0 for the top of the file.
+	Container string
+	Depth     int
+}
+
+// Error returns a description of the error.
+func (e *DepthError) Error() string {
+	return fmt.Sprintf("%s: %q at depth %d", ErrMaxDepth, e.Container, e.Depth)
+}
+
+// Unwrap returns ErrMaxDepth.
+func (e *DepthError) Unwrap() error {
+	return ErrMaxDepth
+}
+
+// WithMaxDepth sets how deep containers can be nested before parsing fails
+// with a DepthError, which keeps crafted files from exhausting the stack.
+// The default, which is also used if n is less than 1, is 32. Parsing
+// always moves forward in the file, so a file can't make it loop.
+func WithMaxDepth(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxDepth = n
+		}
+	}
+}
+
+// checkDepth returns a DepthError if a container at the given depth
+// is nested too deeply to descend into.
+func (o options) checkDepth(container string, depth int) error {
+	if depth >= o.maxDepth {
+		return &DepthError{Container: container, Depth: depth}
+	}
+	return nil
+}
+
+// guardedReader is an io.Reader that stops reading when too many bytes
+// have been read or when its context is done.
+type guardedReader struct {
+	r   io.Reader
+	ctx context.Context
+
+	// n is the number of bytes that can still be read, if limited is set.
+	n       int64
+	limited bool
+}
+
+// guardedReadSeeker is a guardedReader that can seek, so trailing tags
+// can still be read. Seeking doesn't count towards the limit.
+type guardedReadSeeker struct {
+	*guardedReader
+	s io.Seeker
+}
+
+// Seek seeks the underlying reader.
+func (g guardedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	if err := g.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return g.s.Seek(offset, whence)
+}
+
+// guard wraps r so that reading it obeys the limit and the context that
+// were set with WithReadLimit and WithContext. r is returned as is if
+// neither was set.
+func (o options) guard(r io.Reader) io.Reader {
+	if o.limit <= 0 && o.ctx == nil {
+		return r
+	}
+	g := &guardedReader{r: r, ctx: o.ctx, n: o.limit, limited: o.limit > 0}
+	if g.ctx == nil {
+		g.ctx = context.Background()
+	}
+	if s, ok := r.(io.Seeker); ok {
+		return guardedReadSeeker{guardedReader: g, s: s}
+	}
+	return g
+}
+
+// guardContext wraps r so that reading it stops when the context set with
+// WithContext is done, without the limit set with WithReadLimit.
+func (o options) guardContext(r io.Reader) io.Reader {
+	if o.ctx == nil {
+		return r
+	}
+	return options{ctx: o.ctx}.guard(r)
+}
+
+// Read reads from the underlying reader.
+func (g *guardedReader) Read(p []byte) (int, error) {
+	if err := g.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if !g.limited {
+		return g.r.Read(p)
+	}
+	if g.n <= 0 {
+		// Reaching the end of the stream at the limit is fine.
+		if _, err := g.r.Read(make([]byte, 1)); err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, ErrReadLimit
+	}
+	if int64(len(p)) > g.n {
+		p = p[:g.n]
+	}
+	n, err := g.r.Read(p)
+	g.n -= int64(n)
+	return n, err
+}
+
+// check checks the limit and the context for a file of the given size
+// that is already in memory.
+func (o options) check(size int) error {
+	if o.ctx != nil {
+		if err := o.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if o.limit > 0 && int64(size) > o.limit {
+		return ErrReadLimit
+	}
+	return nil
+}
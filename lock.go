@@ -0,0 +1,64 @@
+package sndtag
+
+import "os"
+
+// A FileLocker locks files so that processes that edit the same file,
+// like two taggers retagging a library, don't interleave their writes.
+// The locks are advisory: they only exclude other writers that lock the
+// file too, not readers.
+//
+// The default FileLocker uses flock(2) on Unix and LockFileEx on Windows.
+// On other systems files aren't locked.
+type FileLocker interface {
+	// Lock blocks until the caller holds the lock of the file at path,
+	// and returns a function that releases it.
+	Lock(path string) (unlock func() error, err error)
+}
+
+// WithFileLocker sets the FileLocker that WriteFile and WriteQueue use to
+// lock a file from before it is read until the new file has been renamed
+// over it. A nil FileLocker disables locking.
+func WithFileLocker(l FileLocker) Option {
+	return func(o *options) {
+		o.locker = l
+	}
+}
+
+// defaultLocker is the FileLocker used when none is set
+// with WithFileLocker, and by RepairFile and Revert.
+var defaultLocker FileLocker = osLocker{}
+
+// lockPath locks the file at path with l, if l isn't nil, and returns
+// the function that releases the lock.
+func lockPath(l FileLocker, path string) (func() error, error) {
+	if l == nil {
+		return func() error { return nil }, nil
+	}
+	return l.Lock(path)
+}
+
+// lockOpened locks f, which was opened from path, with lock, and checks
+// that f is still the file at path once it holds the lock. The writer
+// that held the lock may have renamed a new file over it, in which case
+// the lock is released and lockOpened returns false so that the caller
+// opens the file again.
+func lockOpened(f *os.File, path string, lock, unlock func(*os.File) error) (bool, error) {
+	if err := lock(f); err != nil {
+		return false, err
+	}
+	locked, err := f.Stat()
+	if err != nil {
+		unlock(f)
+		return false, err
+	}
+	current, err := os.Stat(osPath(path))
+	if err != nil {
+		unlock(f)
+		return false, err
+	}
+	if !os.SameFile(locked, current) {
+		unlock(f)
+		return false, nil
+	}
+	return true, nil
+}
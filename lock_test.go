@@ -0,0 +1,154 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows
+
+package sndtag
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockAsync locks the file at path in a goroutine and returns a channel
+// that receives the unlock function once the lock is held.
+func lockAsync(t *testing.T, path string) <-chan func() error {
+	locked := make(chan func() error, 1)
+	go func() {
+		unlock, err := defaultLocker.Lock(path)
+		if err != nil {
+			t.Error(err)
+			unlock = func() error { return nil }
+		}
+		locked <- unlock
+	}()
+	return locked
+}
+
+// checkBlocked fails the test if a lock is taken within a short time.
+func checkBlocked(t *testing.T, locked <-chan func() error) {
+	t.Helper()
+	select {
+	case unlock := <-locked:
+		unlock()
+		t.Fatal("the lock was taken while another one was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// waitLocked waits for a lock to be taken.
+func waitLocked(t *testing.T, locked <-chan func() error) func() error {
+	t.Helper()
+	select {
+	case unlock := <-locked:
+		return unlock
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock wasn't taken")
+		return nil
+	}
+}
+
+func TestLockContention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.wav")
+	if err := os.WriteFile(path, testWav(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := defaultLocker.Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter := lockAsync(t, path)
+	checkBlocked(t, waiter)
+
+	// The holder renames a new file over the locked one, so the waiter
+	// has to lock the new file rather than the one it opened.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, testWav(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock = waitLocked(t, waiter)
+
+	third := lockAsync(t, path)
+	checkBlocked(t, third)
+	unlock()
+	waitLocked(t, third)()
+}
+
+func TestWriteFileLocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.wav")
+	if err := os.WriteFile(path, testWav(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name    string
+		opts    []Option
+		blocked bool
+	}{
+		{"default", nil, true},
+		{"no locker", []Option{WithFileLocker(nil)}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			unlock, err := defaultLocker.Lock(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan error, 1)
+			go func() {
+				done <- WriteFile(path, TagSet{KeyArtist: tc.name}, tc.opts...)
+			}()
+			select {
+			case err := <-done:
+				if tc.blocked {
+					t.Errorf("WriteFile returned %v while the file was locked", err)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if !tc.blocked {
+					t.Error("WriteFile waited for the lock")
+				}
+			}
+			unlock()
+			if tc.blocked {
+				if err := <-done; err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFileConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.wav")
+	if err := os.WriteFile(path, testWav(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Each writer reads the file once it holds the lock, so no edit is lost.
+	keys := []string{KeyArtist, KeyAlbum, KeyTitle, KeyGenre}
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			if err := WriteFile(path, TagSet{key: fmt.Sprint("Value ", i)}); err != nil {
+				t.Error(err)
+			}
+		}(i, key)
+	}
+	wg.Wait()
+
+	metadata, err := readTestFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range keys {
+		if got, want := metadata[key], fmt.Sprint("Value ", i); got != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package sndtag
+
+import (
+	"os"
+	"syscall"
+)
+
+// osLocker locks files with flock(2).
+type osLocker struct{}
+
+// Lock takes an exclusive flock on the file at path.
+func (osLocker) Lock(path string) (func() error, error) {
+	for {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := lockOpened(f, path, flock, funlock)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if !ok {
+			f.Close()
+			continue
+		}
+		return func() error {
+			defer f.Close()
+			return funlock(f)
+		}, nil
+	}
+}
+
+// flock takes an exclusive lock on f, retrying if interrupted by a signal.
+func flock(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// funlock releases the lock on f.
+func funlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
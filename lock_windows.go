@@ -0,0 +1,87 @@
+//go:build windows
+
+package sndtag
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileExclusiveLock = 0x2
+
+	// The locked byte is far past the end of any file, since locks on
+	// Windows are mandatory and would otherwise stop readers.
+	lockOffsetHigh = 0x7fffffff
+)
+
+// osLocker locks files with LockFileEx.
+type osLocker struct{}
+
+// Lock takes an exclusive lock on the file at path. The file is opened
+// with FILE_SHARE_DELETE so that a new file can be renamed over it
+// while the lock is held.
+func (osLocker) Lock(path string) (func() error, error) {
+	for {
+		f, err := openShared(path)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := lockOpened(f, path, lockFileEx, unlockFileEx)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if !ok {
+			f.Close()
+			continue
+		}
+		return func() error {
+			defer f.Close()
+			return unlockFileEx(f)
+		}, nil
+	}
+}
+
+// openShared opens a file for reading without stopping
+// other processes from reading, writing or replacing it.
+func openShared(path string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(osPath(path))
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
+
+// lockFileEx takes an exclusive lock on a byte of f.
+func lockFileEx(f *os.File) error {
+	ol := syscall.Overlapped{OffsetHigh: lockOffsetHigh}
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// unlockFileEx releases the lock taken by lockFileEx.
+func unlockFileEx(f *os.File) error {
+	ol := syscall.Overlapped{OffsetHigh: lockOffsetHigh}
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
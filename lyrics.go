@@ -0,0 +1,89 @@
+package sndtag
+
+import "strconv"
+
+// Lyrics are the unsynchronized lyrics of an ID3v2 USLT frame, which like
+// comments have a language and a description.
+type Lyrics struct {
+	// Language is an ISO-639-2 language code, e.g. "eng".
+	Language    string
+	Description string
+	Text        string
+}
+
+// LanguageTag returns the language of the lyrics as a BCP 47 tag,
+// see LanguageTag.
+func (l Lyrics) LanguageTag() string {
+	return LanguageTag(l.Language)
+}
+
+// decodeLyrics decodes the data of a USLT frame,
+// which is laid out like a COMM frame.
+func decodeLyrics(data []byte, cs charsets) Lyrics {
+	return Lyrics(decodeComment(data, cs))
+}
+
+// setLyrics stores USLT frames as properties.
+// Each frame is stored as "UnsyncedLyrics<n>Language",
+// "UnsyncedLyrics<n>Description" and "UnsyncedLyrics<n>Text", counting
+// from 1, and the number of frames is stored as "UnsyncedLyrics".
+// The "Lyrics" property is set to the best lyrics for the preferred
+// language, see WithLanguage.
+func setLyrics(metadata map[string]string, lyrics []Lyrics, language string) {
+	if len(lyrics) == 0 {
+		return
+	}
+	metadata[KeyUnsyncedLyrics] = strconv.Itoa(len(lyrics))
+
+	for i, l := range lyrics {
+		metadata[KeyUnsyncedLyricsLanguage(i+1)] = l.Language
+		metadata[KeyUnsyncedLyricsDescription(i+1)] = l.Description
+		metadata[KeyUnsyncedLyricsText(i+1)] = l.Text
+	}
+	if l, ok := BestLyrics(lyrics, language); ok {
+		metadata[KeyLyrics] = l.Text
+	}
+}
+
+// UnsyncedLyrics returns the lyrics stored in a metadata map,
+// in the order they appear in the file.
+func UnsyncedLyrics(metadata map[string]string) []Lyrics {
+	count := listCount(metadata, KeyUnsyncedLyrics)
+	if count == 0 {
+		return nil
+	}
+	lyrics := make([]Lyrics, 0, count)
+
+	for i := 1; i <= count; i++ {
+		lyrics = append(lyrics, Lyrics{
+			Language:    metadata[KeyUnsyncedLyricsLanguage(i)],
+			Description: metadata[KeyUnsyncedLyricsDescription(i)],
+			Text:        metadata[KeyUnsyncedLyricsText(i)],
+		})
+	}
+	return lyrics
+}
+
+// BestLyrics picks the lyrics that best match a preferred language, the way
+// BestComment picks a comment. The second return value is false if there
+// are no lyrics.
+func BestLyrics(lyrics []Lyrics, language string) (Lyrics, bool) {
+	if len(lyrics) == 0 {
+		return Lyrics{}, false
+	}
+	best := bestLanguage(len(lyrics), func(i int) (string, string) {
+		return lyrics[i].Language, lyrics[i].Description
+	}, language)
+	return lyrics[best], true
+}
+
+// LyricsIn returns the lyrics in a preferred language, see LanguageMatches.
+func LyricsIn(lyrics []Lyrics, language string) []Lyrics {
+	var matches []Lyrics
+	for _, l := range lyrics {
+		if LanguageMatches(l.Language, language) {
+			matches = append(matches, l)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,535 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+)
+
+// Matroska element IDs, including their length marker.
+const (
+	ebmlHeader        = 0x1a45dfa3
+	ebmlDocType       = 0x4282
+	mkvSegment        = 0x18538067
+	mkvInfo           = 0x1549a966
+	mkvTimecodeScale  = 0x2ad7b1
+	mkvDuration       = 0x4489
+	mkvTitle          = 0x7ba9
+	mkvTracks         = 0x1654ae6b
+	mkvTrackEntry     = 0xae
+	mkvTrackType      = 0x83
+	mkvCodecID        = 0x86
+	mkvCodecPrivate   = 0x63a2
+	mkvName           = 0x536e
+	mkvAudio          = 0xe1
+	mkvSamplingFreq   = 0xb5
+	mkvChannels       = 0x9f
+	mkvBitDepth       = 0x6264
+	mkvAttachments    = 0x1941a469
+	mkvAttachedFile   = 0x61a7
+	mkvFileName       = 0x466e
+	mkvFileMimeType   = 0x4660
+	mkvFileData       = 0x465c
+	mkvCluster        = 0x1f43b675
+	mkvMaxElementSize = 1 << 20
+)
+
+// mkvTrackTypeAudio is the track type of audio tracks.
+const mkvTrackTypeAudio = 2
+
+// mkvUnknownSize is returned by readEBMLVint for elements
+// whose size is not known, e.g. live streams.
+const mkvUnknownSize = -1
+
+// matroska reads the metadata of Matroska and WebM files.
+// Only the segment info, the tracks and the attachments are read.
+type matroska struct {
+	r        *countingReader
+	opts     options
+	metadata map[string]string
+	tracks   int
+	files    int
+}
+
+// newMatroska creates a new map that contains properties for Matroska files.
+// Each track is stored as "Track<n>Codec", "Track<n>Name", "Track<n>SampleRate",
+// etc, counting from 1. Codec private data is stored hex-encoded as
+// "Track<n>CodecPrivate", and it is decoded for WAV (A_MS/ACM) and FLAC tracks,
+// so the parameters of the original stream can be checked. Attached files
+// are stored as "Attachment<n>Name" etc, and attached WAV and FLAC files are
+// decoded the same way. The properties of the first audio track are also
+// stored without a prefix.
+// Note that r is positioned at the start of the file.
+func newMatroska(r io.Reader, o options) (map[string]string, error) {
+	m := matroska{
+		r:        &countingReader{r: r},
+		opts:     o,
+		metadata: map[string]string{},
+	}
+	id, size, err := m.readElementHeader()
+	if err != nil {
+		return nil, err
+	}
+	if id != ebmlHeader {
+		return nil, fmt.Errorf("expected EBML header, got element 0x%x", id)
+	}
+	data, err := m.readElementData(size)
+	if err != nil {
+		return nil, err
+	}
+	m.readEBMLHeader(data)
+
+	// Read the top-level elements of the segment.
+	id, size, err = m.readElementHeader()
+	if err != nil {
+		return nil, err
+	}
+	if id != mkvSegment {
+		return nil, fmt.Errorf("expected Matroska segment, got element 0x%x", id)
+	}
+	if err := m.readSegment(); err != nil && err != io.EOF && err != errPayload {
+		return nil, err
+	}
+	if m.tracks > 0 {
+		m.metadata[KeyTracks] = strconv.Itoa(m.tracks)
+	}
+	if m.files > 0 {
+		m.metadata[KeyAttachments] = strconv.Itoa(m.files)
+	}
+	return m.metadata, nil
+}
+
+// readEBMLHeader reads the document type, e.g. "matroska" or "webm".
+func (m *matroska) readEBMLHeader(b []byte) {
+	m.metadata[KeyFormat] = "Matroska"
+
+	_ = walkEBML(b, func(id int64, data []byte) error {
+		if id == ebmlDocType && string(data) == "webm" {
+			m.metadata[KeyFormat] = "WebM"
+		}
+		return nil
+	})
+}
+
+// readSegment reads the children of the segment until the first cluster,
+// since the info, tracks and attachments normally come before the clusters.
+func (m *matroska) readSegment() error {
+	for {
+		id, size, err := m.readElementHeader()
+		if err != nil {
+			return err
+		}
+		switch id {
+		case mkvInfo, mkvTracks:
+			data, err := m.readElementData(size)
+			if err != nil {
+				return err
+			}
+			if id == mkvInfo {
+				err = m.readInfo(data)
+			} else {
+				err = m.readTracks(data)
+			}
+			if err != nil {
+				return err
+			}
+		case mkvAttachments:
+			if err := m.readAttachments(size); err != nil {
+				return err
+			}
+		case mkvCluster:
+			if size == mkvUnknownSize {
+				// Clusters of live streams can't be skipped.
+				return nil
+			}
+			// Skip the audio data, see WithProbeOnly.
+			n, err := m.opts.skipPayload(m.r, size)
+			if err != nil {
+				return err
+			}
+			if n < size {
+				return io.ErrUnexpectedEOF
+			}
+		default:
+			if size == mkvUnknownSize {
+				return nil
+			}
+			if _, err := io.CopyN(ioutil.Discard, m.r, size); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readInfo reads the segment info, which has the title and the duration.
+func (m *matroska) readInfo(b []byte) error {
+	var (
+		scale    = 1000000.0
+		duration float64
+	)
+	err := walkEBML(b, func(id int64, data []byte) error {
+		switch id {
+		case mkvTimecodeScale:
+			scale = float64(decodeEBMLUint(data))
+		case mkvDuration:
+			duration = decodeEBMLFloat(data)
+		case mkvTitle:
+			m.metadata[KeyTitle] = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if duration > 0 {
+		// The duration is in units of the timecode scale, in nanoseconds.
+		seconds := duration * scale / 1e9
+		m.metadata[KeyDuration] = strconv.FormatFloat(seconds, 'f', 3, 64)
+	}
+	return nil
+}
+
+// readTracks reads the track entries.
+func (m *matroska) readTracks(b []byte) error {
+	return walkEBML(b, func(id int64, data []byte) error {
+		if id != mkvTrackEntry {
+			return nil
+		}
+		m.tracks++
+		return m.readTrackEntry(m.tracks, data)
+	})
+}
+
+// readTrackEntry reads a track entry and its audio settings.
+func (m *matroska) readTrackEntry(n int, b []byte) error {
+	var (
+		props = map[string]string{}
+		codec string
+		audio bool
+		priv  []byte
+	)
+	err := walkEBML(b, func(id int64, data []byte) error {
+		switch id {
+		case mkvTrackType:
+			audio = decodeEBMLUint(data) == mkvTrackTypeAudio
+		case mkvCodecID:
+			codec = string(data)
+		case mkvCodecPrivate:
+			priv = data
+		case mkvName:
+			props["Name"] = string(data)
+		case mkvAudio:
+			return walkEBML(data, func(id int64, data []byte) error {
+				readMatroskaAudio(id, data, props)
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	props[KeyCodec] = codec
+
+	if len(priv) > 0 {
+		props["CodecPrivate"] = hex.EncodeToString(priv)
+
+		// The codec private data of the original stream takes precedence.
+		switch codec {
+		case "A_MS/ACM":
+			decodeWaveFormatEx(priv, props)
+		case "A_FLAC":
+			decodeFLACStreamInfo(priv, props)
+		}
+	}
+	for prop, value := range props {
+		m.metadata[KeyTrackProperty(n, prop)] = value
+	}
+	if _, ok := m.metadata[KeySampleRate]; audio && !ok {
+		for prop, value := range props {
+			if prop != "Name" && prop != "CodecPrivate" {
+				m.metadata[prop] = value
+			}
+		}
+	}
+	return nil
+}
+
+// readMatroskaAudio reads an element of the audio settings of a track.
+func readMatroskaAudio(id int64, data []byte, props map[string]string) {
+	switch id {
+	case mkvSamplingFreq:
+		props[KeySampleRate] = strconv.FormatFloat(decodeEBMLFloat(data), 'f', -1, 64)
+	case mkvChannels:
+		props[KeyNumChannels] = strconv.FormatUint(decodeEBMLUint(data), 10)
+	case mkvBitDepth:
+		props[KeyBitRate] = strconv.FormatUint(decodeEBMLUint(data), 10)
+	}
+}
+
+// readAttachments reads the attached files. The file data is not held
+// in memory, only its start is read to decode attached WAV and FLAC files.
+func (m *matroska) readAttachments(size int64) error {
+	if size == mkvUnknownSize {
+		return fmt.Errorf("attachments of unknown size")
+	}
+	end := m.r.n + size
+
+	for m.r.n < end {
+		id, size, err := m.readElementHeader()
+		if err != nil {
+			return err
+		}
+		if size == mkvUnknownSize {
+			return fmt.Errorf("attached file of unknown size")
+		}
+		if id != mkvAttachedFile {
+			if _, err := io.CopyN(ioutil.Discard, m.r, size); err != nil {
+				return err
+			}
+			continue
+		}
+		m.files++
+		if err := m.readAttachedFile(m.files, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAttachedFile reads the name, MIME type and size of an attached file.
+func (m *matroska) readAttachedFile(n int, size int64) error {
+	end := m.r.n + size
+
+	for m.r.n < end {
+		id, size, err := m.readElementHeader()
+		if err != nil {
+			return err
+		}
+		switch id {
+		case mkvFileName, mkvFileMimeType:
+			data, err := m.readElementData(size)
+			if err != nil {
+				return err
+			}
+			prop := "Name"
+			if id == mkvFileMimeType {
+				prop = "MIMEType"
+			}
+			m.metadata[KeyAttachmentProperty(n, prop)] = string(data)
+		case mkvFileData:
+			head := make([]byte, artworkSniffSize)
+			if int64(len(head)) > size {
+				head = head[:size]
+			}
+			if _, err := io.ReadFull(m.r, head); err != nil {
+				return err
+			}
+			if _, err := io.CopyN(ioutil.Discard, m.r, size-int64(len(head))); err != nil {
+				return err
+			}
+			props := map[string]string{
+				"Size": strconv.FormatInt(size, 10),
+			}
+			decodeWrappedFormat(head, props)
+
+			for prop, value := range props {
+				m.metadata[KeyAttachmentProperty(n, prop)] = value
+			}
+		default:
+			if _, err := io.CopyN(ioutil.Discard, m.r, size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readElementHeader reads the ID and the size of an element.
+func (m *matroska) readElementHeader() (int64, int64, error) {
+	id, err := readEBMLVint(m.r, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := readEBMLVint(m.r, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	return id, size, nil
+}
+
+// readElementData reads the data of an element into memory.
+func (m *matroska) readElementData(size int64) ([]byte, error) {
+	if size == mkvUnknownSize || size > mkvMaxElementSize {
+		return nil, fmt.Errorf("element of size %d is too large", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(m.r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readEBMLVint reads a variable-length integer. The number of leading zero
+// bits of the first byte is the number of bytes that follow. IDs keep the
+// length marker, sizes don't, and a size with all bits set is unknown.
+func readEBMLVint(r io.Reader, keepMarker bool) (int64, error) {
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(r, first); err != nil {
+		return 0, err
+	}
+	length := ebmlVintLength(first[0])
+	if length > 8 {
+		return 0, fmt.Errorf("invalid EBML variable-length integer")
+	}
+	rest := make([]byte, length-1)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return 0, err
+	}
+	return decodeEBMLVint(append(first, rest...), keepMarker), nil
+}
+
+// decodeEBMLVint decodes a variable-length integer of a known length.
+func decodeEBMLVint(b []byte, keepMarker bool) int64 {
+	var (
+		marker  = byte(0x80) >> uint(len(b)-1)
+		value   = int64(b[0])
+		unknown = b[0]&(marker-1) == marker-1
+	)
+	if !keepMarker {
+		value = int64(b[0] & (marker - 1))
+	}
+	for _, c := range b[1:] {
+		value = value<<8 | int64(c)
+		unknown = unknown && c == 0xff
+	}
+	if unknown && !keepMarker {
+		return mkvUnknownSize
+	}
+	return value
+}
+
+// walkEBML calls fn for each child element of an element that is in memory.
+func walkEBML(b []byte, fn func(id int64, data []byte) error) error {
+	for len(b) > 0 {
+		id, rest, err := nextEBMLVint(b, true)
+		if err != nil {
+			return err
+		}
+		size, rest, err := nextEBMLVint(rest, false)
+		if err != nil {
+			return err
+		}
+		if size < 0 || size > int64(len(rest)) {
+			return fmt.Errorf("truncated EBML element 0x%x", id)
+		}
+		if err := fn(id, rest[:size]); err != nil {
+			return err
+		}
+		b = rest[size:]
+	}
+	return nil
+}
+
+// nextEBMLVint decodes the variable-length integer at the start of a byte
+// slice and also returns the bytes that follow it.
+func nextEBMLVint(b []byte, keepMarker bool) (int64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, fmt.Errorf("truncated EBML element")
+	}
+	length := ebmlVintLength(b[0])
+	if length > 8 {
+		return 0, nil, fmt.Errorf("invalid EBML variable-length integer")
+	}
+	if length > len(b) {
+		return 0, nil, fmt.Errorf("truncated EBML variable-length integer")
+	}
+	return decodeEBMLVint(b[:length], keepMarker), b[length:], nil
+}
+
+// ebmlVintLength returns the length of a variable-length integer
+// from its first byte, or 9 if it is invalid.
+func ebmlVintLength(first byte) int {
+	length := 1
+	for mask := byte(0x80); length <= 8 && first&mask == 0; mask >>= 1 {
+		length++
+	}
+	return length
+}
+
+// decodeEBMLUint decodes a big-endian unsigned integer of up to 8 bytes.
+func decodeEBMLUint(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// decodeEBMLFloat decodes a 4 or 8-byte big-endian float.
+func decodeEBMLFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// decodeWrappedFormat decodes the format of a WAV or FLAC file from its start.
+func decodeWrappedFormat(b []byte, props map[string]string) {
+	switch {
+	case len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "WAVE":
+		for body := b[12:]; len(body) > 0; {
+			id, data, rest, err := nextChunk(body)
+			if err != nil {
+				return
+			}
+			if id == "fmt " {
+				decodeWaveFormatEx(data, props)
+				return
+			}
+			body = rest
+		}
+	case len(b) >= 4 && string(b[:4]) == "fLaC":
+		decodeFLACStreamInfo(b, props)
+	}
+}
+
+// decodeWaveFormatEx decodes a WAVEFORMATEX structure, which is what the
+// fmt chunk of a WAV file holds. Unlike readFormat, any format tag is accepted.
+func decodeWaveFormatEx(b []byte, props map[string]string) {
+	if len(b) < 16 {
+		return
+	}
+	props[KeyAudioFormat] = strconv.Itoa(int(binary.LittleEndian.Uint16(b[0:2])))
+	props[KeyNumChannels] = strconv.Itoa(int(binary.LittleEndian.Uint16(b[2:4])))
+	props[KeySampleRate] = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[4:8])), 10)
+	props[KeyByteRate] = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[8:12])), 10)
+	props[KeyBlockAlign] = strconv.Itoa(int(binary.LittleEndian.Uint16(b[12:14])))
+	props[KeyBitRate] = strconv.Itoa(int(binary.LittleEndian.Uint16(b[14:16])))
+}
+
+// decodeFLACStreamInfo decodes the STREAMINFO block that follows the "fLaC"
+// signature, which is what the codec private data of FLAC tracks holds.
+func decodeFLACStreamInfo(b []byte, props map[string]string) {
+	// The signature and the block header are followed by the minimum and
+	// maximum block and frame sizes, then 64 bits that hold the sample rate,
+	// the number of channels, the bits per sample and the number of samples.
+	const offset = 4 + 4 + 10
+
+	if len(b) < offset+8 || string(b[:4]) != "fLaC" || b[4]&0x7f != 0 {
+		return
+	}
+	bits := binary.BigEndian.Uint64(b[offset:])
+
+	props[KeySampleRate] = strconv.FormatUint(bits>>44, 10)
+	props[KeyNumChannels] = strconv.FormatUint(bits>>41&0x7+1, 10)
+	props[KeyBitRate] = strconv.FormatUint(bits>>36&0x1f+1, 10)
+	props[KeySampleCount] = strconv.FormatUint(bits&0xfffffffff, 10)
+}
@@ -0,0 +1,147 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// testEBML encodes an EBML element with an ID, which includes its length
+// marker, and a size of 8 bytes.
+func testEBML(id uint32, children ...[]byte) []byte {
+	var data []byte
+	for _, c := range children {
+		data = append(data, c...)
+	}
+	var b []byte
+	switch {
+	case id >= 1<<24:
+		b = binary.BigEndian.AppendUint32(b, id)
+	case id >= 1<<16:
+		b = append(b, byte(id>>16), byte(id>>8), byte(id))
+	case id >= 1<<8:
+		b = append(b, byte(id>>8), byte(id))
+	default:
+		b = append(b, byte(id))
+	}
+	b = binary.BigEndian.AppendUint64(b, 1<<56|uint64(len(data)))
+	return append(b, data...)
+}
+
+// testEBMLFloat encodes an 8-byte float element.
+func testEBMLFloat(id uint32, f float64) []byte {
+	return testEBML(id, binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+// testMatroska encodes a Matroska file of a document type with a title,
+// a duration of 2.5 seconds, a video track and a stereo audio track.
+func testMatroska(docType string, extra ...[]byte) []byte {
+	segment := [][]byte{
+		testEBML(mkvInfo,
+			testEBML(mkvTimecodeScale, []byte{0x0f, 0x42, 0x40}),
+			testEBMLFloat(mkvDuration, 2500),
+			testEBML(mkvTitle, []byte("Title")),
+		),
+		testEBML(mkvTracks,
+			testEBML(mkvTrackEntry,
+				testEBML(mkvTrackType, []byte{1}),
+				testEBML(mkvCodecID, []byte("V_VP9")),
+			),
+			testEBML(mkvTrackEntry,
+				testEBML(mkvTrackType, []byte{mkvTrackTypeAudio}),
+				testEBML(mkvCodecID, []byte("A_OPUS")),
+				testEBML(mkvName, []byte("Stereo")),
+				testEBML(mkvAudio,
+					testEBMLFloat(mkvSamplingFreq, 48000),
+					testEBML(mkvChannels, []byte{2}),
+				),
+			),
+		),
+	}
+	segment = append(segment, extra...)
+	file := testEBML(ebmlHeader, testEBML(ebmlDocType, []byte(docType)))
+	return append(file, testEBML(mkvSegment, segment...)...)
+}
+
+func TestNewMatroska(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file []byte
+		want map[string]string
+		err  bool
+	}{
+		{
+			name: "matroska",
+			file: testMatroska("matroska"),
+			want: map[string]string{
+				KeyFormat: "Matroska", KeyTitle: "Title", KeyDuration: "2.500", KeyTracks: "2",
+				KeyCodec: "A_OPUS", KeySampleRate: "48000", KeyNumChannels: "2",
+				KeyTrackProperty(1, KeyCodec): "V_VP9", KeyTrackProperty(2, "Name"): "Stereo",
+			},
+		},
+		{
+			name: "webm",
+			file: testMatroska("webm"),
+			want: map[string]string{KeyFormat: "WebM", KeyTitle: "Title"},
+		},
+		{
+			name: "cluster and attachment",
+			file: testMatroska("matroska",
+				testEBML(mkvCluster, make([]byte, 64)),
+				testEBML(mkvAttachments, testEBML(mkvAttachedFile,
+					testEBML(mkvFileName, []byte("cover.png")),
+					testEBML(mkvFileMimeType, []byte("image/png")),
+					testEBML(mkvFileData, []byte("\x89PNG\r\n\x1a\n")),
+				)),
+			),
+			want: map[string]string{
+				KeyAttachments: "1", KeyAttachmentProperty(1, "Name"): "cover.png",
+				KeyAttachmentProperty(1, "MIMEType"): "image/png", KeyAttachmentProperty(1, "Size"): "8",
+			},
+		},
+		{
+			name: "truncated element",
+			file: []byte("\x1aE\xdf\xa3\x81\xff\xff\xff\xff\xff\xff"),
+			err:  true,
+		},
+		{
+			name: "truncated info",
+			file: testMatroska("matroska")[:60],
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			readers := map[string]func() (map[string]string, error){
+				"NewFromBytes": func() (map[string]string, error) { return NewFromBytes(tc.file) },
+				"New":          func() (map[string]string, error) { return New(bytes.NewReader(tc.file)) },
+				"newMatroska":  func() (map[string]string, error) { return newMatroska(bytes.NewReader(tc.file), options{}) },
+			}
+			for name, read := range readers {
+				metadata, err := read()
+				if tc.err {
+					if err == nil {
+						t.Errorf("%s: got no error", name)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				for key, want := range tc.want {
+					if got := metadata[key]; got != want {
+						t.Errorf("%s: %s: got %q, want %q", name, key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWalkEBMLTruncated(t *testing.T) {
+	for _, b := range [][]byte{{0xff}, {0x42}, {0x42, 0x82}, {0x81, 0x85, 'a'}} {
+		if err := walkEBML(b, func(int64, []byte) error { return nil }); err == nil {
+			t.Errorf("walkEBML(%x): got no error", b)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package sndtag
+
+import "strings"
+
+// TagProvider is the tag of the sources of properties found by a Provider,
+// see WithProviders. Their ID is empty.
+const TagProvider = "Provider"
+
+// Metadata is a set of properties along with where they were read from,
+// e.g. the result of New and the sources recorded with WithSources.
+// Sources can be nil, or lack some of the properties.
+type Metadata struct {
+	Properties map[string]string
+	Sources    map[string]Source
+}
+
+// A MergeRule sets the merge policy of some properties, overriding the
+// policy passed to Merge, e.g. to take the genre from an online lookup
+// but keep every other property of the file.
+type MergeRule struct {
+	Keys   []string
+	Policy MergePolicy
+}
+
+// indexedLists are the counts of indexed properties and the prefix of
+// their keys. A list is merged as a whole along with its count, so that
+// lists from different sources aren't mixed.
+var indexedLists = []struct {
+	count, prefix string
+}{
+	{KeyComments, "Comment"},
+	{KeyUnsyncedLyrics, "UnsyncedLyrics"},
+	{KeyArtworks, "Artwork"},
+	{KeyObjects, "Object"},
+	{KeyRelativeVolumes, "RelativeVolume"},
+	{KeyEqualizations, "Equalization"},
+	{KeyCuePoints, "Cue"},
+	{KeySampleLoops, "Loop"},
+	{KeySamples, "Sample"},
+	{KeyInstruments, "Instrument"},
+	{KeyTexts, "Text"},
+	{KeyTracks, "Track"},
+	{KeyAttachments, "Attachment"},
+	{KeyCodingHistoryEntries, "CodingHistory"},
+	{KeyCueSheetTracks, "CueSheetTrack"},
+	{KeyEdits, "Edit"},
+}
+
+// Merge merges the properties of two sources, e.g. the tags of a file
+// and those found by a Provider, and returns the result, with the source
+// of each property. Neither input is modified.
+//
+// Properties that only one input has are kept. For the others, MergeMissing
+// keeps the value of primary and MergeOverwrite takes the value of
+// secondary, unless a rule for the property says otherwise; the last rule
+// for a property applies. Indexed properties, like "Comment1Text", are
+// merged along with their count, like "Comments", see KeyComments.
+func Merge(primary, secondary Metadata, policy MergePolicy, rules ...MergeRule) Metadata {
+	merged := Metadata{
+		Properties: make(map[string]string, len(primary.Properties)+len(secondary.Properties)),
+		Sources:    map[string]Source{},
+	}
+	for k, v := range primary.Properties {
+		merged.Properties[k] = v
+		if s, ok := primary.Sources[k]; ok {
+			merged.Sources[k] = s
+		}
+	}
+	policies := map[string]MergePolicy{}
+	for _, rule := range rules {
+		for _, k := range rule.Keys {
+			policies[k] = rule.Policy
+		}
+	}
+
+	for k, v := range secondary.Properties {
+		if inIndexedList(k) {
+			// Merged along with the count.
+			continue
+		}
+		p, ok := policies[k]
+		if !ok {
+			p = policy
+		}
+		if _, ok := merged.Properties[k]; ok && p == MergeMissing {
+			continue
+		}
+		if prefix, ok := indexedListPrefix(k); ok {
+			merged.replaceList(secondary, prefix)
+		}
+		merged.set(secondary, k, v)
+	}
+	return merged
+}
+
+// set sets a property to a value from another source.
+func (m Metadata) set(from Metadata, key, value string) {
+	m.Properties[key] = value
+	if s, ok := from.Sources[key]; ok {
+		m.Sources[key] = s
+	} else {
+		delete(m.Sources, key)
+	}
+}
+
+// replaceList replaces the indexed properties with a prefix with those of
+// another source.
+func (m Metadata) replaceList(from Metadata, prefix string) {
+	for k := range m.Properties {
+		if isIndexedKey(k, prefix) {
+			delete(m.Properties, k)
+			delete(m.Sources, k)
+		}
+	}
+	for k, v := range from.Properties {
+		if isIndexedKey(k, prefix) {
+			m.set(from, k, v)
+		}
+	}
+}
+
+// indexedListPrefix returns the prefix of the indexed properties that
+// a key is the count of, if it is one.
+func indexedListPrefix(key string) (string, bool) {
+	for _, l := range indexedLists {
+		if l.count == key {
+			return l.prefix, true
+		}
+	}
+	return "", false
+}
+
+// inIndexedList reports whether a key is one of the indexed properties
+// of indexedLists.
+func inIndexedList(key string) bool {
+	for _, l := range indexedLists {
+		if isIndexedKey(key, l.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIndexedKey reports whether a key is an indexed property with a prefix,
+// see indexedKey.
+func isIndexedKey(key, prefix string) bool {
+	rest := strings.TrimPrefix(key, prefix)
+	return len(rest) < len(key) && rest != "" && rest[0] >= '0' && rest[0] <= '9'
+}
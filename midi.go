@@ -0,0 +1,270 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// MIDI meta event types.
+const (
+	midiMetaText      = 0x01
+	midiMetaCopyright = 0x02
+	midiMetaTrackName = 0x03
+	midiMetaTempo     = 0x51
+)
+
+// midiDefaultTempo is the tempo until the first tempo event,
+// in microseconds per quarter note, i.e. 120 beats per minute.
+const midiDefaultTempo = 500000
+
+// midiTempo is a tempo change at an absolute time in ticks.
+type midiTempo struct {
+	tick  int64
+	tempo int64
+}
+
+// midi reads the metadata of Standard MIDI Files.
+type midi struct {
+	metadata map[string]string
+	texts    []string
+	tempos   []midiTempo
+
+	// end is the time of the last event of any track, in ticks.
+	end int64
+}
+
+// newMIDI creates a new map that contains properties for a Standard MIDI File
+// that is entirely in memory. The name of each track is stored as
+// "Track<n>Name", counting from 1, and text events are stored as "Text<n>",
+// with the number of them stored as "Texts". The name of the first track is
+// also stored as "Title". "Duration" is estimated from the tempo map.
+func newMIDI(b []byte) (map[string]string, error) {
+	m := midi{metadata: map[string]string{}}
+
+	id, header, rest, err := nextMIDIChunk(b)
+	if err != nil {
+		return nil, err
+	}
+	if expected, got := "MThd", id; expected != got {
+		return nil, fmt.Errorf("expected chunk ID %s, got %s", expected, got)
+	}
+	if len(header) < 6 {
+		return nil, fmt.Errorf("truncated MThd chunk")
+	}
+	var (
+		format   = binary.BigEndian.Uint16(header[0:2])
+		tracks   = binary.BigEndian.Uint16(header[2:4])
+		division = binary.BigEndian.Uint16(header[4:6])
+	)
+	m.metadata[KeyMIDIFormat] = strconv.Itoa(int(format))
+	m.metadata[KeyMIDITracks] = strconv.Itoa(int(tracks))
+	m.metadata[KeyMIDIDivision] = strconv.Itoa(int(division))
+
+	// Read the tracks. Chunks of other types are ignored.
+	for n := 1; len(rest) > 0 && n <= int(tracks); {
+		id, data, next, err := nextMIDIChunk(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = next
+
+		if id != "MTrk" {
+			continue
+		}
+		if err := m.readTrack(n, data); err != nil {
+			return nil, err
+		}
+		n++
+	}
+	if name, ok := m.metadata[KeyTrackName(1)]; ok && name != "" {
+		m.metadata[KeyTitle] = name
+	}
+	if len(m.texts) > 0 {
+		m.metadata[KeyTexts] = strconv.Itoa(len(m.texts))
+		for i, text := range m.texts {
+			m.metadata[KeyText(i+1)] = text
+		}
+	}
+	if seconds, ok := m.duration(division); ok {
+		m.metadata[KeyDuration] = strconv.FormatFloat(seconds, 'f', 3, 64)
+	}
+	return m.metadata, nil
+}
+
+// nextMIDIChunk returns the chunk at the start of a byte slice,
+// along with the bytes that follow it.
+func nextMIDIChunk(b []byte) (id string, data, rest []byte, err error) {
+	if len(b) < 8 {
+		return "", nil, nil, fmt.Errorf("truncated chunk header")
+	}
+	id = string(b[:4])
+	length := int64(binary.BigEndian.Uint32(b[4:8]))
+	if length > int64(len(b)-8) {
+		return "", nil, nil, fmt.Errorf("truncated %s chunk", id)
+	}
+	return id, b[8 : 8+length], b[8+length:], nil
+}
+
+// readTrack reads the events of a track and keeps the meta events.
+func (m *midi) readTrack(n int, b []byte) error {
+	var (
+		tick    int64
+		running byte
+	)
+	for len(b) > 0 {
+		delta, rest, err := readVLQ(b)
+		if err != nil {
+			return err
+		}
+		tick += delta
+		b = rest
+
+		if len(b) == 0 {
+			return fmt.Errorf("truncated event in track %d", n)
+		}
+		status := b[0]
+		if status < 0x80 {
+			// Running status: the status byte of the previous event is reused.
+			if running == 0 {
+				return fmt.Errorf("data byte without status in track %d", n)
+			}
+			status = running
+		} else {
+			b = b[1:]
+		}
+
+		switch {
+		case status == 0xff:
+			if len(b) == 0 {
+				return fmt.Errorf("truncated meta event in track %d", n)
+			}
+			typ := b[0]
+			data, rest, err := readMIDIData(b[1:])
+			if err != nil {
+				return err
+			}
+			b, running = rest, 0
+
+			m.readMeta(n, tick, typ, data)
+		case status == 0xf0 || status == 0xf7:
+			// Skip system exclusive events.
+			_, rest, err := readMIDIData(b)
+			if err != nil {
+				return err
+			}
+			b, running = rest, 0
+		case status >= 0x80 && status < 0xf0:
+			running = status
+
+			// Program change and channel pressure have one data byte.
+			size := 2
+			if status&0xf0 == 0xc0 || status&0xf0 == 0xd0 {
+				size = 1
+			}
+			if len(b) < size {
+				return fmt.Errorf("truncated channel event in track %d", n)
+			}
+			b = b[size:]
+		default:
+			return fmt.Errorf("unexpected status byte 0x%x in track %d", status, n)
+		}
+		if tick > m.end {
+			m.end = tick
+		}
+	}
+	return nil
+}
+
+// readMeta stores the meta events we recognize.
+func (m *midi) readMeta(n int, tick int64, typ byte, data []byte) {
+	switch typ {
+	case midiMetaText:
+		m.texts = append(m.texts, decodeInfoText(data))
+	case midiMetaCopyright:
+		if _, ok := m.metadata[KeyCopyright]; !ok {
+			m.metadata[KeyCopyright] = decodeInfoText(data)
+		}
+	case midiMetaTrackName:
+		if _, ok := m.metadata[KeyTrackName(n)]; !ok {
+			m.metadata[KeyTrackName(n)] = decodeInfoText(data)
+		}
+	case midiMetaTempo:
+		if len(data) == 3 {
+			tempo := int64(data[0])<<16 | int64(data[1])<<8 | int64(data[2])
+			m.tempos = append(m.tempos, midiTempo{tick: tick, tempo: tempo})
+		}
+	}
+}
+
+// duration returns the time of the last event in seconds.
+// The division is either a number of ticks per quarter note, or
+// a number of ticks per SMPTE frame if its high bit is set.
+func (m *midi) duration(division uint16) (float64, bool) {
+	if division == 0 {
+		return 0, false
+	}
+	if division&0x8000 != 0 {
+		fps := -int(int8(division >> 8))
+		ticksPerFrame := int(division & 0xff)
+		if fps <= 0 || ticksPerFrame == 0 {
+			return 0, false
+		}
+		// 29 means 29.97 drop-frame.
+		rate := float64(fps)
+		if fps == 29 {
+			rate = 29.97
+		}
+		return float64(m.end) / (rate * float64(ticksPerFrame)), true
+	}
+
+	// Add up the time between tempo changes.
+	sort.SliceStable(m.tempos, func(i, j int) bool {
+		return m.tempos[i].tick < m.tempos[j].tick
+	})
+	var (
+		micros float64
+		tick   int64
+		tempo  int64 = midiDefaultTempo
+	)
+	for _, t := range m.tempos {
+		if t.tick > m.end {
+			break
+		}
+		micros += float64(t.tick-tick) * float64(tempo) / float64(division)
+		tick, tempo = t.tick, t.tempo
+	}
+	micros += float64(m.end-tick) * float64(tempo) / float64(division)
+
+	return micros / 1e6, true
+}
+
+// readMIDIData reads data that is preceded by its length.
+func readMIDIData(b []byte) (data, rest []byte, err error) {
+	length, b, err := readVLQ(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if length > int64(len(b)) {
+		return nil, nil, fmt.Errorf("truncated MIDI event")
+	}
+	return b[:length], b[length:], nil
+}
+
+// readVLQ reads a variable-length quantity, which has 7 bits per byte
+// and the high bit set on all bytes but the last. It is at most 4 bytes.
+func readVLQ(b []byte) (int64, []byte, error) {
+	var n int64
+
+	for i := 0; i < 4; i++ {
+		if i >= len(b) {
+			return 0, nil, fmt.Errorf("truncated variable-length quantity")
+		}
+		n = n<<7 | int64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return n, b[i+1:], nil
+		}
+	}
+	return 0, nil, fmt.Errorf("variable-length quantity is too long")
+}
@@ -0,0 +1,85 @@
+package sndtag
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewMIDI(t *testing.T) {
+	song, err := os.ReadFile(filepath.Join("testdata", "midi", "song.mid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	smpte, err := os.ReadFile(filepath.Join("testdata", "midi", "smpte.mid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first event of the second track, a track name, starts at 8 bytes
+	// into its chunk.
+	second := bytes.LastIndex(song, []byte("MTrk")) + 8
+
+	for _, tc := range []struct {
+		name string
+		file []byte
+		want map[string]string
+		err  bool
+	}{
+		{
+			name: "tempo map",
+			file: song,
+			want: map[string]string{
+				KeyMIDIFormat: "1", KeyMIDITracks: "2", KeyMIDIDivision: "96",
+				KeyTitle: "Song", KeyTrackName(1): "Song", KeyTrackName(2): "Piano",
+				KeyCopyright: "(c) 2020 Someone", KeyTexts: "2",
+				KeyText(1): "first text", KeyText(2): "second text",
+				// 192 ticks at 120 BPM and 192 ticks at 240 BPM.
+				KeyDuration: "1.500",
+			},
+		},
+		{
+			name: "SMPTE division",
+			file: smpte,
+			want: map[string]string{KeyMIDIFormat: "0", KeyMIDITracks: "1", KeyTitle: "Timecode", KeyDuration: "2.000"},
+		},
+		{
+			name: "truncated track",
+			file: song[:len(song)-10],
+			err:  true,
+		},
+		{
+			name: "data byte without status",
+			file: append(append(append([]byte(nil), song[:second]...), 0, 0x3c), song[second+2:]...),
+			err:  true,
+		},
+		{
+			name: "short MThd chunk",
+			file: append([]byte("MThd\x00\x00\x00\x02\x00\x01"), song[14:]...),
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, read := range map[string]func() (map[string]string, error){
+				"New":          func() (map[string]string, error) { return New(bytes.NewReader(tc.file)) },
+				"NewFromBytes": func() (map[string]string, error) { return NewFromBytes(tc.file) },
+			} {
+				metadata, err := read()
+				if tc.err {
+					if err == nil {
+						t.Errorf("%s: got no error", name)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				for key, want := range tc.want {
+					if got := metadata[key]; got != want {
+						t.Errorf("%s: %s: got %q, want %q", name, key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Monkey's Audio format flags.
+const (
+	apeFormatFlag8Bit  = 1 << 0
+	apeFormatFlag24Bit = 1 << 3
+)
+
+// monkeysAudioHeaderSize is the number of bytes that are read to find
+// the header, which follows a 52-byte descriptor in newer files.
+const monkeysAudioHeaderSize = 128
+
+// isMonkeysAudio reports whether b starts with the signature
+// of a Monkey's Audio file.
+func isMonkeysAudio(b []byte) bool {
+	return len(b) >= 4 && string(b[:4]) == "MAC "
+}
+
+// newMonkeysAudio creates a new map that contains properties for Monkey's
+// Audio files. header holds the bytes that have already been read. If r is
+// an io.ReadSeeker the APEv2 tag at the end of the file is read too.
+func newMonkeysAudio(r io.Reader, header []byte, o options) (map[string]string, error) {
+	b := make([]byte, monkeysAudioHeaderSize)
+	n := copy(b, header)
+
+	m, err := io.ReadFull(r, b[n:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	metadata, err := monkeysAudioMetadata(b[:n+m])
+	if err != nil {
+		return nil, err
+	}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if err := readAPEv2(rs, metadata, o); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// newMonkeysAudioBytes creates a new map that contains properties for a
+// Monkey's Audio file that is entirely in memory, including its APEv2 tag.
+func newMonkeysAudioBytes(b []byte, o options) (map[string]string, error) {
+	metadata, err := monkeysAudioMetadata(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseAPEv2(b, metadata, o); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// monkeysAudioMetadata reads the header at the start of a Monkey's Audio file.
+// Files written by version 3.98 and later have a descriptor followed by the
+// header, older files only have a header with a different layout.
+func monkeysAudioMetadata(b []byte) (map[string]string, error) {
+	if len(b) < 6 {
+		return nil, fmt.Errorf("truncated Monkey's Audio header")
+	}
+	version := binary.LittleEndian.Uint16(b[4:6])
+
+	var (
+		compression, flags, channels, bits uint16
+		sampleRate, frames, finalBlocks    uint32
+		blocksPerFrame                     uint32
+	)
+	if version >= 3980 {
+		if len(b) < 12 {
+			return nil, fmt.Errorf("truncated Monkey's Audio descriptor")
+		}
+		offset := int64(binary.LittleEndian.Uint32(b[8:12]))
+		if offset+24 > int64(len(b)) {
+			return nil, fmt.Errorf("truncated Monkey's Audio header")
+		}
+		h := b[offset : offset+24]
+
+		compression = binary.LittleEndian.Uint16(h[0:2])
+		flags = binary.LittleEndian.Uint16(h[2:4])
+		blocksPerFrame = binary.LittleEndian.Uint32(h[4:8])
+		finalBlocks = binary.LittleEndian.Uint32(h[8:12])
+		frames = binary.LittleEndian.Uint32(h[12:16])
+		bits = binary.LittleEndian.Uint16(h[16:18])
+		channels = binary.LittleEndian.Uint16(h[18:20])
+		sampleRate = binary.LittleEndian.Uint32(h[20:24])
+	} else {
+		if len(b) < 32 {
+			return nil, fmt.Errorf("truncated Monkey's Audio header")
+		}
+		compression = binary.LittleEndian.Uint16(b[6:8])
+		flags = binary.LittleEndian.Uint16(b[8:10])
+		channels = binary.LittleEndian.Uint16(b[10:12])
+		sampleRate = binary.LittleEndian.Uint32(b[12:16])
+		frames = binary.LittleEndian.Uint32(b[24:28])
+		finalBlocks = binary.LittleEndian.Uint32(b[28:32])
+
+		// Old headers imply the bit depth and the frame size.
+		switch {
+		case flags&apeFormatFlag8Bit != 0:
+			bits = 8
+		case flags&apeFormatFlag24Bit != 0:
+			bits = 24
+		default:
+			bits = 16
+		}
+		switch {
+		case version >= 3950:
+			blocksPerFrame = 73728 * 4
+		case version >= 3900 || (version >= 3800 && compression == 4000):
+			blocksPerFrame = 73728
+		default:
+			blocksPerFrame = 9216
+		}
+	}
+
+	metadata := map[string]string{
+		KeyFormat:           "Monkey's Audio",
+		KeyStreamVersion:    fmt.Sprintf("%d.%02d", version/1000, version%1000/10),
+		KeyCompressionLevel: strconv.Itoa(int(compression)),
+		KeySampleRate:       strconv.FormatUint(uint64(sampleRate), 10),
+		KeyNumChannels:      strconv.Itoa(int(channels)),
+		KeyBitRate:          strconv.Itoa(int(bits)),
+		KeyFrameCount:       strconv.FormatUint(uint64(frames), 10),
+	}
+	if frames > 0 {
+		samples := uint64(frames-1)*uint64(blocksPerFrame) + uint64(finalBlocks)
+		metadata[KeySampleCount] = strconv.FormatUint(samples, 10)
+	}
+	return metadata, nil
+}
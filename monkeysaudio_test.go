@@ -0,0 +1,86 @@
+package sndtag
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewMonkeysAudio(t *testing.T) {
+	newer, err := os.ReadFile(filepath.Join("testdata", "monkeysaudio", "new.ape"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	older, err := os.ReadFile(filepath.Join("testdata", "monkeysaudio", "old.ape"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		file []byte
+		want map[string]string
+		err  bool
+	}{
+		{
+			name: "descriptor",
+			file: newer,
+			want: map[string]string{
+				KeyFormat: "Monkey's Audio", KeyStreamVersion: "3.99", KeyCompressionLevel: "2000",
+				KeySampleRate: "44100", KeyNumChannels: "2", KeyBitRate: "16",
+				// Two full frames of 294912 blocks and a final frame of 1000.
+				KeyFrameCount: "3", KeySampleCount: "590824",
+				KeyTitle: "New", KeyArtist: "Artist",
+			},
+		},
+		{
+			name: "old header",
+			file: older,
+			want: map[string]string{
+				KeyFormat: "Monkey's Audio", KeyStreamVersion: "3.93", KeyCompressionLevel: "3000",
+				KeySampleRate: "22050", KeyNumChannels: "1", KeyBitRate: "24",
+				KeyFrameCount: "2", KeySampleCount: "74228",
+				KeyTitle: "Old", KeyGenre: "Ambient",
+			},
+		},
+		{
+			name: "header past the descriptor",
+			file: append(append([]byte(nil), newer[:8]...), append([]byte{0, 0, 1, 0}, newer[12:]...)...),
+			err:  true,
+		},
+		{
+			name: "truncated descriptor",
+			file: newer[:10],
+			err:  true,
+		},
+		{
+			name: "truncated old header",
+			file: older[:20],
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, read := range map[string]func() (map[string]string, error){
+				"New":          func() (map[string]string, error) { return New(bytes.NewReader(tc.file)) },
+				"NewFromBytes": func() (map[string]string, error) { return NewFromBytes(tc.file) },
+			} {
+				metadata, err := read()
+				if tc.err {
+					if err == nil {
+						t.Errorf("%s: got no error", name)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				for key, want := range tc.want {
+					if got := metadata[key]; got != want {
+						t.Errorf("%s: %s: got %q, want %q", name, key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,543 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// mp4 parses iTunes-style metadata from MP4 files (m4a, m4b, m4v, mp4).
+// See https://developer.apple.com/documentation/quicktime-file-format for more info.
+type mp4 struct {
+	r        *countingReader
+	metadata map[string]string
+	opts     options
+
+	// file is the whole file when it is entirely in memory,
+	// which offsets are relative to.
+	file []byte
+
+	// artworks holds the pictures of the covr atom.
+	artworks *[]artwork
+}
+
+// mp4Atoms maps ilst item atoms to property names.
+var mp4Atoms = map[string]string{
+	MP4AtomTitle:           KeyTitle,
+	MP4AtomArtist:          KeyArtist,
+	MP4AtomAlbum:           KeyAlbum,
+	MP4AtomAlbumArtist:     KeyAlbumArtist,
+	MP4AtomYear:            KeyYear,
+	MP4AtomGenre:           KeyGenre,
+	MP4AtomComment:         KeyComment,
+	MP4AtomTrack:           KeyTrack,
+	MP4AtomTVShow:          KeyTVShow,
+	MP4AtomTVEpisodeID:     KeyTVEpisodeID,
+	MP4AtomTVEpisode:       KeyTVEpisode,
+	MP4AtomTVSeason:        KeyTVSeason,
+	MP4AtomTVNetwork:       KeyTVNetwork,
+	MP4AtomMediaKind:       KeyMediaKind,
+	MP4AtomAdvisory:        KeyAdvisory,
+	MP4AtomGapless:         KeyGapless,
+	MP4AtomGrouping:        KeyGrouping,
+	MP4AtomWork:            KeyWork,
+	MP4AtomMovementName:    KeyMovementName,
+	MP4AtomMovementNumber:  KeyMovementNumber,
+	MP4AtomMovementCount:   KeyMovementCount,
+	MP4AtomOwner:           KeyOwner,
+	MP4AtomPurchaseAccount: KeyPurchaseAccount,
+	MP4AtomPurchaseDate:    KeyPurchaseDate,
+}
+
+// mp4MediaKinds maps values of the stik atom to names.
+var mp4MediaKinds = map[int64]string{
+	0:  "Movie",
+	1:  "Music",
+	2:  "Audiobook",
+	6:  "Music Video",
+	9:  "Movie",
+	10: "TV Show",
+	11: "Booklet",
+	14: "Ringtone",
+	21: "Podcast",
+	23: "iTunes U",
+}
+
+// mp4Advisories maps values of the rtng atom to names.
+var mp4Advisories = map[int64]string{
+	0: "None",
+	1: "Explicit",
+	2: "Clean",
+	4: "Explicit",
+}
+
+// valueName returns the key of the name of a value of a property
+// that has named values, like KeyMediaKind, and the name.
+func valueName(prop string, n int64) (string, string, bool) {
+	var (
+		key   string
+		names map[int64]string
+	)
+	switch prop {
+	case KeyMediaKind:
+		key, names = KeyMediaKindName, mp4MediaKinds
+	case KeyAdvisory:
+		key, names = KeyAdvisoryName, mp4Advisories
+	}
+	name, ok := names[n]
+	return key, name, ok
+}
+
+// mp4ImageTypes maps the image types of the data atom to MIME types.
+var mp4ImageTypes = map[uint32]string{
+	13: "image/jpeg",
+	14: "image/png",
+	27: "image/bmp",
+}
+
+// Well-known types of the data atom.
+const (
+	mp4DataImplicit = 0
+	mp4DataUTF8     = 1
+	mp4DataInt      = 21
+	mp4DataUint     = 22
+)
+
+// newMP4 creates a new map that contains properties from an MP4 file.
+// Note that the size and type of the ftyp atom have already been read
+// by the time this function is called, and are passed in as header.
+func newMP4(r io.Reader, header []byte, o options) (map[string]string, error) {
+	m := mp4{
+		r:        &countingReader{r: r, n: int64(len(header))},
+		metadata: map[string]string{},
+		opts:     o,
+		artworks: &[]artwork{},
+	}
+	size := int64(binary.BigEndian.Uint32(header)) - int64(len(header))
+	if size < 4 {
+		return nil, fmt.Errorf("invalid ftyp atom size %d", size+int64(len(header)))
+	}
+
+	// Read the major brand, which tells mp4 audio and video files apart.
+	brand, err := readFourCC(m.r)
+	if err != nil {
+		return nil, err
+	}
+	m.metadata[KeyBrand] = strings.TrimSpace(string(brand))
+
+	if _, err := io.CopyN(ioutil.Discard, m.r, size-4); err != nil {
+		return nil, err
+	}
+
+	// Read the top-level atoms.
+	if err := m.readAtoms(m.r, 0); err != nil && err != io.EOF && err != errDone && err != errPayload {
+		return nil, err
+	}
+	setArtworks(m.metadata, *m.artworks)
+
+	return m.metadata, nil
+}
+
+// readAtoms reads atoms from an io.Reader until it is exhausted,
+// descending into the ones that lead to the ilst atom.
+// The atoms are at the given depth in the file.
+func (m mp4) readAtoms(r io.Reader, depth int) error {
+	for {
+		typ, data, err := readAtom(r)
+		if err != nil {
+			return err
+		}
+		m.opts.countChunk()
+
+		switch typ {
+		case "moov", "udta", "trak", "mdia":
+			if err = m.opts.checkDepth(typ, depth); err == nil {
+				err = m.readAtoms(data, depth+1)
+			}
+		case "mdhd":
+			var b []byte
+			if b, err = ioutil.ReadAll(io.LimitReader(data, 64)); err == nil {
+				m.readMediaHeader(b)
+			}
+		case "meta":
+			if err = m.opts.checkDepth(typ, depth); err != nil {
+				break
+			}
+			// The meta atom has a version and flags before its children.
+			if _, err = io.CopyN(ioutil.Discard, data, 4); err == nil {
+				err = m.readAtoms(data, depth+1)
+			}
+		case "ilst":
+			err = m.readItems(data)
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		// Skip the media data, see WithProbeOnly.
+		if c, ok := r.(*countingReader); ok && typ == "mdat" {
+			n := int64(-1)
+			if lr, ok := data.(*io.LimitedReader); ok {
+				n = lr.N
+			}
+			if _, err := m.opts.skipPayload(c, n); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Discard whatever is left of the atom.
+		if _, err := io.Copy(ioutil.Discard, data); err != nil {
+			return err
+		}
+	}
+}
+
+// macLanguages maps the Macintosh language codes of QuickTime files to
+// BCP 47 tags.
+var macLanguages = map[uint16]string{
+	0: "en", 1: "fr", 2: "de", 3: "it", 4: "nl", 5: "sv", 6: "es", 7: "da",
+	8: "pt", 9: "no", 10: "he", 11: "ja", 12: "ar", 13: "fi", 14: "el",
+	15: "is", 16: "mt", 17: "tr", 18: "hr", 19: "zh-Hant", 20: "ur", 21: "hi",
+	22: "th", 23: "ko", 24: "lt", 25: "pl", 26: "hu", 27: "et", 28: "lv",
+	30: "fo", 31: "fa", 32: "ru", 33: "zh-Hans",
+}
+
+// readMediaHeader reads the language of the first track from the data of
+// an mdhd atom. The language is an ISO 639-2/T code packed into 15 bits.
+func (m mp4) readMediaHeader(b []byte) {
+	if _, ok := m.metadata[KeyLanguage]; ok || !m.opts.wants(KeyLanguage) || len(b) < 4 {
+		return
+	}
+	// Version 1 headers have 64-bit times and durations.
+	offset := 20
+	if b[0] == 1 {
+		offset = 32
+	}
+	if len(b) < offset+2 {
+		return
+	}
+	packed := binary.BigEndian.Uint16(b[offset:])
+	if packed < 0x400 {
+		// QuickTime files can have Macintosh language codes instead.
+		lang, ok := macLanguages[packed]
+		if !ok {
+			lang = LanguageUndetermined
+		}
+		m.metadata[KeyLanguage] = lang
+		return
+	}
+	code := []byte{
+		byte(packed>>10&0x1f) + 0x60,
+		byte(packed>>5&0x1f) + 0x60,
+		byte(packed&0x1f) + 0x60,
+	}
+	m.metadata[KeyLanguage] = LanguageTag(string(code))
+}
+
+// readItems reads the item atoms of an ilst atom.
+func (m mp4) readItems(r io.Reader) error {
+	for {
+		offset := m.r.n
+		typ, item, err := readAtom(r)
+		if err != nil {
+			return err
+		}
+		m.opts.countChunk()
+		if typ == MP4AtomCover && m.wantsCover() {
+			if err := m.readCover(item); err != nil {
+				return err
+			}
+		}
+		if prop, ok := mp4Atoms[typ]; ok && m.opts.wants(prop) {
+			b, err := ioutil.ReadAll(item)
+			if err != nil {
+				return err
+			}
+			source := Source{Tag: TagMP4, ID: typ, Offset: offset}
+			if err := m.readItem(b, prop, source); err != nil {
+				return err
+			}
+			if m.opts.done(m.metadata) {
+				return errDone
+			}
+		}
+		if _, err := io.Copy(ioutil.Discard, item); err != nil {
+			return err
+		}
+	}
+}
+
+// newMP4Bytes creates a new map that contains properties from an MP4 file
+// that is entirely in memory. It indexes into the byte slice instead of
+// copying the atom data, so the media data is never touched.
+func newMP4Bytes(b []byte, o options) (map[string]string, error) {
+	m := mp4{
+		metadata: map[string]string{},
+		opts:     o,
+		file:     b,
+		artworks: &[]artwork{},
+	}
+	if len(b) < 12 || string(b[4:8]) != "ftyp" {
+		return nil, fmt.Errorf("expected ftyp atom")
+	}
+
+	// Read the major brand, which tells mp4 audio and video files apart.
+	m.metadata[KeyBrand] = strings.TrimSpace(string(b[8:12]))
+
+	if err := m.parseAtoms(b, 0); err != nil && err != errDone {
+		return nil, err
+	}
+	setArtworks(m.metadata, *m.artworks)
+
+	return m.metadata, nil
+}
+
+// parseAtoms reads the atoms in a byte slice,
+// descending into the ones that lead to the ilst atom.
+// The atoms are at the given depth in the file.
+func (m mp4) parseAtoms(b []byte, depth int) error {
+	for len(b) > 0 {
+		typ, data, rest, err := nextAtom(b)
+		if err != nil {
+			return err
+		}
+		m.opts.countChunk()
+		b = rest
+
+		switch typ {
+		case "moov", "udta", "trak", "mdia":
+			if err = m.opts.checkDepth(typ, depth); err == nil {
+				err = m.parseAtoms(data, depth+1)
+			}
+		case "mdhd":
+			m.readMediaHeader(data)
+		case "meta":
+			if err = m.opts.checkDepth(typ, depth); err != nil {
+				break
+			}
+			// The meta atom has a version and flags before its children.
+			if len(data) >= 4 {
+				err = m.parseAtoms(data[4:], depth+1)
+			}
+		case "ilst":
+			err = m.parseItems(data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseItems reads the item atoms of an ilst atom in a byte slice.
+func (m mp4) parseItems(b []byte) error {
+	for len(b) > 0 {
+		typ, item, rest, err := nextAtom(b)
+		if err != nil {
+			return err
+		}
+		m.opts.countChunk()
+		source := Source{Tag: TagMP4, ID: typ, Offset: sliceOffset(m.file, b)}
+		b = rest
+
+		if typ == MP4AtomCover && m.wantsCover() {
+			if err := m.readCover(bytes.NewReader(item)); err != nil {
+				return err
+			}
+		}
+		if prop, ok := mp4Atoms[typ]; ok && m.opts.wants(prop) {
+			if err := m.readItem(item, prop, source); err != nil {
+				return err
+			}
+			if m.opts.done(m.metadata) {
+				return errDone
+			}
+		}
+	}
+	return nil
+}
+
+// wantsCover reports whether the covr atom should be read.
+func (m mp4) wantsCover() bool {
+	return m.opts.wants("Artwork") || m.opts.artwork != nil
+}
+
+// readCover reads the pictures of a covr atom, which has a data atom
+// for each picture. Only the start of each picture is held in memory.
+// The first picture is copied to the artwork writer.
+func (m mp4) readCover(r io.Reader) error {
+	for {
+		typ, data, err := readAtom(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if typ != "data" {
+			return fmt.Errorf("expected data atom, got %s", typ)
+		}
+
+		// The data atom starts with a version, a type and a locale.
+		var header struct {
+			Type   uint32
+			Locale uint32
+		}
+		if err := binary.Read(data, binary.BigEndian, &header); err != nil {
+			return err
+		}
+		var w io.Writer
+		if len(*m.artworks) == 0 {
+			w = m.opts.artwork
+		}
+		a, err := readArtwork(data, w)
+		if err != nil {
+			return err
+		}
+		if a.MIMEType == "" {
+			a.MIMEType = mp4ImageTypes[header.Type&0xffffff]
+		}
+		a.PictureType = pictureTypeFrontCover
+		*m.artworks = append(*m.artworks, a)
+	}
+}
+
+// readItem reads the data atom of an item and stores its value as a property.
+// source tells where the item is.
+func (m mp4) readItem(item []byte, prop string, source Source) error {
+	typ, data, _, err := nextAtom(item)
+	if err != nil {
+		return err
+	}
+	if typ != "data" {
+		return fmt.Errorf("expected data atom, got %s", typ)
+	}
+
+	// The data atom starts with a version, a type and a locale.
+	if len(data) < 8 {
+		return fmt.Errorf("truncated data atom")
+	}
+	var (
+		dataType = binary.BigEndian.Uint32(data[0:4])
+		value    = data[8:]
+	)
+
+	switch dataType & 0xffffff {
+	case mp4DataImplicit:
+		// The track number is stored as reserved(2), number(2), total(2).
+		if prop == KeyTrack && len(value) >= 6 {
+			m.metadata[prop] = strconv.Itoa(int(binary.BigEndian.Uint16(value[2:])))
+			m.opts.setSource(prop, source)
+			return nil
+		}
+		fallthrough
+	case mp4DataInt, mp4DataUint:
+		n, ok := decodeMP4Int(value, dataType&0xffffff == mp4DataInt)
+		if !ok {
+			return nil
+		}
+		m.metadata[prop] = strconv.FormatInt(n, 10)
+		m.opts.setSource(prop, source)
+
+		if key, name, ok := valueName(prop, n); ok {
+			m.metadata[key] = name
+			m.opts.setSource(key, source)
+		}
+	case mp4DataUTF8:
+		m.metadata[prop] = string(value)
+		m.opts.setSource(prop, source)
+	}
+	return nil
+}
+
+// decodeMP4Int decodes a big-endian integer of 1, 2, 4 or 8 bytes.
+func decodeMP4Int(b []byte, signed bool) (int64, bool) {
+	switch len(b) {
+	case 1:
+		if signed {
+			return int64(int8(b[0])), true
+		}
+		return int64(b[0]), true
+	case 2:
+		if signed {
+			return int64(int16(binary.BigEndian.Uint16(b))), true
+		}
+		return int64(binary.BigEndian.Uint16(b)), true
+	case 4:
+		if signed {
+			return int64(int32(binary.BigEndian.Uint32(b))), true
+		}
+		return int64(binary.BigEndian.Uint32(b)), true
+	case 8:
+		return int64(binary.BigEndian.Uint64(b)), true
+	}
+	return 0, false
+}
+
+// readAtom reads an atom header from an io.Reader and returns the
+// atom type and a reader for the atom data.
+// An atom with a size of 0 extends to the end of the stream.
+func readAtom(r io.Reader) (typ string, data io.Reader, err error) {
+	var size uint32
+	if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+		return
+	}
+	typb, err := readFourCC(r)
+	if err != nil {
+		return
+	}
+	typ = string(typb)
+
+	switch size {
+	case 0:
+		return typ, r, nil
+	case 1:
+		// 64-bit extended size.
+		var largeSize uint64
+		if err = binary.Read(r, binary.BigEndian, &largeSize); err != nil {
+			return
+		}
+		if largeSize < 16 {
+			return "", nil, fmt.Errorf("invalid %s atom size %d", typ, largeSize)
+		}
+		return typ, io.LimitReader(r, int64(largeSize-16)), nil
+	}
+	if size < 8 {
+		return "", nil, fmt.Errorf("invalid %s atom size %d", typ, size)
+	}
+	return typ, io.LimitReader(r, int64(size-8)), nil
+}
+
+// nextAtom returns the atom at the start of a byte slice,
+// along with the bytes that follow it.
+// An atom with a size of 0 extends to the end of the byte slice.
+func nextAtom(b []byte) (typ string, data, rest []byte, err error) {
+	if len(b) < 8 {
+		return "", nil, nil, fmt.Errorf("truncated atom header")
+	}
+	var (
+		size       = uint64(binary.BigEndian.Uint32(b[0:4]))
+		headerSize = uint64(8)
+	)
+	typ = string(b[4:8])
+
+	switch size {
+	case 0:
+		size = uint64(len(b))
+	case 1:
+		// 64-bit extended size.
+		if len(b) < 16 {
+			return "", nil, nil, fmt.Errorf("truncated %s atom header", typ)
+		}
+		size, headerSize = binary.BigEndian.Uint64(b[8:16]), 16
+	}
+	if size < headerSize || size > uint64(len(b)) {
+		return "", nil, nil, fmt.Errorf("invalid %s atom size %d", typ, size)
+	}
+	return typ, b[headerSize:size], b[size:], nil
+}
@@ -0,0 +1,186 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// musepackSampleRates are the sample rates of Musepack streams,
+// indexed by the sample frequency field of the stream header.
+var musepackSampleRates = [4]int{44100, 48000, 37800, 32000}
+
+// musepackFrameSamples is the number of samples per channel in a frame.
+const musepackFrameSamples = 1152
+
+// musepackHeaderSize is the number of bytes that are read to find
+// the stream header. SV8 stream header packets are small.
+const musepackHeaderSize = 64
+
+// isMusepack reports whether b starts with the signature of a
+// Musepack SV7 or SV8 stream.
+func isMusepack(b []byte) bool {
+	return len(b) >= 4 && (string(b[:3]) == "MP+" || string(b[:4]) == "MPCK")
+}
+
+// newMusepack creates a new map that contains properties for Musepack files.
+// header holds the bytes that have already been read. If r is an
+// io.ReadSeeker the APEv2 tag at the end of the file is read too.
+func newMusepack(r io.Reader, header []byte, o options) (map[string]string, error) {
+	b := make([]byte, musepackHeaderSize)
+	n := copy(b, header)
+
+	m, err := io.ReadFull(r, b[n:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	metadata, err := musepackMetadata(b[:n+m])
+	if err != nil {
+		return nil, err
+	}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if err := readAPEv2(rs, metadata, o); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// newMusepackBytes creates a new map that contains properties for a
+// Musepack file that is entirely in memory, including its APEv2 tag.
+func newMusepackBytes(b []byte, o options) (map[string]string, error) {
+	metadata, err := musepackMetadata(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseAPEv2(b, metadata, o); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// musepackMetadata reads the stream header at the start of a Musepack file.
+func musepackMetadata(b []byte) (map[string]string, error) {
+	metadata := map[string]string{
+		KeyFormat: "Musepack",
+	}
+	var err error
+
+	if string(b[:3]) == "MP+" {
+		err = readMusepackSV7(b, metadata)
+	} else {
+		err = readMusepackSV8(b[4:], metadata)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// readMusepackSV7 reads an SV7 stream header, which is the signature and
+// version, the number of frames and flags that hold the sample rate.
+// SV7 streams are always stereo.
+func readMusepackSV7(b []byte, metadata map[string]string) error {
+	if len(b) < 12 {
+		return fmt.Errorf("truncated Musepack SV7 header")
+	}
+	if version := b[3] & 0x0f; version != 7 {
+		return fmt.Errorf("unsupported Musepack stream version %d", version)
+	}
+	var (
+		frames = binary.LittleEndian.Uint32(b[4:8])
+		flags  = binary.LittleEndian.Uint32(b[8:12])
+	)
+	metadata[KeyStreamVersion] = "7"
+	metadata[KeyFrameCount] = strconv.FormatUint(uint64(frames), 10)
+	metadata[KeySampleRate] = strconv.Itoa(musepackSampleRates[flags>>16&3])
+	metadata[KeyNumChannels] = "2"
+	return nil
+}
+
+// readMusepackSV8 reads the SH packet of an SV8 stream. Packets have a
+// 2-byte key and a variable-length size that includes the key and size.
+func readMusepackSV8(b []byte, metadata map[string]string) error {
+	for len(b) >= 3 {
+		key := string(b[:2])
+		size, n, err := readMusepackVLQ(b[2:])
+		if err != nil {
+			return err
+		}
+		if size < uint64(2+n) {
+			return fmt.Errorf("invalid Musepack %s packet size %d", key, size)
+		}
+		if key != "SH" {
+			if size > uint64(len(b)) {
+				break
+			}
+			b = b[size:]
+			continue
+		}
+		end := size
+		if end > uint64(len(b)) {
+			end = uint64(len(b))
+		}
+		return readMusepackStreamHeader(b[2+n:end], metadata)
+	}
+	return fmt.Errorf("no stream header in Musepack SV8 file")
+}
+
+// readMusepackStreamHeader reads the payload of an SH packet: a CRC,
+// the stream version, the number of samples, the number of samples of
+// silence at the start, and two bytes that hold the sample rate and
+// the number of channels.
+func readMusepackStreamHeader(b []byte, metadata map[string]string) error {
+	if len(b) < 5 {
+		return fmt.Errorf("truncated Musepack SH packet")
+	}
+	version := b[4]
+	b = b[5:]
+
+	samples, n, err := readMusepackVLQ(b)
+	if err != nil {
+		return err
+	}
+	b = b[n:]
+
+	_, n, err = readMusepackVLQ(b)
+	if err != nil {
+		return err
+	}
+	b = b[n:]
+
+	if len(b) < 2 {
+		return fmt.Errorf("truncated Musepack SH packet")
+	}
+	rate := int(b[0] >> 5)
+	if rate >= len(musepackSampleRates) {
+		return fmt.Errorf("invalid Musepack sample frequency %d", rate)
+	}
+	frames := (samples + musepackFrameSamples - 1) / musepackFrameSamples
+
+	metadata[KeyStreamVersion] = strconv.Itoa(int(version))
+	metadata[KeySampleCount] = strconv.FormatUint(samples, 10)
+	metadata[KeyFrameCount] = strconv.FormatUint(frames, 10)
+	metadata[KeySampleRate] = strconv.Itoa(musepackSampleRates[rate])
+	metadata[KeyNumChannels] = strconv.Itoa(int(b[1]>>4) + 1)
+	return nil
+}
+
+// readMusepackVLQ reads a big-endian variable-length quantity, which has
+// 7 bits per byte and the high bit set on all bytes but the last.
+// It also returns the number of bytes that were read.
+func readMusepackVLQ(b []byte) (uint64, int, error) {
+	var n uint64
+
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0, fmt.Errorf("truncated Musepack size")
+		}
+		n = n<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return n, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("variable-length size is too long")
+}
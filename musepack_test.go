@@ -0,0 +1,91 @@
+package sndtag
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewMusepack(t *testing.T) {
+	sv7, err := os.ReadFile(filepath.Join("testdata", "musepack", "sv7.mpc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv8, err := os.ReadFile(filepath.Join("testdata", "musepack", "sv8.mpc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The SH packet follows the signature and a 12-byte RG packet, and its
+	// sample frequency byte is 12 bytes into the packet.
+	const rate = 4 + 12 + 12
+
+	for _, tc := range []struct {
+		name string
+		file []byte
+		want map[string]string
+		err  bool
+	}{
+		{
+			name: "SV7",
+			file: sv7,
+			want: map[string]string{
+				KeyFormat: "Musepack", KeyStreamVersion: "7", KeyFrameCount: "1000",
+				KeySampleRate: "48000", KeyNumChannels: "2",
+				KeyTitle: "Seven", KeyArtist: "Artist", KeyTrack: "2", KeyYear: "2004",
+			},
+		},
+		{
+			name: "SV8",
+			file: sv8,
+			want: map[string]string{
+				KeyFormat: "Musepack", KeyStreamVersion: "8", KeySampleCount: "132300",
+				KeyFrameCount: "115", KeySampleRate: "44100", KeyNumChannels: "1",
+				KeyTitle: "Eight", KeyAlbum: "Album", KeyComment: "Comment",
+			},
+		},
+		{
+			name: "SV7 with another stream version",
+			file: append([]byte("MP+\x16"), sv7[4:]...),
+			err:  true,
+		},
+		{
+			name: "truncated SH packet",
+			file: sv8[:rate-3],
+			err:  true,
+		},
+		{
+			name: "invalid sample frequency",
+			file: append(append(append([]byte(nil), sv8[:rate]...), 5<<5), sv8[rate+1:]...),
+			err:  true,
+		},
+		{
+			name: "no SH packet",
+			file: []byte("MPCKSE\x03"),
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, read := range map[string]func() (map[string]string, error){
+				"New":          func() (map[string]string, error) { return New(bytes.NewReader(tc.file)) },
+				"NewFromBytes": func() (map[string]string, error) { return NewFromBytes(tc.file) },
+			} {
+				metadata, err := read()
+				if tc.err {
+					if err == nil {
+						t.Errorf("%s: got no error", name)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				for key, want := range tc.want {
+					if got := metadata[key]; got != want {
+						t.Errorf("%s: %s: got %q, want %q", name, key, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package sndtag
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/briansorahan/sndtag/riff"
+	"github.com/briansorahan/sndtag/vorbiscomment"
+)
+
+// vorbisCommentFields maps property names to the fields of Vorbis comments.
+var vorbisCommentFields = map[string]string{
+	KeyAlbum:          "ALBUM",
+	KeyAlbumArtist:    "ALBUMARTIST",
+	KeyArtist:         "ARTIST",
+	KeyBarcode:        "BARCODE",
+	KeyCatalogNumber:  "CATALOGNUMBER",
+	KeyComment:        "COMMENT",
+	KeyDisc:           "DISCNUMBER",
+	KeyGenre:          "GENRE",
+	KeyGrouping:       "GROUPING",
+	KeyLabel:          "LABEL",
+	KeyMedia:          "MEDIA",
+	KeyReleaseCountry: "RELEASECOUNTRY",
+	KeyTitle:          "TITLE",
+	KeyTrack:          "TRACKNUMBER",
+	KeyWork:           "WORK",
+	KeyYear:           "DATE",
+}
+
+// vorbisVendor is the vendor string of the Vorbis comments NewTag writes.
+const vorbisVendor = "sndtag"
+
+// flacBlockVorbisComment is the type of a FLAC VORBIS_COMMENT metadata block.
+const flacBlockVorbisComment = 4
+
+// NewTag returns a tag with the given properties for a file of a format,
+// which encoders can embed in files they create from scratch:
+//
+//   - for FormatMP3, an ID3v2.3 tag with padding, see WithPadding, which
+//     goes at the start of the file
+//   - for FormatWAV, a LIST chunk with an INFO list, which goes after the
+//     fmt chunk, see WithINFOEncoding
+//   - for FormatFLAC, a VORBIS_COMMENT metadata block, which goes after the
+//     STREAMINFO block and needs its last-block flag set if nothing follows
+//
+// Empty values are left out. Properties that can't be written to the tag
+// and other formats are an error.
+func NewTag(format Format, tags TagSet, opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
+
+	switch format {
+	case FormatMP3:
+		t := &id3v2{header: id3v2Header{Major: 3}, metadata: map[string]string{}, opts: o}
+		if err := t.update(tags); err != nil {
+			return nil, err
+		}
+		padding := id3v2DefaultPadding
+		if o.padding != nil {
+			padding = o.padding.padding(len(t.encode(0))-10, -1)
+		}
+		tag := t.encode(padding)
+		if err := validateID3v2(tag); err != nil {
+			return nil, err
+		}
+		return tag, nil
+	case FormatWAV:
+		for prop := range tags {
+			if _, ok := wavInfoProperties[prop]; !ok {
+				return nil, fmt.Errorf("property %s can not be written to a WAV INFO list", prop)
+			}
+		}
+		list := encodeInfo(tags, o.infoEncoding)
+		if list == nil {
+			list = []byte("INFO")
+		}
+		if err := validateChunk("LIST", list); err != nil {
+			return nil, err
+		}
+		return riff.EncodeChunk("LIST", list), nil
+	case FormatFLAC:
+		return encodeVorbisCommentBlock(tags)
+	}
+	return nil, fmt.Errorf("tags can not be created for format %d", format)
+}
+
+// encodeVorbisCommentBlock encodes a FLAC VORBIS_COMMENT metadata block,
+// including its header, with the given properties.
+// The fields are sorted so the output is deterministic.
+func encodeVorbisCommentBlock(tags TagSet) ([]byte, error) {
+	c := vorbiscomment.Comments{Vendor: vorbisVendor}
+	for prop, value := range tags {
+		field, ok := vorbisCommentFields[prop]
+		if !ok {
+			return nil, fmt.Errorf("property %s can not be written to Vorbis comments", prop)
+		}
+		if value != "" {
+			c.Add(field, value)
+		}
+	}
+	sort.Slice(c.Fields, func(i, j int) bool {
+		return c.Fields[i].Name < c.Fields[j].Name
+	})
+
+	// Vorbis comments are little-endian, unlike the FLAC block header.
+	data := c.Encode()
+	if len(data) >= 1<<24 {
+		return nil, fmt.Errorf("Vorbis comments are too large: %d bytes", len(data))
+	}
+	header := []byte{flacBlockVorbisComment, byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}
+	block := append(header, data...)
+	if err := validateFLACBlock(block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
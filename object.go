@@ -0,0 +1,76 @@
+package sndtag
+
+import (
+	"encoding/hex"
+	"strconv"
+)
+
+// An EncapsulatedObject is a file stored in an ID3v2 GEOB frame,
+// e.g. the cue points and beat grids that DJ software stores,
+// or attachments added by podcast tools.
+type EncapsulatedObject struct {
+	MIMEType    string
+	Filename    string
+	Description string
+	Data        []byte
+}
+
+// decodeObject decodes the data of a GEOB frame.
+func decodeObject(data []byte, cs charsets) EncapsulatedObject {
+	if len(data) < 2 {
+		return EncapsulatedObject{}
+	}
+	enc := data[0]
+	mime, rest := splitTerminated(0, data[1:])
+	filename, rest := splitTerminated(enc, rest)
+	desc, object := splitTerminated(enc, rest)
+
+	return EncapsulatedObject{
+		MIMEType:    decodeLatin1(mime),
+		Filename:    decodeText(enc, filename, cs),
+		Description: decodeText(enc, desc, cs),
+		Data:        object,
+	}
+}
+
+// setObjects stores encapsulated objects as properties.
+// Each object is stored as "Object<n>MIMEType", "Object<n>Filename",
+// "Object<n>Description", "Object<n>Size" and "Object<n>Data", which is
+// hex-encoded, counting from 1, and the number of objects is stored as "Objects".
+func setObjects(metadata map[string]string, objects []EncapsulatedObject) {
+	if len(objects) == 0 {
+		return
+	}
+	metadata[KeyObjects] = strconv.Itoa(len(objects))
+
+	for i, obj := range objects {
+		metadata[KeyObjectMIMEType(i+1)] = obj.MIMEType
+		metadata[KeyObjectFilename(i+1)] = obj.Filename
+		metadata[KeyObjectDescription(i+1)] = obj.Description
+		metadata[KeyObjectSize(i+1)] = strconv.Itoa(len(obj.Data))
+		metadata[KeyObjectData(i+1)] = hex.EncodeToString(obj.Data)
+	}
+}
+
+// EncapsulatedObjects returns the objects stored in a metadata map,
+// in the order they appear in the file. Objects are only read when
+// all properties are requested or WithFields includes KeyObjects.
+func EncapsulatedObjects(metadata map[string]string) []EncapsulatedObject {
+	count := listCount(metadata, KeyObjects)
+	if count == 0 {
+		return nil
+	}
+	objects := make([]EncapsulatedObject, 0, count)
+
+	for i := 1; i <= count; i++ {
+		data, _ := hex.DecodeString(metadata[KeyObjectData(i)])
+
+		objects = append(objects, EncapsulatedObject{
+			MIMEType:    metadata[KeyObjectMIMEType(i)],
+			Filename:    metadata[KeyObjectFilename(i)],
+			Description: metadata[KeyObjectDescription(i)],
+			Data:        data,
+		})
+	}
+	return objects
+}
@@ -0,0 +1,227 @@
+package sndtag
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Option configures how metadata is read and written.
+type Option func(*options)
+
+// options holds the configuration set by Options.
+type options struct {
+	artwork         io.Writer
+	fields          map[string]bool
+	infoEncoding    TextEncoding
+	id3Chunk        bool
+	canonicalFrames bool
+	charsets        charsets
+	detectCharset   bool
+	sources         map[string]Source
+	limit           int64
+	ctx             context.Context
+	providers       []Provider
+	mergePolicy     MergePolicy
+	mergeRules      []MergeRule
+	raw             *RawFormat
+	journal         *Journal
+	artistFallback  bool
+	locker          FileLocker
+	partial         bool
+	stats           *ParseStats
+	keyStyle        KeyStyle
+	editLists       bool
+	sidecars        bool
+	lenient         bool
+	editIndex       *editIndex
+	filter          *Filter
+	schemaVersion   bool
+	padding         *PaddingPolicy
+	bextSync        bool
+	maxDepth        int
+	language        string
+	probes          *probeProfile
+	ext             string
+	decoders        []PCMDecoder
+	silence         float64
+	probeOnly       bool
+	device          *DeviceProfile
+	duplicatePolicy DuplicatePolicy
+	duplicates      *[]DuplicateKey
+	ratingScales    []RatingScale
+}
+
+// newOptions applies opts to the default options.
+func newOptions(opts []Option) options {
+	o := options{
+		infoEncoding: Windows1252,
+		locker:       defaultLocker,
+		maxDepth:     defaultMaxDepth,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.detectCharset {
+		o.charsets = append(o.charsets[:len(o.charsets):len(o.charsets)], CharsetDetect)
+	}
+	return o
+}
+
+// errDone is returned by parsers to stop parsing
+// when all the fields set by WithFields have been found.
+var errDone = errors.New("all requested fields were found")
+
+// WithFields tells the parsers to only decode the given properties,
+// and to stop reading as soon as all of them have been found.
+// This makes reading a few properties from a large library much faster,
+// e.g. artwork is never decoded when only the title is requested.
+// The returned map may contain other properties too.
+func WithFields(keys ...string) Option {
+	return func(o *options) {
+		if o.fields == nil {
+			o.fields = map[string]bool{}
+		}
+		for _, key := range keys {
+			o.fields[key] = true
+		}
+	}
+}
+
+// WithArtwork copies the image data of the embedded front cover, or the
+// first picture if there is no front cover, to w while parsing.
+// MP4 cover art is streamed without reading the whole image into memory.
+func WithArtwork(w io.Writer) Option {
+	return func(o *options) {
+		o.artwork = w
+	}
+}
+
+// WithCanonicalFrames tells Write to sort the frames of ID3v2 tags by ID
+// and to use the default amount of padding. By default the original frame
+// order and padding are kept and only the frames that changed are replaced,
+// since some players depend on the frame order.
+func WithCanonicalFrames() Option {
+	return func(o *options) {
+		o.canonicalFrames = true
+	}
+}
+
+// WithCharsets sets the charsets that are tried, in order, to decode text
+// in ID3v1 tags and ID3v2 frames that are declared ISO-8859-1. Many taggers
+// wrote such text in the local code page, e.g.
+//
+//	sndtag.WithCharsets(sndtag.CharsetUTF8, gbk, sndtag.CharsetWindows1251)
+//
+// ASCII text and text that no charset accepts is decoded as ISO-8859-1,
+// which is also the default.
+func WithCharsets(chain ...Charset) Option {
+	return func(o *options) {
+		o.charsets = chain
+	}
+}
+
+// WithCharsetDetection guesses the charset of text in ID3v1 tags and ID3v2
+// frames that are declared ISO-8859-1 but aren't, after trying the charsets
+// set by WithCharsets. For every such property the guess, its confidence
+// and the raw bytes are stored too, e.g. "TitleCharset",
+// "TitleCharsetConfidence" and "TitleRaw". See DetectCharset and RawText.
+func WithCharsetDetection() Option {
+	return func(o *options) {
+		o.detectCharset = true
+	}
+}
+
+// WithSources records in sources where each tag property was read from:
+// the tag system, the ID of the frame, chunk, atom or item, and its offset
+// in the file. This tells debugging tools and editors which underlying
+// structure to act on. Properties of the audio stream aren't recorded.
+func WithSources(sources map[string]Source) Option {
+	return func(o *options) {
+		o.sources = sources
+	}
+}
+
+// WithReadLimit makes New fail with ErrReadLimit when it needs to read more
+// than n bytes, and NewFromBytes fail when the file is larger than n bytes.
+// It bounds the work done for untrusted input.
+func WithReadLimit(n int64) Option {
+	return func(o *options) {
+		o.limit = n
+	}
+}
+
+// WithContext makes New stop reading when ctx is done,
+// in which case the error of the context is returned.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// wants reports whether a property should be decoded.
+// Properties that are stored as a family of keys (e.g. "Cue1ID",
+// "Cue1SampleOffset" and "CuePoints") can be checked with their prefix.
+func (o options) wants(prop string) bool {
+	if len(o.fields) == 0 {
+		return true
+	}
+	for field := range o.fields {
+		if strings.HasPrefix(field, prop) {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsAny reports whether any of the properties should be decoded.
+func (o options) wantsAny(props ...string) bool {
+	for _, prop := range props {
+		if o.wants(prop) {
+			return true
+		}
+	}
+	return false
+}
+
+// done reports whether all the fields set by WithFields have been found.
+func (o options) done(metadata map[string]string) bool {
+	if len(o.fields) == 0 {
+		return false
+	}
+	for field := range o.fields {
+		if _, ok := metadata[field]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// TextEncoding is a character encoding for formats that don't
+// say which encoding their text is in.
+type TextEncoding int
+
+// Text encodings.
+const (
+	Windows1252 TextEncoding = iota
+	UTF8
+)
+
+// WithINFOEncoding sets the encoding of the text written to the INFO list
+// of WAV files. The default is Windows1252, which is what Windows Explorer
+// expects. Characters that can't be encoded in Windows-1252 are replaced with '?'.
+func WithINFOEncoding(enc TextEncoding) Option {
+	return func(o *options) {
+		o.infoEncoding = enc
+	}
+}
+
+// WithID3Chunk makes the WAV writer also write the properties to an
+// "id3 " chunk, which some programs read instead of the INFO list.
+// An existing id3 chunk is always updated.
+func WithID3Chunk() Option {
+	return func(o *options) {
+		o.id3Chunk = true
+	}
+}
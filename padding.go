@@ -0,0 +1,112 @@
+package sndtag
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A PaddingPolicy decides how much padding is written after the frames of
+// an ID3v2 tag. Padding lets a tag grow without moving the audio data, so
+// that repeated small edits keep the tag, and the file, the same size.
+type PaddingPolicy struct {
+	// Target is the padding that is written when a tag is resized,
+	// because the frames don't fit in it or because it has more than
+	// Max bytes of padding, and when a tag is added to a file.
+	Target int
+
+	// Max is the most padding that is kept when the frames shrink.
+	// 0 means there is no maximum.
+	Max int
+
+	// Align rounds the size of a tag that is resized up to a multiple
+	// of Align bytes, so that tags grow in steps. 0 means no rounding.
+	Align int
+}
+
+// DefaultPaddingPolicy keeps the size of tags as long as the frames fit,
+// and otherwise writes 1 KB of padding, rounding tags up to 4 KB.
+var DefaultPaddingPolicy = PaddingPolicy{
+	Target: id3v2DefaultPadding,
+	Align:  4096,
+}
+
+// WithPadding sets the padding policy that Write uses for ID3v2 tags.
+// By default the padding of the existing tag is kept as it is, so the tag
+// grows and shrinks with its frames, and new tags get 1 KB of padding.
+func WithPadding(p PaddingPolicy) Option {
+	return func(o *options) {
+		o.padding = &p
+	}
+}
+
+// padding returns the padding to write after frames of the given size, in
+// a tag whose frames and padding took up room bytes, or -1 for a new tag.
+func (p PaddingPolicy) padding(frames, room int) int {
+	if frames <= room && (p.Max == 0 || room-frames <= p.Max) {
+		return room - frames
+	}
+	padding := p.Target
+	if p.Align > 0 {
+		size := 10 + frames + padding
+		padding += (p.Align - size%p.Align) % p.Align
+	}
+	return padding
+}
+
+// Defragment returns a Repair that merges the ID3v2 tags at the start of a
+// file into one tag, the way Write does, and applies a padding policy to it,
+// consolidating the padding of all the tags in one rewrite. Files with a
+// single tag whose size the policy keeps are left unchanged. Files with
+// ID3v2.2 tags are left alone, see ConvertID3v2.
+//
+// Use it with RepairFile, e.g.
+//
+//	fixes, err := sndtag.RepairFile(path, sndtag.Defragment(sndtag.DefaultPaddingPolicy))
+func Defragment(p PaddingPolicy) Repair {
+	return func(b []byte) ([]byte, []Fix) {
+		if !bytes.HasPrefix(b, []byte("ID3")) {
+			return b, nil
+		}
+		tags, rest, err := parseID3v2Tags(b, 0, options{})
+		if err != nil || len(tags) == 0 {
+			return b, nil
+		}
+		major := uint8(3)
+		for _, tag := range tags {
+			if tag.header.Major == 2 {
+				return b, nil
+			}
+		}
+		if tags[0].header.Major == 4 {
+			major = 4
+		}
+		var (
+			t = &id3v2{
+				header:   id3v2Header{Major: major},
+				frames:   mergeID3v2Frames(tags, major),
+				metadata: map[string]string{},
+			}
+			frames  = len(t.encode(0)) - 10
+			room    = len(b) - len(rest) - 10
+			padding = p.padding(frames, room)
+			fixes   []Fix
+		)
+		if len(tags) == 1 && frames+padding == room {
+			return b, nil
+		}
+		if len(tags) > 1 {
+			fixes = append(fixes, Fix{Description: fmt.Sprintf("merged %d ID3v2 tags", len(tags))})
+		}
+		var total int
+		for _, tag := range tags {
+			total += tag.padding
+		}
+		if total != padding {
+			fixes = append(fixes, Fix{Description: fmt.Sprintf("ID3v2 padding %d changed to %d", total, padding)})
+		}
+		if len(fixes) == 0 {
+			fixes = append(fixes, Fix{Description: "rewrote ID3v2 tag"})
+		}
+		return append(t.encode(padding), rest...), fixes
+	}
+}
@@ -0,0 +1,138 @@
+package sndtag
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testPaddedID3v2 encodes an ID3v2 tag with frames and padding bytes.
+func testPaddedID3v2(major byte, padding int, frames ...[]byte) []byte {
+	var body []byte
+	for _, f := range frames {
+		body = append(body, f...)
+	}
+	body = append(body, make([]byte, padding)...)
+	tag := []byte{'I', 'D', '3', major, 0, 0}
+	tag = append(tag, encodeSynchsafe(int64(len(body)))...)
+	return append(tag, body...)
+}
+
+func TestPaddingPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy PaddingPolicy
+		frames int
+		room   int
+		want   int
+	}{
+		{PaddingPolicy{Target: 100}, 50, 80, 30},
+		{PaddingPolicy{Target: 100}, 50, 40, 100},
+		{PaddingPolicy{Target: 100}, 50, -1, 100},
+		{PaddingPolicy{Target: 100, Max: 20}, 50, 80, 100},
+		{PaddingPolicy{Target: 100, Max: 30}, 50, 80, 30},
+		{PaddingPolicy{Target: 100, Align: 256}, 50, 40, 196},
+		{DefaultPaddingPolicy, 5000, 4000, 4096*2 - 10 - 5000},
+	} {
+		if got := tc.policy.padding(tc.frames, tc.room); got != tc.want {
+			t.Errorf("%+v.padding(%d, %d): got %d, want %d", tc.policy, tc.frames, tc.room, got, tc.want)
+		}
+	}
+}
+
+func TestDefragment(t *testing.T) {
+	var (
+		title  = testTextFrame(ID3v2FrameTitle, "Title")
+		artist = testTextFrame(ID3v2FrameArtist, "Artist")
+		other  = testTextFrame(ID3v2FrameTitle, "Other")
+		two    = append(testPaddedID3v2(3, 16, title), testPaddedID3v2(3, 16, artist, other)...)
+	)
+	for _, tc := range []struct {
+		name   string
+		policy PaddingPolicy
+		file   []byte
+		want   []byte
+		fixes  int
+	}{
+		{
+			name:   "two tags",
+			policy: PaddingPolicy{Target: 100},
+			file:   testMP3(two),
+			// The first title wins and the tags keep their combined size.
+			want:  testMP3(testPaddedID3v2(3, len(two)-10-len(title)-len(artist), title, artist)),
+			fixes: 2,
+		},
+		{
+			name:   "too much padding",
+			policy: PaddingPolicy{Target: 100, Max: 200},
+			file:   testMP3(testPaddedID3v2(3, 1000, title)),
+			want:   testMP3(testPaddedID3v2(3, 100, title)),
+			fixes:  1,
+		},
+		{
+			name:   "aligned",
+			policy: PaddingPolicy{Target: 100, Max: 200, Align: 512},
+			file:   testMP3(testPaddedID3v2(4, 1000, title)),
+			want:   testMP3(testPaddedID3v2(4, 512-10-len(title), title)),
+			fixes:  1,
+		},
+		{
+			name:   "kept",
+			policy: DefaultPaddingPolicy,
+			file:   testMP3(testPaddedID3v2(3, 1000, title)),
+			want:   testMP3(testPaddedID3v2(3, 1000, title)),
+		},
+		{
+			name:   "ID3v2.2",
+			policy: DefaultPaddingPolicy,
+			file:   testMP3(append(testID3v2(2, testID3v22Frame("TT2", []byte("\x00Title"))), testPaddedID3v2(3, 16, title)...)),
+			want:   testMP3(append(testID3v2(2, testID3v22Frame("TT2", []byte("\x00Title"))), testPaddedID3v2(3, 16, title)...)),
+		},
+		{
+			name:   "no tag",
+			policy: DefaultPaddingPolicy,
+			file:   testMP3(nil),
+			want:   testMP3(nil),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, fixes := Defragment(tc.policy)(tc.file)
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("got\n%x\nwant\n%x", got, tc.want)
+			}
+			if len(fixes) != tc.fixes {
+				t.Errorf("got fixes %v, want %d", fixes, tc.fixes)
+			}
+		})
+	}
+}
+
+func TestWithPadding(t *testing.T) {
+	title := testTextFrame(ID3v2FrameTitle, "Title")
+	for _, tc := range []struct {
+		name    string
+		file    []byte
+		opts    []Option
+		padding int
+	}{
+		{"kept", testMP3(testPaddedID3v2(3, 300, title)), nil, 300},
+		{"new tag", testMP3(nil), nil, id3v2DefaultPadding},
+		{"policy", testMP3(testPaddedID3v2(3, 300, title)), []Option{WithPadding(PaddingPolicy{Target: 64, Max: 100})}, 64},
+		{"policy keeps room", testMP3(testPaddedID3v2(3, 300, title)), []Option{WithPadding(PaddingPolicy{Target: 64})}, 300 - 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, bytes.NewReader(tc.file), TagSet{KeyTitle: "Title 2"}, tc.opts...); err != nil {
+				t.Fatal(err)
+			}
+			tags, _, err := parseID3v2Tags(out.Bytes(), 0, options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tags[0].padding != tc.padding {
+				t.Errorf("got padding %d, want %d", tags[0].padding, tc.padding)
+			}
+			if !bytes.HasSuffix(out.Bytes(), testMP3(nil)) {
+				t.Error("the audio data changed")
+			}
+		})
+	}
+}
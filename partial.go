@@ -0,0 +1,104 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+)
+
+// WithPartialFiles reads WAV files that are still being written, e.g. by
+// a recorder, which only fills in the RIFF and data chunk lengths when it
+// stops or every so often. The audio data is taken to run to the end of
+// the file when the length of the data chunk is 0 or 0xFFFFFFFF, when it
+// runs past the end of the file, or when the data chunk is the last chunk
+// and the file has grown since its length was written. A chunk that is
+// cut off ends the file instead of failing. Such files have "Partial" set
+// to "true".
+//
+// "Duration" is the length of the audio data that has been written, in
+// seconds. Since the audio data is measured by reading it, New reads
+// files to the end in this mode, unless WithProbeOnly is set too and
+// the file can be seeked.
+func WithPartialFiles() Option {
+	return func(o *options) {
+		o.partial = true
+	}
+}
+
+// placeholderLength reports whether the length of a data chunk is one
+// that recorders write before they know the length.
+func placeholderLength(length uint32) bool {
+	return length == 0 || length == 0xffffffff
+}
+
+// readPartialData reads the audio data of a file that may be being written
+// and sets its length. It returns io.EOF if the audio data runs to the end
+// of the file, since there are no more chunks.
+func (w wav) readPartialData(length uint32) error {
+	var (
+		declared = length
+		riffEnd  = int64(w.length) + 8
+		toEnd    = placeholderLength(declared) || w.r.n+int64(declared) >= riffEnd
+		limit    = int64(declared)
+	)
+	if toEnd {
+		limit = -1
+	}
+	n, err := w.opts.skipPayload(w.r, limit)
+	if err != nil {
+		return err
+	}
+	w.metadata[KeyDataLength] = strconv.FormatInt(n, 10)
+
+	if toEnd {
+		if n != int64(declared) {
+			w.metadata[KeyPartial] = "true"
+		}
+		return io.EOF
+	}
+	if n < int64(declared) {
+		w.metadata[KeyPartial] = "true"
+		return io.EOF
+	}
+	return w.skipPadByte(length)
+}
+
+// nextPartialChunk is nextChunk for a file that may be being written,
+// where riffLeft is how much of b the RIFF chunk length covers. The data
+// chunk runs to the end of b if its length is a placeholder, if it runs
+// past the end of b or if it is the last chunk. A chunk that is cut off
+// ends the chunks, in which case the ID is empty.
+func (w wav) nextPartialChunk(b []byte, riffLeft int64) (id string, data, rest []byte, err error) {
+	if len(b) < 8 {
+		w.metadata[KeyPartial] = "true"
+		return "", nil, nil, nil
+	}
+	length := binary.LittleEndian.Uint32(b[4:8])
+
+	if string(b[:4]) == "data" && (placeholderLength(length) || 8+int64(length) >= riffLeft) {
+		if int64(length) != int64(len(b)-8) {
+			w.metadata[KeyPartial] = "true"
+		}
+		return "data", b[8:], nil, nil
+	}
+	if int64(length) > int64(len(b)-8) {
+		// A chunk that is cut off.
+		w.metadata[KeyPartial] = "true"
+		return "", nil, nil, nil
+	}
+	return nextChunk(b)
+}
+
+// setDuration sets the duration of the audio data from the length of the
+// data chunk and the byte rate, once both chunks have been read.
+func (w wav) setDuration() {
+	length, err := strconv.ParseInt(w.metadata[KeyDataLength], 10, 64)
+	if err != nil {
+		return
+	}
+	byteRate, err := strconv.ParseInt(w.metadata[KeyByteRate], 10, 64)
+	if err != nil || byteRate <= 0 {
+		return
+	}
+	w.metadata[KeyDuration] = strconv.FormatFloat(float64(length)/float64(byteRate), 'f', 3, 64)
+}
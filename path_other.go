@@ -0,0 +1,20 @@
+//go:build !windows
+
+package sndtag
+
+// osPath returns the path to pass to the os package for a file,
+// which is the path itself on this system.
+func osPath(path string) string {
+	return path
+}
+
+// walkRoot returns the path to walk a directory tree from, so that the
+// paths of the files in it can be passed to the os package as they are.
+func walkRoot(root string) string {
+	return root
+}
+
+// pathKey returns a key that is the same for all the paths of a file.
+func pathKey(path string) string {
+	return path
+}
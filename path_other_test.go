@@ -0,0 +1,16 @@
+//go:build !windows
+
+package sndtag
+
+import "testing"
+
+func TestOSPath(t *testing.T) {
+	for _, path := range []string{"song.mp3", "/music/con.mp3", "/music/Song.mp3"} {
+		if got := osPath(path); got != path {
+			t.Errorf("osPath(%q) = %q", path, got)
+		}
+		if got := pathKey(path); got != path {
+			t.Errorf("pathKey(%q) = %q", path, got)
+		}
+	}
+}
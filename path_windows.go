@@ -0,0 +1,92 @@
+//go:build windows
+
+package sndtag
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath is the length from which paths need the extended-length
+// prefix. It leaves room for the 8.3 name of a file in a directory,
+// which is what CreateDirectory requires.
+const maxShortPath = 248
+
+// reservedNames are the device names that Windows opens instead of a file
+// with that name, whatever its extension.
+var reservedNames = map[string]bool{
+	"AUX": true, "CON": true, "CONIN$": true, "CONOUT$": true, "NUL": true, "PRN": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// osPath returns the path to pass to the os package for a file.
+// Paths that are too long for the Win32 API, and paths with a file or
+// directory named like a device, e.g. "con.mp3", get the \\?\ prefix,
+// which turns off the parsing that truncates and reinterprets them.
+func osPath(path string) string {
+	if len(path) < maxShortPath && !hasReservedName(path) {
+		return path
+	}
+	return extendedPath(path)
+}
+
+// walkRoot returns the path to walk a directory tree from, so that the
+// paths of the files in it can be passed to the os package as they are.
+// It has the \\?\ prefix, since any file in the tree may need it.
+func walkRoot(root string) string {
+	return extendedPath(root)
+}
+
+// extendedPath returns the absolute path of a file with the \\?\ prefix.
+func extendedPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// A UNC path, \\server\share\...
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// hasReservedName reports whether an element of path is a device name.
+// Trailing dots and spaces are ignored, like Windows does.
+func hasReservedName(path string) bool {
+	for _, elem := range strings.FieldsFunc(path, isSeparator) {
+		if i := strings.IndexByte(elem, '.'); i >= 0 {
+			elem = elem[:i]
+		}
+		if reservedNames[strings.ToUpper(strings.TrimRight(elem, " "))] {
+			return true
+		}
+	}
+	return false
+}
+
+// isSeparator reports whether r separates the elements of a path.
+func isSeparator(r rune) bool {
+	return r == '\\' || r == '/'
+}
+
+// pathKey returns a key that is the same for all the paths of a file,
+// since paths on Windows are case-insensitive, either slash can be used
+// and they can be relative or have the \\?\ prefix.
+func pathKey(path string) string {
+	switch {
+	case strings.HasPrefix(path, `\\?\UNC\`):
+		path = `\\` + path[8:]
+	case strings.HasPrefix(path, `\\?\`):
+		path = path[4:]
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return strings.ToUpper(filepath.Clean(path))
+}
@@ -0,0 +1,44 @@
+//go:build windows
+
+package sndtag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOSPath(t *testing.T) {
+	long := `C:\music\` + strings.Repeat("a", 250) + `.mp3`
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{`C:\music\song.mp3`, `C:\music\song.mp3`},
+		{`C:\music\con.mp3`, `\\?\C:\music\con.mp3`},
+		{`C:\music\Com1 .wav`, `\\?\C:\music\Com1 .wav`},
+		{`C:\console\song.mp3`, `C:\console\song.mp3`},
+		{`C:\nul\song.mp3`, `\\?\C:\nul\song.mp3`},
+		{`\\server\share\aux.wav`, `\\?\UNC\server\share\aux.wav`},
+		{`\\?\C:\music\con.mp3`, `\\?\C:\music\con.mp3`},
+		{long, `\\?\` + long},
+	} {
+		if got := osPath(tc.path); got != tc.want {
+			t.Errorf("osPath(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestPathKey(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+	}{
+		{`C:\Music\Song.mp3`, `c:/music/song.MP3`},
+		{`C:\music\song.mp3`, `\\?\C:\music\song.mp3`},
+		{`\\server\share\a.wav`, `\\?\UNC\server\share\a.wav`},
+		{`C:\music\..\music\a.wav`, `C:\music\a.wav`},
+	} {
+		if pathKey(tc.a) != pathKey(tc.b) {
+			t.Errorf("pathKey(%q) = %q, pathKey(%q) = %q", tc.a, pathKey(tc.a), tc.b, pathKey(tc.b))
+		}
+	}
+}
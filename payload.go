@@ -0,0 +1,70 @@
+package sndtag
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// errPayload is returned by parsers in probe-only mode when they reach
+// audio data that they can't seek past, to stop parsing.
+var errPayload = errors.New("reached audio data")
+
+// WithProbeOnly makes New read only the regions of a file that hold
+// metadata, and never the audio data, which matters when reading is
+// expensive, e.g. from tape archives or cloud storage. The data chunk of
+// WAV files, the mdat atoms of MP4 files and the clusters of Matroska
+// files are seeked past if the reader is an io.Seeker, so the metadata
+// after them is still read. Otherwise New stops at the audio data and
+// returns the properties that come before it, and headerless files, see
+// WithRawFormat, have no "DataLength". ParseStats.BytesRead tells how
+// much was read.
+//
+// The bytes that identify a format and the few bytes after an ID3v2 tag
+// that tell whether another tag follows are still read. MIDI files and
+// tracker modules are read whole, since the sample headers of modules
+// are spread among their samples. NewFromBytes has the whole file already,
+// so it is unaffected.
+func WithProbeOnly() Option {
+	return func(o *options) {
+		o.probeOnly = true
+	}
+}
+
+// skipPayload skips up to n bytes of audio data read from c, or the rest
+// of the file if n is negative, and returns the number of bytes skipped.
+// In probe-only mode it seeks past them if the file can be seeked, and
+// returns errPayload otherwise, see WithProbeOnly.
+func (o options) skipPayload(c *countingReader, n int64) (int64, error) {
+	if !o.probeOnly {
+		r := io.Reader(c)
+		if n >= 0 {
+			r = io.LimitReader(c, n)
+		}
+		return io.Copy(ioutil.Discard, r)
+	}
+	s, ok := c.r.(io.Seeker)
+	if !ok {
+		return 0, errPayload
+	}
+	current, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	skipped := end - current
+	if skipped < 0 {
+		skipped = 0
+	}
+	if n >= 0 && n < skipped {
+		skipped = n
+	}
+	if _, err := s.Seek(current+skipped, io.SeekStart); err != nil {
+		return 0, err
+	}
+	c.n += skipped
+	return skipped, nil
+}
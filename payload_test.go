@@ -0,0 +1,97 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// testAtom encodes an MP4 atom.
+func testAtom(typ string, children ...[]byte) []byte {
+	var data []byte
+	for _, c := range children {
+		data = append(data, c...)
+	}
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	b = append(b, typ...)
+	return append(b, data...)
+}
+
+// testM4A encodes an M4A file with a title whose moov atom is after the
+// media data.
+func testM4A(title string, media int) []byte {
+	item := testAtom("\xa9nam", testAtom("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte(title)))
+	meta := testAtom("meta", make([]byte, 4), testAtom("ilst", item))
+	b := testAtom("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	b = append(b, testAtom("mdat", make([]byte, media))...)
+	return append(b, testAtom("moov", testAtom("udta", meta))...)
+}
+
+func TestWithProbeOnly(t *testing.T) {
+	const audio = 1 << 20
+
+	// The INFO list is after 1 MiB of audio data.
+	format := []byte{1, 0, 2, 0, 0x44, 0xac, 0, 0, 0x10, 0xb1, 2, 0, 4, 0, 16, 0}
+	body := append([]byte("WAVE"), testChunk("fmt ", format)...)
+	body = append(body, testChunk("data", make([]byte, audio))...)
+	body = append(body, testInfoList(testChunk(INFOChunkTitle, []byte("Title\x00")))...)
+	wav := testChunk("RIFF", body)
+
+	// The ID3v1 tag is after the audio data, and only has the title.
+	mp3 := testID3v2(3, testTextFrame(ID3v2FrameArtist, "Artist"))
+	for len(mp3) < audio {
+		mp3 = append(mp3, testMP3(nil)...)
+	}
+	mp3 = append(mp3, testID3v1("Title")...)
+
+	block, err := NewTag(FormatFLAC, TagSet{KeyTitle: "Title", KeyArtist: "Artist"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block[0] |= 0x80
+	flac := append(testFLAC(block), bytes.Repeat([]byte{0xff, 0xf8}, audio/2)...)
+
+	m4a := testM4A("Title", audio)
+
+	seekable := func(b []byte) func() io.Reader {
+		return func() io.Reader { return bytes.NewReader(b) }
+	}
+	stream := func(b []byte) func() io.Reader {
+		return func() io.Reader { return struct{ io.Reader }{bytes.NewReader(b)} }
+	}
+	for _, tc := range []struct {
+		name     string
+		reader   func() io.Reader
+		opts     []Option
+		want     map[string]string
+		maxBytes int64
+	}{
+		{"wav seekable", seekable(wav), []Option{WithProbeOnly()}, map[string]string{KeyTitle: "Title", KeySampleRate: "44100"}, 4096},
+		{"wav stream", stream(wav), []Option{WithProbeOnly()}, map[string]string{KeyTitle: "", KeySampleRate: "44100"}, 4096},
+		{"wav default", stream(wav), nil, map[string]string{KeyTitle: "Title", KeySampleRate: "44100"}, int64(len(wav))},
+		{"mp3 seekable", seekable(mp3), []Option{WithProbeOnly()}, map[string]string{KeyTitle: "Title", KeyArtist: "Artist"}, 4096},
+		{"mp3 stream", stream(mp3), []Option{WithProbeOnly()}, map[string]string{KeyTitle: "", KeyArtist: "Artist"}, 4096},
+		{"flac seekable", seekable(flac), []Option{WithProbeOnly()}, map[string]string{KeyTitle: "Title", KeySampleRate: "44100"}, 4096},
+		{"flac stream", stream(flac), []Option{WithProbeOnly()}, map[string]string{KeyTitle: "Title", KeySampleRate: "44100"}, 4096},
+		{"m4a seekable", seekable(m4a), []Option{WithProbeOnly()}, map[string]string{KeyTitle: "Title"}, 4096},
+		{"m4a stream", stream(m4a), []Option{WithProbeOnly()}, map[string]string{KeyTitle: ""}, 4096},
+		{"m4a default", stream(m4a), nil, map[string]string{KeyTitle: "Title"}, int64(len(m4a))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stats ParseStats
+			metadata, err := New(tc.reader(), append(tc.opts, WithStats(&stats))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tc.want {
+				if got := metadata[key]; got != want {
+					t.Errorf("%s: got %q, want %q", key, got, want)
+				}
+			}
+			if stats.BytesRead > tc.maxBytes {
+				t.Errorf("read %d bytes, want at most %d", stats.BytesRead, tc.maxBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Peaks is the envelope of audio, made of the smallest and the largest
+// sample of each channel in consecutive blocks of frames, e.g. to draw
+// the waveform of a file in a library browser, see ComputePeaks.
+type Peaks struct {
+	SampleRate int
+	Channels   int
+
+	// FramesPerPeak is the number of frames in a block.
+	// The last block may be shorter.
+	FramesPerPeak int
+
+	// Min and Max are the smallest and the largest sample of each channel
+	// in each block, interleaved like PCM.Samples.
+	Min []float32
+	Max []float32
+}
+
+// Len returns the number of blocks.
+func (p *Peaks) Len() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Min) / p.Channels
+}
+
+// ComputePeaks computes the peaks of the audio of a file in blocks of
+// framesPerPeak frames, reading it once without holding it in memory.
+// It decodes the same files as PreviewPCM, and the ones of the decoders
+// set with WithPCMDecoders are decoded entirely first. The context set
+// with WithContext stops it.
+func ComputePeaks(r io.Reader, framesPerPeak int, opts ...Option) (*Peaks, error) {
+	if framesPerPeak < 1 {
+		return nil, fmt.Errorf("expected at least 1 frame per peak, got %d", framesPerPeak)
+	}
+	p := &peaksBuilder{peaks: Peaks{FramesPerPeak: framesPerPeak}}
+	if err := newOptions(opts).streamAudio(r, p); err != nil {
+		return nil, err
+	}
+	return p.finish(), nil
+}
+
+// peaksBuilder computes peaks from the decoded samples.
+type peaksBuilder struct {
+	peaks Peaks
+
+	// min and max are the peaks of the block being read,
+	// which has n frames so far.
+	min, max []float32
+	n        int
+}
+
+func (p *peaksBuilder) format(f pcmFormat) {
+	p.peaks.SampleRate, p.peaks.Channels = f.rate, f.channels
+	p.min, p.max = make([]float32, f.channels), make([]float32, f.channels)
+}
+
+func (p *peaksBuilder) samples(s []float32) bool {
+	for ; len(s) >= len(p.min) && len(p.min) > 0; s = s[len(p.min):] {
+		for ch, v := range s[:len(p.min)] {
+			if p.n == 0 || v < p.min[ch] {
+				p.min[ch] = v
+			}
+			if p.n == 0 || v > p.max[ch] {
+				p.max[ch] = v
+			}
+		}
+		if p.n++; p.n == p.peaks.FramesPerPeak {
+			p.flush()
+		}
+	}
+	return true
+}
+
+// flush adds the peaks of the block being read.
+func (p *peaksBuilder) flush() {
+	p.peaks.Min = append(p.peaks.Min, p.min...)
+	p.peaks.Max = append(p.peaks.Max, p.max...)
+	p.n = 0
+}
+
+// finish adds the peaks of the last block and returns the peaks.
+func (p *peaksBuilder) finish() *Peaks {
+	if p.n > 0 {
+		p.flush()
+	}
+	return &p.peaks
+}
+
+// peaksVersion is the version of the audiowaveform data format that
+// MarshalBinary writes, which is the first one with several channels.
+const peaksVersion = 2
+
+// MarshalBinary encodes the peaks in the binary data format of the BBC's
+// audiowaveform, which waveform viewers like peaks.js read, with 16-bit
+// values.
+func (p *Peaks) MarshalBinary() ([]byte, error) {
+	header := []uint32{
+		peaksVersion,
+		0, // flags: 16-bit values
+		uint32(p.SampleRate),
+		uint32(p.FramesPerPeak),
+		uint32(p.Len()),
+		uint32(p.Channels),
+	}
+	b := make([]byte, 0, 4*len(header)+4*len(p.Min))
+	for _, v := range header {
+		b = binary.LittleEndian.AppendUint32(b, v)
+	}
+	for i := range p.Min[:p.Len()*p.Channels] {
+		b = binary.LittleEndian.AppendUint16(b, uint16(peakValue(p.Min[i])))
+		b = binary.LittleEndian.AppendUint16(b, uint16(peakValue(p.Max[i])))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes peaks in the binary data format of audiowaveform,
+// versions 1 and 2, with 8 or 16-bit values.
+func (p *Peaks) UnmarshalBinary(b []byte) error {
+	if len(b) < 20 {
+		return fmt.Errorf("expected peaks of at least 20 bytes, got %d", len(b))
+	}
+	var (
+		version  = binary.LittleEndian.Uint32(b)
+		flags    = binary.LittleEndian.Uint32(b[4:8])
+		peaks    = Peaks{Channels: 1}
+		length   = int64(binary.LittleEndian.Uint32(b[16:20]))
+		width    = 2
+		data     []byte
+		maxValue = float32(32767)
+	)
+	peaks.SampleRate = int(binary.LittleEndian.Uint32(b[8:12]))
+	peaks.FramesPerPeak = int(binary.LittleEndian.Uint32(b[12:16]))
+
+	switch version {
+	case 1:
+		data = b[20:]
+	case 2:
+		if len(b) < 24 {
+			return fmt.Errorf("expected peaks of at least 24 bytes, got %d", len(b))
+		}
+		peaks.Channels = int(binary.LittleEndian.Uint32(b[20:24]))
+		data = b[24:]
+	default:
+		return fmt.Errorf("unsupported peaks version %d", version)
+	}
+	if flags&1 != 0 {
+		width, maxValue = 1, 127
+	}
+	if peaks.Channels < 1 || int64(len(data)) < length*int64(peaks.Channels)*int64(2*width) {
+		return fmt.Errorf("expected %d peaks of %d channels, got %d bytes", length, peaks.Channels, len(data))
+	}
+	n := int(length) * peaks.Channels
+	peaks.Min, peaks.Max = make([]float32, n), make([]float32, n)
+	for i := 0; i < n; i++ {
+		var min, max float32
+		if width == 1 {
+			min, max = float32(int8(data[2*i])), float32(int8(data[2*i+1]))
+		} else {
+			min = float32(int16(binary.LittleEndian.Uint16(data[4*i:])))
+			max = float32(int16(binary.LittleEndian.Uint16(data[4*i+2:])))
+		}
+		peaks.Min[i], peaks.Max[i] = min/maxValue, max/maxValue
+	}
+	*p = peaks
+	return nil
+}
+
+// peakValue converts a sample to a 16-bit value.
+func peakValue(v float32) int16 {
+	return int16(math.Max(-32768, math.Min(32767, math.Round(float64(v)*32767))))
+}
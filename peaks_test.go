@@ -0,0 +1,136 @@
+package sndtag
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestComputePeaks(t *testing.T) {
+	// The smallest and largest left and right samples of each block.
+	type block [4]int16
+
+	for _, tc := range []struct {
+		name          string
+		file          string
+		framesPerPeak int
+		want          []block
+	}{
+		{
+			name:          "WAV",
+			file:          "tone.wav",
+			framesPerPeak: 1024,
+			want: []block{
+				{-16000, 16000, -8000, 8000},
+				{-16000, 32767, -32768, 8000},
+				{-16000, 16000, -8000, 8000},
+				{-16000, 16000, -8000, 8000},
+				// The last block of 314 frames is silent.
+				{0, 0, 0, 0},
+			},
+		},
+		{
+			name:          "FLAC",
+			file:          "tone.flac",
+			framesPerPeak: 1024,
+			want: []block{
+				{-16000, 16000, -8000, 8000},
+				{-16000, 32767, -32768, 8000},
+				{-16000, 16000, -8000, 8000},
+				{-16000, 16000, -8000, 8000},
+				{0, 0, 0, 0},
+			},
+		},
+		{
+			name:          "AIFF in one block",
+			file:          "tone.aiff",
+			framesPerPeak: 4410,
+			want:          []block{{-16000, 32767, -32768, 8000}},
+		},
+		{
+			name:          "blocks of silence",
+			file:          "tone.flac",
+			framesPerPeak: 441,
+			want: []block{
+				{0, 0, 0, 0},
+				{-16000, 16000, -8000, 8000},
+				{-16000, 16000, -8000, 8000},
+				{-16000, 16000, -8000, 8000},
+				{-16000, 32767, -32768, 8000},
+				{-15999, 16000, -8000, 8000},
+				{-16000, 16000, -8000, 8000},
+				{-16000, 16000, -8000, 8000},
+				{-16000, 16000, -8000, 8000},
+				{0, 0, 0, 0},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := ComputePeaks(bytes.NewReader(testAudio(t, tc.file)), tc.framesPerPeak)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.SampleRate != 44100 || p.Channels != 2 || p.FramesPerPeak != tc.framesPerPeak {
+				t.Fatalf("got %d Hz, %d channels and %d frames per peak", p.SampleRate, p.Channels, p.FramesPerPeak)
+			}
+			if p.Len() != len(tc.want) {
+				t.Fatalf("got %d blocks, want %d", p.Len(), len(tc.want))
+			}
+			for i, b := range tc.want {
+				got := [4]float32{p.Min[2*i], p.Max[2*i], p.Min[2*i+1], p.Max[2*i+1]}
+				for j, v := range b {
+					if want := float32(v) / 32768; got[j] != want {
+						t.Errorf("block %d: got %v, want %v", i, got, b)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestComputePeaksErrors(t *testing.T) {
+	if _, err := ComputePeaks(bytes.NewReader(testAudio(t, "tone.wav")), 0); err == nil {
+		t.Error("0 frames per peak: got no error")
+	}
+	if _, err := ComputePeaks(bytes.NewReader(testMP3(nil)), 1024); err == nil {
+		t.Error("MP3: got no error")
+	}
+}
+
+func TestPeaksBinary(t *testing.T) {
+	p, err := ComputePeaks(bytes.NewReader(testAudio(t, "tone.flac")), 441)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 24 + 4*len(p.Min); len(b) != want {
+		t.Fatalf("got %d bytes, want %d", len(b), want)
+	}
+	var got Peaks
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.SampleRate != p.SampleRate || got.Channels != p.Channels || got.FramesPerPeak != p.FramesPerPeak || got.Len() != p.Len() {
+		t.Fatalf("got %+v", got)
+	}
+	// The values are rounded to 16 bits.
+	for i := range p.Min {
+		if math.Abs(float64(got.Min[i]-p.Min[i])) > 1.0/32767 || math.Abs(float64(got.Max[i]-p.Max[i])) > 1.0/32767 {
+			t.Errorf("peak %d: got %v, %v, want %v, %v", i, got.Min[i], got.Max[i], p.Min[i], p.Max[i])
+		}
+	}
+
+	for _, b := range [][]byte{
+		b[:16],
+		b[:len(b)-1],
+		append([]byte{3, 0, 0, 0}, b[4:]...),
+	} {
+		if err := got.UnmarshalBinary(b); err == nil {
+			t.Errorf("%x: got no error", b[:8])
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package sndtag
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"math"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// A Playlist is a list of files and their metadata that can be written as
+// an M3U8 or XSPF playlist, e.g. the files that Walk found with a filter:
+//
+//	var p sndtag.Playlist
+//	err := sndtag.Walk(ctx, store, 8, func(r sndtag.Result) error {
+//		p.Add(r)
+//		return nil
+//	}, sndtag.WithFilter(f))
+type Playlist struct {
+	Title   string
+	Entries []PlaylistEntry
+}
+
+// A PlaylistEntry is a file in a Playlist.
+type PlaylistEntry struct {
+	// Location is the path or the URL of the file. Paths are relative to
+	// the playlist, or absolute, and use "/" as the separator in XSPF
+	// playlists.
+	Location string
+	Metadata map[string]string
+}
+
+// Add adds the file of a result of Walk to the playlist, with its key as
+// its location. Results with an error and files in archives, which players
+// can't open, are skipped.
+func (p *Playlist) Add(r Result) {
+	if r.Err != nil || r.Object.Archive != "" {
+		return
+	}
+	p.Entries = append(p.Entries, PlaylistEntry{Location: r.Object.Key, Metadata: r.Metadata})
+}
+
+// WriteM3U8 writes the playlist as an extended M3U playlist in UTF-8, with
+// an #EXTINF line for each file that holds its duration in seconds, or -1
+// if it is unknown, and its artist and title, and an #EXTALB line with its
+// album. Files without a title are listed by name.
+func (p *Playlist) WriteM3U8(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("#EXTM3U\n")
+	if p.Title != "" {
+		bw.WriteString("#PLAYLIST:" + m3uText(p.Title) + "\n")
+	}
+	for _, e := range p.Entries {
+		seconds := -1
+		if d, ok := playlistDuration(e.Metadata); ok {
+			seconds = int(math.Round(d))
+		}
+		title := e.Metadata[KeyTitle]
+		if title == "" {
+			name := path.Base(toSlash(e.Location))
+			title = strings.TrimSuffix(name, path.Ext(name))
+		}
+		if artist := e.Metadata[KeyArtist]; artist != "" {
+			title = artist + " - " + title
+		}
+		bw.WriteString("#EXTINF:" + strconv.Itoa(seconds) + "," + m3uText(title) + "\n")
+		if album := e.Metadata[KeyAlbum]; album != "" {
+			bw.WriteString("#EXTALB:" + m3uText(album) + "\n")
+		}
+		bw.WriteString(e.Location + "\n")
+	}
+	return bw.Flush()
+}
+
+// m3uText returns text on a single line.
+func m3uText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// xspfPlaylist is the document of an XSPF playlist.
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version int         `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+// xspfTrack is a track of an XSPF playlist.
+type xspfTrack struct {
+	Location   string `xml:"location"`
+	Title      string `xml:"title,omitempty"`
+	Creator    string `xml:"creator,omitempty"`
+	Album      string `xml:"album,omitempty"`
+	Annotation string `xml:"annotation,omitempty"`
+	TrackNum   int    `xml:"trackNum,omitempty"`
+	Duration   int64  `xml:"duration,omitempty"`
+}
+
+// WriteXSPF writes the playlist as an XSPF playlist, with the title, the
+// artist as the creator, the album, the comment as the annotation, the
+// track number and the duration in milliseconds of each file. Paths are
+// written as relative or absolute URIs.
+func (p *Playlist) WriteXSPF(w io.Writer) error {
+	doc := xspfPlaylist{Version: 1, Title: p.Title, Tracks: []xspfTrack{}}
+
+	for _, e := range p.Entries {
+		md := e.Metadata
+		t := xspfTrack{
+			Location:   xspfLocation(e.Location),
+			Title:      md[KeyTitle],
+			Creator:    md[KeyArtist],
+			Album:      md[KeyAlbum],
+			Annotation: md[KeyComment],
+			TrackNum:   leadingNumber(md[KeyTrack]),
+		}
+		if d, ok := playlistDuration(md); ok {
+			t.Duration = int64(math.Round(d * 1000))
+		}
+		doc.Tracks = append(doc.Tracks, t)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// xspfLocation returns the URI of a location, which is a URL or a path.
+func xspfLocation(location string) string {
+	if u, err := url.Parse(location); err == nil && len(u.Scheme) > 1 {
+		return location
+	}
+	location = toSlash(location)
+	if len(location) > 1 && location[1] == ':' {
+		// A Windows path with a drive letter.
+		return (&url.URL{Scheme: "file", Path: "/" + location}).String()
+	}
+	if strings.HasPrefix(location, "/") {
+		return (&url.URL{Scheme: "file", Path: location}).String()
+	}
+	return (&url.URL{Path: location}).String()
+}
+
+// toSlash replaces the backslashes of a Windows path with slashes.
+func toSlash(location string) string {
+	return strings.ReplaceAll(location, `\`, "/")
+}
+
+// playlistDuration returns the duration of a file in seconds, from its
+// "Duration" property or from its number of samples and sample rate.
+func playlistDuration(metadata map[string]string) (float64, bool) {
+	if d, err := strconv.ParseFloat(metadata[KeyDuration], 64); err == nil && d >= 0 {
+		return d, true
+	}
+	samples, err1 := strconv.ParseFloat(metadata[KeySampleCount], 64)
+	rate, err2 := strconv.ParseFloat(metadata[KeySampleRate], 64)
+	if err1 != nil || err2 != nil || rate <= 0 {
+		return 0, false
+	}
+	return samples / rate, true
+}
@@ -0,0 +1,136 @@
+package sndtag
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Style is the layout of the output of Print.
+type Style int
+
+// Styles.
+const (
+	// TableStyle writes one property per line with the values aligned,
+	// the descriptive properties first and the others sorted by key.
+	TableStyle Style = iota
+
+	// LineStyle writes a single line like "Artist - Title (Album, Year) 3:45",
+	// leaving out what isn't set. Files without an artist or a title are
+	// written as their properties, e.g. "Format=Shorten".
+	LineStyle
+)
+
+// formatOrder is the order of the properties that come first in a table.
+var formatOrder = []string{
+	KeyTitle,
+	KeyArtist,
+	KeyAlbum,
+	KeyAlbumArtist,
+	KeyTrack,
+	KeyDisc,
+	KeyYear,
+	KeyGenre,
+	KeyComment,
+}
+
+// Print writes the properties returned by New in a human-readable style.
+// Keys in any KeyStyle are recognized.
+func Print(w io.Writer, metadata map[string]string, style Style) error {
+	switch style {
+	case TableStyle:
+		return formatTable(w, metadata)
+	case LineStyle:
+		_, err := fmt.Fprintln(w, formatLine(metadata))
+		return err
+	}
+	return fmt.Errorf("unknown style %d", style)
+}
+
+// formatTable writes the properties one per line with the values aligned.
+// Lines after the first of a value are indented to the values.
+func formatTable(w io.Writer, metadata map[string]string) error {
+	var (
+		rank  = map[string]int{}
+		keys  = make([]string, 0, len(metadata))
+		width int
+	)
+	for i, key := range formatOrder {
+		rank[foldFilterName(key)] = i + 1
+	}
+	for key := range metadata {
+		keys = append(keys, key)
+		if n := utf8.RuneCountInString(key); n > width {
+			width = n
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rank[foldFilterName(keys[i])], rank[foldFilterName(keys[j])]
+		switch {
+		case ri != 0 && rj != 0:
+			return ri < rj
+		case ri != 0 || rj != 0:
+			return ri != 0
+		}
+		return keys[i] < keys[j]
+	})
+
+	indent := "\n" + strings.Repeat(" ", width+2)
+	for _, key := range keys {
+		value := strings.ReplaceAll(strings.TrimRight(metadata[key], "\r\n"), "\r\n", "\n")
+		value = strings.ReplaceAll(value, "\n", indent)
+		pad := strings.Repeat(" ", width-utf8.RuneCountInString(key))
+		if _, err := fmt.Fprintf(w, "%s%s  %s\n", key, pad, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLine returns the properties as a single line.
+func formatLine(metadata map[string]string) string {
+	var (
+		p      = newFilterProperties(metadata)
+		artist = p.lookup(KeyArtist)
+		title  = p.lookup(KeyTitle)
+	)
+	if artist == "" && title == "" {
+		pairs := make([]string, 0, len(metadata))
+		for key, value := range metadata {
+			if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+				value = strconv.Quote(value)
+			}
+			pairs = append(pairs, key+"="+value)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, " ")
+	}
+
+	var parts []string
+	if artist != "" {
+		parts = append(parts, artist)
+	}
+	if title != "" {
+		parts = append(parts, title)
+	}
+	line := strings.Join(parts, " - ")
+
+	var album []string
+	for _, key := range []string{KeyAlbum, KeyYear} {
+		if v := p.lookup(key); v != "" {
+			album = append(album, v)
+		}
+	}
+	if len(album) > 0 {
+		line += " (" + strings.Join(album, ", ") + ")"
+	}
+	if seconds, err := strconv.ParseFloat(p.lookup(KeyDuration), 64); err == nil {
+		line += " " + FormatDuration(time.Duration(seconds*float64(time.Second)))
+	}
+	// Keep multi-line values on the line.
+	return strings.Join(strings.Fields(line), " ")
+}
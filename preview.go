@@ -0,0 +1,345 @@
+package sndtag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+// PCM is decoded audio, see PreviewPCM.
+type PCM struct {
+	SampleRate int
+	Channels   int
+
+	// Samples are the samples of the channels, interleaved,
+	// scaled to [-1, 1].
+	Samples []float32
+}
+
+// Frames returns the number of samples of each channel.
+func (p *PCM) Frames() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Samples) / p.Channels
+}
+
+// Duration returns the length of the audio.
+func (p *PCM) Duration() time.Duration {
+	if p.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(p.Frames()) * time.Second / time.Duration(p.SampleRate)
+}
+
+// A PCMDecoder decodes the audio of a format for PreviewPCM.
+type PCMDecoder interface {
+	// Match reports whether the decoder decodes a file that starts with
+	// header, which holds the first 12 bytes of the file after its ID3v2
+	// tags, or fewer if the file is shorter.
+	Match(header []byte) bool
+
+	// DecodePCM decodes the first d of the audio of the file read from r,
+	// which starts with header, or all of it if d is 0 or less.
+	DecodePCM(r io.Reader, d time.Duration) (*PCM, error)
+}
+
+// WithPCMDecoders makes PreviewPCM try the decoders, in order, before the
+// built-in ones, e.g. to preview formats that sndtag can't decode.
+func WithPCMDecoders(decoders ...PCMDecoder) Option {
+	return func(o *options) {
+		o.decoders = decoders
+	}
+}
+
+// PreviewPCM decodes the first d of the audio of a file, or all of it if
+// d is 0 or less, e.g. to draw a waveform thumbnail in a library. WAV files
+// with PCM or IEEE float samples, AIFF files and FLAC streams are decoded,
+// and other formats can be added with WithPCMDecoders. ID3v2 tags before
+// the audio are skipped. The context set with WithContext stops decoding.
+//
+// An error wrapping ErrUnrecognizedFormat is returned if no decoder
+// matches the file.
+func PreviewPCM(r io.Reader, d time.Duration, opts ...Option) (*PCM, error) {
+	o := newOptions(opts)
+
+	r, header, err := skipID3v2(o.guardContext(r))
+	if err != nil {
+		return nil, err
+	}
+	for _, dec := range o.decoders {
+		if dec.Match(header) {
+			return dec.DecodePCM(r, d)
+		}
+	}
+	c := &pcmCollector{d: d}
+	if err := streamPCM(r, header, c); err != nil {
+		return nil, err
+	}
+	return &c.pcm, nil
+}
+
+// pcmFormat is the format of decoded audio.
+type pcmFormat struct {
+	rate, channels int
+
+	// bits is the precision of integer samples, and 0 for float samples.
+	bits int
+}
+
+// pcmHandler receives the audio decoded by the built-in decoders.
+type pcmHandler interface {
+	// format is called with the format of the audio before any samples.
+	format(f pcmFormat)
+
+	// samples is called with whole frames of interleaved samples, in order,
+	// and returns false to stop decoding. s is reused by the next call.
+	samples(s []float32) bool
+}
+
+// streamAudio decodes the audio of a file with the decoders set with
+// WithPCMDecoders or the built-in ones, and passes it to h. The audio
+// of the decoders set with WithPCMDecoders is decoded entirely first.
+func (o options) streamAudio(r io.Reader, h pcmHandler) error {
+	r, header, err := skipID3v2(o.guardContext(r))
+	if err != nil {
+		return err
+	}
+	for _, dec := range o.decoders {
+		if !dec.Match(header) {
+			continue
+		}
+		pcm, err := dec.DecodePCM(r, 0)
+		if err != nil {
+			return err
+		}
+		h.format(pcmFormat{rate: pcm.SampleRate, channels: pcm.Channels})
+		if pcm.Channels > 0 {
+			h.samples(pcm.Samples[:pcm.Frames()*pcm.Channels])
+		}
+		return nil
+	}
+	return streamPCM(r, header, h)
+}
+
+// streamPCM decodes the audio of a file that starts with header with the
+// built-in decoders, and passes it to h.
+func streamPCM(r io.Reader, header []byte, h pcmHandler) error {
+	switch {
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return streamFLAC(r, h)
+	case len(header) == 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return streamWav(r, h)
+	case isAIFF(header):
+		return streamAIFF(r, h)
+	}
+	if len(header) > 4 {
+		header = header[:4]
+	}
+	return fmt.Errorf("%w: %q", ErrUnrecognizedFormat, header)
+}
+
+// pcmCollector collects the first d of the audio, or all of it
+// if d is 0 or less.
+type pcmCollector struct {
+	d   time.Duration
+	pcm PCM
+
+	// frames is the number of frames to collect, or -1 for all of them.
+	frames int
+}
+
+func (c *pcmCollector) format(f pcmFormat) {
+	c.pcm = PCM{SampleRate: f.rate, Channels: f.channels}
+	c.frames = -1
+	if c.d > 0 {
+		c.frames = int(math.Ceil(c.d.Seconds() * float64(f.rate)))
+	}
+}
+
+func (c *pcmCollector) samples(s []float32) bool {
+	if c.frames < 0 {
+		c.pcm.Samples = append(c.pcm.Samples, s...)
+		return true
+	}
+	if n := (c.frames - c.pcm.Frames()) * c.pcm.Channels; len(s) > n {
+		s = s[:n]
+	}
+	c.pcm.Samples = append(c.pcm.Samples, s...)
+	return c.pcm.Frames() < c.frames
+}
+
+// sampleCodec describes how the samples of a file are stored.
+type sampleCodec struct {
+	pcmFormat
+
+	// width is the size of a sample in bytes.
+	width     int
+	float     bool
+	bigEndian bool
+}
+
+// stream decodes the samples in length bytes of r and passes them to h.
+// The audio may end before length bytes, since files that are still being
+// written often declare less or more than they have.
+func (c *sampleCodec) stream(r io.Reader, length int64, h pcmHandler) error {
+	var (
+		frameSize = c.width * c.channels
+		buf       = make([]byte, 1024*frameSize)
+		samples   = make([]float32, 0, 1024*c.channels)
+	)
+	for length > 0 {
+		n := int64(len(buf))
+		if n > length {
+			n = length
+		}
+		read, err := io.ReadFull(r, buf[:n])
+		read -= read % frameSize
+		length -= n
+
+		if samples = c.decode(samples[:0], buf[:read]); len(samples) > 0 && !h.samples(samples) {
+			return nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode appends the samples in b to samples, scaled to [-1, 1].
+func (c *sampleCodec) decode(samples []float32, b []byte) []float32 {
+	for ; len(b) >= c.width; b = b[c.width:] {
+		samples = append(samples, c.sample(b[:c.width]))
+	}
+	return samples
+}
+
+// sample decodes a sample. 8-bit integer samples are unsigned in WAV files,
+// and every other integer sample is signed, with its significant bits
+// first, so it is scaled by the size of its container.
+func (c *sampleCodec) sample(b []byte) float32 {
+	var order binary.ByteOrder = binary.LittleEndian
+	if c.bigEndian {
+		order = binary.BigEndian
+	}
+	switch {
+	case c.float && c.width == 4:
+		return math.Float32frombits(order.Uint32(b))
+	case c.float && c.width == 8:
+		return float32(math.Float64frombits(order.Uint64(b)))
+	case c.width == 1 && !c.bigEndian:
+		return float32(int(b[0])-128) / 128
+	}
+	var v uint64
+	for i := range b {
+		if c.bigEndian {
+			v = v<<8 | uint64(b[i])
+		} else {
+			v |= uint64(b[i]) << (8 * i)
+		}
+	}
+	bits := uint(8 * c.width)
+	s := int64(v<<(64-bits)) >> (64 - bits)
+	return float32(float64(s) / float64(uint64(1)<<(bits-1)))
+}
+
+// streamWav decodes the data chunk of a WAV file,
+// whose fmt chunk must come before it.
+func streamWav(r io.Reader, h pcmHandler) error {
+	// Buffered, so that a missing pad byte can be put back, see skipPadByte.
+	r = bufio.NewReader(r)
+
+	// Skip the RIFF header.
+	if _, err := io.CopyN(ioutil.Discard, r, 12); err != nil {
+		return err
+	}
+	var codec *sampleCodec
+	for {
+		id, length, data, err := readChunk(r)
+		if err == io.EOF {
+			return fmt.Errorf("WAV file has no data chunk")
+		}
+		if err != nil {
+			return err
+		}
+		switch id {
+		case "fmt ":
+			b, err := ioutil.ReadAll(data)
+			if err != nil {
+				return err
+			}
+			if codec, err = readWavCodec(b); err != nil {
+				return err
+			}
+		case "data":
+			if codec == nil {
+				return fmt.Errorf("WAV file has no fmt chunk before its data chunk")
+			}
+			h.format(codec.pcmFormat)
+			return codec.stream(data, int64(length), h)
+		}
+		if _, err := io.Copy(ioutil.Discard, data); err != nil {
+			return err
+		}
+		if err := skipPadByte(r, length); err != nil {
+			return err
+		}
+	}
+}
+
+// readWavCodec reads how the samples of a WAV file are stored from its fmt chunk.
+func readWavCodec(b []byte) (*sampleCodec, error) {
+	if len(b) < 16 {
+		return nil, fmt.Errorf("expected fmt chunk of at least 16 bytes, got %d", len(b))
+	}
+	var (
+		format     = binary.LittleEndian.Uint16(b)
+		channels   = int(binary.LittleEndian.Uint16(b[2:4]))
+		blockAlign = int(binary.LittleEndian.Uint16(b[12:14]))
+		bits       = int(binary.LittleEndian.Uint16(b[14:16]))
+	)
+	if format == wavFormatExtensible {
+		if len(b) < 40 {
+			return nil, fmt.Errorf("expected extensible fmt chunk of at least 40 bytes, got %d", len(b))
+		}
+		format = binary.LittleEndian.Uint16(b[24:26])
+
+		// wValidBitsPerSample is 0 if all the bits are valid.
+		if v := int(binary.LittleEndian.Uint16(b[18:20])); v > 0 {
+			bits = v
+		}
+	}
+	if format != wavFormatPCM && format != wavFormatFloat {
+		return nil, fmt.Errorf("expected pcm or float audio format, got %d", format)
+	}
+	if channels == 0 || blockAlign == 0 || blockAlign%channels != 0 || blockAlign/channels > 8 {
+		return nil, fmt.Errorf("invalid block align %d for %d channels", blockAlign, channels)
+	}
+	codec := &sampleCodec{
+		pcmFormat: pcmFormat{
+			rate:     int(binary.LittleEndian.Uint32(b[4:8])),
+			channels: channels,
+		},
+		width: blockAlign / channels,
+		float: format == wavFormatFloat,
+	}
+	switch {
+	case codec.float && codec.width != 4 && codec.width != 8:
+		return nil, fmt.Errorf("expected 32 or 64-bit float samples, got %d bits", 8*codec.width)
+	case !codec.float:
+		codec.bits = 8 * codec.width
+		if bits > 0 && bits < codec.bits {
+			codec.bits = bits
+		}
+	}
+	return codec, nil
+}
@@ -0,0 +1,92 @@
+package sndtag
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// testDecoder decodes files that start with "TEST" to a frame of silence.
+type testDecoder struct{}
+
+func (testDecoder) Match(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("TEST"))
+}
+
+func (testDecoder) DecodePCM(r io.Reader, d time.Duration) (*PCM, error) {
+	return &PCM{SampleRate: 8000, Channels: 1, Samples: []float32{0}}, nil
+}
+
+func TestPreviewPCM(t *testing.T) {
+	wav, err := PreviewPCM(bytes.NewReader(testAudio(t, "tone.wav")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.SampleRate != 44100 || wav.Channels != 2 || wav.Frames() != 4410 || wav.Duration() != 100*time.Millisecond {
+		t.Fatalf("got %d Hz, %d channels and %d frames", wav.SampleRate, wav.Channels, wav.Frames())
+	}
+	// The first clipped frame.
+	if l, r := wav.Samples[2*2000], wav.Samples[2*2000+1]; l != 32767.0/32768 || r != -1 {
+		t.Fatalf("got clipped frame %v, %v", l, r)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		file   []byte
+		d      time.Duration
+		opts   []Option
+		frames int
+		err    error
+	}{
+		{name: "FLAC", file: testAudio(t, "tone.flac"), frames: 4410},
+		{name: "AIFF", file: testAudio(t, "tone.aiff"), frames: 4410},
+		{name: "WAV after an ID3v2 tag", file: append(testID3v2(3, testTextFrame("TIT2", "Tone")), testAudio(t, "tone.wav")...), frames: 4410},
+		{name: "first 10 ms of WAV", file: testAudio(t, "tone.wav"), d: 10 * time.Millisecond, frames: 441},
+		{name: "first 50 ms of FLAC", file: testAudio(t, "tone.flac"), d: 50 * time.Millisecond, frames: 2205},
+		{name: "first 50 ms of AIFF", file: testAudio(t, "tone.aiff"), d: 50 * time.Millisecond, frames: 2205},
+		{name: "longer than the audio", file: testAudio(t, "tone.flac"), d: time.Second, frames: 4410},
+		{name: "MP3", file: testMP3(nil), err: ErrUnrecognizedFormat},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pcm, err := PreviewPCM(bytes.NewReader(tc.file), tc.d, tc.opts...)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("got error %v, want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pcm.SampleRate != 44100 || pcm.Channels != 2 || pcm.Frames() != tc.frames {
+				t.Fatalf("got %d Hz, %d channels and %d frames, want %d frames", pcm.SampleRate, pcm.Channels, pcm.Frames(), tc.frames)
+			}
+			// Every decoder decodes the same samples.
+			for i, s := range pcm.Samples {
+				if s != wav.Samples[i] {
+					t.Fatalf("sample %d: got %v, want %v", i, s, wav.Samples[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWithPCMDecoders(t *testing.T) {
+	pcm, err := PreviewPCM(bytes.NewReader([]byte("TEST")), 0, WithPCMDecoders(testDecoder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcm.SampleRate != 8000 || pcm.Frames() != 1 {
+		t.Errorf("got %d Hz and %d frames", pcm.SampleRate, pcm.Frames())
+	}
+	// The built-in decoders are still used for other files.
+	pcm, err = PreviewPCM(bytes.NewReader(testAudio(t, "tone.flac")), 0, WithPCMDecoders(testDecoder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcm.Frames() != 4410 {
+		t.Errorf("got %d frames, want 4410", pcm.Frames())
+	}
+}
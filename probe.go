@@ -0,0 +1,151 @@
+package sndtag
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// probeWarmup is the number of files with an extension that are
+	// recognized before the probes for formats that none of them had
+	// are skipped.
+	probeWarmup = 64
+
+	// probeRefresh is the number of files after which the order of the
+	// probes for an extension is updated.
+	probeRefresh = 16
+)
+
+// WithAdaptiveProbing makes New and NewFromBytes learn which formats are
+// common among the files they read, and try the signatures of those formats
+// first when recognizing the next files. Once enough files with an
+// extension have been read, the signatures of formats that none of them
+// had are only tried if no other signature matches, which saves most of
+// the probes on libraries with one or two formats. The format a file is
+// recognized as never changes, only the work needed to recognize it, see
+// ParseStats.Probes.
+//
+// What is learned is shared by every call that is passed the same Option,
+// so create it once per library, e.g.
+//
+//	err := sndtag.Walk(ctx, store, 8, fn, sndtag.WithAdaptiveProbing())
+//
+// Walk passes the extension of each file; other files are all treated as
+// having the same extension.
+func WithAdaptiveProbing() Option {
+	p := &probeProfile{exts: map[string]*extProfile{}}
+
+	return func(o *options) {
+		o.probes = p
+	}
+}
+
+// withExtension sets the extension of the file being read, from its name,
+// for WithAdaptiveProbing.
+func withExtension(name string) Option {
+	return func(o *options) {
+		o.ext = strings.ToLower(path.Ext(name))
+	}
+}
+
+// probeProfile is what WithAdaptiveProbing learned, per extension.
+type probeProfile struct {
+	mu   sync.Mutex
+	exts map[string]*extProfile
+}
+
+// extProfile is what WithAdaptiveProbing learned about the files with an
+// extension.
+type extProfile struct {
+	mu     sync.Mutex
+	seen   int
+	counts map[fileType]int
+
+	// probes are the probes to try, most common format first, and partial
+	// is whether some probes were left out of it.
+	probes  []typeProbe
+	partial bool
+}
+
+// ext returns the profile of an extension.
+func (p *probeProfile) ext(ext string) *extProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.exts[ext]
+	if !ok {
+		e = &extProfile{counts: map[fileType]int{}, probes: typeProbes}
+		p.exts[ext] = e
+	}
+	return e
+}
+
+// order returns the probes to try for a file with an extension, and
+// whether some probes were left out.
+func (e *extProfile) order() ([]typeProbe, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.probes, e.partial
+}
+
+// observe records the type of a file, and updates the order of the probes
+// every probeRefresh files.
+func (e *extProfile) observe(typ fileType) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.seen++
+	e.counts[typ]++
+	if e.seen%probeRefresh != 0 {
+		return
+	}
+	// Unknown files try every probe anyway, so probes are only left out
+	// if they are rare.
+	skip := e.seen >= probeWarmup && e.counts[fileUnknown]*16 < e.seen
+
+	var probes []typeProbe
+	for _, p := range typeProbes {
+		if e.counts[p.typ] > 0 || !skip {
+			probes = append(probes, p)
+		}
+	}
+	sort.SliceStable(probes, func(i, j int) bool {
+		return e.counts[probes[i].typ] > e.counts[probes[j].typ]
+	})
+	e.probes, e.partial = probes, len(probes) < len(typeProbes)
+}
+
+// detectType returns the type of a file like detectType does, trying the
+// probes in the order WithAdaptiveProbing learned, and counts the probes
+// that were tried.
+func (o options) detectType(b []byte) fileType {
+	if o.probes == nil {
+		return o.probe(b, typeProbes)
+	}
+	e := o.probes.ext(o.ext)
+
+	probes, partial := e.order()
+	typ := o.probe(b, probes)
+	if typ == fileUnknown && partial {
+		typ = o.probe(b, typeProbes)
+	}
+	e.observe(typ)
+	return typ
+}
+
+// probe tries probes in order and returns the type of the first one that
+// matches.
+func (o options) probe(b []byte, probes []typeProbe) fileType {
+	for _, p := range probes {
+		if o.stats != nil {
+			o.stats.Probes++
+		}
+		if p.match(b) {
+			return p.typ
+		}
+	}
+	return fileUnknown
+}
@@ -0,0 +1,140 @@
+package sndtag
+
+import (
+	"context"
+	"fmt"
+)
+
+// A Provider looks up metadata in an external source, e.g. a MusicBrainz
+// client, to fill in what is missing from a file. sndtag doesn't come with
+// any providers, so parsing stays offline unless one is supplied.
+//
+// Lookup is called with the properties read from a file, and returns
+// the properties to add. See WithProviders.
+type Provider interface {
+	Lookup(ctx context.Context, metadata map[string]string) (map[string]string, error)
+}
+
+// ProviderFunc is an adapter that allows the use of ordinary functions as Providers.
+type ProviderFunc func(ctx context.Context, metadata map[string]string) (map[string]string, error)
+
+// Lookup calls f(ctx, metadata).
+func (f ProviderFunc) Lookup(ctx context.Context, metadata map[string]string) (map[string]string, error) {
+	return f(ctx, metadata)
+}
+
+// An ArtworkProvider is a Provider that can also fetch cover art.
+// Artwork is only called for files without embedded pictures,
+// and returns the image data, or nil if there is none.
+type ArtworkProvider interface {
+	Provider
+	Artwork(ctx context.Context, metadata map[string]string) ([]byte, error)
+}
+
+// MergePolicy controls how the properties returned by providers
+// are merged with the properties read from a file.
+type MergePolicy int
+
+// Merge policies.
+const (
+	// MergeMissing only adds the properties that aren't set.
+	MergeMissing MergePolicy = iota
+
+	// MergeOverwrite replaces the properties that are set.
+	MergeOverwrite
+)
+
+// WithProviders makes New and NewFromBytes look up the metadata they read
+// with the providers, in order, and merge the results with policy, see
+// Merge and WithMergeRules.
+// Each provider sees the properties merged by the ones before it.
+// The context set with WithContext is passed to the providers.
+//
+// Artwork is fetched from the first ArtworkProvider that has any if the
+// file has no embedded pictures, and is written to the writer set with
+// WithArtwork. The "Artwork" properties describe it as usual.
+func WithProviders(policy MergePolicy, providers ...Provider) Option {
+	return func(o *options) {
+		o.providers = providers
+		o.mergePolicy = policy
+	}
+}
+
+// WithMergeRules sets the merge policy of some properties for the
+// providers set with WithProviders, overriding the policy passed to it.
+func WithMergeRules(rules ...MergeRule) Option {
+	return func(o *options) {
+		o.mergeRules = append(o.mergeRules, rules...)
+	}
+}
+
+// enrich looks up metadata with the providers set with WithProviders.
+func (o options) enrich(metadata map[string]string) (map[string]string, error) {
+	if len(o.providers) == 0 {
+		return metadata, nil
+	}
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, p := range o.providers {
+		found, err := p.Lookup(ctx, metadata)
+		if err != nil {
+			return nil, fmt.Errorf("looking up metadata: %w", err)
+		}
+		sources := make(map[string]Source, len(found))
+		for k := range found {
+			sources[k] = Source{Tag: TagProvider}
+		}
+		merged := Merge(Metadata{metadata, o.sources}, Metadata{found, sources}, o.mergePolicy, o.mergeRules...)
+		metadata = merged.Properties
+
+		if o.sources != nil {
+			for k := range o.sources {
+				delete(o.sources, k)
+			}
+			for k, s := range merged.Sources {
+				o.sources[k] = s
+			}
+		}
+	}
+	if err := o.fetchArtwork(ctx, metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// fetchArtwork fetches cover art from the first ArtworkProvider
+// that has any, if the file has none and an artwork writer was set.
+func (o options) fetchArtwork(ctx context.Context, metadata map[string]string) error {
+	if o.artwork == nil || metadata[KeyArtworks] != "" {
+		return nil
+	}
+	for _, p := range o.providers {
+		ap, ok := p.(ArtworkProvider)
+		if !ok {
+			continue
+		}
+		img, err := ap.Artwork(ctx, metadata)
+		if err != nil {
+			return fmt.Errorf("fetching artwork: %w", err)
+		}
+		if len(img) == 0 {
+			continue
+		}
+		a := artwork{PictureType: pictureTypeFrontCover, Size: int64(len(img))}
+		if len(img) > artworkSniffSize {
+			a.sniff(img[:artworkSniffSize])
+		} else {
+			a.sniff(img)
+		}
+		setArtworks(metadata, []artwork{a})
+
+		_, err = o.artwork.Write(img)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package sndtag
+
+import "strings"
+
+// commercialReceivedAs maps the "received as" byte of a COMR frame to names.
+var commercialReceivedAs = []string{
+	"Other",
+	"Standard CD album with other songs",
+	"Compressed audio on CD",
+	"File over the Internet",
+	"Stream over the Internet",
+	"As note sheets",
+	"As note sheets in a book with other sheets",
+	"Music on other media",
+	"Non-musical merchandise",
+}
+
+// decodeOwnership decodes the data of an OWNE frame, which has the price
+// paid, the date of purchase and the seller.
+func decodeOwnership(data []byte, cs charsets) map[string]string {
+	if len(data) < 2 {
+		return nil
+	}
+	enc := data[0]
+	price, rest := splitTerminated(0, data[1:])
+	if len(rest) < 8 {
+		return map[string]string{KeyPricePaid: decodeLatin1(price)}
+	}
+	return map[string]string{
+		KeyPricePaid:    decodeLatin1(price),
+		KeyPurchaseDate: formatID3v2Date(rest[:8]),
+		KeySeller:       decodeText(enc, rest[8:], cs),
+	}
+}
+
+// decodeCommercial decodes the data of a COMR frame. The seller logo is skipped.
+func decodeCommercial(data []byte, cs charsets) map[string]string {
+	if len(data) < 2 {
+		return nil
+	}
+	enc := data[0]
+	price, rest := splitTerminated(0, data[1:])
+	props := map[string]string{KeyCommercialPrice: decodeLatin1(price)}
+
+	if len(rest) < 8 {
+		return props
+	}
+	props[KeyCommercialValidUntil] = formatID3v2Date(rest[:8])
+
+	url, rest := splitTerminated(0, rest[8:])
+	props[KeyCommercialContactURL] = decodeLatin1(url)
+
+	if len(rest) == 0 {
+		return props
+	}
+	if int(rest[0]) < len(commercialReceivedAs) {
+		props[KeyCommercialReceivedAs] = commercialReceivedAs[rest[0]]
+	}
+	seller, rest := splitTerminated(enc, rest[1:])
+	desc, _ := splitTerminated(enc, rest)
+	props[KeyCommercialSeller] = decodeText(enc, seller, cs)
+	props[KeyCommercialDescription] = decodeText(enc, desc, cs)
+
+	return props
+}
+
+// formatID3v2Date formats an 8 character YYYYMMDD date as YYYY-MM-DD.
+// Dates in other formats are returned as they are.
+func formatID3v2Date(b []byte) string {
+	date := decodeLatin1(b)
+	if len(date) != 8 || strings.Trim(date, "0123456789") != "" {
+		return date
+	}
+	return date[:4] + "-" + date[4:6] + "-" + date[6:]
+}
+
+// setFrameProperties stores the properties decoded from a frame that are
+// wanted and aren't set by an earlier frame.
+func (t *id3v2) setFrameProperties(props map[string]string, source Source) {
+	for k, v := range props {
+		if _, ok := t.metadata[k]; ok || v == "" || !t.opts.wants(k) {
+			continue
+		}
+		t.metadata[k] = v
+		t.opts.setSource(k, source)
+	}
+}
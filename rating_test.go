@@ -0,0 +1,123 @@
+package sndtag
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRatingScaleHalfStars(t *testing.T) {
+	for _, tc := range []struct {
+		scale     RatingScale
+		value     byte
+		halfStars int
+
+		// halfValue is the value of halfStars, which is value only
+		// for the exact values of the scale.
+		halfValue byte
+	}{
+		{RatingScaleWMP, 0, 0, 0},
+		{RatingScaleWMP, 1, 2, 1},
+		{RatingScaleWMP, 128, 6, 128},
+		{RatingScaleWMP, 118, 4, 64},
+		{RatingScaleMediaMonkey, 13, 1, 13},
+		{RatingScaleMediaMonkey, 1, 2, 1},
+		{RatingScaleMediaMonkey, 118, 5, 118},
+		{RatingScaleMediaMonkey, 242, 9, 242},
+		{RatingScaleMediaMonkey, 255, 10, 255},
+		{RatingScaleMediaMonkey, 120, 4, 64},
+	} {
+		if got := tc.scale.HalfStars(tc.value); got != tc.halfStars {
+			t.Errorf("%s: HalfStars(%d) = %d, want %d", tc.scale.Email, tc.value, got, tc.halfStars)
+		}
+		if got := tc.scale.HalfValue(tc.halfStars); got != tc.halfValue {
+			t.Errorf("%s: HalfValue(%d) = %d, want %d", tc.scale.Email, tc.halfStars, got, tc.halfValue)
+		}
+	}
+}
+
+func TestRatingScaleHalfValue(t *testing.T) {
+	for _, tc := range []struct {
+		scale RatingScale
+
+		// values are the values of 0 to 10 half stars, and halfStars
+		// are the half stars that those values are read as.
+		values    [11]byte
+		halfStars [11]int
+	}{
+		{
+			// Half stars are rounded down.
+			RatingScaleWMP,
+			[11]byte{0, 0, 1, 1, 64, 64, 128, 128, 196, 196, 255},
+			[11]int{0, 0, 2, 2, 4, 4, 6, 6, 8, 8, 10},
+		},
+		{
+			RatingScaleMediaMonkey,
+			[11]byte{0, 13, 1, 54, 64, 118, 128, 186, 196, 242, 255},
+			[11]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		},
+	} {
+		for halfStars, want := range tc.values {
+			if got := tc.scale.HalfValue(halfStars); got != want {
+				t.Errorf("%s: HalfValue(%d) = %d, want %d", tc.scale.Email, halfStars, got, want)
+			}
+			if got := tc.scale.HalfStars(want); got != tc.halfStars[halfStars] {
+				t.Errorf("%s: HalfStars(%d) = %d, want %d", tc.scale.Email, want, got, tc.halfStars[halfStars])
+			}
+		}
+	}
+}
+
+func TestWriteRating(t *testing.T) {
+	custom := RatingScale{Email: "custom", Values: [6]byte{0, 10, 20, 30, 40, 50}}
+
+	for _, tc := range []struct {
+		name string
+		tags TagSet
+		opts []Option
+		raw  string
+		want string
+	}{
+		{"WMP", TagSet{KeyRating: "3"}, nil, "128", "3"},
+		{"WMP half star", TagSet{KeyRating: "3.5"}, nil, "128", "3"},
+		{"MediaMonkey", TagSet{KeyRatingEmail: RatingScaleMediaMonkey.Email, KeyRating: "2.5"}, nil, "118", "2.5"},
+		{"MediaMonkey whole star", TagSet{KeyRatingEmail: RatingScaleMediaMonkey.Email, KeyRating: "4"}, nil, "196", "4"},
+		{"custom", TagSet{KeyRatingEmail: "custom", KeyRating: "2"}, []Option{WithRatingScales(custom)}, "20", "2"},
+		{"unknown", TagSet{KeyRatingEmail: "custom", KeyRating: "2"}, nil, "102", "2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var dst bytes.Buffer
+			if err := Write(&dst, bytes.NewReader(testMP3(nil)), tc.tags, tc.opts...); err != nil {
+				t.Fatal(err)
+			}
+			metadata, err := NewFromBytes(dst.Bytes(), tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := metadata[KeyRatingRaw]; got != tc.raw {
+				t.Errorf("RatingRaw: got %q, want %q", got, tc.raw)
+			}
+			if got := metadata[KeyRating]; got != tc.want {
+				t.Errorf("Rating: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriteRatingEmailKeepsStars(t *testing.T) {
+	var first, second bytes.Buffer
+	tags := TagSet{KeyRatingEmail: RatingScaleMediaMonkey.Email, KeyRating: "1.5"}
+	if err := Write(&first, bytes.NewReader(testMP3(nil)), tags); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(&second, bytes.NewReader(first.Bytes()), TagSet{KeyRatingEmail: RatingScaleWMP.Email}); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := NewFromBytes(second.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// WMP has no half stars, so 1.5 stars are rounded down.
+	if got, want := metadata[KeyRatingRaw], "1"; got != want {
+		t.Errorf("RatingRaw: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package sndtag
+
+import (
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// Sample codings, as used by NIST SPHERE headers and RawFormat.
+const (
+	SampleCodingPCM  = "pcm"
+	SampleCodingULaw = "ulaw"
+	SampleCodingALaw = "alaw"
+)
+
+// RawFormat describes the audio data of a headerless file,
+// which can't be found by reading the file.
+type RawFormat struct {
+	SampleRate    int
+	NumChannels   int
+	BitsPerSample int
+
+	// SampleCoding is one of the SampleCoding constants.
+	SampleCoding string
+
+	// DataOffset is the size of a header to skip, if any.
+	DataOffset int64
+}
+
+// WithRawFormat tells New and NewFromBytes to treat files that aren't
+// recognized as headerless audio data with the given format, instead of
+// returning an error. Their properties are the same ones a WAV or
+// NIST SPHERE file has, e.g. "SampleRate" and "DataLength".
+func WithRawFormat(f RawFormat) Option {
+	return func(o *options) {
+		o.raw = &f
+	}
+}
+
+// newRaw creates a new map that contains properties for a headerless file.
+// n is the number of bytes that have already been read. The rest of the
+// file is read to find its length, unless r is an io.Seeker or in
+// probe-only mode, where the length is unknown, see WithProbeOnly.
+func newRaw(r io.Reader, n int64, o options) (map[string]string, error) {
+	var (
+		f    = *o.raw
+		size int64
+	)
+	if s, ok := r.(io.Seeker); ok {
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		size = end
+	} else if o.probeOnly {
+		size = -1
+	} else {
+		rest, err := io.Copy(ioutil.Discard, r)
+		if err != nil {
+			return nil, err
+		}
+		size = n + rest
+	}
+	return rawMetadata(size, f), nil
+}
+
+// rawMetadata returns the properties of a headerless file of the given size,
+// which is -1 if it is unknown.
+func rawMetadata(size int64, f RawFormat) map[string]string {
+	metadata := map[string]string{
+		KeyDataOffset: strconv.FormatInt(f.DataOffset, 10),
+	}
+	length := size - f.DataOffset
+	if length < 0 {
+		length = 0
+	}
+	if size >= 0 {
+		metadata[KeyDataLength] = strconv.FormatInt(length, 10)
+	}
+
+	if f.SampleCoding != "" {
+		metadata[KeySampleCoding] = f.SampleCoding
+	}
+	if f.SampleRate > 0 {
+		metadata[KeySampleRate] = strconv.Itoa(f.SampleRate)
+	}
+	if f.NumChannels > 0 {
+		metadata[KeyNumChannels] = strconv.Itoa(f.NumChannels)
+	}
+	if f.BitsPerSample > 0 {
+		metadata[KeyBitRate] = strconv.Itoa(f.BitsPerSample)
+	}
+	if frame := int64(f.NumChannels) * int64(f.BitsPerSample) / 8; frame > 0 && size >= 0 {
+		metadata[KeySampleCount] = strconv.FormatInt(length/frame, 10)
+	}
+	return metadata
+}
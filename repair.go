@@ -0,0 +1,302 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// A Fix describes something a repair fixed.
+type Fix struct {
+	// Offset is the offset in the original file of what was fixed.
+	Offset int64
+
+	Description string
+}
+
+// String returns the offset and the description of the fix.
+func (f Fix) String() string {
+	return fmt.Sprintf("%d: %s", f.Offset, f.Description)
+}
+
+// A Repair fixes a kind of corruption in a file and returns the fixed file,
+// which may share memory with b, along with what it fixed. It returns b
+// unchanged if there was nothing to fix.
+type Repair func(b []byte) ([]byte, []Fix)
+
+// RepairFile reads the file at path, applies the repairs in order, and
+// writes the file back if anything was fixed. The file is written to
+// a temporary file next to it, which is synced and renamed over it.
+// The offsets of the fixes are relative to the file as it was before
+// each repair. The file is locked while it is repaired, like WriteFile.
+func RepairFile(path string, repairs ...Repair) ([]Fix, error) {
+	unlock, err := lockPath(defaultLocker, path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	b, err := ioutil.ReadFile(osPath(path))
+	if err != nil {
+		return nil, err
+	}
+	var fixes []Fix
+	for _, repair := range repairs {
+		var fixed []Fix
+		b, fixed = repair(b)
+		fixes = append(fixes, fixed...)
+	}
+	if len(fixes) == 0 {
+		return nil, nil
+	}
+	info, err := os.Stat(osPath(path))
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := createTemp(path, info.Mode())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		discardTemp(tmp)
+		return nil, err
+	}
+	return fixes, commitBatch([]writtenFile{{path: path, tmp: tmp}}, nil)[0].Err
+}
+
+// RepairID3v2Size fixes the declared size of ID3v2 tags at the start of a
+// file when it cuts off a frame or runs into the audio data. The size is
+// set to include the frames and the padding that follows them, as long as
+// the audio data or another tag comes right after. Tags that are
+// unsynchronised as a whole or have an extended header or footer are left
+// alone.
+func RepairID3v2Size(b []byte) ([]byte, []Fix) {
+	var (
+		fixes  []Fix
+		offset int64
+	)
+	for id3v2Repairable(b[offset:]) {
+		var (
+			major    = b[offset+3]
+			declared = synchsafe(b[offset+6 : offset+10])
+			end      = offset + 10 + declared
+		)
+		_, framesEnd := id3v2FrameSpans(b, offset+10, int64(len(b)), major)
+
+		// Padding is all zeros.
+		padEnd := framesEnd
+		for padEnd < int64(len(b)) && b[padEnd] == 0 {
+			padEnd++
+		}
+		valid := end >= framesEnd && end <= int64(len(b)) && (end <= padEnd || followsTag(b, end))
+
+		if !valid && followsTag(b, padEnd) {
+			size := padEnd - offset - 10
+			fixes = append(fixes, Fix{
+				Offset:      offset,
+				Description: fmt.Sprintf("ID3v2 tag size %d changed to %d", declared, size),
+			})
+			if len(fixes) == 1 {
+				b = append([]byte(nil), b...)
+			}
+			copy(b[offset+6:offset+10], encodeSynchsafe(size))
+			end = padEnd
+		}
+		if end > int64(len(b)) {
+			break
+		}
+		offset = end
+	}
+	return b, fixes
+}
+
+// StripEmptyFrames removes the frames with no data, which aren't allowed,
+// from the ID3v2 tags at the start of a file. The size of the tags stays
+// the same, since the space of the frames is added to the padding.
+// Tags that are unsynchronised as a whole or have an extended header or
+// footer are left alone.
+func StripEmptyFrames(b []byte) ([]byte, []Fix) {
+	var (
+		fixes  []Fix
+		offset int64
+	)
+	for id3v2Repairable(b[offset:]) {
+		var (
+			major = b[offset+3]
+			end   = offset + 10 + synchsafe(b[offset+6:offset+10])
+		)
+		if end > int64(len(b)) {
+			break
+		}
+		spans, framesEnd := id3v2FrameSpans(b, offset+10, end, major)
+
+		var (
+			frames  bytes.Buffer
+			removed int
+		)
+		for _, span := range spans {
+			if span.size > 0 {
+				frames.Write(b[span.offset : span.offset+span.headerSize+span.size])
+				continue
+			}
+			fixes = append(fixes, Fix{
+				Offset:      span.offset,
+				Description: fmt.Sprintf("removed empty ID3v2 frame %q", b[span.offset:span.offset+span.idSize]),
+			})
+			removed += int(span.headerSize)
+		}
+		if removed > 0 {
+			frames.Write(make([]byte, removed))
+
+			fixed := append([]byte(nil), b[:offset+10]...)
+			fixed = append(fixed, frames.Bytes()...)
+			b = append(fixed, b[framesEnd:]...)
+		}
+		offset = end
+	}
+	return b, fixes
+}
+
+// RemoveDuplicateID3v1 removes the ID3v1 tags that come right before the
+// ID3v1 tag at the end of a file, which some taggers append instead of
+// replacing the existing tag. The last tag is kept, since it is the one
+// that readers use.
+func RemoveDuplicateID3v1(b []byte) ([]byte, []Fix) {
+	var fixes []Fix
+
+	for n := len(b); n >= 2*id3v1Size; n = len(b) {
+		last, previous := b[n-id3v1Size:], b[n-2*id3v1Size:n-id3v1Size]
+		if !bytes.HasPrefix(last, []byte("TAG")) || !bytes.HasPrefix(previous, []byte("TAG")) {
+			break
+		}
+		fixes = append(fixes, Fix{
+			Offset:      int64(n - 2*id3v1Size),
+			Description: "removed duplicate ID3v1 tag",
+		})
+		b = append(b[:n-2*id3v1Size:n-2*id3v1Size], last...)
+	}
+	return b, fixes
+}
+
+// RepairRIFFSize fixes the size of a RIFF file when it doesn't match the
+// chunks in the file, e.g. because the file was truncated or the size was
+// never filled in. The last chunk is shortened if it runs past the end of
+// the file. An ID3v1 tag after the chunks is left out of the size.
+func RepairRIFFSize(b []byte) ([]byte, []Fix) {
+	if len(b) < 12 || string(b[:4]) != "RIFF" {
+		return b, nil
+	}
+	var (
+		fixes  []Fix
+		fixed  = b
+		offset = int64(12)
+		size   = int64(len(b))
+	)
+	fix := func(at int64, length uint32, description string) {
+		if len(fixes) == 0 {
+			fixed = append([]byte(nil), b...)
+		}
+		fixes = append(fixes, Fix{Offset: at, Description: description})
+		binary.LittleEndian.PutUint32(fixed[at:], length)
+	}
+	for offset+8 <= size {
+		if size-offset == id3v1Size && string(b[offset:offset+3]) == "TAG" {
+			break
+		}
+		length := int64(binary.LittleEndian.Uint32(b[offset+4 : offset+8]))
+		if offset+8+length > size {
+			fix(offset+4, uint32(size-offset-8), fmt.Sprintf("%q chunk length %d changed to %d", b[offset:offset+4], length, size-offset-8))
+			length = size - offset - 8
+		}
+		offset += 8 + length + length%2
+	}
+	if offset > size {
+		// The pad byte of the last chunk is missing.
+		offset = size
+	}
+	declared := int64(binary.LittleEndian.Uint32(b[4:8]))
+	if declared != offset-8 {
+		fix(4, uint32(offset-8), fmt.Sprintf("RIFF size %d changed to %d", declared, offset-8))
+	}
+	return fixed, fixes
+}
+
+// id3v2Repairable reports whether b starts with an ID3v2 tag that the
+// repairs know how to walk.
+func id3v2Repairable(b []byte) bool {
+	if len(b) < 10 || string(b[:3]) != "ID3" || b[3] < 2 || b[3] > 4 {
+		return false
+	}
+	return b[5]&(id3v2FlagUnsync|id3v2FlagExtendedHeader|id3v2FlagFooter) == 0
+}
+
+// id3v2FrameSpan is the location of a frame in a file.
+type id3v2FrameSpan struct {
+	offset     int64
+	headerSize int64
+	idSize     int64
+	size       int64
+}
+
+// id3v2FrameSpans returns the frames of a tag from offset up to end,
+// ignoring the declared size of the tag, and the offset after the last
+// frame. It stops at the padding, at a frame with an invalid ID and at
+// a frame that runs past end.
+func id3v2FrameSpans(b []byte, offset, end int64, major byte) ([]id3v2FrameSpan, int64) {
+	var (
+		spans      []id3v2FrameSpan
+		headerSize = int64(10)
+		idSize     = int64(4)
+	)
+	if major == 2 {
+		headerSize, idSize = 6, 3
+	}
+	for offset+headerSize <= end {
+		header := b[offset : offset+headerSize]
+		if !validFrameID(header[:idSize]) {
+			break
+		}
+		var size int64
+		switch major {
+		case 2:
+			size = int64(header[3])<<16 | int64(header[4])<<8 | int64(header[5])
+		case 3:
+			size = int64(binary.BigEndian.Uint32(header[4:8]))
+		case 4:
+			size = synchsafe(header[4:8])
+		}
+		if offset+headerSize+size > end {
+			break
+		}
+		spans = append(spans, id3v2FrameSpan{offset: offset, headerSize: headerSize, idSize: idSize, size: size})
+		offset += headerSize + size
+	}
+	return spans, offset
+}
+
+// validFrameID reports whether id is made of capital letters and digits.
+func validFrameID(id []byte) bool {
+	for _, c := range id {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// followsTag reports whether the data at offset in a file looks like
+// what can come after an ID3v2 tag: audio data, another tag, or nothing.
+func followsTag(b []byte, offset int64) bool {
+	if offset >= int64(len(b)) {
+		return offset == int64(len(b))
+	}
+	rest := b[offset:]
+	for _, prefix := range []string{"ID3", "TAG", "APETAGEX", "RIFF"} {
+		if bytes.HasPrefix(rest, []byte(prefix)) {
+			return true
+		}
+	}
+	return isMPEGSync(rest)
+}
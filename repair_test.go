@@ -0,0 +1,187 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withID3v2Size returns a copy of a file with the declared size of the
+// ID3v2 tag at its start set to size.
+func withID3v2Size(b []byte, size int64) []byte {
+	b = append([]byte(nil), b...)
+	copy(b[6:10], encodeSynchsafe(size))
+	return b
+}
+
+// withLength returns a copy of a file with the length of the chunk at
+// offset set to length.
+func withLength(b []byte, offset int, length uint32) []byte {
+	b = append([]byte(nil), b...)
+	binary.LittleEndian.PutUint32(b[offset+4:], length)
+	return b
+}
+
+func TestRepairs(t *testing.T) {
+	var (
+		title = testTextFrame(ID3v2FrameTitle, "Title")
+		mp3   = testMP3(testID3v2(3, title))
+		wav   = testWav()
+		v1    = testID3v1("Title")
+	)
+	for _, tc := range []struct {
+		name   string
+		repair Repair
+		file   []byte
+		want   []byte
+		fixes  []int64
+	}{
+		{
+			name:   "ID3v2 size cuts off a frame",
+			repair: RepairID3v2Size,
+			file:   withID3v2Size(mp3, 5),
+			want:   mp3,
+			fixes:  []int64{0},
+		},
+		{
+			name:   "ID3v2 size runs into the audio",
+			repair: RepairID3v2Size,
+			file:   withID3v2Size(mp3, 200),
+			want:   mp3,
+			fixes:  []int64{0},
+		},
+		{
+			name:   "second ID3v2 size",
+			repair: RepairID3v2Size,
+			file:   append(testID3v2(3, title), withID3v2Size(mp3, 5)...),
+			want:   append(testID3v2(3, title), mp3...),
+			fixes:  []int64{int64(len(testID3v2(3, title)))},
+		},
+		{
+			name:   "valid ID3v2 size",
+			repair: RepairID3v2Size,
+			file:   mp3,
+			want:   mp3,
+		},
+		{
+			name:   "empty frames",
+			repair: StripEmptyFrames,
+			file:   testMP3(testID3v2(3, testFrame(ID3v2FrameArtist, nil), title, testFrame(ID3v2FrameAlbum, nil))),
+			want:   testMP3(testID3v2(3, title, make([]byte, 20))),
+			fixes:  []int64{10, 10 + 10 + int64(len(title))},
+		},
+		{
+			name:   "ID3v2.2 empty frames",
+			repair: StripEmptyFrames,
+			file:   testMP3(testID3v2(2, testID3v22Frame("TT2", nil), testID3v22Frame("TP1", []byte("\x00Artist")))),
+			want:   testMP3(testID3v2(2, testID3v22Frame("TP1", []byte("\x00Artist")), make([]byte, 6))),
+			fixes:  []int64{10},
+		},
+		{
+			name:   "no empty frames",
+			repair: StripEmptyFrames,
+			file:   mp3,
+			want:   mp3,
+		},
+		{
+			name:   "duplicate ID3v1 tags",
+			repair: RemoveDuplicateID3v1,
+			file:   append(append(append(testMP3(nil), testID3v1("Old")...), testID3v1("Older")...), v1...),
+			want:   append(testMP3(nil), v1...),
+			fixes:  []int64{417 + 128, 417},
+		},
+		{
+			name:   "single ID3v1 tag",
+			repair: RemoveDuplicateID3v1,
+			file:   append(testMP3(nil), v1...),
+			want:   append(testMP3(nil), v1...),
+		},
+		{
+			name:   "RIFF size",
+			repair: RepairRIFFSize,
+			file:   withLength(wav, 0, 0),
+			want:   wav,
+			fixes:  []int64{4},
+		},
+		{
+			name:   "truncated data chunk",
+			repair: RepairRIFFSize,
+			file:   wav[:len(wav)-100],
+			want:   withLength(withLength(wav[:len(wav)-100], 0, uint32(len(wav)-108)), 36, 300),
+			fixes:  []int64{40, 4},
+		},
+		{
+			name:   "RIFF size with ID3v1",
+			repair: RepairRIFFSize,
+			file:   append(withLength(wav, 0, uint32(len(wav)+120)), v1...),
+			want:   append(wav, v1...),
+			fixes:  []int64{4},
+		},
+		{
+			name:   "valid RIFF size",
+			repair: RepairRIFFSize,
+			file:   wav,
+			want:   wav,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			original := append([]byte(nil), tc.file...)
+			got, fixes := tc.repair(tc.file)
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("got\n%x\nwant\n%x", got, tc.want)
+			}
+			if len(fixes) != len(tc.fixes) {
+				t.Fatalf("got fixes %v, want offsets %v", fixes, tc.fixes)
+			}
+			for i, fix := range fixes {
+				if fix.Offset != tc.fixes[i] || fix.Description == "" {
+					t.Errorf("fix %d: got %v, want offset %d", i, fix, tc.fixes[i])
+				}
+			}
+			if !bytes.Equal(tc.file, original) {
+				t.Error("the input was modified")
+			}
+		})
+	}
+}
+
+func TestRepairFile(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		path   = filepath.Join(dir, "file.mp3")
+		mp3    = testMP3(testID3v2(3, testTextFrame(ID3v2FrameTitle, "Title")))
+		broken = append(withID3v2Size(mp3, 5), testID3v1("Old")...)
+	)
+	broken = append(broken, testID3v1("New")...)
+	if err := os.WriteFile(path, broken, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fixes, err := RepairFile(path, RepairID3v2Size, RemoveDuplicateID3v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixes) != 2 {
+		t.Errorf("got fixes %v", fixes)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(mp3, testID3v1("New")...); !bytes.Equal(got, want) {
+		t.Errorf("got\n%x\nwant\n%x", got, want)
+	}
+
+	// A file with nothing to fix isn't rewritten.
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixes, err := RepairFile(path, RepairID3v2Size, RemoveDuplicateID3v1); err != nil || len(fixes) != 0 {
+		t.Errorf("got %v, %v", fixes, err)
+	}
+	if again, err := os.Stat(path); err != nil || !os.SameFile(info, again) {
+		t.Error("the file was replaced")
+	}
+}
@@ -0,0 +1,144 @@
+// Package riff reads and writes the chunks of RIFF files, the container of
+// WAV files and of other formats like AVI, ANI, WebP and SoundFont 2.
+//
+// A RIFF file is a "RIFF" chunk whose data starts with a form type, e.g.
+// "WAVE", followed by subchunks. Every chunk has a four-character ID, the
+// length of its data as a little-endian 32-bit number, and its data,
+// followed by a pad byte if the length is odd. LIST chunks hold subchunks
+// too, after a list type, e.g. "INFO".
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A Chunk is a chunk of a RIFF file.
+type Chunk struct {
+	ID string
+
+	// Length is the length of the data, without the pad byte.
+	// It is unsigned, so chunks of 2 GB or more can be read.
+	Length uint32
+
+	// Offset is the offset of the chunk header in the file.
+	// It is only set by a Walker.
+	Offset int64
+
+	// NoPad is set by a Walker on chunks with an odd length whose pad
+	// byte is missing, see MissingPad.
+	NoPad bool
+}
+
+// Size returns the number of bytes the chunk takes up, including
+// the chunk header and the pad byte, if it has one.
+func (c Chunk) Size() int64 {
+	if c.NoPad {
+		return 8 + int64(c.Length)
+	}
+	return 8 + int64(c.Length) + int64(c.Length&1)
+}
+
+// ReadChunk reads a chunk header from r and returns the chunk and
+// a reader of its data. The pad byte isn't read, see SkipPadByte.
+func ReadChunk(r io.Reader) (Chunk, io.Reader, error) {
+	var c Chunk
+
+	id, err := ReadFourCC(r)
+	if err != nil {
+		return c, nil, err
+	}
+	c.ID = id
+
+	if err := binary.Read(r, binary.LittleEndian, &c.Length); err != nil {
+		return c, nil, err
+	}
+	return c, io.LimitReader(r, int64(c.Length)), nil
+}
+
+// ReadFourCC reads a chunk ID. io.EOF is returned if r is at its end.
+func ReadFourCC(r io.Reader) (string, error) {
+	id := make([]byte, 4)
+
+	n, err := io.ReadFull(r, id)
+	if err == io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("expected to read %d bytes, actually read %d", len(id), n)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(id), nil
+}
+
+// ExpectFourCC reads a chunk ID and checks it against an expected one.
+func ExpectFourCC(r io.Reader, expected string) error {
+	id, err := ReadFourCC(r)
+	if err != nil {
+		return err
+	}
+	if id != expected {
+		return fmt.Errorf("expected chunk ID %s, got %s", expected, id)
+	}
+	return nil
+}
+
+// SkipPadByte skips the pad byte after the data of a chunk of the given
+// length, if it has one. A missing pad byte is not an error, since many
+// writers leave it out: at the end of a file nothing is read, and before
+// the next chunk the byte read is put back, see MissingPad. Putting it back
+// needs r to be an io.ByteScanner or an io.Seeker; with other readers a
+// missing pad byte before the next chunk is an error.
+func SkipPadByte(r io.Reader, length uint32) error {
+	if length%2 == 0 {
+		return nil
+	}
+	if bs, ok := r.(io.ByteScanner); ok {
+		b, err := bs.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil || !MissingPad(b) {
+			return err
+		}
+		return bs.UnreadByte()
+	}
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	if !MissingPad(b[0]) {
+		return nil
+	}
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(-1, io.SeekCurrent)
+		return err
+	}
+	return fmt.Errorf("missing pad byte before a chunk starting with %q", b[0])
+}
+
+// MissingPad reports whether b, the byte after the data of a chunk with an
+// odd length, starts the ID of the next chunk instead of being its pad
+// byte, as some encoders leave the pad byte out. Pad bytes should be zero,
+// but since some encoders write garbage instead, only a printable ASCII
+// character, which chunk IDs are made of, is taken to start a chunk ID.
+func MissingPad(b byte) bool {
+	return b >= 0x20 && b <= 0x7e
+}
+
+// EncodeChunk encodes a chunk, including the pad byte if needed.
+func EncodeChunk(id string, data []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(id)
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,128 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// unpadded encodes a chunk without its pad byte.
+func unpadded(id string, data []byte) []byte {
+	b := []byte(id)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// riffChunk encodes a RIFF chunk of a form type with subchunks.
+func riffChunk(form string, subchunks ...[]byte) []byte {
+	data := []byte(form)
+	for _, c := range subchunks {
+		data = append(data, c...)
+	}
+	return unpadded("RIFF", data)
+}
+
+func TestSkipPadByte(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		length uint32
+		rest   string
+		plain  bool
+		want   string
+		err    bool
+	}{
+		{name: "even", length: 2, rest: "next", want: "next"},
+		{name: "pad", length: 1, rest: "\x00next", want: "next"},
+		{name: "garbage pad", length: 1, rest: "\xffnext", want: "next"},
+		{name: "end", length: 1, rest: ""},
+		{name: "missing", length: 1, rest: "next", want: "next"},
+		{name: "missing, plain reader", length: 1, rest: "next", plain: true, err: true},
+		{name: "pad, plain reader", length: 1, rest: "\x00next", plain: true, want: "next"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var r io.Reader = bytes.NewReader([]byte(tc.rest))
+			if tc.plain {
+				r = struct{ io.Reader }{r}
+			}
+			err := SkipPadByte(r, tc.length)
+			if tc.err {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rest) != tc.want {
+				t.Errorf("got %q left, want %q", rest, tc.want)
+			}
+		})
+	}
+}
+
+func TestWalker(t *testing.T) {
+	type chunk struct {
+		id     string
+		length uint32
+		noPad  bool
+	}
+	for _, tc := range []struct {
+		name string
+		file []byte
+		want []chunk
+	}{
+		{
+			name: "padded",
+			file: riffChunk("WAVE", EncodeChunk("odd ", []byte("abc")), EncodeChunk("last", []byte("a"))),
+			want: []chunk{{"odd ", 3, false}, {"last", 1, false}},
+		},
+		{
+			name: "missing pad",
+			file: riffChunk("WAVE", unpadded("odd ", []byte("abc")), EncodeChunk("next", []byte("ab"))),
+			want: []chunk{{"odd ", 3, true}, {"next", 2, false}},
+		},
+		{
+			name: "odd final chunk",
+			file: riffChunk("WAVE", EncodeChunk("data", []byte("ab")), unpadded("last", []byte("abc"))),
+			want: []chunk{{"data", 2, false}, {"last", 3, true}},
+		},
+		{
+			// The RIFF length doesn't count the pad byte after it.
+			name: "pad after the RIFF chunk",
+			file: append(riffChunk("WAVE", unpadded("last", []byte("abc"))), 0),
+			want: []chunk{{"last", 3, true}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := NewWalker(bytes.NewReader(tc.file), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []chunk
+			for {
+				c, err := w.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, chunk{c.ID, c.Length, c.NoPad})
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("chunk %d: got %v, want %v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package riff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A Walker finds the subchunks of a RIFF or LIST chunk without reading
+// their data, e.g. to rewrite some of them and copy the others.
+type Walker struct {
+	// Form is the form type of a RIFF chunk, e.g. "WAVE",
+	// or the list type of a LIST chunk, e.g. "INFO".
+	Form string
+
+	rs          io.ReadSeeker
+	offset, end int64
+}
+
+// NewWalker reads the header of the RIFF or LIST chunk at offset base of rs.
+func NewWalker(rs io.ReadSeeker, base int64) (*Walker, error) {
+	var header struct {
+		ID     [4]byte
+		Length uint32
+		Form   [4]byte
+	}
+	if _, err := rs.Seek(base, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(rs, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if id := string(header.ID[:]); id != "RIFF" && id != "LIST" {
+		return nil, fmt.Errorf("expected RIFF or LIST chunk, got %s", id)
+	}
+	return &Walker{
+		Form:   string(header.Form[:]),
+		rs:     rs,
+		offset: base + 12,
+		end:    base + 8 + int64(header.Length),
+	}, nil
+}
+
+// Next returns the next subchunk, or io.EOF after the last one.
+// Like SkipPadByte, it tolerates a missing pad byte, see Chunk.NoPad.
+func (w *Walker) Next() (Chunk, error) {
+	if w.offset+8 > w.end {
+		return Chunk{}, io.EOF
+	}
+	if _, err := w.rs.Seek(w.offset, io.SeekStart); err != nil {
+		return Chunk{}, err
+	}
+	var header struct {
+		ID     [4]byte
+		Length uint32
+	}
+	if err := binary.Read(w.rs, binary.LittleEndian, &header); err != nil {
+		return Chunk{}, err
+	}
+	c := Chunk{ID: string(header.ID[:]), Length: header.Length, Offset: w.offset}
+	if c.Length%2 == 1 {
+		missing, err := w.missingPad(c)
+		if err != nil {
+			return Chunk{}, err
+		}
+		c.NoPad = missing
+	}
+	w.offset += c.Size()
+	return c, nil
+}
+
+// missingPad reports whether the pad byte of a chunk with an odd length is
+// missing, because the chunk ends the file or its parent chunk, or because
+// the next chunk starts right after its data.
+func (w *Walker) missingPad(c Chunk) (bool, error) {
+	pad := c.Offset + 8 + int64(c.Length)
+	if pad >= w.end {
+		return true, nil
+	}
+	if _, err := w.rs.Seek(pad, io.SeekStart); err != nil {
+		return false, err
+	}
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(w.rs, b); err != nil {
+		if err == io.EOF {
+			return true, nil
+		}
+		return false, err
+	}
+	return MissingPad(b[0]), nil
+}
+
+// Data returns a reader of the data of a chunk that Next returned.
+// It reads from the same io.ReadSeeker, so it must be used before Next
+// is called again.
+func (w *Walker) Data(c Chunk) (io.Reader, error) {
+	if _, err := w.rs.Seek(c.Offset+8, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.LimitReader(w.rs, int64(c.Length)), nil
+}
@@ -0,0 +1,58 @@
+package riff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A Writer writes a RIFF file. The length of the RIFF chunk comes before
+// its subchunks, so the subchunks are known before the file is written,
+// and the Writer doesn't need to seek or to hold them in memory.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter writes the header of a RIFF chunk with a form type, e.g.
+// "WAVE", whose subchunks take up size bytes, see Chunk.Size.
+func NewWriter(w io.Writer, form string, size int64) (*Writer, error) {
+	length := 4 + size
+	if length > 0xffffffff {
+		return nil, fmt.Errorf("RIFF chunk length %d does not fit in 32 bits", length)
+	}
+	if _, err := io.WriteString(w, "RIFF"); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(length)); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, form); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteChunk writes a subchunk.
+func (w *Writer) WriteChunk(id string, data []byte) error {
+	_, err := w.w.Write(EncodeChunk(id, data))
+	return err
+}
+
+// CopyChunk writes a subchunk whose data is read from r, e.g. audio data
+// that is too large to hold in memory.
+func (w *Writer) CopyChunk(id string, length uint32, r io.Reader) error {
+	if _, err := io.WriteString(w.w, id); err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, length); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w.w, r, int64(length)); err != nil {
+		return err
+	}
+	if length%2 == 1 {
+		_, err := w.w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package sndtag
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrMalformed is wrapped by the error that New and NewFromBytes return
+// when a file is malformed in a way that a parser doesn't check for.
+//
+// The parsers are meant to degrade gracefully on invalid, truncated and
+// crafted files: they return an error instead of panicking, they always
+// move forward in the file so they can't hang, and they don't allocate
+// more memory up front than the file can hold, no matter the sizes the
+// file declares. WithReadLimit and WithMaxDepth bound the work done for
+// untrusted input further. Use "sndtag check" to run the parsers over a
+// corpus of such files.
+var ErrMalformed = errors.New("malformed file")
+
+// malformed returns the error for a panic in a parser.
+func malformed(r interface{}) error {
+	return fmt.Errorf("%w: %v", ErrMalformed, r)
+}
+
+// readSizeStep is how much readN allocates at a time.
+const readSizeStep = 1 << 20
+
+// readN reads n bytes from r. Unlike io.ReadFull with a buffer of n bytes,
+// it grows the buffer as the data comes in, so a size declared by a
+// truncated file doesn't allocate more than the file holds.
+func readN(r io.Reader, n int64) ([]byte, error) {
+	if n <= readSizeStep {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	var buf bytes.Buffer
+	buf.Grow(readSizeStep)
+
+	read, err := io.CopyN(&buf, r, n)
+	if err == io.EOF {
+		if read == 0 {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,141 @@
+package sndtag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// corruptFiles are the files in testdata/corrupt and whether New and
+// NewFromBytes fail to parse them. Some of them are unusual but valid.
+var corruptFiles = []struct {
+	name     string
+	newErr   bool
+	bytesErr bool
+}{
+	{name: "apev2-huge.mp3"},
+	{name: "empty.bin", newErr: true, bytesErr: true},
+	{name: "id3v1-only.mp3"},
+	{name: "id3v2-empty.mp3"},
+	{name: "id3v2-frame-overrun.mp3", newErr: true, bytesErr: true},
+	{name: "id3v2-huge-size.mp3", newErr: true, bytesErr: true},
+	{name: "id3v2-unsync-end.mp3"},
+	{name: "midi-huge-track.mid", newErr: true, bytesErr: true},
+	{name: "mkv-truncated-element.mka", newErr: true, bytesErr: true},
+	{name: "mkv-unknown-size.mka", newErr: true, bytesErr: true},
+	{name: "monkeys-truncated.ape", newErr: true, bytesErr: true},
+	{name: "mp4-deep.m4a", newErr: true, bytesErr: true},
+	{name: "mp4-item-truncated.m4a", newErr: true, bytesErr: true},
+	// New reads atoms that run past the end of the stream up to the end,
+	// like a truncated file, while NewFromBytes checks their sizes first.
+	{name: "mp4-large-size.m4a", bytesErr: true},
+	{name: "mp4-small-size.m4a", newErr: true, bytesErr: true},
+	{name: "musepack-truncated.mpc", newErr: true, bytesErr: true},
+	{name: "riff-cue-count.wav", newErr: true, bytesErr: true},
+	{name: "riff-huge-chunk.wav", newErr: true, bytesErr: true},
+	{name: "riff-info-overrun.wav", newErr: true, bytesErr: true},
+	{name: "riff-odd-no-pad.wav"},
+	{name: "riff-short-fmt.wav", newErr: true, bytesErr: true},
+	{name: "riff-zero-length.wav"},
+	{name: "sphere-bad-size.sph", newErr: true, bytesErr: true},
+	{name: "tiny.bin", newErr: true, bytesErr: true},
+	{name: "xm-truncated.xm", newErr: true, bytesErr: true},
+}
+
+func TestCorruptFiles(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "corrupt", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != len(corruptFiles) {
+		t.Fatalf("got %d corrupt files, want %d", len(paths), len(corruptFiles))
+	}
+	const (
+		readLimit = 1 << 20
+		memLimit  = 4 << 20
+	)
+	for _, tc := range corruptFiles {
+		b, err := os.ReadFile(filepath.Join("testdata", "corrupt", tc.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The file itself, then truncated copies of it, which only have
+		// to fail cleanly.
+		const copies = 4
+		for i := copies; i >= 0; i-- {
+			data := b[:len(b)*i/copies]
+			t.Run(fmt.Sprintf("%s[:%d]", tc.name, len(data)), func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				var stats ParseStats
+				for _, p := range []struct {
+					name  string
+					parse func() error
+					err   bool
+				}{
+					{"New", func() error {
+						_, err := New(bytes.NewReader(data), WithContext(ctx), WithReadLimit(readLimit), WithStats(&stats))
+						return err
+					}, tc.newErr},
+					{"NewFromBytes", func() error {
+						_, err := NewFromBytes(data, WithContext(ctx), WithReadLimit(readLimit))
+						return err
+					}, tc.bytesErr},
+				} {
+					var before, after runtime.MemStats
+					runtime.ReadMemStats(&before)
+					err := p.parse()
+					runtime.ReadMemStats(&after)
+
+					// Errors are expected, but not panics or hangs.
+					if errors.Is(err, ErrMalformed) || errors.Is(err, context.DeadlineExceeded) {
+						t.Errorf("%s: %s", p.name, err)
+					}
+					if i == copies && (err != nil) != p.err {
+						t.Errorf("%s: got error %v, want an error: %t", p.name, err, p.err)
+					}
+					if allocated := after.TotalAlloc - before.TotalAlloc; allocated > memLimit {
+						t.Errorf("%s: allocated %d bytes", p.name, allocated)
+					}
+				}
+				if stats.BytesRead > readLimit {
+					t.Errorf("New read %d bytes", stats.BytesRead)
+				}
+			})
+		}
+	}
+}
+
+func TestReadN(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data int
+		n    int64
+		err  error
+	}{
+		{"small", 10, 10, nil},
+		{"large", 3 << 20, 3 << 20, nil},
+		{"empty", 0, 10, io.EOF},
+		{"small truncated", 5, 10, io.ErrUnexpectedEOF},
+		{"large truncated", 10, 1 << 40, io.ErrUnexpectedEOF},
+		{"large empty", 0, 1 << 40, io.EOF},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := readN(bytes.NewReader(make([]byte, tc.data)), tc.n)
+			if err != tc.err {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if err == nil && int64(len(b)) != tc.n {
+				t.Errorf("read %d bytes, want %d", len(b), tc.n)
+			}
+		})
+	}
+}
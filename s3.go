@@ -0,0 +1,307 @@
+package sndtag
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3RangeSize is the size of the range requests of opened objects.
+const s3RangeSize = 256 << 10
+
+// emptySHA256 is the hex-encoded SHA-256 of an empty request body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Store is a Store with the objects in a bucket of an S3-compatible
+// object storage service, e.g. Amazon S3, Google Cloud Storage (with HMAC
+// keys and the https://storage.googleapis.com endpoint) or MinIO.
+// Requests are signed with AWS Signature Version 4, or sent anonymously
+// if there is no access key.
+//
+// Opened objects are read with range requests of up to 256 KiB, so only
+// the parts of a file that are read are downloaded, rounded up to that,
+// e.g. the tags at the start and the end of an MP3 file. Reading the
+// metadata of some formats reads most of the file, though.
+type S3Store struct {
+	// Endpoint is the URL of the service, e.g. "https://s3.us-east-1.amazonaws.com".
+	Endpoint string
+
+	// Region is the region used to sign requests, e.g. "us-east-1".
+	// Services that don't have regions usually accept "auto" or "us-east-1".
+	Region string
+
+	Bucket string
+
+	// Prefix limits the objects to the ones whose keys start with it.
+	Prefix string
+
+	AccessKey string
+	SecretKey string
+
+	// VirtualHosted puts the bucket in the host name, as in
+	// https://bucket.s3.amazonaws.com/key, instead of the path.
+	VirtualHosted bool
+
+	// Client is the HTTP client to use, http.DefaultClient if it is nil.
+	Client *http.Client
+}
+
+// s3ListResult is the response of a ListObjectsV2 request.
+type s3ListResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key  string
+		Size int64
+	}
+}
+
+// List calls fn for every object in the bucket that starts with the prefix.
+func (s *S3Store) List(ctx context.Context, fn func(Object) error) error {
+	var token string
+
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if s.Prefix != "" {
+			query.Set("prefix", s.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, "", query, nil)
+		if err != nil {
+			return err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, c := range result.Contents {
+			if strings.HasSuffix(c.Key, "/") {
+				continue
+			}
+			if err := fn(Object{Key: c.Key, Size: c.Size}); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Open opens an object. The returned io.ReadCloser is also an io.Seeker.
+func (s *S3Store) Open(ctx context.Context, obj Object) (io.ReadCloser, error) {
+	return &s3Object{ctx: ctx, store: s, obj: obj}, nil
+}
+
+// s3Object reads an object with range requests of s3RangeSize bytes.
+// A request is made on the first read after opening or seeking, and
+// when the previous range has been read.
+type s3Object struct {
+	ctx   context.Context
+	store *S3Store
+	obj   Object
+	pos   int64
+	body  io.ReadCloser
+}
+
+// Read reads from the object at the current position.
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.pos >= o.obj.Size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		end := o.pos + s3RangeSize
+		if end > o.obj.Size {
+			end = o.obj.Size
+		}
+		header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", o.pos, end-1)}}
+
+		resp, err := o.store.do(o.ctx, o.obj.Key, nil, header)
+		if err != nil {
+			return 0, err
+		}
+		o.body = resp.Body
+	}
+	n, err := o.body.Read(p)
+	o.pos += int64(n)
+	if err == io.EOF && o.pos < o.obj.Size {
+		// The range has been read, the next read requests another one.
+		err = o.Close()
+	}
+	return n, err
+}
+
+// Seek sets the position of the next read.
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.pos
+	case io.SeekEnd:
+		offset += o.obj.Size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("s3: seek to negative offset %d", offset)
+	}
+	if offset != o.pos {
+		o.Close()
+		o.pos = offset
+	}
+	return offset, nil
+}
+
+// Close closes the response body of the current range request.
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+// do sends a signed GET request for an object, or for the bucket
+// if key is empty. Responses that aren't successful are errors.
+func (s *S3Store) do(ctx context.Context, key string, query url.Values, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	// The endpoint can have a path, e.g. behind a reverse proxy.
+	// Keys are appended as they are, since they can have "//" or "..".
+	prefix := path.Join("/", u.Path)
+	if s.VirtualHosted {
+		u.Host = s.Bucket + "." + u.Host
+	} else {
+		prefix = path.Join(prefix, s.Bucket)
+	}
+	u.Path = strings.TrimSuffix(prefix, "/") + "/" + key
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3Query(query)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, time.Now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3: GET %s: %s: %s", u.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// sign signs a GET request with AWS Signature Version 4.
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html.
+func (s *S3Store) sign(req *http.Request, now time.Time) {
+	if s.AccessKey == "" {
+		return
+	}
+	var (
+		amzDate = now.Format("20060102T150405Z")
+		date    = now.Format("20060102")
+		scope   = date + "/" + s.Region + "/s3/aws4_request"
+		signed  = "host;x-amz-content-sha256;x-amz-date"
+	)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + emptySHA256,
+		"x-amz-date:" + amzDate,
+		"",
+		signed,
+		emptySHA256,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Query returns a query string with the keys sorted and the keys and
+// values escaped the way Signature Version 4 expects.
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes every byte of s except the unreserved characters,
+// and slashes unless escapeSlash is set.
+func s3Escape(s string, escapeSlash bool) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			sb.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,87 @@
+package sndtag
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestS3StoreOpen(t *testing.T) {
+	data := make([]byte, 600<<10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.EscapedPath()+" "+r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name     string
+		endpoint string
+		key      string
+		read     func(r io.ReadSeeker) ([]byte, error)
+		want     []byte
+		requests []string
+	}{
+		{
+			name:     "tail",
+			endpoint: srv.URL,
+			key:      "music/a.mp3",
+			read: func(r io.ReadSeeker) ([]byte, error) {
+				if _, err := r.Seek(-128, io.SeekEnd); err != nil {
+					return nil, err
+				}
+				return io.ReadAll(r)
+			},
+			want:     data[len(data)-128:],
+			requests: []string{"/bucket/music/a.mp3 bytes=614272-614399"},
+		},
+		{
+			name:     "whole",
+			endpoint: srv.URL + "/minio/",
+			key:      "a//b.mp3",
+			read:     func(r io.ReadSeeker) ([]byte, error) { return io.ReadAll(r) },
+			want:     data,
+			requests: []string{
+				"/minio/bucket/a//b.mp3 bytes=0-262143",
+				"/minio/bucket/a//b.mp3 bytes=262144-524287",
+				"/minio/bucket/a//b.mp3 bytes=524288-614399",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = nil
+			s := &S3Store{Endpoint: tc.endpoint, Region: "us-east-1", Bucket: "bucket"}
+			rc, err := s.Open(context.Background(), Object{Key: tc.key, Size: int64(len(data))})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+
+			got, err := tc.read(rc.(io.ReadSeeker))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("read %d bytes, want %d", len(got), len(tc.want))
+			}
+			if strings.Join(requests, "\n") != strings.Join(tc.requests, "\n") {
+				t.Errorf("got requests\n%s\nwant\n%s", strings.Join(requests, "\n"), strings.Join(tc.requests, "\n"))
+			}
+		})
+	}
+}
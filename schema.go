@@ -0,0 +1,117 @@
+package sndtag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the version of the property keys that New returns.
+//
+// Within a schema version, the keys defined in this package, and the
+// meaning and format of their values, don't change: new formats and
+// properties may add keys, but keys are never renamed or removed. Renaming
+// or removing a key bumps the version, and the change is recorded so that
+// MigrateSchema can rename the keys of properties that were stored with an
+// earlier version. Applications that index properties by key can store the
+// version with them, see WithSchemaVersion, and migrate them on upgrade.
+//
+// Version 1 is the keys as of the introduction of schema versions.
+const SchemaVersion = 1
+
+// schemaRename is a key that was renamed by a schema version.
+type schemaRename struct {
+	from, to string
+}
+
+// schemaChanges are the keys renamed by each schema version after the first,
+// by version. A key that was removed is renamed to "".
+var schemaChanges = map[int][]schemaRename{}
+
+// WithSchemaVersion adds the schema version of the keys, see SchemaVersion,
+// to the properties as KeySchemaVersion.
+func WithSchemaVersion() Option {
+	return func(o *options) {
+		o.schemaVersion = true
+	}
+}
+
+// MigrateSchema returns the properties with the keys of schema version from
+// renamed to the keys of schema version to, which may be earlier, e.g. to
+// reindex properties stored by an earlier release. Keys in any KeyStyle are
+// recognized and keep their style. Properties whose key was removed are
+// dropped, and KeySchemaVersion is updated if it is set.
+func MigrateSchema(metadata map[string]string, from, to int) (map[string]string, error) {
+	for _, v := range []int{from, to} {
+		if v < 1 || v > SchemaVersion {
+			return nil, fmt.Errorf("unknown schema version %d", v)
+		}
+	}
+	migrated := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		migrated[k] = v
+	}
+	for v := from + 1; v <= to; v++ {
+		renames := map[string]string{}
+		for _, r := range schemaChanges[v] {
+			renames[foldFilterName(r.from)] = r.to
+		}
+		migrated = renameKeys(migrated, renames)
+	}
+	for v := from; v > to; v-- {
+		renames := map[string]string{}
+		for _, r := range schemaChanges[v] {
+			if r.to != "" {
+				renames[foldFilterName(r.to)] = r.from
+			}
+		}
+		migrated = renameKeys(migrated, renames)
+	}
+	for k := range migrated {
+		if foldFilterName(k) == foldFilterName(KeySchemaVersion) {
+			migrated[k] = strconv.Itoa(to)
+		}
+	}
+	return migrated, nil
+}
+
+// renameKeys returns the properties with their keys renamed, keeping their
+// style. The renames are by folded key, and keys renamed to "" are dropped.
+func renameKeys(metadata map[string]string, renames map[string]string) map[string]string {
+	if len(renames) == 0 {
+		return metadata
+	}
+	renamed := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		to, ok := renames[foldFilterName(k)]
+		switch {
+		case !ok:
+			renamed[k] = v
+		case to != "":
+			renamed[styleOf(k).Key(to)] = v
+		}
+	}
+	return renamed
+}
+
+// styleOf returns the key style of a key. Keys without upper-case
+// letters are in SnakeCase, and keys without lower-case letters that
+// have an underscore are in ScreamingSnakeCase.
+func styleOf(key string) KeyStyle {
+	switch {
+	case strings.ToLower(key) == key:
+		return SnakeCase
+	case strings.ToUpper(key) == key && strings.Contains(key, "_"):
+		return ScreamingSnakeCase
+	}
+	return CamelCase
+}
+
+// stampSchema adds the schema version to the properties
+// if WithSchemaVersion is used.
+func (o options) stampSchema(metadata map[string]string) map[string]string {
+	if o.schemaVersion && metadata != nil {
+		metadata[KeySchemaVersion] = strconv.Itoa(SchemaVersion)
+	}
+	return metadata
+}
@@ -0,0 +1,312 @@
+package sndtag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sidecarMaxSize is the largest text sidecar file that is read.
+const sidecarMaxSize = 1 << 20
+
+// sidecarArtwork are the names of folder-level artwork files,
+// in order of preference, without their extension.
+var sidecarArtwork = []string{"folder", "cover", "front"}
+
+// WithSidecars makes Walk and Watcher merge the metadata of the sidecar
+// files next to the files they read:
+//
+//   - CUE sheets that reference the file, or that have the same name
+//     apart from the extension. The album, album artist, genre and year
+//     are read from the sheet, and the title, artist and track number
+//     from the track of the file. A file that holds several tracks gets
+//     the tracks of the sheet instead, see KeyCueSheetTrackProperty.
+//   - ".lrc" lyrics with the same name, as "Lyrics".
+//   - ".nfo" files with the same name, or else the first one in the
+//     directory, as "Notes".
+//   - Folder-level artwork, "folder", "cover" or "front" with a ".jpg",
+//     ".jpeg" or ".png" extension, for files without embedded pictures.
+//
+// Sidecars only fill in properties that the file doesn't have. Their
+// names are stored as "Sidecars", and the sources of the properties set
+// from them, see WithSources, have the tag TagSidecar and the name of
+// the sidecar as their ID.
+//
+// Sidecars are only found in stores that can list a directory, which are
+// the ones returned by DirStore and FSStore and the archives Walk
+// descends into.
+func WithSidecars() Option {
+	return func(o *options) {
+		o.sidecars = true
+	}
+}
+
+// mergeSidecars merges the metadata of the sidecar files next to the file
+// with the given key in a store.
+func (o options) mergeSidecars(ctx context.Context, store Store, key string, metadata map[string]string) {
+	lister, ok := store.(dirLister)
+	if !ok {
+		return
+	}
+	objects, err := lister.listDir(lister.dir(key))
+	if err != nil {
+		return
+	}
+	var (
+		s = sidecars{
+			opts:     o,
+			ctx:      ctx,
+			store:    store,
+			metadata: metadata,
+			name:     baseName(key),
+		}
+		nfo *Object
+	)
+	s.stem = strings.TrimSuffix(s.name, path.Ext(s.name))
+
+	for i, obj := range objects {
+		name := baseName(obj.Key)
+		ext := strings.ToLower(path.Ext(name))
+		sameStem := strings.EqualFold(strings.TrimSuffix(name, path.Ext(name)), s.stem)
+
+		switch {
+		case ext == ".cue":
+			s.mergeCueSheet(obj, sameStem)
+		case ext == ".lrc" && sameStem:
+			s.mergeText(obj, KeyLyrics)
+		case ext == ".nfo" && (sameStem || nfo == nil):
+			nfo = &objects[i]
+		}
+	}
+	if nfo != nil {
+		s.mergeText(*nfo, KeyNotes)
+	}
+	if metadata[KeyArtworks] == "" {
+		s.mergeArtwork(objects)
+	}
+	if len(s.used) > 0 {
+		metadata[KeySidecars] = strings.Join(s.used, "/")
+	}
+}
+
+// sidecars merges the metadata of sidecar files into the metadata of a file.
+type sidecars struct {
+	opts     options
+	ctx      context.Context
+	store    Store
+	metadata map[string]string
+
+	// name is the name of the file and stem is its name without its extension.
+	name string
+	stem string
+
+	// used are the names of the sidecars that were merged.
+	used []string
+}
+
+// read reads a sidecar file, up to sidecarMaxSize bytes.
+func (s *sidecars) read(obj Object) ([]byte, error) {
+	rc, err := s.store.Open(s.ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(io.LimitReader(rc, sidecarMaxSize))
+}
+
+// set sets a property from a sidecar if it is missing.
+func (s *sidecars) set(obj Object, prop, value string) bool {
+	if value == "" {
+		return false
+	}
+	if _, ok := s.metadata[prop]; ok {
+		return false
+	}
+	s.metadata[prop] = value
+	s.opts.setSource(prop, Source{Tag: TagSidecar, ID: baseName(obj.Key)})
+	return true
+}
+
+// use records that a sidecar was merged.
+func (s *sidecars) use(obj Object) {
+	s.used = append(s.used, baseName(obj.Key))
+}
+
+// mergeText merges the text of a sidecar as a property.
+func (s *sidecars) mergeText(obj Object, prop string) {
+	b, err := s.read(obj)
+	if err != nil {
+		return
+	}
+	if s.set(obj, prop, sidecarText(b)) {
+		s.use(obj)
+	}
+}
+
+// sidecarText decodes the text of a sidecar, which is UTF-8 with or without
+// a byte order mark, or else ISO-8859-1.
+func sidecarText(b []byte) string {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(b) {
+		return strings.TrimSpace(decodeLatin1(b))
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// mergeCueSheet merges the properties of a CUE sheet if it references
+// the file or, if sameStem is set, if it has the same name as the file.
+func (s *sidecars) mergeCueSheet(obj Object, sameStem bool) {
+	b, err := s.read(obj)
+	if err != nil {
+		return
+	}
+	sheet := parseCueSheet(b)
+
+	file, ok := sheet.file(s.name)
+	switch {
+	case !ok && sameStem && len(sheet.files) == 1:
+		file = sheet.files[0]
+	case !ok:
+		return
+	}
+	s.set(obj, KeyAlbum, sheet.title)
+	s.set(obj, KeyAlbumArtist, sheet.performer)
+	s.set(obj, KeyGenre, sheet.genre)
+	s.set(obj, KeyYear, sheet.date)
+
+	if len(file.tracks) == 1 {
+		track := file.tracks[0]
+		s.set(obj, KeyTitle, track.title)
+		if track.performer != "" {
+			s.set(obj, KeyArtist, track.performer)
+		} else {
+			s.set(obj, KeyArtist, sheet.performer)
+		}
+		s.set(obj, KeyTrack, strconv.Itoa(track.number))
+	} else if s.set(obj, KeyCueSheetTracks, strconv.Itoa(len(file.tracks))) {
+		for i, track := range file.tracks {
+			n := i + 1
+			s.metadata[KeyCueSheetTrackProperty(n, "Number")] = strconv.Itoa(track.number)
+			s.metadata[KeyCueSheetTrackProperty(n, "Title")] = track.title
+			s.metadata[KeyCueSheetTrackProperty(n, "Performer")] = track.performer
+			s.metadata[KeyCueSheetTrackProperty(n, "Index")] = track.index
+		}
+	}
+	s.use(obj)
+}
+
+// mergeArtwork describes the first folder-level artwork file as the
+// front cover.
+func (s *sidecars) mergeArtwork(objects []Object) {
+	for _, name := range sidecarArtwork {
+		for _, obj := range objects {
+			base := strings.ToLower(baseName(obj.Key))
+			switch base {
+			case name + ".jpg", name + ".jpeg", name + ".png":
+			default:
+				continue
+			}
+			rc, err := s.store.Open(s.ctx, obj)
+			if err != nil {
+				continue
+			}
+			a, err := readArtwork(rc, nil)
+			rc.Close()
+			if err != nil {
+				continue
+			}
+			a.PictureType = pictureTypeFrontCover
+			setArtworks(s.metadata, []artwork{a})
+			s.opts.setSource(KeyArtworks, Source{Tag: TagSidecar, ID: baseName(obj.Key)})
+			s.use(obj)
+			return
+		}
+	}
+}
+
+// cueSheet is a CUE sheet.
+type cueSheet struct {
+	title     string
+	performer string
+	genre     string
+	date      string
+	files     []cueFile
+}
+
+// cueFile is a FILE of a CUE sheet and its tracks.
+type cueFile struct {
+	name   string
+	tracks []cueTrack
+}
+
+// cueTrack is a TRACK of a CUE sheet.
+type cueTrack struct {
+	number    int
+	title     string
+	performer string
+
+	// index is the INDEX 01 of the track, as mm:ss:ff.
+	index string
+}
+
+// parseCueSheet parses the commands of a CUE sheet that describe the
+// album and its tracks. Lines that can't be parsed are skipped.
+func parseCueSheet(b []byte) cueSheet {
+	var (
+		sheet   cueSheet
+		scanner = bufio.NewScanner(strings.NewReader(sidecarText(b)))
+	)
+	for scanner.Scan() {
+		fields, err := splitQuoted(scanner.Text())
+		if err != nil || len(fields) < 2 {
+			continue
+		}
+		var track *cueTrack
+		if n := len(sheet.files); n > 0 {
+			if tracks := sheet.files[n-1].tracks; len(tracks) > 0 {
+				track = &tracks[len(tracks)-1]
+			}
+		}
+		switch command := strings.ToUpper(fields[0]); {
+		case command == "FILE":
+			sheet.files = append(sheet.files, cueFile{name: fields[1]})
+		case command == "TRACK" && len(sheet.files) > 0:
+			n, _ := strconv.Atoi(fields[1])
+			f := &sheet.files[len(sheet.files)-1]
+			f.tracks = append(f.tracks, cueTrack{number: n})
+		case command == "TITLE" && track != nil:
+			track.title = fields[1]
+		case command == "TITLE":
+			sheet.title = fields[1]
+		case command == "PERFORMER" && track != nil:
+			track.performer = fields[1]
+		case command == "PERFORMER":
+			sheet.performer = fields[1]
+		case command == "INDEX" && track != nil && len(fields) >= 3 && fields[1] == "01":
+			track.index = fields[2]
+		case command == "REM" && len(fields) >= 3 && strings.EqualFold(fields[1], "GENRE"):
+			sheet.genre = fields[2]
+		case command == "REM" && len(fields) >= 3 && strings.EqualFold(fields[1], "DATE"):
+			sheet.date = fields[2]
+		}
+	}
+	return sheet
+}
+
+// file returns the FILE of a CUE sheet with the given name,
+// regardless of case and of the directory it is in.
+func (sheet cueSheet) file(name string) (cueFile, bool) {
+	for _, f := range sheet.files {
+		if strings.EqualFold(baseName(f.name), name) {
+			return f, true
+		}
+	}
+	return cueFile{}, false
+}
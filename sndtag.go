@@ -1,68 +1,161 @@
 package sndtag
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 )
 
 // Types of tags that are supported.
-// TODO: support id3
+//
+// Deprecated: use Format, e.g. the result of DetectFormat, which covers
+// every format that sndtag recognizes.
 const (
 	RIFF = iota
 	ID3v1
 	ID3v2
 )
 
+// ErrUnrecognizedFormat is wrapped by the error that New and NewFromBytes
+// return for a file whose format isn't recognized.
+var ErrUnrecognizedFormat = errors.New("unrecognized header")
+
 // New creates a new map with metadata read from an io.Reader.
-// If the type is not one of the supported types then an error is returned.
-func New(r io.Reader) (map[string]string, error) {
-	// Read the first 3 bytes.
-	header := make([]byte, 3)
+// If the type is not one of the supported types then an error wrapping
+// ErrUnrecognizedFormat is returned. Files without tags are not an error,
+// see HasTags.
+//
+// If r is a *bufio.Reader, or another reader with a Peek method, the bytes
+// that the format is detected by are peeked rather than read and put back,
+// so r isn't wrapped and is left where the parsers stopped reading. See
+// also DetectFormatReader.
+func New(r io.Reader, opts ...Option) (metadata map[string]string, err error) {
+	o := newOptions(opts)
+
+	defer o.startStats()()
+	o.startDuplicates()
+	defer func() {
+		if r := recover(); r != nil {
+			metadata, err = nil, malformed(r)
+		}
+	}()
 
-	bytesRead, err := r.Read(header)
+	// Readers that can peek, like *bufio.Reader, are peeked at to detect
+	// the format, before they are wrapped.
+	p, _ := r.(peeker)
+	metadata, err = readMetadata(o.guard(o.countReads(r)), p, o)
 	if err != nil {
 		return nil, err
 	}
-	if expected, got := 3, bytesRead; expected != got {
-		return nil, fmt.Errorf("expected to read %d bytes, actually read %d", expected, got)
+	if err := o.checkDuplicates(); err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		// Files without tags are not an error, see HasTags.
+		metadata = map[string]string{}
 	}
+	if metadata, err = o.enrich(metadata); err != nil {
+		return nil, err
+	}
+	return o.styleKeys(o.fallBackToArtist(metadata)), nil
+}
 
-	// Figure out the type.
-	switch x := string(header); x {
-	default:
-		return nil, fmt.Errorf("unrecognized header: %s", x)
-	case "TAG":
-		// TODO: handle id3
-		return newID3(r)
-	case "RIF":
-		if err := checkRIFFLastByte(r, header); err != nil {
+// readMetadata reads the metadata of a file from r, see New. If p isn't
+// nil it peeks at the same stream as r, to detect the format.
+func readMetadata(r io.Reader, p peeker, o options) (map[string]string, error) {
+	s, err := sniff(r, p, sniffSize)
+	if err != nil {
+		return nil, err
+	}
+	typ := o.detectType(s.header)
+
+	// Tracker modules are recognized by a signature further in.
+	if typ == fileUnknown && len(s.header) == sniffSize {
+		if err := s.extend(trackerSniffSize); err != nil {
 			return nil, err
 		}
+		if trackerFormat(s.header) != "" {
+			typ = fileTracker
+		}
+	}
+	header := s.header
 
-		getter, err := newWav(r)
+	// Headerless PCM can look like an MPEG frame sync.
+	if typ == fileMPEG && o.raw != nil {
+		typ = fileUnknown
+	}
+
+	// Figure out the type.
+	switch typ {
+	case fileID3v2:
+		if r, err = s.after(3); err != nil {
+			return nil, err
+		}
+		return newID3v2(r, o)
+	case fileID3v1:
+		if r, err = s.after(3); err != nil {
+			return nil, err
+		}
+		return newID3(r, o)
+	case fileRIFF:
+		if r, err = s.after(4); err != nil {
+			return nil, err
+		}
+		getter, err := newWav(r, o)
 		if err != nil && err != io.EOF {
 			return nil, err
 		}
 		return getter, nil
+	case fileMatroska:
+		if r, err = s.after(0); err != nil {
+			return nil, err
+		}
+		return newMatroska(r, o)
+	case fileMPEG:
+		if r, err = s.after(0); err != nil {
+			return nil, err
+		}
+		return newMPEG(r, o)
+	case fileFLAC:
+		if r, err = s.after(4); err != nil {
+			return nil, err
+		}
+		return newFLAC(r, o)
 	}
-}
-
-// checkRIFFLastByte checks that the 4th byte of a RIFF file is 'F'.
-func checkRIFFLastByte(r io.Reader, header []byte) error {
-	// Read one more byte for RIFF type.
-	headerLastByte := make([]byte, 1)
 
-	bytesRead, err := r.Read(headerLastByte)
-	if err != nil {
-		return err
+	// The other parsers are handed the whole header.
+	if r, err = s.after(len(header)); err != nil {
+		return nil, err
 	}
-	if expected, got := 1, bytesRead; expected != got {
-		return fmt.Errorf("expected to read %d bytes, actually read %d", expected, got)
+	switch typ {
+	case fileMP4:
+		return newMP4(r, header, o)
+	case fileLegacy:
+		return newLegacy(r, header, o)
+	case fileMusepack:
+		return newMusepack(r, header, o)
+	case fileMonkeysAudio:
+		return newMonkeysAudio(r, header, o)
+	case fileSphere:
+		return newSphere(r, header, o)
+	case fileMIDI, fileTracker:
+		// MIDI files and tracker modules are small, so they are read into memory.
+		rest, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		b := append(header, rest...)
+		if typ == fileMIDI {
+			return newMIDI(b)
+		}
+		return newTracker(b)
 	}
-
-	if headerLastByte[0] != 'F' {
-		hdr := string(append(header, headerLastByte...))
-		return fmt.Errorf("expected RIFF, got %s", hdr)
+	if o.raw != nil {
+		return newRaw(r, int64(len(header)), o)
+	}
+	if len(header) > 3 {
+		header = header[:3]
 	}
-	return nil
+	return nil, fmt.Errorf("%w: %s", ErrUnrecognizedFormat, header)
 }
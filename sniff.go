@@ -0,0 +1,178 @@
+package sndtag
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// fileType is a type of file that New and NewFromBytes recognize.
+type fileType int
+
+// File types.
+const (
+	fileUnknown fileType = iota
+	fileID3v2
+	fileID3v1
+	fileRIFF
+	fileMP4
+	fileLegacy
+	fileMusepack
+	fileMonkeysAudio
+	fileMatroska
+	fileMIDI
+	fileSphere
+	fileTracker
+	fileMPEG
+	fileFLAC
+)
+
+// sniffSize is the number of bytes detectType needs to recognize every
+// type of file except tracker modules, which need trackerSniffSize.
+const sniffSize = 8
+
+// detectType returns the type of a file from the bytes at its start.
+// It is used by both New and NewFromBytes, so that they always agree.
+func detectType(b []byte) fileType {
+	for _, p := range typeProbes {
+		if p.match(b) {
+			return p.typ
+		}
+	}
+	return fileUnknown
+}
+
+// typeProbe recognizes a type of file by the bytes at its start.
+type typeProbe struct {
+	typ   fileType
+	match func(b []byte) bool
+}
+
+// typeProbes are the probes that detectType tries, in order. Their
+// signatures don't overlap, so the order only changes how many probes are
+// tried before a file is recognized, see WithAdaptiveProbing.
+var typeProbes = []typeProbe{
+	{fileID3v2, func(b []byte) bool { return bytes.HasPrefix(b, []byte("ID3")) }},
+	{fileID3v1, func(b []byte) bool { return bytes.HasPrefix(b, []byte("TAG")) }},
+	{fileRIFF, func(b []byte) bool { return bytes.HasPrefix(b, []byte("RIFF")) }},
+	{fileMP4, func(b []byte) bool { return len(b) >= 8 && string(b[4:8]) == "ftyp" }},
+	{fileLegacy, func(b []byte) bool { return legacyFormat(b) != "" }},
+	{fileMusepack, isMusepack},
+	{fileMonkeysAudio, isMonkeysAudio},
+	{fileMatroska, func(b []byte) bool { return bytes.HasPrefix(b, []byte("\x1a\x45\xdf\xa3")) }},
+	{fileMIDI, func(b []byte) bool { return bytes.HasPrefix(b, []byte("MThd")) }},
+	{fileSphere, func(b []byte) bool { return bytes.HasPrefix(b, []byte("NIST")) }},
+	{fileTracker, func(b []byte) bool { return trackerFormat(b) != "" }},
+	{fileFLAC, func(b []byte) bool { return bytes.HasPrefix(b, []byte("fLaC")) }},
+	{fileMPEG, isMPEGSync},
+}
+
+// readHeader reads up to n bytes from r. Reaching the end of the stream
+// is only an error if nothing could be read.
+func readHeader(r io.Reader, n int) ([]byte, error) {
+	header := make([]byte, n)
+
+	read, err := io.ReadFull(r, header)
+	if read > 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	return header[:read], err
+}
+
+// peeker is implemented by readers that can return the bytes ahead without
+// consuming them, like *bufio.Reader.
+type peeker interface {
+	Peek(n int) ([]byte, error)
+}
+
+// sniffed is a stream whose first bytes were read, or peeked, to detect
+// its format.
+type sniffed struct {
+	r      io.Reader
+	p      peeker
+	header []byte
+
+	// peeked is whether the header is still to be read from r.
+	peeked bool
+}
+
+// sniff reads the first n bytes of r, or fewer if it is shorter. If p,
+// which must read the same stream as r, isn't nil they are peeked instead,
+// so that the stream isn't wrapped to put them back, see after.
+func sniff(r io.Reader, p peeker, n int) (*sniffed, error) {
+	s := &sniffed{r: r, p: p}
+	if p == nil {
+		header, err := readHeader(r, n)
+		s.header = header
+		return s, err
+	}
+	s.peeked = true
+	return s, s.peek(n)
+}
+
+// extend reads or peeks more of the stream, up to n bytes of header.
+// The stream is read if its buffer is too small to peek that far.
+func (s *sniffed) extend(n int) error {
+	if len(s.header) >= n {
+		return nil
+	}
+	if s.peeked {
+		if err := s.peek(n); err != bufio.ErrBufferFull {
+			return err
+		}
+		if _, err := s.after(len(s.header)); err != nil {
+			return err
+		}
+		s.peeked = false
+	}
+	rest, err := readHeader(s.r, n-len(s.header))
+	if err == io.EOF {
+		err = nil
+	}
+	s.header = append(s.header, rest...)
+	return err
+}
+
+// peek peeks up to n bytes into the header.
+func (s *sniffed) peek(n int) error {
+	b, err := s.p.Peek(n)
+	if len(b) > 0 && err == io.EOF {
+		err = nil
+	}
+	// The bytes are only valid until the next read.
+	s.header = append([]byte(nil), b...)
+	return err
+}
+
+// after returns a reader that is positioned after the first n bytes of the
+// header, for the parsers that expect to be handed a stream that far in.
+// The bytes that were only peeked are discarded, the ones that were read
+// are put back, see rewind.
+func (s *sniffed) after(n int) (io.Reader, error) {
+	if !s.peeked {
+		return rewind(s.r, s.header, n)
+	}
+	if n > len(s.header) {
+		n = len(s.header)
+	}
+	_, err := io.CopyN(ioutil.Discard, s.r, int64(n))
+	return s.r, err
+}
+
+// rewind returns a reader that is positioned after the first n bytes of
+// header, which has been read from r, for the parsers that expect only
+// the identifier of a file to have been read. It seeks back if r is an
+// io.Seeker, so that the parsers can still read the tags at the end.
+func rewind(r io.Reader, header []byte, n int) (io.Reader, error) {
+	if len(header) <= n {
+		return r, nil
+	}
+	if s, ok := r.(io.Seeker); ok {
+		if _, err := s.Seek(int64(n-len(header)), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	return io.MultiReader(bytes.NewReader(header[n:]), r), nil
+}
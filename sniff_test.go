@@ -0,0 +1,64 @@
+package sndtag
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// testID3v1 encodes an ID3v1 tag with a title.
+func testID3v1(title string) []byte {
+	b := make([]byte, id3v1Size)
+	copy(b, "TAG")
+	copy(b[3:33], title)
+	b[127] = 255
+	return b
+}
+
+func TestNewMPEGSync(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file []byte
+		want map[string]string
+	}{
+		{
+			name: "no tags",
+			file: testMP3(nil),
+			want: map[string]string{KeyTitle: ""},
+		},
+		{
+			name: "ID3v1",
+			file: append(testMP3(nil), testID3v1("Title")...),
+			want: map[string]string{KeyTitle: "Title"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DetectFormat(tc.file); got != FormatMP3 {
+				t.Fatalf("DetectFormat: got %s, want %s", got, FormatMP3)
+			}
+			if !Capabilities(FormatMP3).ReadTags {
+				t.Fatal("MP3 tags aren't readable")
+			}
+			readers := map[string]func() (map[string]string, error){
+				"NewFromBytes": func() (map[string]string, error) { return NewFromBytes(tc.file) },
+				"New":          func() (map[string]string, error) { return New(bytes.NewReader(tc.file)) },
+			}
+			for name, read := range readers {
+				metadata, err := read()
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				for key, want := range tc.want {
+					if got := metadata[key]; got != want {
+						t.Errorf("%s: %s: got %q, want %q", name, key, got, want)
+					}
+				}
+			}
+
+			// The ID3v1 tag can't be reached without seeking.
+			if _, err := New(struct{ io.Reader }{bytes.NewReader(tc.file)}); err != nil {
+				t.Errorf("New without seeking: %s", err)
+			}
+		})
+	}
+}
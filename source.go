@@ -0,0 +1,47 @@
+package sndtag
+
+// Tag systems that properties are read from.
+const (
+	TagID3v1 = "ID3v1"
+	TagID3v2 = "ID3v2"
+	TagINFO  = "RIFF INFO"
+	TagMP4   = "MP4"
+	TagAPEv2 = "APEv2"
+
+	// TagSidecar is for properties read from a file next to the file,
+	// like a CUE sheet, see WithSidecars.
+	TagSidecar = "Sidecar"
+)
+
+// A Source tells where the value of a property was read from.
+type Source struct {
+	// Tag is the tag system, e.g. TagID3v2.
+	Tag string
+
+	// ID is the ID of the frame, chunk, atom or item, e.g. "TIT2" or "INAM".
+	// It is empty for ID3v1 fields, which don't have one.
+	ID string
+
+	// Offset is the byte offset in the file of the frame, chunk, atom,
+	// item or field. Frames of ID3v2.3 tags that are unsynchronised as
+	// a whole can't be located, so the offset of the tag is used instead.
+	Offset int64
+}
+
+// setSource records where a property was read from, if sources were
+// requested with WithSources. Properties are only read from the first
+// place they are found, so only the first source of a property is kept.
+func (o options) setSource(key string, s Source) {
+	if o.sources == nil {
+		return
+	}
+	if _, ok := o.sources[key]; !ok {
+		o.sources[key] = s
+	}
+}
+
+// sliceOffset returns the offset of sub in base,
+// where sub is a slice of the same array that starts at or after base.
+func sliceOffset(base, sub []byte) int64 {
+	return int64(cap(base) - cap(sub))
+}
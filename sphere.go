@@ -0,0 +1,164 @@
+package sndtag
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// sphereMaxHeaderSize is the largest NIST SPHERE header that is read.
+// Headers are normally 1024 bytes.
+const sphereMaxHeaderSize = 1 << 20
+
+// sphereFields maps the fields of a NIST SPHERE header to property names.
+// Other fields are stored with their names converted to CamelCase,
+// e.g. "speaker_id" is stored as "SpeakerID".
+var sphereFields = map[string]string{
+	"channel_count": KeyNumChannels,
+	"sample_coding": KeySampleCoding,
+	"sample_count":  KeySampleCount,
+	"sample_rate":   KeySampleRate,
+}
+
+// newSphere creates a new map that contains properties for NIST SPHERE files.
+// Note that the first 3 bytes of the header have already been read
+// by the time this function is called.
+func newSphere(r io.Reader, header []byte, o options) (map[string]string, error) {
+	// The header starts with "NIST_1A\n" and the header size,
+	// which is padded to 7 characters and followed by a newline.
+	start := make([]byte, 16)
+	copy(start, header)
+
+	if _, err := io.ReadFull(r, start[len(header):]); err != nil {
+		return nil, err
+	}
+	size, err := sphereHeaderSize(start)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	copy(b, start)
+
+	if _, err := io.ReadFull(r, b[len(start):]); err != nil {
+		return nil, err
+	}
+	return readSphereHeader(b, o)
+}
+
+// newSphereBytes creates a new map that contains properties for a NIST SPHERE
+// file that is entirely in memory.
+func newSphereBytes(b []byte, o options) (map[string]string, error) {
+	if len(b) < 16 {
+		return nil, fmt.Errorf("truncated NIST SPHERE header")
+	}
+	size, err := sphereHeaderSize(b)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) < size {
+		return nil, fmt.Errorf("truncated NIST SPHERE header")
+	}
+	return readSphereHeader(b[:size], o)
+}
+
+// sphereHeaderSize returns the size of a NIST SPHERE header
+// from its first 16 bytes.
+func sphereHeaderSize(start []byte) (int64, error) {
+	if expected, got := "NIST_1A\n", string(start[:8]); expected != got {
+		return 0, fmt.Errorf("expected %q, got %q", expected, got)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(start[8:16])), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid NIST SPHERE header size: %s", err)
+	}
+	if size < 16 || size > sphereMaxHeaderSize {
+		return 0, fmt.Errorf("invalid NIST SPHERE header size %d", size)
+	}
+	return size, nil
+}
+
+// readSphereHeader reads the fields of a NIST SPHERE header.
+// Each field is a line with a name, a type and a value,
+// e.g. "sample_rate -i 16000", and the last line is "end_head".
+func readSphereHeader(b []byte, o options) (map[string]string, error) {
+	metadata := map[string]string{
+		KeyDataOffset: strconv.Itoa(len(b)),
+	}
+	lines := bytes.Split(b[16:], []byte("\n"))
+
+	for _, line := range lines {
+		line = bytes.TrimRight(line, "\r")
+		if string(line) == "end_head" {
+			break
+		}
+		fields := strings.SplitN(string(line), " ", 3)
+		if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") {
+			continue
+		}
+		name, typ, value := fields[0], fields[1], fields[2]
+
+		// String values have a length, e.g. "-s5", and can contain spaces.
+		if strings.HasPrefix(typ, "-s") {
+			if n, err := strconv.Atoi(typ[2:]); err == nil && n <= len(value) {
+				value = value[:n]
+			}
+		} else {
+			value = strings.TrimSpace(value)
+		}
+		if name == "sample_n_bytes" {
+			// Store the sample size in bits, like the WAV fmt chunk.
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sample_n_bytes %q", value)
+			}
+			metadata[KeyBitRate] = strconv.Itoa(n * 8)
+			continue
+		}
+		prop, ok := sphereFields[name]
+		if !ok {
+			prop = sphereKey(name)
+		}
+		if o.wants(prop) {
+			metadata[prop] = value
+		}
+	}
+	setSphereDataLength(metadata)
+
+	return metadata, nil
+}
+
+// setSphereDataLength stores the length of the audio data,
+// unless it is compressed.
+func setSphereDataLength(metadata map[string]string) {
+	if strings.Contains(metadata[KeySampleCoding], "embedded") {
+		return
+	}
+	var product int64 = 1
+
+	for _, prop := range []string{KeySampleCount, KeyNumChannels, KeyBitRate} {
+		n, err := strconv.ParseInt(metadata[prop], 10, 64)
+		if err != nil {
+			return
+		}
+		product *= n
+	}
+	metadata[KeyDataLength] = strconv.FormatInt(product/8, 10)
+}
+
+// sphereKey converts the name of a NIST SPHERE field to CamelCase.
+func sphereKey(name string) string {
+	var key strings.Builder
+
+	for _, word := range strings.Split(name, "_") {
+		switch word {
+		case "":
+		case "id":
+			key.WriteString("ID")
+		default:
+			key.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return key.String()
+}
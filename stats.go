@@ -0,0 +1,106 @@
+package sndtag
+
+import (
+	"io"
+	"time"
+)
+
+// ParseStats describes the work done to read the metadata of a file,
+// to find the files of a library that are slow to read.
+type ParseStats struct {
+	// BytesRead is the number of bytes read from the file. For
+	// NewFromBytes it is the size of the file, which is already in memory.
+	BytesRead int64
+
+	// Chunks is the number of RIFF chunks and MP4 atoms visited.
+	Chunks int
+
+	// Frames is the number of ID3v2 frames and APEv2 items decoded.
+	Frames int
+
+	// Probes is the number of signatures tried to recognize the format,
+	// see WithAdaptiveProbing.
+	Probes int
+
+	// Seeks is the number of times the reader was seeked,
+	// e.g. to read tags at the end of the file.
+	Seeks int
+
+	// Duration is the time spent reading the metadata.
+	Duration time.Duration
+}
+
+// WithStats stores statistics about reading the metadata of a file in s.
+// s is filled in even if reading fails.
+func WithStats(s *ParseStats) Option {
+	return func(o *options) {
+		o.stats = s
+	}
+}
+
+// countChunk counts a chunk or an atom that was visited.
+func (o options) countChunk() {
+	if o.stats != nil {
+		o.stats.Chunks++
+	}
+}
+
+// countFrame counts a frame or an item that was decoded.
+func (o options) countFrame() {
+	if o.stats != nil {
+		o.stats.Frames++
+	}
+}
+
+// startStats resets the statistics, if they were requested, and returns
+// a function that records the time spent since startStats was called.
+func (o options) startStats() func() {
+	if o.stats == nil {
+		return func() {}
+	}
+	*o.stats = ParseStats{}
+	start := time.Now()
+
+	return func() {
+		o.stats.Duration = time.Since(start)
+	}
+}
+
+// countReads wraps r so that the bytes read from it and the seeks
+// are counted, if statistics were requested.
+func (o options) countReads(r io.Reader) io.Reader {
+	if o.stats == nil {
+		return r
+	}
+	sr := &statsReader{r: r, stats: o.stats}
+	if s, ok := r.(io.Seeker); ok {
+		return statsReadSeeker{statsReader: sr, s: s}
+	}
+	return sr
+}
+
+// statsReader is an io.Reader that counts the bytes read from it.
+type statsReader struct {
+	r     io.Reader
+	stats *ParseStats
+}
+
+// Read reads from the underlying reader.
+func (s *statsReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.stats.BytesRead += int64(n)
+	return n, err
+}
+
+// statsReadSeeker is a statsReader that can seek,
+// and counts the seeks too.
+type statsReadSeeker struct {
+	*statsReader
+	s io.Seeker
+}
+
+// Seek seeks the underlying reader.
+func (s statsReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	s.stats.Seeks++
+	return s.s.Seek(offset, whence)
+}
@@ -0,0 +1,220 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A TagRange is the range of bytes that a tag takes up in a file.
+type TagRange struct {
+	// Tag is the tag system: TagID3v2, TagAPEv2 or TagID3v1.
+	Tag string
+
+	// Version is the version of the tag, e.g. "2.4.0" for ID3v2.4,
+	// "1.1" for ID3v1.1 tags, which have a track number, and "2.0"
+	// for APEv2 tags.
+	Version string
+
+	// Offset is the offset of the tag in the file, and Length is its
+	// length including its header, padding and footer.
+	Offset int64
+	Length int64
+
+	// Header is the length of the header, which is 10 bytes plus the
+	// extended header for ID3v2 tags, 32 bytes for APEv2 tags that have
+	// a header and 0 for ID3v1 tags.
+	Header int64
+
+	// Padding is the length of the padding after the frames of an
+	// ID3v2 tag. It is 0 for other tags.
+	Padding int64
+
+	// Footer is the length of the footer, which is 10 bytes for ID3v2.4
+	// tags that have one and 32 bytes for APEv2 tags.
+	Footer int64
+}
+
+// TagRanges returns the ranges of the tags of a file in the order they
+// appear in it: the ID3v2 tags at the start of the file, and the APEv2
+// and ID3v1 tags at the end. Splicing tools can use them to cut the audio
+// out of a file, see also AudioRange.
+func TagRanges(rs io.ReadSeeker) ([]TagRange, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	ranges, start, err := id3v2Ranges(rs, size)
+	if err != nil {
+		return nil, err
+	}
+	trailing, err := trailingTagRanges(rs, start, size)
+	if err != nil {
+		return nil, err
+	}
+	return append(ranges, trailing...), nil
+}
+
+// AudioRange returns the offsets of the start and the end of the audio
+// data of a file, which is what is left of it without its tags, see
+// TagRanges. For WAV files it is the data chunk, and for FLAC files
+// it is the frames that follow the metadata blocks.
+func AudioRange(rs io.ReadSeeker) (start, end int64, err error) {
+	ranges, err := TagRanges(rs)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+	end = size
+	for _, r := range ranges {
+		if r.Tag == TagID3v2 {
+			start = r.Offset + r.Length
+		} else if r.Offset < end {
+			end = r.Offset
+		}
+	}
+
+	header := make([]byte, 12)
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	if _, err := io.ReadFull(rs, header); err == nil {
+		switch {
+		case string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+			return wavDataRange(rs, start+12, size)
+		case string(header[:4]) == "fLaC":
+			if start, err = flacFramesOffset(rs, start+4, end); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	if end < start {
+		end = start
+	}
+	return start, end, nil
+}
+
+// id3v2Ranges returns the ranges of the ID3v2 tags at the start of a file
+// of the given size, and the offset of the end of the last one.
+func id3v2Ranges(rs io.ReadSeeker, size int64) ([]TagRange, int64, error) {
+	var (
+		ranges []TagRange
+		start  int64
+		header = make([]byte, 10)
+	)
+	for {
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		if _, err := io.ReadFull(rs, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ranges, start, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+		if string(header[:3]) != "ID3" {
+			return ranges, start, nil
+		}
+		t := &id3v2{header: id3v2Header{Major: header[3], Revision: header[4], Flags: header[5]}}
+		copy(t.header.Size[:], header[6:10])
+
+		r := TagRange{
+			Tag:     TagID3v2,
+			Version: fmt.Sprintf("2.%d.%d", t.header.Major, t.header.Revision),
+			Offset:  start,
+			Length:  10 + t.size(),
+			Header:  10,
+		}
+		if r.Offset+r.Length > size {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		if t.header.Flags&id3v2FlagFooter != 0 {
+			r.Footer = id3v2FooterSize
+		}
+		if t.header.Major >= 2 && t.header.Major <= 4 {
+			body := make([]byte, synchsafe(t.header.Size[:]))
+			if _, err := io.ReadFull(rs, body); err != nil {
+				return nil, 0, err
+			}
+			r.Header, r.Padding = t.layout(body)
+		}
+		ranges = append(ranges, r)
+		start += r.Length
+	}
+}
+
+// layout returns the length of the header of a tag, including its
+// extended header, and the length of its padding, given the tag body.
+// The padding is 0 if the frames can't be read.
+func (t *id3v2) layout(body []byte) (header, padding int64) {
+	// ID3v2.4 unsynchronises each frame separately.
+	if t.header.Flags&id3v2FlagUnsync != 0 && t.header.Major < 4 {
+		body = removeUnsync(body)
+	}
+	frames, err := t.skipExtendedHeader(body)
+	if err != nil {
+		return 10, 0
+	}
+	header = 10 + int64(len(body)-len(frames))
+
+	for len(frames) > 0 && frames[0] != 0 {
+		if _, frames, err = t.readFrame(frames); err != nil {
+			return header, 0
+		}
+	}
+	return header, int64(len(frames))
+}
+
+// trailingTagRanges returns the ranges of the APEv2 and ID3v1 tags at
+// the end of a file of the given size, which are looked for after start.
+func trailingTagRanges(rs io.ReadSeeker, start, size int64) ([]TagRange, error) {
+	tailSize := int64(apeFooterSize + id3v1Size)
+	if tailSize > size-start {
+		tailSize = size - start
+	}
+	var (
+		tail      = make([]byte, tailSize)
+		tailStart = size - tailSize
+		ranges    []TagRange
+	)
+	if _, err := rs.Seek(tailStart, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rs, tail); err != nil {
+		return nil, err
+	}
+	if footer, footerEnd := findAPEv2Footer(tail); footer != nil {
+		length, _, err := apeTagSize(footer)
+		if err != nil {
+			return nil, err
+		}
+		r := TagRange{
+			Tag:     TagAPEv2,
+			Version: fmt.Sprintf("%.1f", float64(binary.LittleEndian.Uint32(footer[8:12]))/1000),
+			Length:  length + apeFooterSize,
+			Footer:  apeFooterSize,
+		}
+
+		// Bit 31 of the flags is set if the tag has a header.
+		if binary.LittleEndian.Uint32(footer[20:24])&(1<<31) != 0 {
+			r.Length += apeFooterSize
+			r.Header = apeFooterSize
+		}
+		r.Offset = tailStart + footerEnd - r.Length
+		ranges = append(ranges, r)
+	}
+	if len(tail) >= id3v1Size && string(tail[len(tail)-id3v1Size:len(tail)-id3v1Size+3]) == "TAG" {
+		v1 := tail[len(tail)-id3v1Size:]
+
+		// ID3v1.1 tags use the last two bytes of the comment for a zero
+		// byte and the track number.
+		version := "1.0"
+		if v1[125] == 0 && v1[126] != 0 {
+			version = "1.1"
+		}
+		ranges = append(ranges, TagRange{Tag: TagID3v1, Version: version, Offset: size - id3v1Size, Length: id3v1Size})
+	}
+	return ranges, nil
+}
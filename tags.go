@@ -0,0 +1,61 @@
+package sndtag
+
+// tagProperties are the descriptive properties, which come from the tags
+// of a file rather than from its format.
+var tagProperties = []string{
+	KeyTitle,
+	KeyArtist,
+	KeyAlbum,
+	KeyAlbumArtist,
+	KeyTrack,
+	KeyDisc,
+	KeyYear,
+	KeyGenre,
+	KeyComment,
+	KeyComments,
+	KeyGrouping,
+	KeyRating,
+	KeyRatingRaw,
+	KeyPlayCount,
+	KeyWork,
+	KeyMovementName,
+	KeyOriginalReleaseDate,
+	KeyReleaseDate,
+	KeyBarcode,
+	KeyCatalogNumber,
+	KeyLabel,
+	KeyMedia,
+	KeyReleaseCountry,
+	KeyUnsyncedLyrics,
+	KeyLyrics,
+	KeyArtworks,
+	KeyCopyright,
+	KeyReplayGainTrackGain,
+	KeyReplayGainAlbumGain,
+	KeyPricePaid,
+	KeyOwner,
+	KeyTVShow,
+}
+
+// HasTags reports whether the properties returned by New hold any
+// descriptive properties, like a title, an artist or a picture. Files
+// without tags are not an error: New returns their format properties,
+// e.g. "SampleRate", and HasTags tells them apart from tagged files.
+// Keys in any KeyStyle are recognized.
+func HasTags(metadata map[string]string) bool {
+	if len(metadata) == 0 {
+		return false
+	}
+	folded := make(map[string]bool, len(metadata))
+	for key, value := range metadata {
+		if value != "" {
+			folded[foldFilterName(key)] = true
+		}
+	}
+	for _, key := range tagProperties {
+		if folded[foldFilterName(key)] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,291 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// trackerSniffSize is the number of bytes needed to recognize a tracker
+// module. MOD files have their signature at offset 1080.
+const trackerSniffSize = 1084
+
+// Tracker module formats, as stored in the "ModuleFormat" property.
+const (
+	ModuleFormatMOD = "MOD"
+	ModuleFormatXM  = "XM"
+	ModuleFormatIT  = "IT"
+	ModuleFormatS3M = "S3M"
+)
+
+// modChannels maps the signatures of MOD files to their number of channels.
+// Signatures like "6CHN" and "12CH" are handled by modSignatureChannels.
+var modChannels = map[string]int{
+	"M.K.": 4,
+	"M!K!": 4,
+	"FLT4": 4,
+	"FLT8": 8,
+	"CD81": 8,
+	"OKTA": 8,
+}
+
+// trackerFormat returns the format of a tracker module from its start,
+// or an empty string if it isn't a tracker module.
+func trackerFormat(b []byte) string {
+	switch {
+	case len(b) >= 38 && string(b[:17]) == "Extended Module: ":
+		return ModuleFormatXM
+	case len(b) >= 4 && string(b[:4]) == "IMPM":
+		return ModuleFormatIT
+	case len(b) >= 0x30 && string(b[0x2c:0x30]) == "SCRM":
+		return ModuleFormatS3M
+	case len(b) >= trackerSniffSize && modSignatureChannels(string(b[1080:1084])) > 0:
+		return ModuleFormatMOD
+	}
+	return ""
+}
+
+// modSignatureChannels returns the number of channels of a MOD file
+// from its signature, or 0 if the signature isn't known.
+func modSignatureChannels(sig string) int {
+	if n, ok := modChannels[sig]; ok {
+		return n
+	}
+	if strings.HasSuffix(sig, "CHN") {
+		n, _ := strconv.Atoi(sig[:1])
+		return n
+	}
+	if strings.HasSuffix(sig, "CH") {
+		n, _ := strconv.Atoi(sig[:2])
+		return n
+	}
+	return 0
+}
+
+// newTracker creates a new map that contains the title, the sample names
+// and the instrument names of a tracker module that is entirely in memory.
+// Sample names are stored as "Sample<n>Name" and instrument names as
+// "Instrument<n>Name", counting from 1, and the number of samples and
+// instruments are stored as "Samples" and "Instruments". Trackers have
+// a fixed number of sample slots, so names can be empty.
+func newTracker(b []byte) (map[string]string, error) {
+	t := tracker{metadata: map[string]string{}}
+
+	format := trackerFormat(b)
+	t.metadata[KeyModuleFormat] = format
+
+	var err error
+
+	switch format {
+	case ModuleFormatMOD:
+		err = t.readMOD(b)
+	case ModuleFormatXM:
+		err = t.readXM(b)
+	case ModuleFormatIT:
+		err = t.readIT(b)
+	case ModuleFormatS3M:
+		err = t.readS3M(b)
+	default:
+		err = fmt.Errorf("unrecognized tracker module")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.metadata, nil
+}
+
+// tracker reads the metadata of tracker modules.
+type tracker struct {
+	metadata map[string]string
+}
+
+// readMOD reads a ProTracker MOD file, which has 31 samples.
+func (t tracker) readMOD(b []byte) error {
+	const (
+		sampleCount = 31
+		sampleSize  = 30
+	)
+	t.metadata[KeyTitle] = trackerText(b[:20])
+	t.metadata[KeyNumChannels] = strconv.Itoa(modSignatureChannels(string(b[1080:1084])))
+
+	names := make([]string, sampleCount)
+	for i := range names {
+		sample := b[20+i*sampleSize:]
+		names[i] = trackerText(sample[:22])
+	}
+	t.setNames(KeySamples, KeySampleName, names)
+	return nil
+}
+
+// readXM reads a FastTracker 2 XM file. The instruments come after the
+// patterns, and each instrument is followed by its samples.
+func (t tracker) readXM(b []byte) error {
+	if len(b) < 80 {
+		return fmt.Errorf("truncated XM header")
+	}
+	t.metadata[KeyTitle] = trackerText(b[17:37])
+	t.metadata[KeyTracker] = trackerText(b[38:58])
+
+	var (
+		headerSize  = int64(binary.LittleEndian.Uint32(b[60:64]))
+		channels    = binary.LittleEndian.Uint16(b[68:70])
+		patterns    = int(binary.LittleEndian.Uint16(b[70:72]))
+		instruments = int(binary.LittleEndian.Uint16(b[72:74]))
+		pos         = 60 + headerSize
+	)
+	t.metadata[KeyNumChannels] = strconv.Itoa(int(channels))
+
+	// Skip the patterns.
+	for i := 0; i < patterns; i++ {
+		if pos+9 > int64(len(b)) {
+			return fmt.Errorf("truncated XM pattern %d", i+1)
+		}
+		length := int64(binary.LittleEndian.Uint32(b[pos:]))
+		packed := int64(binary.LittleEndian.Uint16(b[pos+7:]))
+		pos += length + packed
+	}
+
+	// Read the instruments and their samples.
+	var instrumentNames, sampleNames []string
+
+	for i := 0; i < instruments; i++ {
+		if pos+29 > int64(len(b)) {
+			return fmt.Errorf("truncated XM instrument %d", i+1)
+		}
+		var (
+			size             = int64(binary.LittleEndian.Uint32(b[pos:]))
+			samples          = int64(binary.LittleEndian.Uint16(b[pos+27:]))
+			sampleHeaderSize = int64(40)
+		)
+		instrumentNames = append(instrumentNames, trackerText(b[pos+4:pos+26]))
+
+		if samples > 0 {
+			if pos+33 > int64(len(b)) {
+				return fmt.Errorf("truncated XM instrument %d", i+1)
+			}
+			sampleHeaderSize = int64(binary.LittleEndian.Uint32(b[pos+29:]))
+		}
+		pos += size
+
+		// The sample headers are followed by the sample data.
+		var dataSize int64
+
+		for j := int64(0); j < samples; j++ {
+			if sampleHeaderSize < 40 || pos+40 > int64(len(b)) {
+				return fmt.Errorf("truncated XM sample header in instrument %d", i+1)
+			}
+			dataSize += int64(binary.LittleEndian.Uint32(b[pos:]))
+			sampleNames = append(sampleNames, trackerText(b[pos+18:pos+40]))
+			pos += sampleHeaderSize
+		}
+		pos += dataSize
+	}
+	t.setNames(KeyInstruments, KeyInstrumentName, instrumentNames)
+	t.setNames(KeySamples, KeySampleName, sampleNames)
+	return nil
+}
+
+// readIT reads an Impulse Tracker IT file. Instruments and samples are
+// found through tables of offsets that follow the order list.
+func (t tracker) readIT(b []byte) error {
+	if len(b) < 0xc0 {
+		return fmt.Errorf("truncated IT header")
+	}
+	t.metadata[KeyTitle] = trackerText(b[4:30])
+
+	var (
+		orders      = int(binary.LittleEndian.Uint16(b[0x20:]))
+		instruments = int(binary.LittleEndian.Uint16(b[0x22:]))
+		samples     = int(binary.LittleEndian.Uint16(b[0x24:]))
+		table       = 0xc0 + orders
+	)
+	if table+(instruments+samples)*4 > len(b) {
+		return fmt.Errorf("truncated IT offset tables")
+	}
+
+	// Instruments have their name at 0x20 and samples at 0x14.
+	instrumentNames, err := itNames(b, table, instruments, "IMPI", 0x20)
+	if err != nil {
+		return err
+	}
+	sampleNames, err := itNames(b, table+instruments*4, samples, "IMPS", 0x14)
+	if err != nil {
+		return err
+	}
+	t.setNames(KeyInstruments, KeyInstrumentName, instrumentNames)
+	t.setNames(KeySamples, KeySampleName, sampleNames)
+	return nil
+}
+
+// itNames reads the 26-byte names of the instruments or samples of an IT
+// file, given the position of their offset table.
+func itNames(b []byte, table, count int, sig string, nameOffset int) ([]string, error) {
+	names := make([]string, count)
+
+	for i := range names {
+		offset := int64(binary.LittleEndian.Uint32(b[table+i*4:]))
+		if offset+int64(nameOffset)+26 > int64(len(b)) {
+			return nil, fmt.Errorf("truncated IT file")
+		}
+		if expected, got := sig, string(b[offset:offset+4]); expected != got {
+			return nil, fmt.Errorf("expected %s, got %q", expected, got)
+		}
+		names[i] = trackerText(b[offset+int64(nameOffset) : offset+int64(nameOffset)+26])
+	}
+	return names, nil
+}
+
+// readS3M reads a Scream Tracker 3 S3M file. S3M calls its samples
+// instruments; they are stored as samples.
+func (t tracker) readS3M(b []byte) error {
+	if len(b) < 0x60 {
+		return fmt.Errorf("truncated S3M header")
+	}
+	t.metadata[KeyTitle] = trackerText(b[:28])
+
+	var (
+		orders   = int(binary.LittleEndian.Uint16(b[0x20:]))
+		samples  = int(binary.LittleEndian.Uint16(b[0x22:]))
+		table    = 0x60 + orders
+		channels int
+	)
+	// Channels 255 are unused and channels with the high bit set are disabled.
+	for _, setting := range b[0x40:0x60] {
+		if setting < 0x80 {
+			channels++
+		}
+	}
+	t.metadata[KeyNumChannels] = strconv.Itoa(channels)
+
+	if table+samples*2 > len(b) {
+		return fmt.Errorf("truncated S3M instrument table")
+	}
+	names := make([]string, samples)
+
+	for i := range names {
+		// Offsets are stored in 16-byte paragraphs.
+		offset := int64(binary.LittleEndian.Uint16(b[table+i*2:])) * 16
+		if offset+0x50 > int64(len(b)) {
+			return fmt.Errorf("truncated S3M instrument %d", i+1)
+		}
+		names[i] = trackerText(b[offset+0x30 : offset+0x4c])
+	}
+	t.setNames(KeySamples, KeySampleName, names)
+	return nil
+}
+
+// setNames stores a list of names as numbered properties.
+func (t tracker) setNames(countKey string, key func(int) string, names []string) {
+	t.metadata[countKey] = strconv.Itoa(len(names))
+
+	for i, name := range names {
+		t.metadata[key(i+1)] = name
+	}
+}
+
+// trackerText decodes a fixed-size text field, which is padded
+// with NUL bytes or spaces.
+func trackerText(b []byte) string {
+	return strings.TrimRight(decodeLatin1(b), " ")
+}
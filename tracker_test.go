@@ -0,0 +1,76 @@
+package sndtag
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTracker(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		want map[string]string
+	}{
+		{
+			file: "song.mod",
+			want: map[string]string{
+				KeyModuleFormat: ModuleFormatMOD, KeyTitle: "Space Debris", KeyNumChannels: "4",
+				KeySamples: "31", KeySampleName(1): "bass", KeySampleName(2): "snare",
+				KeySampleName(3): "", KeySampleName(31): "last sample",
+			},
+		},
+		{
+			file: "song.xm",
+			want: map[string]string{
+				KeyModuleFormat: ModuleFormatXM, KeyTitle: "Unreal Superhero 3", KeyTracker: "FastTracker v2.00",
+				KeyNumChannels: "8", KeyInstruments: "2", KeyInstrumentName(1): "Lead", KeyInstrumentName(2): "Empty",
+				KeySamples: "2", KeySampleName(1): "lead sample", KeySampleName(2): "lead loop",
+			},
+		},
+		{
+			file: "song.it",
+			want: map[string]string{
+				KeyModuleFormat: ModuleFormatIT, KeyTitle: "Beyond Music",
+				KeyInstruments: "1", KeyInstrumentName(1): "Grand Piano",
+				KeySamples: "2", KeySampleName(1): "Piano C4", KeySampleName(2): "Strings",
+			},
+		},
+		{
+			file: "song.s3m",
+			want: map[string]string{
+				KeyModuleFormat: ModuleFormatS3M, KeyTitle: "2nd Reality", KeyNumChannels: "4",
+				KeySamples: "2", KeySampleName(1): "Kick drum", KeySampleName(2): "Hi-hat",
+			},
+		},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join("testdata", "tracker", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := DetectFormat(b); got != FormatTracker {
+				t.Errorf("DetectFormat: got %s", got)
+			}
+			for name, read := range map[string]func() (map[string]string, error){
+				"New":          func() (map[string]string, error) { return New(bytes.NewReader(b)) },
+				"NewFromBytes": func() (map[string]string, error) { return NewFromBytes(b) },
+			} {
+				metadata, err := read()
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				for key, want := range tc.want {
+					if got, ok := metadata[key]; got != want || !ok {
+						t.Errorf("%s: %s: got %q, want %q", name, key, got, want)
+					}
+				}
+			}
+
+			// Truncated modules fail instead of returning partial names.
+			if _, err := NewFromBytes(b[:len(b)/2]); err == nil {
+				t.Error("truncated module: got no error")
+			}
+		})
+	}
+}
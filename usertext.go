@@ -0,0 +1,113 @@
+package sndtag
+
+import (
+	"strconv"
+	"strings"
+)
+
+// id3v2UserText maps the descriptions of ID3v2 TXXX frames to property
+// names. Descriptions are matched regardless of case.
+var id3v2UserText = map[string]string{
+	"ALBUM ARTIST":                      KeyAlbumArtist,
+	"ALBUMARTIST":                       KeyAlbumArtist,
+	"BARCODE":                           KeyBarcode,
+	"CATALOGNUMBER":                     KeyCatalogNumber,
+	"ITUNESADVISORY":                    KeyAdvisory,
+	"ITUNESGAPLESS":                     KeyGapless,
+	"ITUNESMEDIATYPE":                   KeyMediaKind,
+	"LABEL":                             KeyLabel,
+	"MEDIA":                             KeyMedia,
+	"MUSICBRAINZ ALBUM RELEASE COUNTRY": KeyReleaseCountry,
+	"ORIGINALDATE":                      KeyOriginalReleaseDate,
+	"ORIGINALYEAR":                      KeyOriginalReleaseDate,
+	"RELEASECOUNTRY":                    KeyReleaseCountry,
+	"RELEASEDATE":                       KeyReleaseDate,
+	"REPLAYGAIN_ALBUM_GAIN":             KeyReplayGainAlbumGain,
+	"REPLAYGAIN_ALBUM_PEAK":             KeyReplayGainAlbumPeak,
+	"REPLAYGAIN_TRACK_GAIN":             KeyReplayGainTrackGain,
+	"REPLAYGAIN_TRACK_PEAK":             KeyReplayGainTrackPeak,
+	"WORK":                              KeyWork,
+}
+
+// id3v2UserTextProperties maps the properties that are written to
+// ID3v2 TXXX frames to the descriptions of the frames, which are the
+// ones MusicBrainz Picard uses.
+var id3v2UserTextProperties = map[string]string{
+	KeyBarcode:        "BARCODE",
+	KeyCatalogNumber:  "CATALOGNUMBER",
+	KeyReleaseCountry: "MusicBrainz Album Release Country",
+}
+
+// decodeUserText decodes the data of a TXXX frame,
+// which has a description and a value.
+func decodeUserText(data []byte, cs charsets) (string, string) {
+	if len(data) < 1 {
+		return "", ""
+	}
+	enc := data[0]
+	desc, value := splitTerminated(enc, data[1:])
+
+	return decodeText(enc, desc, cs), decodeText(enc, value, cs)
+}
+
+// userTextProperties returns the properties of a TXXX frame,
+// or nil if its description isn't known.
+func userTextProperties(data []byte, cs charsets) map[string]string {
+	desc, value := decodeUserText(data, cs)
+
+	prop, ok := id3v2UserText[strings.ToUpper(desc)]
+	if !ok {
+		return nil
+	}
+	props := map[string]string{prop: value}
+
+	if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+		if key, name, ok := valueName(prop, n); ok {
+			props[key] = name
+		}
+	}
+	return props
+}
+
+// setUserText replaces the TXXX frames with a description, which is
+// matched regardless of case, keeping the position of the first one.
+// An empty value removes them.
+func (t *id3v2) setUserText(desc, value string) {
+	var (
+		frames   = t.frames[:0]
+		replaced = value == ""
+		data     = t.encodeUserText(desc, value)
+	)
+	for _, frame := range t.frames {
+		if frame.ID != ID3v2FrameUserText {
+			frames = append(frames, frame)
+			continue
+		}
+		content := t.content(frame)
+		if content == nil {
+			frames = append(frames, frame)
+			continue
+		}
+		if d, _ := decodeUserText(content, nil); !strings.EqualFold(d, desc) {
+			frames = append(frames, frame)
+			continue
+		}
+		if !replaced {
+			frames = append(frames, id3v2Frame{ID: ID3v2FrameUserText, Data: data})
+			replaced = true
+		}
+	}
+	if !replaced {
+		frames = append(frames, id3v2Frame{ID: ID3v2FrameUserText, Data: data})
+	}
+	t.frames = frames
+}
+
+// splitNumber splits a number like "3/12" into the number and the total.
+// The total is empty if there isn't one.
+func splitNumber(s string) (string, string) {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	}
+	return strings.TrimSpace(s), ""
+}
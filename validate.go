@@ -0,0 +1,151 @@
+package sndtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/briansorahan/sndtag/vorbiscomment"
+)
+
+// A ValidationError is returned by Write, NewTag and CanonicalID3v2 when
+// a tag they produced is structurally invalid, e.g. a frame too large for
+// its size field, instead of the tag being written. Such a tag would be
+// read back wrongly, or break the file it is written to.
+type ValidationError struct {
+	// Tag is what is invalid, e.g. TagID3v2 or "RIFF LIST chunk".
+	Tag string
+
+	// Offset is the offset in the tag of the invalid part.
+	Offset int64
+
+	Reason string
+}
+
+// Error returns a description of the error.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s at offset %d: %s", e.Tag, e.Offset, e.Reason)
+}
+
+// invalid returns a ValidationError.
+func invalid(tag string, offset int64, format string, args ...interface{}) error {
+	return &ValidationError{Tag: tag, Offset: offset, Reason: fmt.Sprintf(format, args...)}
+}
+
+// validateID3v2 checks an ID3v2 tag as the writers encode it: version 2.3
+// or 2.4 without flags, synchsafe sizes that add up, and zero padding.
+func validateID3v2(b []byte) error {
+	if len(b) < 10 || string(b[:3]) != "ID3" {
+		return invalid(TagID3v2, 0, "missing header")
+	}
+	if major := b[3]; major != 3 && major != 4 {
+		return invalid(TagID3v2, 3, "version 2.%d", major)
+	}
+	if b[5] != 0 {
+		return invalid(TagID3v2, 5, "flags %#x", b[5])
+	}
+	if !isSynchsafe(b[6:10]) {
+		return invalid(TagID3v2, 6, "tag size isn't synchsafe")
+	}
+	if size := synchsafe(b[6:10]); size != int64(len(b)-10) {
+		return invalid(TagID3v2, 6, "tag size %d, the tag has %d bytes", size, len(b)-10)
+	}
+	offset := int64(10)
+	for offset < int64(len(b)) {
+		if b[offset] == 0 {
+			// Padding, which must be all zeros.
+			if i := bytes.IndexFunc(b[offset:], func(r rune) bool { return r != 0 }); i >= 0 {
+				return invalid(TagID3v2, offset+int64(i), "padding isn't zero")
+			}
+			break
+		}
+		if offset+10 > int64(len(b)) {
+			return invalid(TagID3v2, offset, "truncated frame header")
+		}
+		header := b[offset : offset+10]
+		var size int64
+		if b[3] == 4 {
+			if !isSynchsafe(header[4:8]) {
+				return invalid(TagID3v2, offset+4, "size of frame %s isn't synchsafe", header[:4])
+			}
+			size = synchsafe(header[4:8])
+		} else {
+			size = int64(binary.BigEndian.Uint32(header[4:8]))
+		}
+		if offset+10+size > int64(len(b)) {
+			return invalid(TagID3v2, offset+4, "frame %s of %d bytes runs past the end of the tag", header[:4], size)
+		}
+		offset += 10 + size
+	}
+	return nil
+}
+
+// isSynchsafe reports whether b is a synchsafe integer, which doesn't
+// use the top bit of its bytes.
+func isSynchsafe(b []byte) bool {
+	for _, c := range b {
+		if c&0x80 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// validateChunk checks a RIFF chunk that the writers encode, along with
+// the subchunks of LIST chunks and the tags of id3 chunks.
+func validateChunk(id string, data []byte) error {
+	tag := "RIFF " + id + " chunk"
+	if len(id) != 4 {
+		return invalid(tag, 0, "chunk ID of %d bytes", len(id))
+	}
+	if int64(len(data)) > 0xffffffff {
+		return invalid(tag, 4, "chunk of %d bytes doesn't fit in 32 bits", len(data))
+	}
+	switch id {
+	case "LIST":
+		if len(data) < 4 {
+			return invalid(tag, 8, "missing list type")
+		}
+		offset := int64(12)
+		for rest := data[4:]; len(rest) > 0; {
+			if len(rest) < 8 {
+				return invalid(tag, offset, "truncated subchunk header")
+			}
+			length := int64(binary.LittleEndian.Uint32(rest[4:8]))
+			size := 8 + length + length%2
+			if size > int64(len(rest)) {
+				return invalid(tag, offset, "subchunk %s of %d bytes runs past the end of the list", rest[:4], length)
+			}
+			// The pad byte keeps the next subchunk aligned.
+			if length%2 == 1 && rest[size-1] != 0 {
+				return invalid(tag, offset+size-1, "pad byte isn't zero")
+			}
+			rest = rest[size:]
+			offset += size
+		}
+	case "id3 ", "ID3 ":
+		return validateID3v2(data)
+	}
+	return nil
+}
+
+// validateFLACBlock checks a FLAC metadata block, including its header,
+// and the Vorbis comments of VORBIS_COMMENT blocks.
+func validateFLACBlock(b []byte) error {
+	const tag = "FLAC metadata block"
+	if len(b) < 4 {
+		return invalid(tag, 0, "truncated header")
+	}
+	if typ := b[0] & 0x7f; typ == 127 {
+		return invalid(tag, 0, "block type %d", typ)
+	}
+	if length := int(b[1])<<16 | int(b[2])<<8 | int(b[3]); length != len(b)-4 {
+		return invalid(tag, 1, "block length %d, the block has %d bytes", length, len(b)-4)
+	}
+	if b[0]&0x7f == flacBlockVorbisComment {
+		if _, err := vorbiscomment.Decode(b[4:]); err != nil {
+			return invalid(tag, 4, "%s", err)
+		}
+	}
+	return nil
+}
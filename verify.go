@@ -0,0 +1,172 @@
+package sndtag
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ErrNoChecksum is returned by Verify for a file that doesn't have
+// an embedded checksum of its audio data.
+var ErrNoChecksum = errors.New("file has no embedded checksum")
+
+// ErrVerifyUnsupported is wrapped by the error that Verify returns for a
+// file in a format it can't check, see Caps.Verify.
+var ErrVerifyUnsupported = errors.New("verification is not supported")
+
+// A Verification is the result of checking the audio data of a file
+// against the checksum embedded in it.
+type Verification struct {
+	// Format is where the checksum was found: "FLAC" for the MD5 signature
+	// in the STREAMINFO block, which covers the decoded samples, or "WAV"
+	// for the "MD5 " chunk of a WAV file, which covers the data chunk.
+	Format string
+
+	// Expected is the embedded checksum and Computed is the checksum
+	// of the audio data, hex-encoded.
+	Expected string
+	Computed string
+
+	// OK is true if the checksums match.
+	OK bool
+}
+
+// Verify recomputes the checksum of the audio data of a FLAC or WAV file
+// and compares it to the one embedded in the file, e.g. for quality control
+// of an archive. FLAC files are decoded to compute the MD5 of their samples.
+// ID3v2 tags before the FLAC signature are skipped.
+//
+// Verify returns ErrNoChecksum if the file has no checksum, which is the
+// case for FLAC files whose encoder left the MD5 signature empty.
+func Verify(r io.Reader) (Verification, error) {
+	r, header, err := skipID3v2(r)
+	if err != nil {
+		return Verification{}, err
+	}
+	switch {
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return verifyFLAC(r)
+	case len(header) == 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return verifyWav(r)
+	}
+	return Verification{}, fmt.Errorf("%w for header: %q", ErrVerifyUnsupported, header)
+}
+
+// verifyFLAC verifies the MD5 signature of a FLAC stream.
+func verifyFLAC(r io.Reader) (Verification, error) {
+	// Skip the signature.
+	if _, err := io.CopyN(ioutil.Discard, r, 4); err != nil {
+		return Verification{}, err
+	}
+	info, err := readFLACStreamInfo(r)
+	if err != nil {
+		return Verification{}, err
+	}
+	if info.md5 == [16]byte{} {
+		return Verification{}, ErrNoChecksum
+	}
+	h := md5.New()
+	if err := hashFLACSamples(r, info, h); err != nil {
+		return Verification{}, err
+	}
+	return newVerification("FLAC", info.md5[:], h.Sum(nil)), nil
+}
+
+// verifyWav verifies the "MD5 " chunk of a WAV file,
+// which may come before or after the data chunk.
+func verifyWav(r io.Reader) (Verification, error) {
+	// Buffered, so that a missing pad byte can be put back, see skipPadByte.
+	r = bufio.NewReader(r)
+
+	// Skip the RIFF header.
+	if _, err := io.CopyN(ioutil.Discard, r, 12); err != nil {
+		return Verification{}, err
+	}
+	var (
+		h        = md5.New()
+		expected []byte
+		hasData  bool
+	)
+	for {
+		id, length, data, err := readChunk(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Verification{}, err
+		}
+		switch id {
+		case "data":
+			n, err := io.Copy(h, data)
+			if err != nil {
+				return Verification{}, err
+			}
+			if n != int64(length) {
+				return Verification{}, fmt.Errorf("truncated data chunk")
+			}
+			hasData = true
+		case "MD5 ":
+			if length != md5.Size {
+				return Verification{}, fmt.Errorf("MD5 chunk of %d bytes, expected %d", length, md5.Size)
+			}
+			expected = make([]byte, md5.Size)
+			if _, err := io.ReadFull(data, expected); err != nil {
+				return Verification{}, fmt.Errorf("truncated MD5 chunk")
+			}
+		}
+		if _, err := io.Copy(ioutil.Discard, data); err != nil {
+			return Verification{}, err
+		}
+		if err := skipPadByte(r, length); err != nil {
+			return Verification{}, err
+		}
+	}
+	if expected == nil {
+		return Verification{}, ErrNoChecksum
+	}
+	if !hasData {
+		return Verification{}, fmt.Errorf("WAV file has no data chunk")
+	}
+	return newVerification("WAV", expected, h.Sum(nil)), nil
+}
+
+// skipID3v2 skips the ID3v2 tags at the start of r, and returns a reader
+// positioned after them along with the 12 bytes that follow, or fewer if
+// the file is shorter.
+func skipID3v2(r io.Reader) (io.Reader, []byte, error) {
+	header, err := readHeader(r, 12)
+	if err != nil {
+		return nil, nil, err
+	}
+	r = io.MultiReader(bytes.NewReader(header), r)
+
+	for bytes.HasPrefix(header, []byte("ID3")) && len(header) >= 10 {
+		size := 10 + synchsafe(header[6:10])
+		if header[5]&id3v2FlagFooter != 0 {
+			size += id3v2FooterSize
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, size); err != nil {
+			return nil, nil, fmt.Errorf("truncated ID3v2 tag")
+		}
+		if header, err = readHeader(r, 12); err != nil {
+			return nil, nil, err
+		}
+		r = io.MultiReader(bytes.NewReader(header), r)
+	}
+	return r, header, nil
+}
+
+// newVerification compares an embedded checksum to a computed one.
+func newVerification(format string, expected, computed []byte) Verification {
+	return Verification{
+		Format:   format,
+		Expected: hex.EncodeToString(expected),
+		Computed: hex.EncodeToString(computed),
+		OK:       bytes.Equal(expected, computed),
+	}
+}
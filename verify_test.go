@@ -0,0 +1,99 @@
+package sndtag
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	const digest = "b8800963ba2cda426368ece81b1ba5f8"
+
+	var (
+		flac = testAudio(t, "tone.flac")
+		wav  = testAudio(t, "tone.wav")
+
+		// The MD5 signature is 18 bytes into STREAMINFO, after the
+		// signature and the block header.
+		signature = 4 + 4 + 18
+	)
+	for _, tc := range []struct {
+		name     string
+		file     []byte
+		want     Verification
+		err      error
+		anyError bool
+	}{
+		{
+			name: "FLAC",
+			file: flac,
+			want: Verification{Format: "FLAC", Expected: digest, Computed: digest, OK: true},
+		},
+		{
+			name: "WAV",
+			file: wav,
+			want: Verification{Format: "WAV", Expected: digest, Computed: digest, OK: true},
+		},
+		{
+			name: "FLAC after an ID3v2 tag",
+			file: append(testID3v2(4, testTextFrame("TIT2", "Tone")), flac...),
+			want: Verification{Format: "FLAC", Expected: digest, Computed: digest, OK: true},
+		},
+		{
+			name: "FLAC with another signature",
+			file: append(append(append([]byte(nil), flac[:signature]...), 0xff), flac[signature+1:]...),
+			want: Verification{Format: "FLAC", Expected: "ff" + digest[2:], Computed: digest},
+		},
+		{
+			name: "WAV with a changed sample",
+			file: append(append(append([]byte(nil), wav[:44]...), 0xff), wav[45:]...),
+			want: Verification{Format: "WAV", Expected: digest, Computed: "95f9e82b534d92e79e1130e3158707e4"},
+		},
+		{
+			name: "FLAC without a signature",
+			file: append(append(append([]byte(nil), flac[:signature]...), make([]byte, 16)...), flac[signature+16:]...),
+			err:  ErrNoChecksum,
+		},
+		{
+			name: "WAV without an MD5 chunk",
+			file: testWav(),
+			err:  ErrNoChecksum,
+		},
+		{
+			name: "AIFF",
+			file: testAudio(t, "tone.aiff"),
+			err:  ErrVerifyUnsupported,
+		},
+		{
+			name:     "truncated FLAC",
+			file:     flac[:len(flac)/2],
+			anyError: true,
+		},
+		{
+			name:     "WAV with a short MD5 chunk",
+			file:     testWav(testChunk("MD5 ", make([]byte, 8))),
+			anyError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Verify(bytes.NewReader(tc.file))
+			switch {
+			case tc.anyError:
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			case tc.err != nil:
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("got error %v, want %v", err, tc.err)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
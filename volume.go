@@ -0,0 +1,266 @@
+package sndtag
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A VolumeChannel is the channel a volume adjustment applies to,
+// as numbered in ID3v2.4 RVA2 frames.
+type VolumeChannel byte
+
+// Volume channels.
+const (
+	VolumeChannelOther VolumeChannel = iota
+	VolumeChannelMaster
+	VolumeChannelFrontRight
+	VolumeChannelFrontLeft
+	VolumeChannelBackRight
+	VolumeChannelBackLeft
+	VolumeChannelFrontCentre
+	VolumeChannelBackCentre
+	VolumeChannelSubwoofer
+)
+
+// volumeChannelNames are the names of the volume channels in keys.
+var volumeChannelNames = [...]string{
+	"Other",
+	"Master",
+	"FrontRight",
+	"FrontLeft",
+	"BackRight",
+	"BackLeft",
+	"FrontCentre",
+	"BackCentre",
+	"Subwoofer",
+}
+
+// String returns the name of the channel, e.g. "FrontLeft".
+func (c VolumeChannel) String() string {
+	if int(c) < len(volumeChannelNames) {
+		return volumeChannelNames[c]
+	}
+	return "Channel" + strconv.Itoa(int(c))
+}
+
+// ChannelVolume is the volume adjustment of a channel.
+type ChannelVolume struct {
+	Channel VolumeChannel
+
+	// Gain is the adjustment in dB, from -64 to +64.
+	Gain float64
+
+	// Peak is the peak amplitude of the channel, where 1 is full scale,
+	// or 0 if the frame has no peak.
+	Peak float64
+}
+
+// RelativeVolume is the content of an ID3v2.4 RVA2 frame, which adjusts
+// the volume of some channels for playback, like ReplayGain does.
+type RelativeVolume struct {
+	// Identification tells adjustments apart, e.g. "track" or "album".
+	Identification string
+	Channels       []ChannelVolume
+}
+
+// Gain returns the adjustment of a channel, falling back to the master
+// volume. The second return value is false if neither is adjusted.
+func (v RelativeVolume) Gain(channel VolumeChannel) (float64, bool) {
+	var (
+		master float64
+		ok     bool
+	)
+	for _, c := range v.Channels {
+		if c.Channel == channel {
+			return c.Gain, true
+		}
+		if c.Channel == VolumeChannelMaster {
+			master, ok = c.Gain, true
+		}
+	}
+	return master, ok
+}
+
+// decodeRelativeVolume decodes the data of an RVA2 frame.
+func decodeRelativeVolume(data []byte) RelativeVolume {
+	id, rest := splitTerminated(0, data)
+
+	v := RelativeVolume{Identification: decodeLatin1(id)}
+	for len(rest) >= 4 {
+		var (
+			channel = VolumeChannel(rest[0])
+			gain    = float64(int16(binary.BigEndian.Uint16(rest[1:3]))) / 512
+			bits    = int(rest[3])
+			n       = (bits + 7) / 8
+		)
+		if len(rest) < 4+n {
+			break
+		}
+		var peak float64
+		for _, b := range rest[4 : 4+n] {
+			peak = peak*256 + float64(b)
+		}
+		if bits > 0 {
+			// Full scale is half the range of the bits.
+			peak = math.Ldexp(peak, 1-bits)
+		}
+		v.Channels = append(v.Channels, ChannelVolume{Channel: channel, Gain: gain, Peak: peak})
+		rest = rest[4+n:]
+	}
+	return v
+}
+
+// setRelativeVolumes stores RVA2 frames as properties.
+// Each frame is stored as "RelativeVolume<n>Identification" and, for each
+// channel it adjusts, "RelativeVolume<n><Channel>Gain" and
+// "RelativeVolume<n><Channel>Peak", e.g. "RelativeVolume1MasterGain",
+// counting from 1, and the number of frames is stored as "RelativeVolumes".
+func setRelativeVolumes(metadata map[string]string, volumes []RelativeVolume) {
+	if len(volumes) == 0 {
+		return
+	}
+	metadata[KeyRelativeVolumes] = strconv.Itoa(len(volumes))
+
+	for i, v := range volumes {
+		metadata[KeyRelativeVolumeIdentification(i+1)] = v.Identification
+		for _, c := range v.Channels {
+			metadata[KeyRelativeVolumeGain(i+1, c.Channel)] = formatDecibels(c.Gain)
+			if c.Peak != 0 {
+				metadata[KeyRelativeVolumePeak(i+1, c.Channel)] = strconv.FormatFloat(c.Peak, 'f', 6, 64)
+			}
+		}
+	}
+}
+
+// RelativeVolumes returns the RVA2 frames stored in a metadata map,
+// in the order they appear in the file, with their channels in the order
+// of the VolumeChannel constants.
+func RelativeVolumes(metadata map[string]string) []RelativeVolume {
+	count := listCount(metadata, KeyRelativeVolumes)
+	if count == 0 {
+		return nil
+	}
+	volumes := make([]RelativeVolume, 0, count)
+
+	for i := 1; i <= count; i++ {
+		v := RelativeVolume{Identification: metadata[KeyRelativeVolumeIdentification(i)]}
+		for c := range volumeChannelNames {
+			channel := VolumeChannel(c)
+			gain, err := strconv.ParseFloat(metadata[KeyRelativeVolumeGain(i, channel)], 64)
+			if err != nil {
+				continue
+			}
+			peak, _ := strconv.ParseFloat(metadata[KeyRelativeVolumePeak(i, channel)], 64)
+			v.Channels = append(v.Channels, ChannelVolume{Channel: channel, Gain: gain, Peak: peak})
+		}
+		volumes = append(volumes, v)
+	}
+	return volumes
+}
+
+// Interpolation methods of equalization curves.
+const (
+	// InterpolationBand means the gain of a point applies up to the
+	// next point.
+	InterpolationBand = "band"
+
+	// InterpolationLinear means the gain changes linearly between points.
+	InterpolationLinear = "linear"
+)
+
+// EqualizationPoint is a point of an equalization curve.
+type EqualizationPoint struct {
+	// Frequency is in Hz, from 0 to 32767.5.
+	Frequency float64
+
+	// Gain is the adjustment in dB, from -64 to +64.
+	Gain float64
+}
+
+// Equalization is the content of an ID3v2.4 EQU2 frame, which is an
+// equalization curve for playback.
+type Equalization struct {
+	Identification string
+
+	// Interpolation is InterpolationBand or InterpolationLinear.
+	Interpolation string
+	Points        []EqualizationPoint
+}
+
+// decodeEqualization decodes the data of an EQU2 frame.
+func decodeEqualization(data []byte) Equalization {
+	if len(data) < 1 {
+		return Equalization{}
+	}
+	id, rest := splitTerminated(0, data[1:])
+
+	e := Equalization{Identification: decodeLatin1(id), Interpolation: InterpolationBand}
+	if data[0] == 1 {
+		e.Interpolation = InterpolationLinear
+	}
+	for ; len(rest) >= 4; rest = rest[4:] {
+		e.Points = append(e.Points, EqualizationPoint{
+			Frequency: float64(binary.BigEndian.Uint16(rest)) / 2,
+			Gain:      float64(int16(binary.BigEndian.Uint16(rest[2:]))) / 512,
+		})
+	}
+	return e
+}
+
+// setEqualizations stores EQU2 frames as properties.
+// Each frame is stored as "Equalization<n>Identification",
+// "Equalization<n>Interpolation" and "Equalization<n>Points", which holds
+// the points as frequency:gain pairs separated by spaces, e.g.
+// "100:-3 1000:1.5", counting from 1, and the number of frames is stored
+// as "Equalizations".
+func setEqualizations(metadata map[string]string, eqs []Equalization) {
+	if len(eqs) == 0 {
+		return
+	}
+	metadata[KeyEqualizations] = strconv.Itoa(len(eqs))
+
+	for i, e := range eqs {
+		points := make([]string, len(e.Points))
+		for j, p := range e.Points {
+			points[j] = strconv.FormatFloat(p.Frequency, 'f', -1, 64) + ":" + formatDecibels(p.Gain)
+		}
+		metadata[KeyEqualizationIdentification(i+1)] = e.Identification
+		metadata[KeyEqualizationInterpolation(i+1)] = e.Interpolation
+		metadata[KeyEqualizationPoints(i+1)] = strings.Join(points, " ")
+	}
+}
+
+// Equalizations returns the EQU2 frames stored in a metadata map,
+// in the order they appear in the file.
+func Equalizations(metadata map[string]string) []Equalization {
+	count := listCount(metadata, KeyEqualizations)
+	if count == 0 {
+		return nil
+	}
+	eqs := make([]Equalization, 0, count)
+
+	for i := 1; i <= count; i++ {
+		e := Equalization{
+			Identification: metadata[KeyEqualizationIdentification(i)],
+			Interpolation:  metadata[KeyEqualizationInterpolation(i)],
+		}
+		for _, point := range strings.Fields(metadata[KeyEqualizationPoints(i)]) {
+			freq, gain, _ := strings.Cut(point, ":")
+			f, err1 := strconv.ParseFloat(freq, 64)
+			g, err2 := strconv.ParseFloat(gain, 64)
+			if err1 == nil && err2 == nil {
+				e.Points = append(e.Points, EqualizationPoint{Frequency: f, Gain: g})
+			}
+		}
+		eqs = append(eqs, e)
+	}
+	return eqs
+}
+
+// formatDecibels formats a gain in dB. Gains are multiples of 1/512 dB,
+// which the shortest representation formats exactly.
+func formatDecibels(gain float64) string {
+	return strconv.FormatFloat(gain, 'f', -1, 64)
+}
@@ -0,0 +1,132 @@
+// Package vorbiscomment reads and writes Vorbis comments, the tags of
+// FLAC, Ogg Vorbis and Opus files, at the level of their fields.
+// See https://xiph.org/vorbis/doc/v-comment.html.
+//
+// Vorbis comments are a vendor string and a list of fields like
+// "ARTIST=Someone". Field names are case-insensitive ASCII and a name
+// can appear several times, e.g. for several artists.
+package vorbiscomment
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// A Field is a field of Vorbis comments.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Comments are the fields of Vorbis comments, in order.
+type Comments struct {
+	Vendor string
+	Fields []Field
+}
+
+// Get returns the values of the fields with a name, regardless of case.
+func (c *Comments) Get(name string) []string {
+	var values []string
+	for _, f := range c.Fields {
+		if strings.EqualFold(f.Name, name) {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// Add adds a field.
+func (c *Comments) Add(name, value string) {
+	c.Fields = append(c.Fields, Field{Name: name, Value: value})
+}
+
+// Set replaces the fields with a name, regardless of case, with a field
+// for each value, where the first of them was. They are added at the end
+// if there are none. No values removes the fields.
+func (c *Comments) Set(name string, values ...string) {
+	var (
+		fields   = make([]Field, 0, len(c.Fields)+len(values))
+		replaced bool
+	)
+	for _, f := range c.Fields {
+		if !strings.EqualFold(f.Name, name) {
+			fields = append(fields, f)
+			continue
+		}
+		if !replaced {
+			for _, v := range values {
+				fields = append(fields, Field{Name: name, Value: v})
+			}
+			replaced = true
+		}
+	}
+	if !replaced {
+		for _, v := range values {
+			fields = append(fields, Field{Name: name, Value: v})
+		}
+	}
+	c.Fields = fields
+}
+
+// Decode decodes Vorbis comments, e.g. the data of a FLAC VORBIS_COMMENT
+// metadata block. The framing bit of Ogg Vorbis comment headers, if
+// there is one, is ignored.
+func Decode(b []byte) (*Comments, error) {
+	var (
+		c   = &Comments{}
+		err error
+	)
+	if c.Vendor, b, err = readString(b); err != nil {
+		return nil, fmt.Errorf("vendor string: %w", err)
+	}
+	if len(b) < 4 {
+		return nil, fmt.Errorf("truncated Vorbis comment count")
+	}
+	n := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+
+	// Every field takes up 4 bytes or more.
+	if int64(n) > int64(len(b))/4 {
+		return nil, fmt.Errorf("%d Vorbis comments don't fit in %d bytes", n, len(b))
+	}
+	for i := uint32(0); i < n; i++ {
+		var s string
+		if s, b, err = readString(b); err != nil {
+			return nil, fmt.Errorf("comment %d: %w", i+1, err)
+		}
+		name, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("comment %d has no '=': %q", i+1, s)
+		}
+		c.Fields = append(c.Fields, Field{Name: name, Value: value})
+	}
+	return c, nil
+}
+
+// readString reads a string that is preceded by its length.
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 4 {
+		return "", nil, fmt.Errorf("truncated length")
+	}
+	n := binary.LittleEndian.Uint32(b)
+	if int64(n) > int64(len(b)-4) {
+		return "", nil, fmt.Errorf("length %d exceeds remaining %d bytes", n, len(b)-4)
+	}
+	return string(b[4 : 4+n]), b[4+n:], nil
+}
+
+// Encode encodes the comments, without the framing bit of Ogg Vorbis
+// comment headers.
+func (c *Comments) Encode() []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(c.Vendor)))
+	b = append(b, c.Vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(c.Fields)))
+	for _, f := range c.Fields {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(f.Name)+1+len(f.Value)))
+		b = append(b, f.Name...)
+		b = append(b, '=')
+		b = append(b, f.Value...)
+	}
+	return b
+}
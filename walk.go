@@ -0,0 +1,209 @@
+package sndtag
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// An Object is a file in a Store.
+type Object struct {
+	// Key identifies the file in the store, e.g. its path.
+	Key string
+
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// Archive is the key of the zip or tar archive that holds the file,
+	// if any, in which case Key is the path of the file in the archive.
+	Archive string
+}
+
+// A Store lists and opens files, e.g. the files in a directory
+// or the objects in a bucket.
+type Store interface {
+	// List calls fn for every file in the store,
+	// and stops when fn returns an error.
+	List(ctx context.Context, fn func(Object) error) error
+
+	// Open opens a file. The metadata at the end of a file, like APEv2
+	// and ID3v1 tags, is only read if the file is also an io.Seeker.
+	Open(ctx context.Context, obj Object) (io.ReadCloser, error)
+}
+
+// A Result is the metadata read from a file by Walk.
+type Result struct {
+	Object   Object
+	Metadata map[string]string
+
+	// Err is the error opening or parsing the file.
+	Err error
+}
+
+// Walk reads the metadata of every file in store with the given number of
+// workers, and calls fn with each result in the calling goroutine, in the
+// order the files are done. Files that can't be opened or parsed are passed
+// to fn with their error. With WithFilter, only the files that match the
+// filter are passed to fn. Walk stops when fn returns an error, when listing
+// the files fails, or when ctx is done, and returns the error. Walk returns
+// once all of its goroutines have stopped and all the files it opened are
+// closed, so it can be cancelled mid-scan in a long-running process; a
+// Store whose List or Open ignore ctx can delay that.
+//
+// Walk descends into zip and tar archives, including gzipped tar archives,
+// which are recognized by their extension. The files in an archive are
+// passed to fn instead of the archive itself.
+func Walk(ctx context.Context, store Store, workers int, fn func(Result) error, opts ...Option) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		objects = make(chan Object)
+		results = make(chan Result)
+		listErr = make(chan error, 1)
+		wg      sync.WaitGroup
+	)
+	go func() {
+		defer close(objects)
+
+		listErr <- store.List(ctx, func(obj Object) error {
+			select {
+			case objects <- obj:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx))
+	o := newOptions(opts)
+	if o.editLists {
+		opts = append(opts, withEditIndex(newEditIndex(store)))
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			send := func(result Result) error {
+				select {
+				case results <- result:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			for obj := range objects {
+				var err error
+				if isArchive(obj.Key) {
+					err = walkArchive(ctx, store, obj, opts, send)
+				} else {
+					err = send(readObject(ctx, store, obj, opts))
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var err error
+	for result := range results {
+		if result.Err == nil && o.filter != nil && !o.filter.Match(result.Metadata) {
+			continue
+		}
+		if err == nil {
+			if err = fn(result); err != nil {
+				cancel()
+			}
+		}
+	}
+	// The lister is done too once the workers are, since they only stop
+	// when it closes objects or ctx is done. Waiting for it means that no
+	// goroutine outlives Walk.
+	listed := <-listErr
+	if err != nil {
+		return err
+	}
+	if listed != nil {
+		return listed
+	}
+	return ctx.Err()
+}
+
+// readObject opens a file in a store and reads its metadata.
+func readObject(ctx context.Context, store Store, obj Object, opts []Option) Result {
+	rc, err := store.Open(ctx, obj)
+	if err != nil {
+		return Result{Object: obj, Err: err}
+	}
+	defer rc.Close()
+
+	o := newOptions(opts)
+	if format := editListFormat(obj.Key); o.editLists && format != "" {
+		events, err := parseEditList(rc, format)
+		if err != nil {
+			return Result{Object: obj, Err: err}
+		}
+		return Result{Object: obj, Metadata: o.styleKeys(editListMetadata(format, events))}
+	}
+
+	// The keys are styled once the sidecars and the edit lists are merged.
+	metadata, err := New(rc, append(opts[:len(opts):len(opts)], WithKeyStyle(CamelCase), withExtension(obj.Key))...)
+	if err != nil {
+		return Result{Object: obj, Err: err}
+	}
+	if o.sidecars {
+		o.mergeSidecars(ctx, store, obj.Key, metadata)
+	}
+	if o.editIndex != nil {
+		o.editIndex.link(ctx, obj.Key, metadata)
+	}
+	return Result{Object: obj, Metadata: o.styleKeys(metadata)}
+}
+
+// DirStore returns a Store with the regular files in a directory
+// and its subdirectories. The keys are the paths of the files.
+func DirStore(root string) Store {
+	return dirStore(root)
+}
+
+// dirStore is a Store with the files in a directory tree.
+type dirStore string
+
+// List calls fn for every regular file in the directory tree.
+// The keys start with the root as it was given, even if the tree
+// is walked from an extended-length path on Windows.
+func (d dirStore) List(ctx context.Context, fn func(Object) error) error {
+	root := walkRoot(string(d))
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return fn(Object{Key: filepath.Join(string(d), strings.TrimPrefix(path, root)), Size: info.Size()})
+	})
+}
+
+// Open opens a file.
+func (d dirStore) Open(ctx context.Context, obj Object) (io.ReadCloser, error) {
+	return os.Open(osPath(obj.Key))
+}
@@ -0,0 +1,110 @@
+package sndtag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// checkGoroutines fails the test if goroutines that were started after
+// base was taken are still running, giving them a moment to return.
+func checkGoroutines(t *testing.T, base int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines are still running, want %d", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testLibrary writes n WAV files with a title to a temporary directory.
+func testLibrary(t *testing.T, n int) string {
+	dir := t.TempDir()
+	for i := 0; i < n; i++ {
+		data := testWav(testInfoList(testChunk(INFOChunkTitle, []byte(fmt.Sprintf("Song %d\x00", i)))))
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.wav", i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestWalkCancel(t *testing.T) {
+	dir := testLibrary(t, 50)
+	stop := errors.New("stop")
+
+	for _, tc := range []struct {
+		name string
+		stop func(cancel context.CancelFunc) error
+		want error
+	}{
+		{"cancel", func(cancel context.CancelFunc) error { cancel(); return nil }, context.Canceled},
+		{"error", func(context.CancelFunc) error { return stop }, stop},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			base := runtime.NumGoroutine()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			err := Walk(ctx, DirStore(dir), 4, func(Result) error { return tc.stop(cancel) })
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+			checkGoroutines(t, base)
+		})
+	}
+}
+
+func TestWriteQueueCancel(t *testing.T) {
+	dir := testLibrary(t, 20)
+	base := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &WriteQueue{Workers: 2, Interval: 50 * time.Millisecond, Context: ctx}
+	for i := 0; i < 20; i++ {
+		if err := q.Add(filepath.Join(dir, fmt.Sprintf("%02d.wav", i)), TagSet{KeyArtist: "Artist"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+
+	// Nothing needs to be received from Results for the queue to stop.
+	checkGoroutines(t, base)
+	if err := q.Add(filepath.Join(dir, "00.wav"), TagSet{KeyArtist: "Artist"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Add after cancel: got %v, want %v", err, ErrQueueClosed)
+	}
+
+	// The files that weren't written are untouched and no copies are left.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 20 {
+		t.Errorf("got %d files, want 20", len(entries))
+	}
+	for _, e := range entries {
+		metadata, err := readTestFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Errorf("%s: %s", e.Name(), err)
+		}
+		if a := metadata[KeyArtist]; a != "" && a != "Artist" {
+			t.Errorf("%s: Artist %q", e.Name(), a)
+		}
+	}
+}
+
+// readTestFile reads the properties of a file.
+func readTestFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromBytes(b)
+}
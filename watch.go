@@ -0,0 +1,279 @@
+package sndtag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Notifier reports the paths of files that may have changed.
+// An fsnotify.Watcher can be adapted by sending the names of its
+// events on a channel; NewPoller returns one that needs no dependencies.
+type Notifier interface {
+	// Changes returns the channel the paths are sent on,
+	// which is closed when the notifier is closed.
+	Changes() <-chan string
+	Close() error
+}
+
+// A PropertyChange is a property that was added, changed or removed.
+// Old is empty for a property that was added, and New is empty for
+// a property that was removed.
+type PropertyChange struct {
+	Key string
+	Old string
+	New string
+}
+
+// A Change is an event sent by a Watcher when the metadata of a file changes.
+type Change struct {
+	Path string
+
+	// Properties are the properties that changed, sorted by key.
+	Properties []PropertyChange
+
+	// Removed is true if the file was removed,
+	// in which case all its properties are removed too.
+	Removed bool
+
+	// Err is the error reading the file, if any. It is only sent again
+	// once the file changes.
+	Err error
+}
+
+// Diff returns the properties that differ between two sets of metadata,
+// sorted by key.
+func Diff(before, after map[string]string) []PropertyChange {
+	var changes []PropertyChange
+
+	for k, v := range before {
+		if av, ok := after[k]; !ok || av != v {
+			changes = append(changes, PropertyChange{Key: k, Old: v, New: av})
+		}
+	}
+	for k, v := range after {
+		if _, ok := before[k]; !ok {
+			changes = append(changes, PropertyChange{Key: k, New: v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// A Watcher re-reads the files reported by a Notifier and sends the changes
+// to their metadata, e.g. to keep the index of a media server current.
+// The first time a file is reported all its properties are added. Files
+// that aren't audio, like cover images and cue sheets, are left out.
+type Watcher struct {
+	notifier Notifier
+	opts     []Option
+
+	mu       sync.Mutex
+	metadata map[string]map[string]string
+
+	// failed holds the state of the files that couldn't be read,
+	// so that their error is only sent again once they change.
+	failed map[string]fileState
+}
+
+// NewWatcher returns a Watcher for the files reported by n.
+// The options are used to read the files.
+func NewWatcher(n Notifier, opts ...Option) *Watcher {
+	return &Watcher{
+		notifier: n,
+		opts:     opts,
+		metadata: map[string]map[string]string{},
+		failed:   map[string]fileState{},
+	}
+}
+
+// Metadata returns the last metadata read from a file, or nil if
+// it hasn't been read. The map must not be modified.
+func (w *Watcher) Metadata(path string) map[string]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.metadata[path]
+}
+
+// Run reads the files reported by the notifier and calls fn for the ones
+// whose metadata changed, including the ones that can't be read, which are
+// reported once until they change. Files whose format isn't recognized are
+// skipped, or reported as removed if they were read before. Run stops when
+// fn returns an error, when ctx is done, or when the notifier is closed,
+// and returns the error. The notifier isn't closed by Run.
+func (w *Watcher) Run(ctx context.Context, fn func(Change) error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case path, ok := <-w.notifier.Changes():
+			if !ok {
+				return nil
+			}
+			change, changed := w.update(ctx, path)
+			if !changed {
+				continue
+			}
+			if err := fn(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// update reads a file and returns how its metadata changed,
+// and whether it did.
+func (w *Watcher) update(ctx context.Context, path string) (Change, bool) {
+	metadata, err := readFile(ctx, path, w.opts)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	old, known := w.metadata[path]
+	switch {
+	case os.IsNotExist(err), errors.Is(err, ErrUnrecognizedFormat):
+		delete(w.failed, path)
+		if !known {
+			return Change{}, false
+		}
+		delete(w.metadata, path)
+		return Change{Path: path, Properties: Diff(old, nil), Removed: true}, true
+	case err != nil:
+		var state fileState
+		if info, statErr := os.Stat(osPath(path)); statErr == nil {
+			state = fileState{size: info.Size(), modTime: info.ModTime()}
+		}
+		if failed, ok := w.failed[path]; ok && failed.size == state.size && failed.modTime.Equal(state.modTime) {
+			return Change{}, false
+		}
+		w.failed[path] = state
+		return Change{Path: path, Err: err}, true
+	}
+	delete(w.failed, path)
+	w.metadata[path] = metadata
+
+	changes := Diff(old, metadata)
+	if known && len(changes) == 0 {
+		return Change{}, false
+	}
+	return Change{Path: path, Properties: changes}, true
+}
+
+// readFile reads the metadata of a file.
+func readFile(ctx context.Context, path string, opts []Option) (map[string]string, error) {
+	f, err := os.Open(osPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx))
+	o := newOptions(opts)
+	if !o.sidecars {
+		return New(f, opts...)
+	}
+
+	// The keys are styled once the sidecars are merged.
+	metadata, err := New(f, append(opts, WithKeyStyle(CamelCase))...)
+	if err != nil {
+		return nil, err
+	}
+	o.mergeSidecars(ctx, dirStore(""), path, metadata)
+	return o.styleKeys(metadata), nil
+}
+
+// poller is a Notifier that polls a directory tree.
+type poller struct {
+	changes chan string
+	done    chan struct{}
+	once    sync.Once
+}
+
+// fileState is what a poller compares to tell if a file changed.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewPoller returns a Notifier that walks a directory tree every interval
+// and reports the regular files that were added, modified or removed since
+// the last walk. All the files are reported after the first walk.
+func NewPoller(root string, interval time.Duration) Notifier {
+	p := &poller{
+		changes: make(chan string),
+		done:    make(chan struct{}),
+	}
+	go p.poll(root, interval)
+	return p
+}
+
+// Changes returns the channel the paths are sent on.
+func (p *poller) Changes() <-chan string {
+	return p.changes
+}
+
+// Close stops polling.
+func (p *poller) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
+
+// poll walks the directory tree until the poller is closed.
+func (p *poller) poll(root string, interval time.Duration) {
+	defer close(p.changes)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		files  = map[string]fileState{}
+		walked = walkRoot(root)
+	)
+	for {
+		seen := map[string]fileState{}
+
+		// Files that can't be walked are left out, which reports them as removed.
+		_ = filepath.Walk(walked, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				seen[filepath.Join(root, strings.TrimPrefix(path, walked))] = fileState{size: info.Size(), modTime: info.ModTime()}
+			}
+			return nil
+		})
+		var changed []string
+		for path, state := range seen {
+			if old, ok := files[path]; !ok || old.size != state.size || !old.modTime.Equal(state.modTime) {
+				changed = append(changed, path)
+			}
+		}
+		for path := range files {
+			if _, ok := seen[path]; !ok {
+				changed = append(changed, path)
+			}
+		}
+		files = seen
+
+		sort.Strings(changed)
+		for _, path := range changed {
+			select {
+			case p.changes <- path:
+			case <-p.done:
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sndtag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// describeChange summarizes a change for comparison.
+func describeChange(c Change) string {
+	switch {
+	case c.Err != nil:
+		return filepath.Base(c.Path) + ": error"
+	case c.Removed:
+		return filepath.Base(c.Path) + ": removed"
+	}
+	return fmt.Sprintf("%s: %d properties", filepath.Base(c.Path), len(c.Properties))
+}
+
+func TestWatcherUpdate(t *testing.T) {
+	var (
+		dir   = t.TempDir()
+		flac  = testAudio(t, "tone.flac")
+		cover = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+		cue   = []byte("REM GENRE Ambient\nFILE \"tone.flac\" WAVE\n")
+		w     = NewWatcher(nil)
+	)
+	write := func(name string, b []byte) func() error {
+		return func() error { return os.WriteFile(filepath.Join(dir, name), b, 0644) }
+	}
+	remove := func(name string) func() error {
+		return func() error { return os.Remove(filepath.Join(dir, name)) }
+	}
+	for _, step := range []struct {
+		name   string
+		do     func() error
+		path   string
+		change string
+	}{
+		{name: "audio file", do: write("tone.flac", flac), path: "tone.flac", change: "tone.flac: 6 properties"},
+		{name: "unchanged audio file", path: "tone.flac"},
+		{name: "cover", do: write("cover.jpg", cover), path: "cover.jpg"},
+		{name: "cue sheet", do: write("album.cue", cue), path: "album.cue"},
+		{name: "unreadable file", do: write("broken.mpc", []byte("MPCK")), path: "broken.mpc", change: "broken.mpc: error"},
+		{name: "unchanged unreadable file", path: "broken.mpc"},
+		{name: "changed unreadable file", do: write("broken.mpc", []byte("MPCKSE\x03")), path: "broken.mpc", change: "broken.mpc: error"},
+		{name: "removed unreadable file", do: remove("broken.mpc"), path: "broken.mpc"},
+		{name: "recreated unreadable file", do: write("broken.mpc", []byte("MPCK")), path: "broken.mpc", change: "broken.mpc: error"},
+		{name: "audio file that isn't audio anymore", do: write("tone.flac", cover), path: "tone.flac", change: "tone.flac: removed"},
+		{name: "removed cover", do: remove("cover.jpg"), path: "cover.jpg"},
+	} {
+		if step.do != nil {
+			if err := step.do(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		change, changed := w.update(context.Background(), filepath.Join(dir, step.path))
+		var got string
+		if changed {
+			got = describeChange(change)
+		}
+		if got != step.change {
+			t.Errorf("%s: got change %q, want %q", step.name, got, step.change)
+		}
+	}
+}
+
+func TestWatcherPoller(t *testing.T) {
+	dir := t.TempDir()
+	for name, b := range map[string][]byte{
+		"tone.flac":  testAudio(t, "tone.flac"),
+		"cover.jpg":  []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"),
+		"album.cue":  []byte("REM GENRE Ambient\n"),
+		"notes.txt":  []byte("notes\n"),
+		"broken.mpc": []byte("MPCK"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := runtime.NumGoroutine()
+
+	// The files are polled many times, but only reported once.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	p := NewPoller(dir, 5*time.Millisecond)
+
+	var got []string
+	err := NewWatcher(p).Run(ctx, func(c Change) error {
+		got = append(got, describeChange(c))
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	p.Close()
+	checkGoroutines(t, base)
+
+	if want := []string{"broken.mpc: error", "tone.flac: 6 properties"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -5,175 +5,590 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"strconv"
+
+	"github.com/briansorahan/sndtag/riff"
 )
 
+// wavInfoChunks maps the subchunks of an INFO list to property names.
+var wavInfoChunks = map[string]string{
+	INFOChunkArtist:  KeyArtist,
+	INFOChunkComment: KeyComment,
+	INFOChunkDate:    KeyYear,
+	INFOChunkGenre:   KeyGenre,
+	INFOChunkTitle:   KeyTitle,
+	INFOChunkAlbum:   KeyAlbum,
+	INFOChunkTrack:   KeyTrack,
+}
+
 // wav parses RIFF tags from wav files.
 // See http://soundfile.sapp.org/doc/WaveFormat/ for more info.
 type wav struct {
-	length   int32
+	length   uint32
+	r        *countingReader
 	metadata map[string]string
+	opts     options
+	timecode *bwfTimecode
+
+	// seen holds the IDs of the chunks that have been read. Chunks can
+	// come in any order, e.g. some tools write the data chunk before the
+	// fmt chunk, so the properties that depend on several chunks are set
+	// once they have all been read.
+	seen map[string]bool
 }
 
 // newWav creates a new map that contains properties for WAV files.
 // Note that the "RIFF" chunk identifier has already been read
 // by the time this function is called.
-func newWav(r io.Reader) (map[string]string, error) {
+func newWav(r io.Reader, o options) (map[string]string, error) {
 	w := wav{
+		// The "RIFF" chunk identifier has already been read.
+		r:        &countingReader{r: r, n: 4},
 		metadata: map[string]string{},
+		opts:     o,
+		timecode: &bwfTimecode{},
+		seen:     map[string]bool{},
 	}
 
 	// Get the length.
-	if err := binary.Read(r, binary.LittleEndian, &w.length); err != nil {
+	if err := binary.Read(w.r, binary.LittleEndian, &w.length); err != nil {
 		return nil, err
 	}
 
 	// Sniff the format.
-	if err := expectFourCC(r, "WAVE"); err != nil {
+	if err := expectFourCC(w.r, "WAVE", o); err != nil {
+		return nil, err
+	}
+
+	// Read subchunks of the RIFF chunk.
+	if err := w.readSubchunks(); err != nil {
 		return nil, err
 	}
+	if err := w.checkFormat(); err != nil {
+		return nil, err
+	}
+	w.setTimecode()
+	w.setDuration()
+
+	return w.metadata, nil
+}
+
+// newWavBytes creates a new map that contains properties for a WAV file
+// that is entirely in memory. It indexes into the byte slice instead of
+// copying the chunk data, so the audio data is never touched.
+func newWavBytes(b []byte, o options) (map[string]string, error) {
+	w := wav{
+		metadata: map[string]string{},
+		opts:     o,
+		timecode: &bwfTimecode{},
+		seen:     map[string]bool{},
+	}
+	if len(b) < 12 {
+		return nil, fmt.Errorf("truncated RIFF header")
+	}
+	w.length = binary.LittleEndian.Uint32(b[4:8])
+
+	// Sniff the format.
+	if expected, got := "WAVE", string(b[8:12]); !o.matchFourCC(got, expected) {
+		return nil, fmt.Errorf("expected chunk ID %s, got %s", expected, got)
+	}
 
 	// Read subchunks of the RIFF chunk.
-	if err := w.readSubchunks(r); err != nil {
+	body := b[12:]
+	if end := int64(w.length) - 4; end >= 0 && end < int64(len(body)) && !o.partial {
+		body = body[:end]
+	}
+	if o.partial && int64(w.length)+8 != int64(len(b)) {
+		w.metadata[KeyPartial] = "true"
+	}
+	for len(body) > 0 {
+		var (
+			id         string
+			data, rest []byte
+			err        error
+		)
+		if o.partial {
+			id, data, rest, err = w.nextPartialChunk(body, int64(w.length)-4-int64(len(b)-12-len(body)))
+		} else {
+			id, data, rest, err = nextChunk(body)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if id == "" {
+			break
+		}
+		id = o.chunkID(id)
+		w.seen[id] = true
+		w.opts.countChunk()
+		offset := len(b) - len(body) + 8
+
+		if id == "data" {
+			w.metadata[KeyDataOffset] = strconv.Itoa(offset)
+			w.metadata[KeyDataLength] = strconv.Itoa(len(data))
+		} else if w.wantsChunk(id) {
+			if err := w.readChunkData(id, data, int64(offset)); err != nil {
+				return nil, err
+			}
+		}
+		body = rest
+
+		if w.opts.done(w.metadata) {
+			break
+		}
+	}
+	if err := w.checkFormat(); err != nil {
 		return nil, err
 	}
+	w.setTimecode()
+	w.setDuration()
 
 	return w.metadata, nil
 }
 
-// readSubchunks reads the subchunks of the RIFF chunk.
-func (w wav) readSubchunks(r io.Reader) error {
-	id, length, data, err := readChunk(r)
+// readSubchunks reads the subchunks of the RIFF chunk
+// until the end of the RIFF chunk or the end of the stream.
+func (w wav) readSubchunks() error {
+	// The RIFF chunk length does not include the chunk ID and the length itself.
+	end := int64(w.length) + 8
+	if w.opts.partial {
+		// The length is out of date if the file is being written.
+		end = math.MaxInt64
+	}
+	for w.r.n < end && !w.opts.done(w.metadata) {
+		start := w.r.n
+		err := w.readSubchunk()
+		if err == errPayload {
+			return nil
+		}
+		if w.opts.partial && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			if err == io.ErrUnexpectedEOF || w.r.n != int64(w.length)+8 {
+				w.metadata[KeyPartial] = "true"
+			}
+			return nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		// Every chunk has an 8-byte header, even an empty one, so
+		// this can only happen if the reader misbehaves.
+		if w.r.n == start {
+			return fmt.Errorf("no progress reading RIFF chunks at offset %d", start)
+		}
+	}
+	return nil
+}
+
+// readSubchunk reads a single subchunk of the RIFF chunk.
+// The data of the chunks we recognize is read into memory and decoded,
+// any other chunk data is discarded.
+func (w wav) readSubchunk() error {
+	id, length, data, err := readChunk(w.r)
 	if err != nil {
 		return err
 	}
+	id = w.opts.chunkID(id)
+	w.seen[id] = true
+	w.opts.countChunk()
+	offset := w.r.n
 
+	switch id {
+	case "data":
+		// Record where the audio data is so it can be located
+		// without parsing the file again.
+		w.metadata[KeyDataOffset] = strconv.FormatInt(offset, 10)
+		w.metadata[KeyDataLength] = strconv.FormatInt(int64(length), 10)
+
+		if w.opts.partial {
+			return w.readPartialData(length)
+		}
+		n, err := w.opts.skipPayload(w.r, int64(length))
+		if err != nil {
+			return err
+		}
+		if n < int64(length) {
+			return io.ErrUnexpectedEOF
+		}
+		return w.skipPadByte(length)
+	default:
+		if !w.wantsChunk(id) {
+			break
+		}
+		b, err := ioutil.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		if expected, got := int(length), len(b); expected != got {
+			return io.ErrUnexpectedEOF
+		}
+		if err := w.readChunkData(id, b, offset); err != nil {
+			return err
+		}
+	}
+
+	// Discard whatever is left of the chunk.
+	if _, err := io.Copy(ioutil.Discard, data); err != nil {
+		return err
+	}
+	if expected, got := offset+int64(length), w.r.n; expected != got {
+		return io.ErrUnexpectedEOF
+	}
+	return w.skipPadByte(length)
+}
+
+// checkFormat checks that the file has a fmt chunk, unless parsing stopped
+// once the fields set by WithFields were found or WithLenientParsing is set.
+func (w wav) checkFormat() error {
+	if w.seen["fmt "] || w.opts.lenient || w.opts.done(w.metadata) {
+		return nil
+	}
+	return fmt.Errorf("WAV file has no fmt chunk")
+}
+
+// wantsChunk reports whether readChunkData should decode a chunk,
+// i.e. whether we know the chunk and it has properties that were requested.
+func (w wav) wantsChunk(id string) bool {
+	switch id {
+	case "fmt ":
+		return w.opts.wantsAny(KeyAudioFormat, KeyNumChannels, KeySampleRate, KeyByteRate, KeyBlockAlign, KeyBitRate,
+			KeySampleFormat, KeyContainerBits, KeyValidBits, KeyChannelMask, KeyTimecode, KeyDuration)
+	case "LIST", "INFO":
+		for _, prop := range wavInfoChunks {
+			if w.opts.wants(prop) {
+				return true
+			}
+		}
+		return false
+	case "id3 ", "ID3 ":
+		return true
+	case "cue ":
+		return w.opts.wants("Cue")
+	case "smpl":
+		return w.opts.wantsAny("Loop", KeySampleLoops)
+	case "bext":
+		return w.opts.wantsAny(KeyTimeReference, KeyTimecode, KeyCodingHistory)
+	case "iXML":
+		return w.opts.wantsAny(KeyTimeReference, KeyTimecode)
+	}
+	return false
+}
+
+// readChunkData decodes the data of a subchunk of the RIFF chunk,
+// which is at offset in the file.
+func (w wav) readChunkData(id string, data []byte, offset int64) error {
+	// Some encoders write empty chunks, e.g. an empty LIST chunk when
+	// there are no tags, which have nothing to decode. An empty fmt chunk
+	// is still an error.
+	if len(data) == 0 && id != "fmt " {
+		return nil
+	}
 	switch id {
 	case "fmt ":
 		// Read the wav format chunk data.
 		return w.readFormat(data)
-	case "data":
-		// Discard the audio data.
-		_, err := io.CopyN(ioutil.Discard, r, int64(length))
-		return err
 	case "LIST":
 		// Read a LIST chunk (can contain subchunks).
-		return w.readList(data)
+		return w.readList(data, offset)
 	case "INFO":
 		// Read an INFO chunk (can contain exif tags).
 		// Not sure if the INFO always appears in a LIST, or if it
 		// can sometimes appear on its own (briansorahan).
-		return w.readInfo(data)
-	default:
-		return fmt.Errorf("unrecognized chunk ID: %s", id)
+		return w.readInfo(data, offset)
+	case "id3 ", "ID3 ":
+		// Read an ID3v2 tag that mirrors or extends the INFO chunk.
+		return w.readID3(data, offset)
+	case "cue ":
+		// Read cue points.
+		return w.readCue(data)
+	case "smpl":
+		// Read sampler loops.
+		return w.readSampler(data)
+	case "bext":
+		// Read the Broadcast Wave time reference.
+		return w.readBext(data)
+	case "iXML":
+		// Read the timecode rate.
+		return w.readIXML(data)
 	}
+	return nil
 }
 
 // readFormat reads the fmt chunk data.
 // It also stores the formatting information as properties.
-func (w wav) readFormat(r io.Reader) error {
+func (w wav) readFormat(data []byte) error {
+	if expected, got := 16, len(data); got < expected {
+		return fmt.Errorf("expected fmt chunk of at least %d bytes, got %d", expected, got)
+	}
+
 	// Read the audio format.
-	if err := w.readAudioFormat(r); err != nil {
+	if err := w.readAudioFormat(data); err != nil {
 		return err
 	}
 
 	// Read the number of channels.
-	if err := w.readInt16(r, "NumChannels"); err != nil {
-		return err
-	}
+	w.readUint16(data[2:4], KeyNumChannels)
 
 	// Read sample rate.
-	if err := w.readInt32(r, "SampleRate"); err != nil {
-		return err
-	}
+	w.readUint32(data[4:8], KeySampleRate)
 
 	// Read byte rate.
-	if err := w.readInt32(r, "ByteRate"); err != nil {
-		return err
-	}
+	w.readUint32(data[8:12], KeyByteRate)
 
 	// Read block align.
-	if err := w.readInt16(r, "BlockAlign"); err != nil {
-		return err
-	}
+	w.readUint16(data[12:14], KeyBlockAlign)
 
 	// Read bit rate.
-	if err := w.readInt16(r, "BitRate"); err != nil {
-		return err
-	}
+	w.readUint16(data[14:16], KeyBitRate)
 
+	w.setSampleBits(data)
 	return nil
 }
 
+// Sample formats of WAV files, as stored in the "SampleFormat" property.
+const (
+	SampleFormatPCM   = "pcm"
+	SampleFormatFloat = "float"
+)
+
+// Audio formats of the fmt chunk that are read.
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
 // readAudioFormat reads the audio format from the fmt chunk
-// and stores it as the "AudioFormat" property.
-func (w wav) readAudioFormat(r io.Reader) error {
-	var audioFormat int16
-	if err := binary.Read(r, binary.LittleEndian, &audioFormat); err != nil {
-		return err
+// and stores it as the "AudioFormat" property, along with the
+// "SampleFormat". Only PCM and IEEE float samples are read,
+// including WAVE_FORMAT_EXTENSIBLE files that have them.
+func (w wav) readAudioFormat(data []byte) error {
+	var (
+		audioFormat  = binary.LittleEndian.Uint16(data)
+		sampleFormat = audioFormat
+	)
+	if audioFormat == wavFormatExtensible {
+		// The sub format is a GUID that starts with the format.
+		if len(data) < 40 {
+			return fmt.Errorf("expected extensible fmt chunk of at least 40 bytes, got %d", len(data))
+		}
+		sampleFormat = binary.LittleEndian.Uint16(data[24:26])
 	}
-	if expected, got := int16(1), audioFormat; expected != got {
-		return fmt.Errorf("expected pcm audio format %d, got %d", expected, got)
+	switch sampleFormat {
+	case wavFormatPCM:
+		w.metadata[KeySampleFormat] = SampleFormatPCM
+	case wavFormatFloat:
+		w.metadata[KeySampleFormat] = SampleFormatFloat
+	default:
+		return fmt.Errorf("expected pcm or float audio format, got %d", sampleFormat)
 	}
-	w.metadata["AudioFormat"] = strconv.FormatInt(int64(audioFormat), 10)
+	w.metadata[KeyAudioFormat] = strconv.FormatUint(uint64(audioFormat), 10)
 	return nil
 }
 
-// readInt16 reads an int16 from an io.Reader and stores it as a property.
-func (w wav) readInt16(r io.Reader, prop string) error {
-	var val int16
-	if err := binary.Read(r, binary.LittleEndian, &val); err != nil {
-		return err
+// setSampleBits sets the container bits and the valid bits of the samples,
+// and the channel mask of WAVE_FORMAT_EXTENSIBLE files. The container bits
+// come from the block align, since some files declare the valid bits as
+// the bits per sample, e.g. 24 for 24-bit samples in 32-bit containers.
+func (w wav) setSampleBits(data []byte) {
+	var (
+		channels   = binary.LittleEndian.Uint16(data[2:4])
+		blockAlign = binary.LittleEndian.Uint16(data[12:14])
+		bits       = binary.LittleEndian.Uint16(data[14:16])
+		container  = bits
+		valid      = bits
+	)
+	if channels > 0 && blockAlign%channels == 0 {
+		container = blockAlign / channels * 8
+	}
+	if binary.LittleEndian.Uint16(data) == wavFormatExtensible {
+		// wValidBitsPerSample is 0 if all the bits are valid.
+		if v := binary.LittleEndian.Uint16(data[18:20]); v > 0 && v <= container {
+			valid = v
+		}
+		w.metadata[KeyChannelMask] = fmt.Sprintf("0x%x", binary.LittleEndian.Uint32(data[20:24]))
+	}
+	w.metadata[KeyContainerBits] = strconv.FormatUint(uint64(container), 10)
+	w.metadata[KeyValidBits] = strconv.FormatUint(uint64(valid), 10)
+}
+
+// readUint16 reads a uint16 from a byte slice and stores it as a property.
+// The fields of the fmt chunk are unsigned, so e.g. 40000 channels aren't
+// read as a negative number.
+func (w wav) readUint16(b []byte, prop string) {
+	val := binary.LittleEndian.Uint16(b)
+	w.metadata[prop] = strconv.FormatUint(uint64(val), 10)
+}
+
+// readUint32 reads a uint32 from a byte slice and stores it as a property.
+func (w wav) readUint32(b []byte, prop string) {
+	val := binary.LittleEndian.Uint32(b)
+	w.metadata[prop] = strconv.FormatUint(uint64(val), 10)
+}
+
+// readCue reads a cue chunk and stores the sample offset of each cue point
+// as "Cue<n>SampleOffset" and its identifier as "Cue<n>ID", counting from 1.
+// The number of cue points is stored as "CuePoints".
+func (w wav) readCue(data []byte) error {
+	// Each cue point is ID, position, data chunk ID, chunk start,
+	// block start and sample offset.
+	const cuePointSize = 24
+
+	if len(data) < 4 {
+		return fmt.Errorf("truncated cue chunk")
+	}
+	count := binary.LittleEndian.Uint32(data)
+	if int64(count)*cuePointSize > int64(len(data)-4) {
+		return fmt.Errorf("cue chunk with %d cue points is too short", count)
+	}
+	w.metadata[KeyCuePoints] = strconv.FormatUint(uint64(count), 10)
+
+	for i := 1; i <= int(count); i++ {
+		point := data[4+(i-1)*cuePointSize:]
+		id := binary.LittleEndian.Uint32(point[0:4])
+		sampleOffset := binary.LittleEndian.Uint32(point[20:24])
+
+		w.metadata[KeyCueID(i)] = strconv.FormatUint(uint64(id), 10)
+		w.metadata[KeyCueSampleOffset(i)] = strconv.FormatUint(uint64(sampleOffset), 10)
 	}
-	w.metadata[prop] = strconv.FormatInt(int64(val), 10)
 	return nil
 }
 
-// readInt32 reads an int32 from an io.Reader and stores it as a property.
-func (w wav) readInt32(r io.Reader, prop string) error {
-	var val int32
-	if err := binary.Read(r, binary.LittleEndian, &val); err != nil {
-		return err
+// readSampler reads a smpl chunk and stores the start and end sample
+// of each loop as "Loop<n>Start" and "Loop<n>End", counting from 1.
+// The number of loops is stored as "SampleLoops".
+func (w wav) readSampler(data []byte) error {
+	// The header is manufacturer, product, sample period, MIDI unity note,
+	// MIDI pitch fraction, SMPTE format, SMPTE offset, number of loops
+	// and sampler data. Each loop is cue point ID, type, start, end,
+	// fraction and play count.
+	const (
+		headerSize = 36
+		loopSize   = 24
+	)
+	if len(data) < headerSize {
+		return fmt.Errorf("truncated smpl chunk")
+	}
+	count := binary.LittleEndian.Uint32(data[28:32])
+	if int64(count)*loopSize > int64(len(data)-headerSize) {
+		return fmt.Errorf("smpl chunk with %d loops is too short", count)
+	}
+	w.metadata[KeySampleLoops] = strconv.FormatUint(uint64(count), 10)
+
+	for i := 1; i <= int(count); i++ {
+		loop := data[headerSize+(i-1)*loopSize:]
+		start := binary.LittleEndian.Uint32(loop[8:12])
+		end := binary.LittleEndian.Uint32(loop[12:16])
+
+		w.metadata[KeyLoopStart(i)] = strconv.FormatUint(uint64(start), 10)
+		w.metadata[KeyLoopEnd(i)] = strconv.FormatUint(uint64(end), 10)
 	}
-	w.metadata[prop] = strconv.Itoa(int(val))
 	return nil
 }
 
 // readList reads a LIST chunk, which can contain subchunks.
-func (w wav) readList(r io.Reader) error {
-	// TODO: Do not force the format to INFO.
-	return expectFourCC(r, "INFO")
+// Only INFO lists are read, other list types are ignored.
+func (w wav) readList(data []byte, offset int64) error {
+	if len(data) < 4 {
+		return fmt.Errorf("truncated LIST chunk")
+	}
+	if !w.opts.matchFourCC(string(data[:4]), "INFO") {
+		return nil
+	}
+	return w.readInfo(data[4:], offset+4)
 }
 
-// readInfo reads an INFO chunk.
-func (w wav) readInfo(r io.Reader) error {
+// readInfo reads the subchunks of an INFO list, which is at offset in the file,
+// and stores the ones we recognize as properties.
+func (w wav) readInfo(data []byte, offset int64) error {
+	start := data
+
+	for len(data) > 0 {
+		id, value, rest, err := nextChunk(data)
+		if err != nil {
+			return err
+		}
+		source := Source{Tag: TagINFO, ID: id, Offset: offset + sliceOffset(start, data)}
+		data = rest
+
+		prop, ok := wavInfoChunks[w.opts.chunkID(id)]
+		if !ok || len(value) == 0 {
+			continue
+		}
+		text := decodeInfoText(value)
+		if old, ok := w.metadata[prop]; !ok || w.opts.replaces(prop, old, text) {
+			w.metadata[prop] = text
+			w.opts.setSource(prop, source)
+		}
+	}
 	return nil
 }
 
-// readChunk reads a chunk from an io.Reader and returns the
-// chunk identifier, the chunk length, the chunk data, and an error.
-func readChunk(r io.Reader) (id string, length int32, data io.Reader, err error) {
-	idb, err := readFourCC(r)
+// readID3 reads an id3 chunk. Properties that are already set,
+// e.g. from the INFO list, are kept, unless WithDuplicateKeys says
+// otherwise.
+func (w wav) readID3(data []byte, offset int64) error {
+	tags, _, err := parseID3v2Tags(data, offset, w.opts)
 	if err != nil {
-		return
+		return err
+	}
+	w.opts.mergeTags(w.metadata, mergeID3v2Metadata(tags))
+	return nil
+}
+
+// nextChunk returns the chunk at the start of a byte slice,
+// along with the bytes that follow it and its pad byte.
+func nextChunk(b []byte) (id string, data, rest []byte, err error) {
+	if len(b) < 8 {
+		return "", nil, nil, fmt.Errorf("truncated chunk header")
+	}
+	id = string(b[:4])
+	length := int64(binary.LittleEndian.Uint32(b[4:8]))
+
+	if length > int64(len(b)-8) {
+		return "", nil, nil, fmt.Errorf("%s chunk length %d exceeds the remaining %d bytes", id, length, len(b)-8)
 	}
-	id = string(idb)
+	data, rest = b[8:8+length], b[8+length:]
 
-	if err = binary.Read(r, binary.LittleEndian, &length); err != nil {
-		return
+	// A missing pad byte is tolerated, at the end or before the next chunk.
+	if length%2 == 1 && len(rest) > 0 && !riff.MissingPad(rest[0]) {
+		rest = rest[1:]
 	}
-	data = io.LimitReader(r, int64(length))
-	return
+	return id, data, rest, nil
+}
+
+// skipPadByte skips the byte that follows chunks with an odd length,
+// which keeps chunks aligned to 16 bits. A missing pad byte is tolerated,
+// see riff.SkipPadByte.
+func skipPadByte(r io.Reader, length uint32) error {
+	return riff.SkipPadByte(r, length)
+}
+
+// skipPadByte skips the pad byte after a chunk of the given length, if it
+// has one, tolerating a missing one like riff.SkipPadByte.
+func (w wav) skipPadByte(length uint32) error {
+	return riff.SkipPadByte(w.r, length)
+}
+
+// readChunk reads a chunk from an io.Reader and returns the
+// chunk identifier, the chunk length, the chunk data, and an error.
+// The length is unsigned, so chunks of 2 GB or more can be read.
+func readChunk(r io.Reader) (id string, length uint32, data io.Reader, err error) {
+	c, data, err := riff.ReadChunk(r)
+	return c.ID, c.Length, data, err
 }
 
 // expectFourCC reads a chunk ID from an io.Reader and checks it
 // against an expected value.
-func expectFourCC(r io.Reader, expected string) error {
+func expectFourCC(r io.Reader, expected string, o options) error {
 	chunkID, err := readFourCC(r)
 	if err != nil {
 		return err
 	}
-	if expected != string(chunkID) {
+	if !o.matchFourCC(string(chunkID), expected) {
 		return fmt.Errorf("expected chunk ID %s, got %s", expected, chunkID)
 	}
 	return nil
@@ -181,13 +596,49 @@ func expectFourCC(r io.Reader, expected string) error {
 
 // readFourCC reads a chunk ID.
 func readFourCC(r io.Reader) ([]byte, error) {
-	chunkID := make([]byte, 4)
-	bytesRead, err := r.Read(chunkID)
+	id, err := riff.ReadFourCC(r)
 	if err != nil {
 		return nil, err
 	}
-	if expected, got := 4, bytesRead; expected != got {
-		return nil, fmt.Errorf("expected to read %d bytes, actually read %d", expected, got)
+	return []byte(id), nil
+}
+
+// countingReader is an io.Reader that counts the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	n int64
+
+	// pending holds bytes that were put back, see UnreadByte.
+	pending []byte
+	last    byte
+}
+
+// Read reads from the underlying reader and counts the bytes.
+func (c *countingReader) Read(p []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		c.n += int64(n)
+		return n, nil
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ReadByte reads a byte, so that riff.SkipPadByte can put it back.
+func (c *countingReader) ReadByte() (byte, error) {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(c, b); err != nil {
+		return 0, err
 	}
-	return chunkID, nil
+	c.last = b[0]
+	return b[0], nil
+}
+
+// UnreadByte puts back the byte that ReadByte just read.
+func (c *countingReader) UnreadByte() error {
+	c.pending = append([]byte{c.last}, c.pending...)
+	c.n--
+	return nil
 }
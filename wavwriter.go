@@ -0,0 +1,269 @@
+package sndtag
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/briansorahan/sndtag/riff"
+)
+
+// wavChunk is the location of a chunk in a RIFF file.
+type wavChunk struct {
+	riff.Chunk
+
+	// data replaces the chunk data when it is not nil.
+	data []byte
+}
+
+// writeWav copies a WAV file from src to dst, replacing the INFO list with
+// one that has been updated with the properties in tags.
+// The chunks are located before anything is written, so src must be seekable.
+// Note that the "RIF" bytes have already been read.
+func writeWav(dst io.Writer, src io.ReadSeeker, tags TagSet, o options) error {
+	base, err := src.Seek(-3, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	chunks, err := findWavChunks(src, base)
+	if err != nil {
+		return err
+	}
+
+	// Read the existing INFO list and id3 chunk.
+	var (
+		info     = map[string]string{}
+		infoAt   = -1
+		id3At    = -1
+		bextAt   = -1
+		existing []*id3v2
+		bext     []byte
+	)
+	for i, c := range chunks {
+		switch c.ID {
+		case "LIST":
+			if _, err := src.Seek(c.Offset+8, io.SeekStart); err != nil {
+				return err
+			}
+			data, err := readWavChunkData(src, c)
+			if err != nil {
+				return err
+			}
+			if len(data) < 4 || string(data[:4]) != "INFO" {
+				continue
+			}
+			if err := (wav{metadata: info}).readInfo(data[4:], 0); err != nil {
+				return err
+			}
+			infoAt = i
+		case "id3 ", "ID3 ":
+			data, err := readWavChunkData(src, c)
+			if err != nil {
+				return err
+			}
+			if existing, _, err = parseID3v2Tags(data, 0, options{}); err != nil {
+				return err
+			}
+			if err := checkDropped(existing); err != nil {
+				return err
+			}
+			id3At = i
+		case "bext":
+			if !o.bextSync {
+				continue
+			}
+			if bext, err = readWavChunkData(src, c); err != nil {
+				return err
+			}
+			bextAt = i
+		}
+	}
+
+	// Update the properties.
+	for prop, value := range tags {
+		if _, ok := wavInfoProperties[prop]; !ok {
+			return fmt.Errorf("property %s can not be written to a WAV INFO list", prop)
+		}
+		if value == "" {
+			delete(info, prop)
+		} else {
+			info[prop] = value
+		}
+	}
+
+	if bextAt >= 0 {
+		chunks[bextAt] = newWavChunk("bext", syncBext(bext, info, tags))
+	}
+
+	// Mirror the INFO list in the id3 chunk. Only the properties being
+	// written are mirrored in an existing chunk, so that the frames that
+	// the INFO list doesn't have are kept, and so is its version.
+	if id3At >= 0 || o.id3Chunk {
+		var major uint8 = 3
+		if len(existing) > 0 && existing[0].header.Major == 4 {
+			major = 4
+		}
+		t := &id3v2{
+			header:   id3v2Header{Major: major},
+			frames:   mergeID3v2Frames(existing, major),
+			metadata: map[string]string{},
+			opts:     o,
+		}
+		mirror := TagSet{}
+		for prop := range wavInfoProperties {
+			if _, ok := tags[prop]; ok || id3At < 0 {
+				mirror[prop] = info[prop]
+			}
+		}
+		if err := t.update(mirror); err != nil {
+			return err
+		}
+		if o.device != nil {
+			if err := o.device.enforce(t); err != nil {
+				return err
+			}
+		}
+		if id3At >= 0 {
+			chunks[id3At] = newWavChunk("id3 ", t.encode(0))
+		} else {
+			chunks = append(chunks, newWavChunk("id3 ", t.encode(0)))
+		}
+	}
+
+	// Replace the INFO list, add one at the end, or remove it if it is empty.
+	list := encodeInfo(info, o.infoEncoding)
+	switch {
+	case infoAt >= 0 && list == nil:
+		chunks = append(chunks[:infoAt], chunks[infoAt+1:]...)
+	case infoAt >= 0:
+		chunks[infoAt] = newWavChunk("LIST", list)
+	case list != nil:
+		chunks = append(chunks, newWavChunk("LIST", list))
+	}
+	return writeWavChunks(dst, src, chunks)
+}
+
+// findWavChunks returns the location of the subchunks of a RIFF WAVE chunk
+// that starts at base.
+func findWavChunks(r io.ReadSeeker, base int64) ([]wavChunk, error) {
+	w, err := riff.NewWalker(r, base)
+	if err != nil {
+		return nil, err
+	}
+	if w.Form != "WAVE" {
+		return nil, fmt.Errorf("expected RIFF WAVE, got %s", w.Form)
+	}
+	var chunks []wavChunk
+	for {
+		c, err := w.Next()
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, wavChunk{Chunk: c})
+	}
+}
+
+// readWavChunkData reads the data of a chunk into memory.
+func readWavChunkData(r io.ReadSeeker, c wavChunk) ([]byte, error) {
+	if _, err := r.Seek(c.Offset+8, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return readN(r, int64(c.Length))
+}
+
+// newWavChunk returns a chunk with new data.
+func newWavChunk(id string, data []byte) wavChunk {
+	if data == nil {
+		data = []byte{}
+	}
+	return wavChunk{Chunk: riff.Chunk{ID: id, Length: uint32(len(data))}, data: data}
+}
+
+// writeWavChunks writes a RIFF WAVE chunk with the given subchunks.
+// Subchunks without new data are copied from src.
+func writeWavChunks(dst io.Writer, src io.ReadSeeker, chunks []wavChunk) error {
+	var size int64
+	for _, c := range chunks {
+		// New chunks are checked before anything is written.
+		if c.data != nil {
+			if err := validateChunk(c.ID, c.data); err != nil {
+				return err
+			}
+		}
+		// Chunks without their pad byte get one.
+		c.NoPad = false
+		size += c.Size()
+	}
+	w, err := riff.NewWriter(dst, "WAVE", size)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if c.data == nil {
+			if _, err := src.Seek(c.Offset, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := copySpan(dst, src, c.Offset, c.Size()); err != nil {
+				return err
+			}
+			if c.NoPad {
+				if _, err := dst.Write([]byte{0}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := w.WriteChunk(c.ID, c.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wavInfoProperties maps property names to the subchunks of an INFO list.
+var wavInfoProperties = map[string]string{
+	KeyAlbum:   INFOChunkAlbum,
+	KeyArtist:  INFOChunkArtist,
+	KeyComment: INFOChunkComment,
+	KeyGenre:   INFOChunkGenre,
+	KeyTitle:   INFOChunkTitle,
+	KeyTrack:   INFOChunkTrack,
+	KeyYear:    INFOChunkDate,
+}
+
+// encodeInfo encodes an INFO list with the given properties.
+// The subchunks are sorted by ID so the output is deterministic.
+// It returns nil if there are no properties.
+func encodeInfo(info map[string]string, enc TextEncoding) []byte {
+	var ids []string
+	values := map[string]string{}
+
+	for prop, value := range info {
+		id, ok := wavInfoProperties[prop]
+		if !ok || value == "" {
+			continue
+		}
+		ids = append(ids, id)
+		values[id] = value
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+
+	list := []byte("INFO")
+	for _, id := range ids {
+		var text []byte
+		if enc == UTF8 {
+			text = []byte(values[id])
+		} else {
+			text = encodeWindows1252(values[id])
+		}
+		// INFO strings are NUL-terminated.
+		list = append(list, riff.EncodeChunk(id, append(text, 0))...)
+	}
+	return list
+}
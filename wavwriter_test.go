@@ -0,0 +1,108 @@
+package sndtag
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteWavKeepsID3Frames(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		major byte
+		tags  TagSet
+		want  map[string]string
+	}{
+		{
+			name:  "title",
+			major: 3,
+			tags:  TagSet{KeyTitle: "New"},
+			want:  map[string]string{KeyTitle: "New", KeyAlbum: "Album", KeyGenre: "Genre"},
+		},
+		{
+			name:  "ID3v2.4",
+			major: 4,
+			tags:  TagSet{KeyArtist: "Artist"},
+			want:  map[string]string{KeyTitle: "Old", KeyArtist: "Artist", KeyAlbum: "Album", KeyGenre: "Genre"},
+		},
+		{
+			name:  "remove",
+			major: 3,
+			tags:  TagSet{KeyAlbum: ""},
+			want:  map[string]string{KeyTitle: "Old", KeyAlbum: "", KeyGenre: "Genre"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The album and the genre are only in the id3 chunk.
+			tag := testID3v2(tc.major,
+				testTextFrame(ID3v2FrameTitle, "Old"),
+				testTextFrame(ID3v2FrameAlbum, "Album"),
+				testTextFrame(ID3v2FrameGenre, "Genre"),
+			)
+			src := testWav(
+				testInfoList(testChunk(INFOChunkTitle, []byte("Old\x00"))),
+				testChunk("id3 ", tag),
+			)
+
+			var dst bytes.Buffer
+			if err := Write(&dst, bytes.NewReader(src), tc.tags); err != nil {
+				t.Fatal(err)
+			}
+			metadata, err := NewFromBytes(dst.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tc.want {
+				if got := metadata[key]; got != want {
+					t.Errorf("%s: got %q, want %q", key, got, want)
+				}
+			}
+
+			// The id3 chunk keeps its version.
+			i := bytes.Index(dst.Bytes(), []byte("ID3"))
+			if i < 0 {
+				t.Fatal("no id3 chunk")
+			}
+			if got := dst.Bytes()[i+3]; got != tc.major {
+				t.Errorf("got ID3v2.%d, want ID3v2.%d", got, tc.major)
+			}
+		})
+	}
+}
+
+func TestWriteWavMissingPad(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  []byte
+	}{
+		{
+			name: "before a chunk",
+			src:  testWav(testUnpaddedChunk("odd ", []byte("abc")), testInfoList(testChunk(INFOChunkTitle, []byte("Old\x00")))),
+		},
+		{
+			name: "final chunk",
+			src:  testWav(testInfoList(testChunk(INFOChunkTitle, []byte("Old\x00"))), testUnpaddedChunk("odd ", []byte("abc"))),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Whatever New reads can be written.
+			if _, err := NewFromBytes(tc.src); err != nil {
+				t.Fatal(err)
+			}
+			var dst bytes.Buffer
+			if err := Write(&dst, bytes.NewReader(tc.src), TagSet{KeyTitle: "New"}); err != nil {
+				t.Fatal(err)
+			}
+			metadata, err := NewFromBytes(dst.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := metadata[KeyTitle], "New"; got != want {
+				t.Errorf("Title: got %q, want %q", got, want)
+			}
+			// The chunk gets its pad byte.
+			if !bytes.Contains(dst.Bytes(), []byte("odd \x03\x00\x00\x00abc\x00")) {
+				t.Error("the odd chunk isn't padded")
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+package sndtag
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrQueueClosed is returned when adding a job to a WriteQueue that has been closed.
+var ErrQueueClosed = errors.New("write queue is closed")
+
+// A WriteResult is the outcome of writing the tags of a file in a WriteQueue.
+type WriteResult struct {
+	Path string
+
+	// Tags are the tags that were written, i.e. all the edits
+	// made to the file since it was last written.
+	Tags TagSet
+
+	// Err is the error writing the file, if any.
+	Err error
+}
+
+// A WriteQueue writes tags to many files, e.g. when retagging a library.
+// Edits to a file that is waiting to be written are coalesced, so that
+// each file is rewritten once. Files are written to a temporary file next
+// to them with a bounded number of workers, and the temporary files are
+// synced and renamed over the originals in batches. Each file is locked
+// from when it starts being written until it is renamed, so that other
+// processes don't edit it at the same time, see WithFileLocker.
+//
+// The fields must not be changed after the first call to Add or Results.
+type WriteQueue struct {
+	// Workers is the number of files written at the same time.
+	// The default is 1.
+	Workers int
+
+	// BatchSize is the largest number of files that are synced together.
+	// Smaller batches are synced when no other file is ready.
+	// The default is 16.
+	BatchSize int
+
+	// Interval is the least amount of time between starting
+	// to write two files. The default is no limit.
+	Interval time.Duration
+
+	// Options are passed to Write.
+	Options []Option
+
+	// Context stops the queue when it is done. Files that haven't started
+	// being written are dropped, and the copies of the files that are being
+	// written are removed. Files that were written completely are still
+	// renamed over the originals, so that they match the journal, see
+	// WithJournal. Results is closed once the workers have stopped, without
+	// sending the results that are left, so nothing needs to be received
+	// from it for the goroutines of the queue to stop. The default is a
+	// context that is never done.
+	Context context.Context
+
+	once    sync.Once
+	ctx     context.Context
+	done    chan struct{}
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[string]TagSet
+	paths   map[string]string
+	order   []string
+	busy    map[string]bool
+	closed  bool
+	next    time.Time
+	written chan writtenFile
+	results chan WriteResult
+}
+
+// writtenFile is a file that has been written to a temporary file
+// that has yet to be synced and renamed.
+type writtenFile struct {
+	path string
+	tags TagSet
+	tmp  *os.File
+	err  error
+
+	// unlock releases the lock of the file, if it is locked.
+	unlock func() error
+}
+
+// start starts the workers.
+func (q *WriteQueue) start() {
+	q.once.Do(func() {
+		workers, batchSize := q.Workers, q.BatchSize
+		if workers < 1 {
+			workers = 1
+		}
+		if batchSize < 1 {
+			batchSize = 16
+		}
+		q.ctx = q.Context
+		if q.ctx == nil {
+			q.ctx = context.Background()
+		}
+		q.done = make(chan struct{})
+		q.cond = sync.NewCond(&q.mu)
+		q.pending = map[string]TagSet{}
+		q.paths = map[string]string{}
+		q.busy = map[string]bool{}
+		q.written = make(chan writtenFile)
+		q.results = make(chan WriteResult, batchSize)
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				q.work()
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(q.written)
+		}()
+		go q.flush(batchSize)
+		go q.watch()
+	})
+}
+
+// watch stops the queue when its context is done, dropping the queued
+// files, and returns when the queue is done.
+func (q *WriteQueue) watch() {
+	select {
+	case <-q.ctx.Done():
+	case <-q.done:
+		return
+	}
+	q.mu.Lock()
+	q.closed = true
+	q.pending = map[string]TagSet{}
+	q.paths = map[string]string{}
+	q.order = nil
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// Add adds the edits in tags to the file at path. If the file is waiting
+// to be written, the edits are merged with the ones that are already
+// queued, with the new values replacing the old ones. Paths of the same
+// file that only differ in case are the same file on Windows.
+// Add returns ErrQueueClosed once the queue is closed or its context is
+// done.
+func (q *WriteQueue) Add(path string, tags TagSet) error {
+	q.start()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	key := pathKey(path)
+
+	queued, ok := q.pending[key]
+	if !ok {
+		queued = TagSet{}
+		q.pending[key] = queued
+		q.paths[key] = path
+		q.order = append(q.order, key)
+		q.cond.Signal()
+	}
+	for k, v := range tags {
+		queued[k] = v
+	}
+	return nil
+}
+
+// Results returns the channel the result of writing each file is sent on.
+// It must be received from for the queue to make progress, and is closed
+// once the queue has been closed and all the files have been written.
+func (q *WriteQueue) Results() <-chan WriteResult {
+	q.start()
+	return q.results
+}
+
+// Close stops the queue from accepting jobs.
+// The files that are queued are still written.
+func (q *WriteQueue) Close() {
+	q.start()
+
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// work writes the queued files to temporary files until the queue is
+// closed and empty. A file isn't written again until its temporary file
+// has been renamed, so that no edits are lost.
+func (q *WriteQueue) work() {
+	for {
+		q.mu.Lock()
+		path, tags, ok := q.take()
+		for !ok && !(q.closed && len(q.order) == 0) {
+			q.cond.Wait()
+			path, tags, ok = q.take()
+		}
+		if !ok {
+			q.mu.Unlock()
+			return
+		}
+		delay := q.delay()
+		q.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-q.ctx.Done():
+			timer.Stop()
+		}
+		opts := append(q.Options[:len(q.Options):len(q.Options)], WithContext(q.ctx))
+		q.written <- writeTemp(path, tags, opts)
+	}
+}
+
+// take removes the first queued file that isn't being written from the
+// queue, and marks it as being written. q.mu must be held.
+func (q *WriteQueue) take() (string, TagSet, bool) {
+	for i, key := range q.order {
+		if q.busy[key] {
+			continue
+		}
+		q.order = append(q.order[:i], q.order[i+1:]...)
+		path, tags := q.paths[key], q.pending[key]
+		delete(q.pending, key)
+		delete(q.paths, key)
+		q.busy[key] = true
+		return path, tags, true
+	}
+	return "", nil, false
+}
+
+// delay returns how long to wait before starting to write a file
+// so that writes are at least q.Interval apart. q.mu must be held.
+func (q *WriteQueue) delay() time.Duration {
+	if q.Interval <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if q.next.Before(now) {
+		q.next = now
+	}
+	delay := q.next.Sub(now)
+	q.next = q.next.Add(q.Interval)
+	return delay
+}
+
+// flush syncs and renames the written files in batches,
+// and sends their results until the context of the queue is done.
+func (q *WriteQueue) flush(batchSize int) {
+	defer close(q.done)
+	defer close(q.results)
+
+	var (
+		batch   []writtenFile
+		journal = newOptions(q.Options).journal
+	)
+	for f := range q.written {
+		batch = append(batch, f)
+
+		// Gather the files that are ready, up to a full batch.
+	gather:
+		for len(batch) < batchSize {
+			select {
+			case f, ok := <-q.written:
+				if !ok {
+					break gather
+				}
+				batch = append(batch, f)
+			default:
+				break gather
+			}
+		}
+		results := commitBatch(batch, journal)
+
+		q.mu.Lock()
+		for _, f := range batch {
+			delete(q.busy, pathKey(f.path))
+		}
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		for _, result := range results {
+			select {
+			case q.results <- result:
+			case <-q.ctx.Done():
+			}
+		}
+		batch = batch[:0]
+	}
+}
+
+// WriteFile writes tags to the file at path, like Write. The file is written
+// to a temporary file next to it, which is synced and renamed over it.
+// The file is locked while it is written, see WithFileLocker.
+func WriteFile(path string, tags TagSet, opts ...Option) error {
+	f := writeTemp(path, tags, opts)
+	if f.err != nil {
+		return f.err
+	}
+	return commitBatch([]writtenFile{f}, newOptions(opts).journal)[0].Err
+}
+
+// writeTemp locks the file at path and writes a copy of it with tags to
+// a temporary file in the same directory, which is returned unsynced.
+// The file stays locked until the batch it is in is committed, unless
+// it couldn't be written.
+func writeTemp(path string, tags TagSet, opts []Option) writtenFile {
+	f := writtenFile{path: path, tags: tags}
+
+	unlock, err := lockPath(newOptions(opts).locker, path)
+	if err != nil {
+		f.err = err
+		return f
+	}
+	if f.tmp, f.err = writeCopy(path, tags, opts); f.err != nil {
+		unlock()
+		return f
+	}
+	f.unlock = unlock
+	return f
+}
+
+// writeCopy writes a copy of the file at path with tags to a temporary
+// file in the same directory, which is returned unsynced. The write is
+// recorded in the journal set with WithJournal, if any.
+func writeCopy(path string, tags TagSet, opts []Option) (*os.File, error) {
+	src, err := os.Open(osPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := createTemp(path, info.Mode())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		journal = newOptions(opts).journal
+		dst     = io.Writer(tmp)
+		rec     *copyRecorder
+	)
+	if journal != nil {
+		rec = newCopyRecorder(tmp)
+		dst = rec
+	}
+	if err := Write(dst, src, tags, opts...); err != nil {
+		discardTemp(tmp)
+		return nil, err
+	}
+	if rec != nil {
+		entry, err := rec.entry(path, src, info.Size())
+		if err == nil {
+			err = journal.Record(entry)
+		}
+		if err != nil {
+			discardTemp(tmp)
+			return nil, err
+		}
+	}
+	return tmp, nil
+}
+
+// createTemp creates a temporary file with the given permissions
+// in the same directory as the file at path.
+func createTemp(path string, mode os.FileMode) (*os.File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(osPath(path)), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Chmod(mode.Perm()); err != nil {
+		discardTemp(tmp)
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// discardTemp closes and removes a temporary file.
+func discardTemp(tmp *os.File) {
+	tmp.Close()
+	os.Remove(tmp.Name())
+}
+
+// commitBatch syncs the journal and the temporary files of a batch and
+// renames them over the original files, then syncs the directories they
+// are in once. The files are unlocked once they have been renamed.
+func commitBatch(batch []writtenFile, journal *Journal) []WriteResult {
+	var (
+		results    = make([]WriteResult, len(batch))
+		dirs       = map[string]bool{}
+		journalErr = journal.sync()
+	)
+	for i, f := range batch {
+		results[i] = WriteResult{Path: f.path, Tags: f.tags, Err: f.err}
+		if f.err == nil {
+			results[i].Err = commitFile(f, journalErr)
+		}
+		if f.unlock != nil {
+			f.unlock()
+		}
+		if results[i].Err == nil {
+			dirs[filepath.Dir(osPath(f.path))] = true
+		}
+	}
+
+	// Sync the directories so that the renames are durable.
+	for dir := range dirs {
+		d, err := os.Open(dir)
+		if err != nil {
+			continue
+		}
+		d.Sync()
+		d.Close()
+	}
+	return results
+}
+
+// commitFile syncs the temporary file of a written file and renames it
+// over the original file. The temporary file is removed if that fails,
+// or if the journal couldn't be synced.
+func commitFile(f writtenFile, journalErr error) error {
+	if journalErr != nil {
+		discardTemp(f.tmp)
+		return journalErr
+	}
+	if err := f.tmp.Sync(); err != nil {
+		discardTemp(f.tmp)
+		return err
+	}
+	if err := f.tmp.Close(); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	if err := os.Rename(f.tmp.Name(), osPath(f.path)); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	return nil
+}
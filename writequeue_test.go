@@ -0,0 +1,154 @@
+package sndtag
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// gateLocker is a FileLocker that blocks locking a file until its gate
+// is closed, so that tests can hold a worker of a WriteQueue.
+type gateLocker struct {
+	path   string
+	locked chan struct{}
+	gate   chan struct{}
+}
+
+// Lock waits for the gate if path is the gated file.
+func (l *gateLocker) Lock(path string) (func() error, error) {
+	if path == l.path {
+		close(l.locked)
+		<-l.gate
+	}
+	return func() error { return nil }, nil
+}
+
+// collect receives the results of a queue until it is closed.
+func collect(q *WriteQueue) []WriteResult {
+	var results []WriteResult
+	for result := range q.Results() {
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestWriteQueueOrder(t *testing.T) {
+	const n = 10
+	dir := testLibrary(t, n)
+	q := &WriteQueue{BatchSize: 1}
+	for i := 0; i < n; i++ {
+		if err := q.Add(filepath.Join(dir, fmt.Sprintf("%02d.wav", i)), TagSet{KeyArtist: fmt.Sprint("Artist ", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Close()
+
+	results := collect(q)
+	if len(results) != n {
+		t.Fatalf("got %d results, want %d", len(results), n)
+	}
+	for i, result := range results {
+		if want := filepath.Join(dir, fmt.Sprintf("%02d.wav", i)); result.Path != want || result.Err != nil {
+			t.Errorf("result %d: got %s, %v, want %s", i, result.Path, result.Err, want)
+		}
+		metadata, err := readTestFile(result.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := metadata[KeyArtist], fmt.Sprint("Artist ", i); got != want {
+			t.Errorf("%s: got artist %q, want %q", result.Path, got, want)
+		}
+		if got, want := metadata[KeyTitle], fmt.Sprint("Song ", i); got != want {
+			t.Errorf("%s: got title %q, want %q", result.Path, got, want)
+		}
+	}
+}
+
+func TestWriteQueueCoalesce(t *testing.T) {
+	dir := testLibrary(t, 2)
+	var (
+		first  = filepath.Join(dir, "00.wav")
+		second = filepath.Join(dir, "01.wav")
+		locker = &gateLocker{path: first, locked: make(chan struct{}), gate: make(chan struct{})}
+	)
+	q := &WriteQueue{Options: []Option{WithFileLocker(locker)}}
+	if err := q.Add(first, TagSet{KeyArtist: "Artist"}); err != nil {
+		t.Fatal(err)
+	}
+	// The only worker is busy with the first file while the second one
+	// is edited twice.
+	<-locker.locked
+	for _, tags := range []TagSet{{KeyArtist: "Old"}, {KeyArtist: "New", KeyAlbum: "Album"}} {
+		if err := q.Add(second, tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(locker.gate)
+	q.Close()
+
+	results := collect(q)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	want := TagSet{KeyArtist: "New", KeyAlbum: "Album"}
+	if results[1].Path != second || len(results[1].Tags) != len(want) {
+		t.Fatalf("got %+v, want the merged edits of %s", results[1], second)
+	}
+	metadata, err := readTestFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range want {
+		if results[1].Tags[key] != value || metadata[key] != value {
+			t.Errorf("%s: got %q in the result and %q in the file, want %q", key, results[1].Tags[key], metadata[key], value)
+		}
+	}
+}
+
+func TestWriteQueueErrors(t *testing.T) {
+	dir := testLibrary(t, 1)
+	text := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(text, []byte("not audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{filepath.Join(dir, "missing.wav"), text, filepath.Join(dir, "00.wav")}
+
+	q := &WriteQueue{Workers: 2}
+	for _, path := range paths {
+		if err := q.Add(path, TagSet{KeyArtist: "Artist"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Close()
+	if err := q.Add(paths[2], TagSet{KeyAlbum: "Album"}); err != ErrQueueClosed {
+		t.Errorf("Add after Close: got %v, want %v", err, ErrQueueClosed)
+	}
+
+	errs := map[string]error{}
+	for _, result := range collect(q) {
+		errs[result.Path] = result.Err
+	}
+	for i, path := range paths {
+		err, ok := errs[path]
+		switch {
+		case !ok:
+			t.Errorf("%s: no result", path)
+		case i < 2 && err == nil:
+			t.Errorf("%s: got no error", path)
+		case i == 2 && err != nil:
+			t.Errorf("%s: %s", path, err)
+		}
+	}
+	// A failed write leaves the file as it was and no temporary file.
+	if b, err := os.ReadFile(text); err != nil || string(b) != "not audio" {
+		t.Errorf("%s: got %q, %v", text, b, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d files, want 2", len(entries))
+	}
+}
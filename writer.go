@@ -0,0 +1,60 @@
+package sndtag
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// TagSet is a set of properties to write.
+// The keys are the same property names that New returns.
+// An empty value removes the property.
+type TagSet map[string]string
+
+// Write copies a stream from src to dst, updating its tags with the
+// properties in tags. Properties that are not in tags are left alone.
+// MPEG audio streams, with or without ID3v2 tags, and WAV files can be
+// written. WAV files are written in two passes, so src must be an
+// io.ReadSeeker. Write stops when the context set with WithContext is done.
+// Tags that would be structurally invalid are a *ValidationError, and are
+// not written.
+func Write(dst io.Writer, src io.Reader, tags TagSet, opts ...Option) error {
+	o := newOptions(opts)
+	src = o.guardContext(src)
+
+	// Read the first 3 bytes.
+	header := make([]byte, 3)
+
+	if _, err := io.ReadFull(src, header); err != nil {
+		return err
+	}
+
+	// Figure out the type.
+	switch {
+	case string(header) == "ID3":
+		existing, rest, err := readID3v2Tags(src, options{})
+		if err != nil {
+			return err
+		}
+		// The audio starts after the last tag.
+		last := existing[len(existing)-1]
+		audioOffset := last.offset + 10 + last.size()
+
+		return writeID3v2(dst, existing, io.MultiReader(bytes.NewReader(rest), src), audioOffset, tags, o)
+	case string(header) == "RIF":
+		rs, ok := src.(io.ReadSeeker)
+		if !ok {
+			return fmt.Errorf("writing WAV requires an io.ReadSeeker")
+		}
+		return writeWav(dst, rs, tags, o)
+	case isMPEGSync(header):
+		return writeID3v2(dst, nil, io.MultiReader(bytes.NewReader(header), src), 0, tags, o)
+	default:
+		return fmt.Errorf("writing is not supported for header: %s", header)
+	}
+}
+
+// isMPEGSync reports whether b starts with an MPEG audio frame sync.
+func isMPEGSync(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xff && b[1]&0xe0 == 0xe0
+}